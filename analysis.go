@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// analysis accumulates statistics about a run one generation at a time and
+// prints them as the -analyze report once the run is over.
+type analysis struct {
+	w io.Writer
+
+	observed          bool
+	generation        int
+	initialPopulation int
+	population        int
+
+	// sumX and sumY are the coordinate sums of the alive cells, kept up to date
+	// from the born and died cells so the centroid costs nothing per cell.
+	sumX, sumY float64
+
+	initialCentroid, centroid centroid
+	drift                     driftFit
+
+	// motion is set once the whole universe is seen to repeat itself.
+	motion *motion
+
+	// forecast, when not nil, extrapolates the run to a later generation and
+	// is printed as the run goes.
+	forecast *forecaster
+}
+
+type centroid struct {
+	x, y float64
+}
+
+func newAnalysis(w io.Writer, forecastTarget int) *analysis {
+	a := &analysis{w: w}
+	if forecastTarget > 0 {
+		a.forecast = newForecaster(forecastTarget)
+	}
+	return a
+}
+
+func (a *analysis) observe(event Event) error {
+	a.generation = event.generation
+	a.population += len(event.born) - len(event.died)
+	for cell := range event.born {
+		a.sumX += float64(cell.x)
+		a.sumY += float64(cell.y)
+	}
+	for cell := range event.died {
+		a.sumX -= float64(cell.x)
+		a.sumY -= float64(cell.y)
+	}
+	a.centroid = a.currentCentroid()
+	if !a.observed {
+		a.initialPopulation, a.initialCentroid = a.population, a.centroid
+		a.observed = true
+	}
+	if a.population > 0 {
+		a.drift.add(event.generation, a.centroid)
+	}
+	if a.forecast != nil {
+		a.forecast.observe(event)
+		if event.generation > 0 && event.generation%forecastProgressEvery == 0 && event.generation < a.forecast.target {
+			return a.forecast.print(a.w, fmt.Sprintf("Generation %d: ", event.generation))
+		}
+	}
+	return nil
+}
+
+func (a *analysis) close() error {
+	if err := a.print(a.w); err != nil {
+		return fmt.Errorf("printing analysis failed: %v", err)
+	}
+	return nil
+}
+
+func (a *analysis) currentCentroid() centroid {
+	if a.population == 0 {
+		return centroid{}
+	}
+	return centroid{a.sumX / float64(a.population), a.sumY / float64(a.population)}
+}
+
+func (a *analysis) print(w io.Writer) error {
+	vx, vy := a.drift.velocity()
+	_, err := fmt.Fprintf(w, "Analysis:\n"+
+		"  generations: %d\n"+
+		"  population: %d -> %d\n"+
+		"  centroid: (%.3f, %.3f) -> (%.3f, %.3f)\n"+
+		"  drift: (%.4f, %.4f) cells/generation, speed %.4fc\n",
+		a.generation,
+		a.initialPopulation, a.population,
+		a.initialCentroid.x, a.initialCentroid.y, a.centroid.x, a.centroid.y,
+		vx, vy, math.Max(math.Abs(vx), math.Abs(vy)))
+	if err != nil {
+		return err
+	}
+	if a.motion != nil {
+		_, err = fmt.Fprintf(w, "  motion: %v\n", *a.motion)
+	} else {
+		_, err = fmt.Fprintf(w, "  motion: no repetition within %d generations\n", maxDetectedPeriod)
+	}
+	if err == nil && a.forecast != nil && a.forecast.target > a.generation {
+		err = a.forecast.print(w, "  ")
+	}
+	return err
+}
+
+// driftFit is a running least-squares fit of the centroid against the
+// generation. Its slope is the drift velocity, which averages out the wobble
+// that oscillating and spaceship phases add on top of any net movement.
+type driftFit struct {
+	n, sumT, sumTT, sumX, sumTX, sumY, sumTY float64
+}
+
+func (fit *driftFit) add(generation int, c centroid) {
+	t := float64(generation)
+	fit.n++
+	fit.sumT += t
+	fit.sumTT += t * t
+	fit.sumX += c.x
+	fit.sumTX += t * c.x
+	fit.sumY += c.y
+	fit.sumTY += t * c.y
+}
+
+func (fit *driftFit) velocity() (float64, float64) {
+	denominator := fit.n*fit.sumTT - fit.sumT*fit.sumT
+	if denominator == 0 {
+		return 0, 0
+	}
+	return (fit.n*fit.sumTX - fit.sumT*fit.sumX) / denominator,
+		(fit.n*fit.sumTY - fit.sumT*fit.sumY) / denominator
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Anchors are named coordinates, such as "gun-exit" or "eater-3", that flags
+// taking a coordinate accept in place of a raw x,y so scripts can refer to
+// stable names.
+type Anchors map[string]Cell
+
+func (anchors Anchors) String() string {
+	names := make([]string, 0, len(anchors))
+	for name := range anchors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	items := make([]string, len(names))
+	for i, name := range names {
+		items[i] = fmt.Sprintf("%s=%d,%d", name, anchors[name].x, anchors[name].y)
+	}
+	return strings.Join(items, " ")
+}
+
+// Set defines an anchor given as name=x,y, for use as a repeated flag.
+func (anchors Anchors) Set(s string) error {
+	name, point, found := strings.Cut(s, "=")
+	if !found || !isAnchorName(name) {
+		return fmt.Errorf("anchor '%s' is not of the form name=x,y", s)
+	}
+	x, y, err := parseCoordinates(point)
+	if err != nil {
+		return fmt.Errorf("anchor '%s': %v", s, err)
+	}
+	anchors[name] = Cell{x, y}
+	return nil
+}
+
+// resolve parses a coordinate given either as x,y or as the name of an
+// anchor.
+func (anchors Anchors) resolve(s string) (Cell, error) {
+	s = strings.TrimSpace(s)
+	if isAnchorName(s) {
+		cell, found := anchors[s]
+		if !found {
+			return Cell{}, fmt.Errorf("unknown anchor '%s'", s)
+		}
+		return cell, nil
+	}
+	x, y, err := parseCoordinates(s)
+	return Cell{x, y}, err
+}
+
+// isAnchorName reports whether s can name an anchor: it must start with a
+// letter so that it is never mistaken for a number.
+func isAnchorName(s string) bool {
+	if s == "" || !(s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z') {
+		return false
+	}
+	return !strings.ContainsAny(s, ",= \t")
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeated flag.
+type stringList []string
+
+func (list *stringList) String() string {
+	if list == nil {
+		return ""
+	}
+	return strings.Join(*list, " ")
+}
+
+func (list *stringList) Set(s string) error {
+	*list = append(*list, s)
+	return nil
+}
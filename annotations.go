@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"math"
+	"os"
+)
+
+// annotationColor is the color -annotations are drawn in.
+var annotationColor = color.RGBA{0xe3, 0x77, 0xc2, 0xff}
+
+// annotation is a highlighted rectangle, an arrow or a label, one of them,
+// drawn over -render and -gif, as read from an -annotations file:
+//
+//	[
+//	  {"rect": {"x": 0, "y": 0, "w": 12, "h": 12}, "label": "reflector"},
+//	  {"arrow": [[-20, -20], [-2, -2]], "label": "glider enters here", "from": 0, "to": 60},
+//	  {"at": [30, 0], "label": "debris", "from": 200}
+//	]
+//
+// Coordinates are cells, an arrow pointing from its first cell to its
+// second. From and to, when given, limit the annotation to those
+// generations of the run. Labels are written in SVGs only, the
+// standard library having no font to draw them into PNGs and GIFs with;
+// there a label with neither rect nor arrow is drawn as a marker at its cell.
+// The schema is that `schema print annotations` prints.
+type annotation struct {
+	Rect  *jsonBounds  `json:"rect,omitempty"`
+	Arrow *[2][2]int64 `json:"arrow,omitempty"`
+	// At is where a label with neither rect nor arrow is.
+	At    *[2]int64 `json:"at,omitempty"`
+	Label string    `json:"label,omitempty"`
+	From  *int      `json:"from,omitempty"`
+	To    *int      `json:"to,omitempty"`
+}
+
+func readAnnotations(path string) ([]annotation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var annotations []annotation
+	if err := json.NewDecoder(file).Decode(&annotations); err != nil {
+		return nil, err
+	}
+	for i, a := range annotations {
+		given := 0
+		for _, set := range []bool{a.Rect != nil, a.Arrow != nil, a.At != nil} {
+			if set {
+				given++
+			}
+		}
+		if given != 1 {
+			return nil, fmt.Errorf("annotation %d needs one of rect, arrow and at, it has %d", i+1, given)
+		}
+		if a.Rect != nil && (a.Rect.W <= 0 || a.Rect.H <= 0) {
+			return nil, fmt.Errorf("annotation %d has a rect of size %dx%d", i+1, a.Rect.W, a.Rect.H)
+		}
+		if a.From != nil && a.To != nil && *a.To < *a.From {
+			return nil, fmt.Errorf("annotation %d ends at generation %d before it starts at %d", i+1, *a.To, *a.From)
+		}
+		if len(a.Label) > maxCommentLength {
+			return nil, fmt.Errorf("annotation %d has a label longer than %d characters", i+1, maxCommentLength)
+		}
+	}
+	return annotations, nil
+}
+
+// shows reports whether the annotation is drawn at generation.
+func (a annotation) shows(generation int) bool {
+	return (a.From == nil || generation >= *a.From) && (a.To == nil || generation <= *a.To)
+}
+
+// center is the pixel at the middle of the cell x,y.
+func (view viewTransform) center(cell [2]int64) (float64, float64) {
+	return view.point(float64(cell[0])+0.5, float64(cell[1])+0.5)
+}
+
+// arrowHead returns the two ends of the barbs of an arrow pointing from
+// x0,y0 to x1,y1.
+func arrowHead(x0, y0, x1, y1, length float64) (float64, float64, float64, float64) {
+	angle := math.Atan2(y1-y0, x1-x0)
+	return x1 - length*math.Cos(angle-math.Pi/6), y1 - length*math.Sin(angle-math.Pi/6),
+		x1 - length*math.Cos(angle+math.Pi/6), y1 - length*math.Sin(angle+math.Pi/6)
+}
+
+// clipLine returns the fractions of the way from x0,y0 to x1,y1 between which
+// the line is within a pixel of the width by height image, and false when it
+// never is.
+func clipLine(x0, y0, x1, y1, width, height float64) (float64, float64, bool) {
+	from, to := 0.0, 1.0
+	clip := func(p, q float64) bool {
+		// p is the speed towards an edge, q how far inside of it the start is
+		switch {
+		case p == 0:
+			return q >= 0
+		case p < 0:
+			from = math.Max(from, q/p)
+		default:
+			to = math.Min(to, q/p)
+		}
+		return from <= to
+	}
+	dx, dy := x1-x0, y1-y0
+	return from, to, clip(-dx, x0+1) && clip(dx, width+1-x0) && clip(-dy, y0+1) && clip(dy, height+1-y0)
+}
+
+// paintAnnotations draws the annotations shown at generation over img in
+// annotationColor, which its palette must have.
+func paintAnnotations(img *image.Paletted, view viewTransform, annotations []annotation, generation int) {
+	bounds := img.Bounds()
+	index := uint8(img.Palette.Index(annotationColor))
+	set := func(x, y float64) {
+		if p := image.Pt(int(math.Floor(x)), int(math.Floor(y))); p.In(bounds) {
+			img.SetColorIndex(p.X, p.Y, index)
+		}
+	}
+	line := func(x0, y0, x1, y1 float64) {
+		// only the part of the line on the image is walked
+		from, to, ok := clipLine(x0, y0, x1, y1, float64(bounds.Dx()), float64(bounds.Dy()))
+		if !ok {
+			return
+		}
+		dx, dy := x1-x0, y1-y0
+		steps := math.Ceil(math.Max(math.Abs(dx), math.Abs(dy)) * (to - from))
+		for i := 0.0; i <= steps; i++ {
+			t := from + (to-from)*i/math.Max(steps, 1)
+			set(x0+dx*t, y0+dy*t)
+		}
+	}
+	head := math.Max(float64(view.cellSize)*1.5, 4)
+	for _, a := range annotations {
+		if !a.shows(generation) {
+			continue
+		}
+		if a.Rect != nil {
+			left, top, right, bottom := view.box(*a.Rect)
+			left, top = left-1, top-1
+			line(left, top, right, top)
+			line(left, bottom, right, bottom)
+			line(left, top, left, bottom)
+			line(right, top, right, bottom)
+		}
+		if a.Arrow != nil {
+			x0, y0 := view.center(a.Arrow[0])
+			x1, y1 := view.center(a.Arrow[1])
+			line(x0, y0, x1, y1)
+			bx, by, cx, cy := arrowHead(x0, y0, x1, y1, head)
+			line(x1, y1, bx, by)
+			line(x1, y1, cx, cy)
+		}
+		if a.At != nil {
+			// a cross in place of the label
+			x, y := view.center(*a.At)
+			line(x-head/2, y-head/2, x+head/2, y+head/2)
+			line(x-head/2, y+head/2, x+head/2, y-head/2)
+		}
+	}
+}
+
+// writeSVGAnnotations writes the annotations shown at generation as SVG
+// outlines, arrows and labels.
+func writeSVGAnnotations(out *bufio.Writer, view viewTransform, annotations []annotation, generation int) {
+	stroke := svgColor(annotationColor)
+	fontSize := math.Max(float64(view.cellSize)*2, 10)
+	head := math.Max(float64(view.cellSize)*1.5, 4)
+	fmt.Fprintf(out, "<g fill=\"none\" stroke=\"%s\" stroke-width=\"1\" font-family=\"sans-serif\" font-size=\"%g\">\n", stroke, fontSize)
+	for _, a := range annotations {
+		if !a.shows(generation) {
+			continue
+		}
+		var x, y float64
+		switch {
+		case a.Rect != nil:
+			left, top, right, bottom := view.box(*a.Rect)
+			fmt.Fprintf(out, "<rect x=\"%g\" y=\"%g\" width=\"%g\" height=\"%g\"/>\n", left-0.5, top-0.5, right-left+1, bottom-top+1)
+			x, y = left, top-2
+		case a.Arrow != nil:
+			x0, y0 := view.center(a.Arrow[0])
+			x1, y1 := view.center(a.Arrow[1])
+			bx, by, cx, cy := arrowHead(x0, y0, x1, y1, head)
+			fmt.Fprintf(out, "<path d=\"M%g %gL%g %gM%g %gL%g %gL%g %g\"/>\n", x0, y0, x1, y1, bx, by, x1, y1, cx, cy)
+			// the label is at the tail, away from what the arrow points at
+			x, y = x0, y0-2
+		default:
+			x, y = view.center(*a.At)
+		}
+		if a.Label != "" {
+			fmt.Fprintf(out, "<text x=\"%g\" y=\"%g\" fill=\"%s\" stroke=\"none\">%s</text>\n", x, y, stroke, html.EscapeString(a.Label))
+		}
+	}
+	fmt.Fprintf(out, "</g>\n")
+}
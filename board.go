@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// maxBoardCells bounds the size of a board printed to a terminal.
+const maxBoardCells = 1 << 20
+
+const (
+	boardDead  = "."
+	boardAlive = "█"
+	// boardDecaying is a decaying cell of a Generations rule.
+	boardDecaying = "▒"
+)
+
+// printBoard draws the viewport of view as rows of . and █, a character per
+// cell, for a quick look at a pattern in the terminal, with ▒ for the
+// decaying cells of a Generations rule. A hex grid takes two
+// characters per cell, so that each row can be indented by half a cell. A
+// viewport too large for that is printed as densities instead.
+func printBoard(out io.Writer, cells Cells, decay Decay, view viewTransform) error {
+	view.cellSize = 1
+	if view.hex {
+		view.cellSize = 2
+	}
+	if view.viewport.w > maxBoardCells || view.viewport.h > maxBoardCells || view.viewport.w*view.viewport.h > maxBoardCells {
+		return printDensityBoard(out, cells, view)
+	}
+	width, height := int(view.width()), int(view.viewport.h)
+	rows := make([][]string, height)
+	for i := range rows {
+		rows[i] = make([]string, width)
+	}
+	set := func(cell Cell, symbol string) {
+		if square, ok := view.pixels(cell); ok {
+			rows[square.Min.Y/view.cellSize][square.Min.X] = symbol
+		}
+	}
+	for y := view.viewport.y; y < view.viewport.y+view.viewport.h; y++ {
+		for x := view.viewport.x; x < view.viewport.x+view.viewport.w; x++ {
+			set(Cell{x, y}, boardDead)
+		}
+	}
+	for cell := range decay {
+		set(cell, boardDecaying)
+	}
+	for cell := range cells {
+		set(cell, boardAlive)
+	}
+
+	w := bufio.NewWriter(out)
+	for _, row := range rows {
+		var line strings.Builder
+		for _, symbol := range row {
+			if symbol == "" {
+				// between the cells of a hex grid
+				symbol = " "
+			}
+			line.WriteString(symbol)
+		}
+		w.WriteString(strings.TrimRight(line.String(), " "))
+		w.WriteString("\n")
+	}
+	return w.Flush()
+}
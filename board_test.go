@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestPrintBoardDecay checks that the decaying cells of a Generations rule
+// are printed between alive and dead.
+func TestPrintBoardDecay(t *testing.T) {
+	cells := Cells{{0, 0}: {}}
+	decay := Decay{{1, 0}: 2}
+	var out strings.Builder
+	view := viewTransform{viewport: Rect{-1, 0, 4, 1}}
+	if err := printBoard(&out, cells, decay, view); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), ".█▒.\n"; got != want {
+		t.Errorf("printed %q, not %q", got, want)
+	}
+}
+
+// TestPrintBoardDensity checks that a viewport too large to print a
+// character per cell is printed a character per block of cells.
+func TestPrintBoardDensity(t *testing.T) {
+	cells := make(Cells)
+	for x := int64(0); x < 16; x++ {
+		for y := int64(0); y < 16; y++ {
+			cells.addCell(Cell{x, y})
+		}
+	}
+	cells.addCell(Cell{16, 0})
+	var out strings.Builder
+	view := viewTransform{viewport: Rect{0, 0, 4096, 4096}}
+	if err := printBoard(&out, cells, nil, view); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 256 || !strings.HasPrefix(lines[0], "█░.") || strings.Count(lines[1], ".") != 256 {
+		t.Errorf("printed %d lines starting %q, not 256 of 16x16 blocks", len(lines), lines[0][:min(len(lines[0]), 16)])
+	}
+	img, err := renderGrid(cells, nil, viewTransform{viewport: Rect{0, 0, 1 << 20, 1 << 20}, cellSize: 1}, nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 2048 || bounds.Dy() != 2048 || img.Pix[0] == 0 {
+		t.Errorf("drew a %v image with %d for the first block, not 2048x2048 blocks", bounds, img.Pix[0])
+	}
+}
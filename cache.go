@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	CACHE_ENTRY_EXTENSION = ".ckpt"
+)
+
+// maxCacheSize bounds the entries of the cache on disk: storing a result
+// beyond it removes the entries least recently used until it fits again.
+const maxCacheSize = 1 << 30
+
+// resultCache keeps the results of runs in a directory, one checkpoint per
+// run, so that running the same input under the same rule for the same
+// generations again reads the result back instead of simulating it. Runs
+// the cache may hold are deterministic ones whose only output is the result:
+// see cacheable.
+type resultCache struct {
+	dir string
+}
+
+// defaultCacheDir is where the cache is kept unless -cache-dir says
+// otherwise: gameoflife in the user's cache directory, such as ~/.cache.
+func defaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gameoflife"), nil
+}
+
+// cacheDir resolves -cache-dir and -no-cache, returning "" for no cache.
+func cacheDir(dir string, disabled bool) string {
+	if disabled {
+		return ""
+	}
+	if dir == "" {
+		var err error
+		if dir, err = defaultCacheDir(); err != nil {
+			logger(logTools).Warn("Not caching results: no cache directory", "error", err)
+			return ""
+		}
+	}
+	return dir
+}
+
+// cacheable reports whether a run has nothing to show but its result, so that
+// a cached result stands in for it. Runs that check the engines, stop on a
+// condition or keep cells aside, as Generations rules and constraints do, are
+// simulated and not cached; so are rule tables, whose files may change
+// under the same name.
+func cacheable(opts runOptions, rule Rule, sinks []EventSink, stats *analysis) bool {
+	return len(sinks) == 0 && stats == nil && opts.iterations > 0 && opts.stop == nil && opts.gps == 0 &&
+		!opts.verifyDeterminism && !opts.paranoid && opts.constraints.isEmpty() && !rule.isGenerations() && rule.table == nil
+}
+
+// cacheKey names the cache entry for running cells, starting at generation
+// start, for iterations generations.
+func cacheKey(cells Cells, rule Rule, neighborhood Neighborhood, start, iterations int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%x\t%s\t%s\t%d\t%d",
+		cellsDigest(cells), rule, rule.countedOver(neighborhood), start, iterations)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// cellsDigest is the sha256 of the coordinates of cells in order. Unlike
+// Cells.hash, whose XOR two different universes can share, it cannot be made
+// to collide, which a cache handing back results on a match relies on.
+func cellsDigest(cells Cells) []byte {
+	digest := sha256.New()
+	var coordinates [16]byte
+	for _, cell := range cells.sorted() {
+		binary.LittleEndian.PutUint64(coordinates[:8], uint64(cell.x))
+		binary.LittleEndian.PutUint64(coordinates[8:], uint64(cell.y))
+		digest.Write(coordinates[:])
+	}
+	return digest.Sum(nil)
+}
+
+func (cache resultCache) path(key string) string {
+	return filepath.Join(cache.dir, key+CACHE_ENTRY_EXTENSION)
+}
+
+// lookup returns the cached result for key, if there is one. An entry that
+// cannot be read is a miss.
+func (cache resultCache) lookup(key string) (Cells, bool) {
+	state, err := readCheckpointFile(cache.path(key))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger(logEngine).Warn("Ignoring unreadable cache entry", "key", key, "error", err)
+		}
+		return nil, false
+	}
+	// mark the entry as used, for prune
+	now := time.Now()
+	os.Chtimes(cache.path(key), now, now)
+	return state.pattern.cells, true
+}
+
+// store saves the result of a run under key.
+func (cache resultCache) store(key string, result Pattern, codec Codec) error {
+	if err := os.MkdirAll(cache.dir, 0o755); err != nil {
+		return err
+	}
+	state := checkpoint{pattern: Pattern{cells: result.cells, generation: result.generation, rule: result.rule}, target: result.generation}
+	if err := saveCheckpoint(cache.path(key), state, codec); err != nil {
+		return err
+	}
+	return cache.prune(maxCacheSize)
+}
+
+// prune removes the entries least recently used until the cache takes at
+// most size bytes.
+func (cache resultCache) prune(size int64) error {
+	entries, err := cache.entries()
+	if err != nil {
+		return err
+	}
+	total := int64(0)
+	for _, entry := range entries {
+		total += entry.Size()
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ModTime().Before(entries[j].ModTime()) })
+	for _, entry := range entries {
+		if total <= size {
+			break
+		}
+		if err := os.Remove(filepath.Join(cache.dir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		total -= entry.Size()
+		logger(logEngine).Debug("Removed a cache entry to keep the cache within its size", "entry", entry.Name())
+	}
+	return nil
+}
+
+// entries lists the entries of the cache by name.
+func (cache resultCache) entries() ([]fs.FileInfo, error) {
+	all, err := os.ReadDir(cache.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []fs.FileInfo
+	for _, entry := range all {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), CACHE_ENTRY_EXTENSION) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, info)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func runCache(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing cache command, expected one of: ls, clear; the cache keeps at most %s, dropping the results least recently used beyond that", formatBytes(maxCacheSize))
+	}
+	dir := cacheDir(*cacheDirArg, false)
+	if dir == "" {
+		return fmt.Errorf("no cache directory, give one with -cache-dir")
+	}
+	cache := resultCache{dir}
+	switch args[0] {
+	case "ls":
+		return runCacheList(cache, args[1:])
+	case "clear":
+		return runCacheClear(cache, args[1:])
+	default:
+		return fmt.Errorf("unknown cache command '%s', expected one of: ls, clear", args[0])
+	}
+}
+
+// runCacheList prints each cached result: its key, rule, generation,
+// population and size on disk.
+func runCacheList(cache resultCache, args []string) error {
+	flags := flag.NewFlagSet("cache ls", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	entries, err := cache.entries()
+	if err != nil {
+		return err
+	}
+	total := uint64(0)
+	for _, entry := range entries {
+		key := strings.TrimSuffix(entry.Name(), CACHE_ENTRY_EXTENSION)
+		total += uint64(entry.Size())
+		state, err := readCheckpointFile(cache.path(key))
+		if err != nil {
+			fmt.Printf("%s\tunreadable: %v\n", key, err)
+			continue
+		}
+		fmt.Printf("%s\t%s\tgeneration %d\t%d cells\t%s\n", key, state.pattern.rule, state.pattern.generation, len(state.pattern.cells), formatBytes(uint64(entry.Size())))
+	}
+	fmt.Printf("%d cached results, %s of at most %s in %s\n", len(entries), formatBytes(total), formatBytes(maxCacheSize), cache.dir)
+	return nil
+}
+
+// runCacheClear removes every cached result.
+func runCacheClear(cache resultCache, args []string) error {
+	flags := flag.NewFlagSet("cache clear", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	entries, err := cache.entries()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.Remove(filepath.Join(cache.dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Removed %d cached results from %s\n", len(entries), cache.dir)
+	return nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// runCensus counts the objects of a settled RLE pattern, such as the ash left
+// by a soup, by kind. The file is streamed row by row and each object is
+// classified as soon as no later row can touch it, so memory is bounded by
+// the objects crossing the current rows rather than the size of the file.
+func runCensus(args []string) error {
+	flags := flag.NewFlagSet("census", flag.ContinueOnError)
+	libraryArg := flags.String("library", "", "Learn the settled objects of the census into this library file, naming the ones not seen before and counting how often each occurs")
+	objectsArg := flags.String("objects", "", "Name objects by the apgcodes of this file, a tab separated apgcode and name on each line, as well as the common objects of B3/S23 built in")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one RLE file, got %d arguments", flags.NArg())
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := decompressing(file, flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("parsing %s failed: %v", flags.Arg(0), err)
+	}
+	census := newStreamingCensus(objectGap)
+	// the decaying cells of a Generations pattern are counted as objects too
+	header, err := scanRLE(reader, nil, func(cell Cell, state uint8) error {
+		return census.add(cell)
+	})
+	if err != nil {
+		return fmt.Errorf("parsing %s failed: %v", flags.Arg(0), err)
+	}
+	// objects are classified under the rule of the file, once it is known
+	census.rule = conwayRule
+	if header.rule != "" {
+		if census.rule, err = parseRule(header.rule); err != nil {
+			return err
+		}
+	}
+	census.finish()
+	names, err := loadObjectNames(*objectsArg, census.rule)
+	if err != nil {
+		return fmt.Errorf("loading -objects failed: %v", err)
+	}
+
+	entries := census.tally()
+	if *libraryArg != "" {
+		library, err := loadLibrary(*libraryArg)
+		if err != nil {
+			return fmt.Errorf("loading library failed: %v", err)
+		}
+		added := library.learn(entries)
+		if err := library.save(*libraryArg); err != nil {
+			return fmt.Errorf("saving library failed: %v", err)
+		}
+		logger(logTools).Info("Added new objects to the library", "added", added, "library", *libraryArg)
+	}
+	census.print(entries, names)
+	return nil
+}
+
+// censusObject is an object still being assembled from the rows read so far.
+type censusObject struct {
+	cells   Cells
+	lastRow int64
+}
+
+type censusEntry struct {
+	count          int
+	classification string
+	population     int
+	// motion is how the object repeats, when found within maxDetectedPeriod
+	// generations.
+	motion *motion
+	// apgcode is that of the object, when it repeats.
+	apgcode string
+}
+
+// streamingCensus groups cells arriving in row order into objects, keeping
+// only the cells of the last gap rows indexed for joining new cells to the
+// objects they touch.
+type streamingCensus struct {
+	gap  int64
+	rule Rule
+
+	row int64
+	// recent maps the cells of the rows within gap of row to their object.
+	recent     map[Cell]*censusObject
+	recentRows [][]Cell
+	active     map[*censusObject]struct{}
+	// finished objects wait for the rule before being classified, since the
+	// RLE header is only known once the file has been read.
+	finished []Cells
+}
+
+func newStreamingCensus(gap int64) *streamingCensus {
+	return &streamingCensus{
+		gap:    gap,
+		recent: make(map[Cell]*censusObject),
+		active: make(map[*censusObject]struct{}),
+	}
+}
+
+func (census *streamingCensus) add(cell Cell) error {
+	if len(census.recentRows) == 0 || cell.y != census.row {
+		census.advance(cell.y)
+	}
+
+	var object *censusObject
+	for dy := -census.gap; dy <= 0; dy++ {
+		for dx := -census.gap; dx <= census.gap; dx++ {
+			if dy == 0 && dx >= 0 {
+				break
+			}
+			neighbor, ok := cell.offset(Offset{dx, dy})
+			if !ok {
+				continue
+			}
+			if other, found := census.recent[neighbor]; found && other != object {
+				object = census.merge(object, other)
+			}
+		}
+	}
+	if object == nil {
+		object = &censusObject{cells: make(Cells)}
+		census.active[object] = struct{}{}
+	}
+	object.cells.addCell(cell)
+	object.lastRow = cell.y
+	census.recent[cell] = object
+	census.recentRows[len(census.recentRows)-1] = append(census.recentRows[len(census.recentRows)-1], cell)
+	return nil
+}
+
+// merge joins two objects that turned out to be one, keeping the larger.
+func (census *streamingCensus) merge(a, b *censusObject) *censusObject {
+	if a == nil {
+		return b
+	}
+	if len(a.cells) < len(b.cells) {
+		a, b = b, a
+	}
+	for cell := range b.cells {
+		a.cells.addCell(cell)
+		if _, found := census.recent[cell]; found {
+			census.recent[cell] = a
+		}
+	}
+	a.lastRow = max(a.lastRow, b.lastRow)
+	delete(census.active, b)
+	return a
+}
+
+// advance moves on to row, forgetting rows that can no longer be joined and
+// finishing objects that no later row can reach.
+func (census *streamingCensus) advance(row int64) {
+	census.row = row
+	census.recentRows = append(census.recentRows, nil)
+	for len(census.recentRows) > 1 {
+		oldest := census.recentRows[0]
+		if len(oldest) > 0 && oldest[0].y >= row-census.gap {
+			break
+		}
+		for _, cell := range oldest {
+			delete(census.recent, cell)
+		}
+		census.recentRows = census.recentRows[1:]
+	}
+	for object := range census.active {
+		if object.lastRow < row-census.gap {
+			census.finished = append(census.finished, object.cells)
+			delete(census.active, object)
+		}
+	}
+}
+
+func (census *streamingCensus) finish() {
+	for object := range census.active {
+		census.finished = append(census.finished, object.cells)
+	}
+	census.active = nil
+	census.recent = nil
+}
+
+// tally groups the finished objects by their canonical form.
+func (census *streamingCensus) tally() map[string]*censusEntry {
+	entries := make(map[string]*censusEntry)
+	for _, object := range census.finished {
+		m, found := detectMotion(object, census.rule, maxDetectedPeriod)
+		phases := 1
+		if found {
+			phases = m.period
+		}
+		key := canonicalForm(object, census.rule, phases)
+		entry, known := entries[key]
+		if !known {
+			entry = &censusEntry{classification: describeMotion(m, found), population: len(object), apgcode: apgcode(object, census.rule, m, found)}
+			if found {
+				entry.motion = &m
+			}
+			entries[key] = entry
+		}
+		entry.count++
+	}
+	return entries
+}
+
+// print writes the count, description, apgcode and canonical form of each kind
+// of object, the most common first, naming the ones names knows.
+func (census *streamingCensus) print(entries map[string]*censusEntry, names objectNames) {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if entries[keys[i]].count != entries[keys[j]].count {
+			return entries[keys[i]].count > entries[keys[j]].count
+		}
+		return keys[i] < keys[j]
+	})
+	fmt.Printf("# %d objects of %d kinds\n", len(census.finished), len(keys))
+	for _, key := range keys {
+		entry := entries[key]
+		code := entry.apgcode
+		if code == "" {
+			code = "-"
+		}
+		description := entry.classification
+		if entry.motion != nil {
+			description = names.describe(entry.apgcode, *entry.motion, true)
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\n", entry.count, description, code, key)
+	}
+}
+
+// orientations are the eight rotations and reflections of the grid.
+var orientations = []func(Cell) Cell{
+	func(c Cell) Cell { return Cell{c.x, c.y} },
+	func(c Cell) Cell { return Cell{-c.x, c.y} },
+	func(c Cell) Cell { return Cell{c.x, -c.y} },
+	func(c Cell) Cell { return Cell{-c.x, -c.y} },
+	func(c Cell) Cell { return Cell{c.y, c.x} },
+	func(c Cell) Cell { return Cell{-c.y, c.x} },
+	func(c Cell) Cell { return Cell{c.y, -c.x} },
+	func(c Cell) Cell { return Cell{-c.y, -c.x} },
+}
+
+// canonicalForm names an object independently of its position, orientation
+// and phase: the smallest RLE of any of its phases in any orientation.
+func canonicalForm(object Cells, rule Rule, phases int) string {
+	best := ""
+	phase := object.clone()
+	engine := newNaiveEngine(rule, mooreNeighborhood, constraints{})
+	for i := 0; i < phases; i++ {
+		for _, orient := range orientations {
+			oriented := make(Cells, len(phase))
+			for cell := range phase {
+				oriented.addCell(orient(cell))
+			}
+			var rle bytes.Buffer
+			writeRLEBody(&rle, oriented)
+			if form := strings.ReplaceAll(strings.TrimSpace(rle.String()), "\n", ""); best == "" || form < best {
+				best = form
+			}
+		}
+		phase, _, _ = engine.step(phase)
+	}
+	return best
+}
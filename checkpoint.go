@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+const (
+	CHECKPOINT_MAGIC = "GOLCKPT1"
+)
+
+// checkpoint is the state of a run that -resume needs to carry it on.
+type checkpoint struct {
+	pattern Pattern
+	// target is the generation the run was to end at, or -1 if it was to run
+	// until its -stop condition held.
+	target int
+	// rngState is the state of the run's random number generator. Runs draw
+	// no random numbers so far, so it is empty, but it is kept for the runs
+	// that will.
+	rngState []byte
+}
+
+// writeCheckpoint writes a checkpoint in a compact binary format:
+//
+//	"GOLCKPT1"
+//	varint generation, varint target
+//	uvarint length, rule
+//	uvarint length, RNG state
+//	uvarint cell count, then per cell in order of y and then x:
+//	  uvarint rows down from the previous cell (varint y for the first)
+//	  varint x, relative to the previous cell in the same row
+//	uint32 CRC-32 of everything before it, big endian
+//
+// Cells close to each other take a byte or two, and the cells are written in
+// bounded memory however large the universe is.
+func writeCheckpoint(w io.Writer, state checkpoint) error {
+	out := bufio.NewWriter(w)
+	crc := crc32.NewIEEE()
+	body := io.MultiWriter(out, crc)
+	buf := make([]byte, binary.MaxVarintLen64)
+	putVarint := func(v int64) error {
+		_, err := body.Write(buf[:binary.PutVarint(buf, v)])
+		return err
+	}
+	putUvarint := func(v uint64) error {
+		_, err := body.Write(buf[:binary.PutUvarint(buf, v)])
+		return err
+	}
+	putBytes := func(b []byte) error {
+		if err := putUvarint(uint64(len(b))); err != nil {
+			return err
+		}
+		_, err := body.Write(b)
+		return err
+	}
+
+	if _, err := io.WriteString(body, CHECKPOINT_MAGIC); err != nil {
+		return err
+	}
+	if err := putVarint(int64(state.pattern.generation)); err != nil {
+		return err
+	}
+	if err := putVarint(int64(state.target)); err != nil {
+		return err
+	}
+	if err := putBytes([]byte(state.pattern.rule)); err != nil {
+		return err
+	}
+	if err := putBytes(state.rngState); err != nil {
+		return err
+	}
+	if err := putUvarint(uint64(len(state.pattern.cells))); err != nil {
+		return err
+	}
+	first, previous := true, Cell{}
+	err := state.pattern.cells.inOrder(func(cell Cell) error {
+		var err error
+		switch {
+		case first:
+			if err = putVarint(cell.y); err == nil {
+				err = putVarint(cell.x)
+			}
+		case cell.y == previous.y:
+			if err = putUvarint(0); err == nil {
+				err = putVarint(cell.x - previous.x)
+			}
+		default:
+			if err = putUvarint(uint64(cell.y - previous.y)); err == nil {
+				err = putVarint(cell.x)
+			}
+		}
+		first, previous = false, cell
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(out, binary.BigEndian, crc.Sum32()); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// checkpointReader reads the fields of a checkpoint while checksumming them.
+type checkpointReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (r *checkpointReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (r *checkpointReader) varint() (int64, error) {
+	return binary.ReadVarint(r)
+}
+
+func (r *checkpointReader) uvarint() (uint64, error) {
+	return binary.ReadUvarint(r)
+}
+
+func (r *checkpointReader) bytes(limit int) ([]byte, error) {
+	length, err := r.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(limit) {
+		return nil, fmt.Errorf("field of %d bytes is longer than %d", length, limit)
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, err
+	}
+	r.crc.Write(b)
+	return b, nil
+}
+
+// readCheckpoint reads a checkpoint written by writeCheckpoint, refusing one
+// that is truncated or corrupt.
+func readCheckpoint(in io.Reader) (checkpoint, error) {
+	r := &checkpointReader{bufio.NewReader(in), crc32.NewIEEE()}
+	state, err := r.checkpoint()
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return checkpoint{}, errors.New("truncated checkpoint")
+	}
+	if err != nil {
+		return checkpoint{}, err
+	}
+	if _, err := r.r.ReadByte(); err != io.EOF {
+		return checkpoint{}, errors.New("corrupt checkpoint: data after the checksum")
+	}
+	return state, nil
+}
+
+func (r *checkpointReader) checkpoint() (checkpoint, error) {
+	magic := make([]byte, len(CHECKPOINT_MAGIC))
+	if _, err := io.ReadFull(r.r, magic); err != nil || !bytes.Equal(magic, []byte(CHECKPOINT_MAGIC)) {
+		return checkpoint{}, fmt.Errorf("not a checkpoint: needed %s magic", CHECKPOINT_MAGIC)
+	}
+	r.crc.Write(magic)
+
+	var state checkpoint
+	generation, err := r.varint()
+	if err != nil {
+		return checkpoint{}, err
+	}
+	target, err := r.varint()
+	if err != nil {
+		return checkpoint{}, err
+	}
+	state.pattern.generation, state.target = int(generation), int(target)
+	rule, err := r.bytes(maxHeaderValueLength)
+	if err != nil {
+		return checkpoint{}, err
+	}
+	state.pattern.rule = string(rule)
+	if state.rngState, err = r.bytes(maxHeaderValueLength); err != nil {
+		return checkpoint{}, err
+	}
+
+	count, err := r.uvarint()
+	if err != nil {
+		return checkpoint{}, err
+	}
+	if count > maxParsedCells {
+		return checkpoint{}, errTooManyCells
+	}
+	state.pattern.cells = make(Cells, count)
+	var cell Cell
+	for i := uint64(0); i < count; i++ {
+		// the first cell's y is a varint, the rest move down by a uvarint
+		var down uint64
+		if i == 0 {
+			cell.y, err = r.varint()
+		} else {
+			down, err = r.uvarint()
+		}
+		if err != nil {
+			return checkpoint{}, err
+		}
+		if down > 2*maxCoordinate {
+			return checkpoint{}, fmt.Errorf("cell %d moves %d rows down, out of range", i, down)
+		}
+		x, err := r.varint()
+		if err != nil {
+			return checkpoint{}, err
+		}
+		if i > 0 && down == 0 {
+			cell.x += x
+		} else {
+			cell.y, cell.x = cell.y+int64(down), x
+		}
+		if err := checkCoordinates(cell); err != nil {
+			return checkpoint{}, err
+		}
+		state.pattern.cells.addCell(cell)
+	}
+
+	var sum uint32
+	if err := binary.Read(r.r, binary.BigEndian, &sum); err != nil {
+		return checkpoint{}, err
+	}
+	if sum != r.crc.Sum32() {
+		return checkpoint{}, errors.New("corrupt checkpoint: checksum mismatch")
+	}
+	return state, nil
+}
+
+// readCheckpointFile reads the checkpoint in a file, which may be compressed.
+func readCheckpointFile(name string) (checkpoint, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return checkpoint{}, err
+	}
+	defer file.Close()
+
+	reader, err := decompressingFrom(file, CHECKPOINT_MAGIC)
+	if err != nil {
+		return checkpoint{}, err
+	}
+	return readCheckpoint(reader)
+}
+
+// checkpointSink saves the run to a checkpoint file every N generations and
+// once it is over. Each checkpoint is written beside the file and renamed
+// over it, so a crash while saving leaves the previous one intact.
+type checkpointSink struct {
+	path   string
+	every  int
+	target int
+	rule   string
+	codec  Codec
+	last   Event
+}
+
+func newCheckpointSink(path string, every, target int, rule Rule, codec Codec) *checkpointSink {
+	return &checkpointSink{path: path, every: every, target: target, rule: rule.String(), codec: codec}
+}
+
+func (sink *checkpointSink) needsEveryGeneration() bool {
+	return true
+}
+
+func (sink *checkpointSink) observe(event Event) error {
+	sink.last = event
+	if sink.every > 0 && event.generation%sink.every == 0 {
+		return sink.save()
+	}
+	return nil
+}
+
+func (sink *checkpointSink) close() error {
+	return sink.save()
+}
+
+func (sink *checkpointSink) save() error {
+	state := checkpoint{pattern: Pattern{cells: sink.last.cells, generation: sink.last.generation, rule: sink.rule}, target: sink.target}
+	return saveCheckpoint(sink.path, state, sink.codec)
+}
+
+// saveCheckpoint writes a checkpoint file beside path and renames it over
+// path, so that nothing ever reads a half written one.
+func saveCheckpoint(path string, state checkpoint, codec Codec) error {
+	staged := path + ".tmp"
+	file, err := createCompressed(staged, codec)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := writeCheckpoint(file, state); err != nil {
+		return fmt.Errorf("writing checkpoint failed: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(staged, path)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardCommand is an external program used to talk to the system
+// clipboard, since the standard library has no clipboard access.
+type clipboardCommand []string
+
+// pasteCommands and copyCommands list, per platform, the programs tried in
+// order; on Linux the first one installed wins, which covers Wayland and X11.
+var (
+	pasteCommands = map[string][]clipboardCommand{
+		"darwin":  {{"pbpaste"}},
+		"linux":   {{"wl-paste", "--no-newline"}, {"xclip", "-selection", "clipboard", "-o"}, {"xsel", "--clipboard", "--output"}},
+		"windows": {{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"}},
+	}
+	copyCommands = map[string][]clipboardCommand{
+		"darwin":  {{"pbcopy"}},
+		"linux":   {{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}},
+		"windows": {{"clip"}},
+	}
+)
+
+func findClipboardCommand(commands map[string][]clipboardCommand) (*exec.Cmd, error) {
+	var tried []string
+	for _, command := range commands[runtime.GOOS] {
+		if _, err := exec.LookPath(command[0]); err == nil {
+			return exec.Command(command[0], command[1:]...), nil
+		}
+		tried = append(tried, command[0])
+	}
+	if len(tried) == 0 {
+		return nil, fmt.Errorf("clipboard access is not supported on %s", runtime.GOOS)
+	}
+	return nil, fmt.Errorf("no clipboard program found, tried: %s", strings.Join(tried, ", "))
+}
+
+// readClipboardCells parses the RLE pattern on the system clipboard, keeping
+// only the cells in region when it is not nil.
+func readClipboardCells(region *Rect) (Cells, error) {
+	cmd, err := findClipboardCommand(pasteCommands)
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("reading clipboard failed: %v", err)
+	}
+	pattern, err := parseRLE(bytes.NewReader(out), region)
+	return pattern.cells, err
+}
+
+// writeClipboardCells places cells on the system clipboard as an RLE snippet
+// that can be pasted into Golly.
+func writeClipboardCells(cells Cells) error {
+	cmd, err := findClipboardCommand(copyCommands)
+	if err != nil {
+		return err
+	}
+	var rle bytes.Buffer
+	if err := writeRLEBody(&rle, cells); err != nil {
+		return err
+	}
+	cmd.Stdin = &rle
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("writing clipboard failed: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Codec is a compression applied to whole files, such as checkpoints,
+// histories and gzipped patterns.
+type Codec struct {
+	name string
+	// extension marks the files of the codec, such as glider.rle.gz.
+	extension string
+	// recognise reports whether a stream starts like one of the codec. It is
+	// nil for none, which any stream could be.
+	recognise func(prefix []byte) bool
+	// ambiguous is true when plain text can look like the codec: a zlib
+	// header can be "x " as in an RLE header, so zlib is only recognised
+	// where the plain contents would start with a magic number of their own.
+	ambiguous bool
+	newWriter func(w io.Writer) io.WriteCloser
+	newReader func(r io.Reader) (io.Reader, error)
+}
+
+// gzipMagic starts every gzip stream, whatever the file is called.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+var codecs = []Codec{
+	{
+		name:      "none",
+		newWriter: func(w io.Writer) io.WriteCloser { return nopWriteCloser{w} },
+		newReader: func(r io.Reader) (io.Reader, error) { return r, nil },
+	},
+	{
+		name:      "gzip",
+		extension: ".gz",
+		recognise: func(prefix []byte) bool { return bytes.HasPrefix(prefix, gzipMagic) },
+		newWriter: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		newReader: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	},
+	{
+		name:      "zlib",
+		extension: ".zz",
+		recognise: func(prefix []byte) bool {
+			// deflate, with the header's check bits right
+			return len(prefix) >= 2 && prefix[0]&0x0f == 8 && (uint16(prefix[0])<<8|uint16(prefix[1]))%31 == 0
+		},
+		ambiguous: true,
+		newWriter: func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		newReader: func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+	},
+	{
+		name:      "zstd",
+		extension: ".zst",
+		recognise: func(prefix []byte) bool { return bytes.HasPrefix(prefix, zstdMagicBytes) },
+		newWriter: func(w io.Writer) io.WriteCloser { return newZstdWriter(w) },
+		newReader: func(r io.Reader) (io.Reader, error) { return newZstdReader(r) },
+	},
+	{
+		name:      "lz4",
+		extension: ".lz4",
+		recognise: func(prefix []byte) bool { return bytes.HasPrefix(prefix, lz4MagicBytes) },
+		newWriter: func(w io.Writer) io.WriteCloser { return newLZ4Writer(w) },
+		newReader: func(r io.Reader) (io.Reader, error) { return newLZ4Reader(r) },
+	},
+}
+
+// codecByName looks up a codec by the name given to -codec.
+func codecByName(name string) (Codec, error) {
+	var names []string
+	for _, codec := range codecs {
+		if codec.name == name {
+			return codec, nil
+		}
+		names = append(names, codec.name)
+	}
+	return Codec{}, fmt.Errorf("unknown codec '%s', expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// codecForFile returns the codec of a file by its extension.
+func codecForFile(name string) (Codec, bool) {
+	extension := strings.ToLower(filepath.Ext(name))
+	for _, codec := range codecs {
+		if codec.extension != "" && codec.extension == extension {
+			return codec, true
+		}
+	}
+	return Codec{}, false
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// decompressing returns a reader of the contents of the file name read from
+// r, decompressing them on the fly when the file has the extension of a codec
+// or starts with the magic number of one.
+func decompressing(r io.Reader, name string) (*bufio.Reader, error) {
+	reader := bufio.NewReader(r)
+	codec, found := codecForFile(name)
+	if !found {
+		prefix, _ := reader.Peek(4)
+		for _, c := range codecs {
+			if c.recognise != nil && !c.ambiguous && c.recognise(prefix) {
+				codec, found = c, true
+				break
+			}
+		}
+	}
+	if !found {
+		return reader, nil
+	}
+	decompressed, err := codec.newReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s failed: %v", codec.name, err)
+	}
+	return bufio.NewReader(decompressed), nil
+}
+
+// decompressingFrom is decompressing for files whose plain contents start
+// with magic, which lets even ambiguous codecs be recognised.
+func decompressingFrom(r io.Reader, magic string) (*bufio.Reader, error) {
+	reader := bufio.NewReader(r)
+	prefix, _ := reader.Peek(len(magic))
+	if string(prefix) == magic {
+		return reader, nil
+	}
+	for _, codec := range codecs {
+		if codec.recognise != nil && codec.recognise(prefix) {
+			decompressed, err := codec.newReader(reader)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s failed: %v", codec.name, err)
+			}
+			return bufio.NewReader(decompressed), nil
+		}
+	}
+	return reader, nil
+}
+
+// withoutCodecExtension strips a trailing codec extension such as .gz, so
+// that glider.rle.gz is known to be RLE by its extension.
+func withoutCodecExtension(name string) string {
+	if _, found := codecForFile(name); found {
+		return strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name
+}
+
+// compressedFile closes the codec's stream before the file under it.
+type compressedFile struct {
+	io.WriteCloser
+	file io.Closer
+}
+
+func (w compressedFile) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// createCompressed creates a file to write to through codec.
+func createCompressed(name string, codec Codec) (io.WriteCloser, error) {
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if codec.name == "none" {
+		return file, nil
+	}
+	return compressedFile{codec.newWriter(file), file}, nil
+}
+
+// createOutput creates a file to write to, compressed when its name has the
+// extension of a codec such as .gz.
+func createOutput(name string) (io.WriteCloser, error) {
+	codec, found := codecForFile(name)
+	if !found {
+		codec = codecs[0]
+	}
+	return createCompressed(name, codec)
+}
+
+// printResult writes the result of a run to w, gzipped if asked to be.
+func printResult(w io.Writer, format Format, result Pattern, compress bool) error {
+	if !compress {
+		return format.write(w, result)
+	}
+	zipped := gzip.NewWriter(w)
+	if err := format.write(zipped, result); err != nil {
+		return err
+	}
+	return zipped.Close()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCodecsRoundTrip checks that a checkpoint and a history written through
+// each codec read back the same, the codec recognised by its magic number.
+func TestCodecsRoundTrip(t *testing.T) {
+	pattern, err := readPreset("r-pentomino", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := newNaiveEngine(conwayRule, mooreNeighborhood, constraints{})
+	generations := []Cells{pattern.cells}
+	events := []Event{{generation: 0, cells: pattern.cells, born: pattern.cells}}
+	cells := pattern.cells.clone()
+	for generation := 1; generation <= 300; generation++ {
+		// the engine reuses the maps it returns, so what is kept is cloned
+		var born, died Cells
+		cells, born, died = engine.step(cells)
+		generations = append(generations, cells.clone())
+		events = append(events, Event{generation: generation, cells: generations[generation], born: born.clone(), died: died.clone()})
+	}
+
+	for _, codec := range codecs {
+		t.Run(codec.name, func(t *testing.T) {
+			dir := t.TempDir()
+			name := filepath.Join(dir, "checkpoint")
+			state := checkpoint{pattern: Pattern{cells: generations[300], generation: 300, rule: conwayRule.String()}, target: 1000}
+			if err := saveCheckpoint(name, state, codec); err != nil {
+				t.Fatal(err)
+			}
+			read, err := readCheckpointFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if read.pattern.generation != 300 || read.target != 1000 || !read.pattern.cells.equal(generations[300]) {
+				t.Errorf("checkpoint read back as generation %d with %d cells", read.pattern.generation, len(read.pattern.cells))
+			}
+
+			name = filepath.Join(dir, "history")
+			file, err := createCompressed(name, codec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			history, err := newHistoryWriter(file, conwayRule, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, event := range events {
+				if err := history.observe(event); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := history.close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := file.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			in, err := os.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer in.Close()
+			reader, err := openHistoryFile(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, generation := range []int{0, 1, 77, 237, 300} {
+				cells, err := reader.at(generation)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !cells.equal(generations[generation]) {
+					t.Errorf("generation %d read back with %d cells, not %d", generation, len(cells), len(generations[generation]))
+				}
+			}
+		})
+	}
+}
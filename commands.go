@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// commands are the subcommands accepted after the global flags, e.g.
+// `gameoflife experiment rulesweep ...`. Running without a subcommand
+// simulates -input for -iterations generations.
+var commands = map[string]func(args []string) error{
+	"cache":      runCache,
+	"census":     runCensus,
+	"corpus":     runCorpus,
+	"diff":       runDiff,
+	"evolve":     runEvolve,
+	"experiment": runExperiment,
+	"explain":    runExplain,
+	"extract":    runExtract,
+	"formats":    runFormats,
+	"history":    runHistory,
+	"merge":      runMerge,
+	"mutate":     runMutate,
+	"react":      runReact,
+	"render":     runRender,
+	"schema":     runSchema,
+}
+
+func runCommand(name string, args []string) error {
+	command, found := commands[name]
+	if !found {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown command '%s', expected one of: %s", name, strings.Join(names, ", "))
+	}
+	return command(args)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sort"
+)
+
+// objectGap is the largest Chebyshev distance between two alive cells that
+// still belong to the same object. A gap of 2 keeps objects that interact
+// through a single dead cell, such as a pond and the blinker next to it,
+// together.
+const objectGap = 2
+
+// components splits cells into groups of cells that are transitively within
+// gap cells of each other, ordered by their top-left cell.
+func (cells Cells) components(gap int64) []Cells {
+	var components []Cells
+	visited := make(Cells, len(cells))
+	for _, start := range cells.sorted() {
+		if !visited.hasCell(start) {
+			components = append(components, cells.componentFrom(start, gap, visited))
+		}
+	}
+	sort.SliceStable(components, func(i, j int) bool {
+		a, _, _ := components[i].boundingBox()
+		b, _, _ := components[j].boundingBox()
+		return a.y < b.y || (a.y == b.y && a.x < b.x)
+	})
+	return components
+}
+
+// componentFrom collects the component of the alive cell start, marking its
+// cells as visited.
+func (cells Cells) componentFrom(start Cell, gap int64, visited Cells) Cells {
+	component := make(Cells)
+	queue := []Cell{start}
+	visited.addCell(start)
+	for len(queue) > 0 {
+		cell := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		component.addCell(cell)
+		for dx := -gap; dx <= gap; dx++ {
+			for dy := -gap; dy <= gap; dy++ {
+				neighbor, ok := cell.offset(Offset{dx, dy})
+				if ok && cells.hasCell(neighbor) && !visited.hasCell(neighbor) {
+					visited.addCell(neighbor)
+					queue = append(queue, neighbor)
+				}
+			}
+		}
+	}
+	return component
+}
+
+// componentAt returns the component of cells containing cell, visiting only
+// that component rather than splitting the whole universe.
+func (cells Cells) componentAt(cell Cell, gap int64) (Cells, bool) {
+	if !cells.hasCell(cell) {
+		return nil, false
+	}
+	return cells.componentFrom(cell, gap, make(Cells)), true
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	CORPUS_HEADER = "#Life Corpus 1.0"
+)
+
+// corpusEntry is one recorded run: what went in and a hash of what came out.
+// A corpus file holds one entry per line, as tab separated fields:
+//
+//	#Life Corpus 1.0
+//	/home/me/glider.lif	-	1a2b...	B3/S23	-1,-1;-1,0;...	0	100	3c4d...
+//
+// giving the input file, the -load-region or "-", the hash of the loaded
+// cells, the rule, the neighborhood, the starting generation, the number of
+// generations run and the hash of the resulting cells. Hashes are of the
+// exact cells, so a pattern that merely moved does not match.
+type corpusEntry struct {
+	input        string
+	region       *Rect
+	inputHash    uint64
+	rule         Rule
+	neighborhood Neighborhood
+	start        int
+	generations  int
+	outputHash   uint64
+}
+
+func (entry corpusEntry) String() string {
+	region := "-"
+	if entry.region != nil {
+		region = entry.region.String()
+	}
+	return fmt.Sprintf("%s\t%s\t%016x\t%s\t%s\t%d\t%d\t%016x",
+		entry.input, region, entry.inputHash, entry.rule, entry.neighborhood, entry.start, entry.generations, entry.outputHash)
+}
+
+func parseCorpusEntry(line string) (corpusEntry, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 8 {
+		return corpusEntry{}, fmt.Errorf("expected 8 tab separated fields, got %d", len(fields))
+	}
+	entry := corpusEntry{input: fields[0]}
+	var err error
+	if fields[1] != "-" {
+		region, err := parseRect(fields[1], nil)
+		if err != nil {
+			return corpusEntry{}, err
+		}
+		entry.region = &region
+	}
+	if entry.inputHash, err = strconv.ParseUint(fields[2], 16, 64); err != nil {
+		return corpusEntry{}, fmt.Errorf("invalid input hash '%s'", fields[2])
+	}
+	if entry.rule, err = parseRule(fields[3]); err != nil {
+		return corpusEntry{}, err
+	}
+	if entry.neighborhood, err = parseNeighborhood(fields[4]); err != nil {
+		return corpusEntry{}, err
+	}
+	if entry.start, err = strconv.Atoi(fields[5]); err != nil {
+		return corpusEntry{}, fmt.Errorf("invalid start generation '%s'", fields[5])
+	}
+	if entry.generations, err = strconv.Atoi(fields[6]); err != nil {
+		return corpusEntry{}, fmt.Errorf("invalid generations '%s'", fields[6])
+	}
+	if entry.outputHash, err = strconv.ParseUint(fields[7], 16, 64); err != nil {
+		return corpusEntry{}, fmt.Errorf("invalid output hash '%s'", fields[7])
+	}
+	return entry, nil
+}
+
+// recordCorpusEntry appends entry to the corpus file, creating it if needed.
+func recordCorpusEntry(name string, entry corpusEntry) error {
+	if absolute, err := filepath.Abs(entry.input); err == nil {
+		// verify may be run from another directory
+		entry.input = absolute
+	}
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := fmt.Fprintf(file, "%s\n", CORPUS_HEADER); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(file, "%s\n", entry); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func runCorpus(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing corpus command, expected one of: verify")
+	}
+	switch args[0] {
+	case "verify":
+		return runCorpusVerify(args[1:])
+	default:
+		return fmt.Errorf("unknown corpus command '%s', expected one of: verify", args[0])
+	}
+}
+
+// runCorpusVerify replays every run recorded in a corpus and reports those
+// whose result no longer matches, so that behavior changes between versions
+// show up on the user's own patterns.
+func runCorpusVerify(args []string) error {
+	flags := flag.NewFlagSet("corpus verify", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one corpus file, got %d arguments", flags.NArg())
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	runs, problems := 0, 0
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, err := parseCorpusEntry(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		runs++
+		if err := verifyCorpusEntry(entry); err != nil {
+			fmt.Printf("%s after %d generations: %v\n", entry.input, entry.generations, err)
+			problems++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d runs, %d not reproduced\n", runs, problems)
+	if problems > 0 {
+		return fmt.Errorf("%d runs were not reproduced", problems)
+	}
+	return nil
+}
+
+func verifyCorpusEntry(entry corpusEntry) error {
+	pattern, err := parsePattern(entry.input, entry.region)
+	if err != nil {
+		return fmt.Errorf("FAILED to read input: %v", err)
+	}
+	cells := pattern.cells
+	if cells.hash() != entry.inputHash {
+		return fmt.Errorf("CHANGED input, the file no longer holds the recorded pattern")
+	}
+	engine := newNaiveEngine(entry.rule, entry.neighborhood, constraints{})
+	for generation := 0; generation < entry.generations; generation++ {
+		cells, _, _ = engine.step(cells)
+	}
+	if hash := cells.hash(); hash != entry.outputHash {
+		return fmt.Errorf("MISMATCH, got %016x, recorded %016x", hash, entry.outputHash)
+	}
+	return nil
+}
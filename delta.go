@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+const (
+	DELTA_HEADER = "#Life Delta 1.0"
+)
+
+// deltaWriter streams only the cells that changed each generation, which is
+// far smaller than a full dump once a pattern has settled. The format is line
+// based:
+//
+//	#Life Delta 1.0
+//	#G 0
+//	+0 -1
+//	+1 0
+//	#G 1
+//	-0 -1
+//	+1 1
+//
+// The first line is the header. Each "#G n" line starts generation n and is
+// followed by one "+x y" line per born cell and one "-x y" line per dead cell.
+// The first generation (0, or the generation a -continue run starts from)
+// lists the initial universe as births, so a reader can rebuild any
+// generation by replaying the stream from the top.
+type deltaWriter struct {
+	w *bufio.Writer
+}
+
+func newDeltaWriter(w io.Writer) (*deltaWriter, error) {
+	delta := &deltaWriter{bufio.NewWriter(w)}
+	if _, err := fmt.Fprintf(delta.w, "%s\n", DELTA_HEADER); err != nil {
+		return nil, err
+	}
+	return delta, nil
+}
+
+func (delta *deltaWriter) observe(event Event) error {
+	if err := delta.writeGeneration(event.generation, event.born, event.died); err != nil {
+		return fmt.Errorf("writing delta stream failed: %v", err)
+	}
+	return nil
+}
+
+func (delta *deltaWriter) close() error {
+	return delta.flush()
+}
+
+func (delta *deltaWriter) flush() error {
+	if err := delta.w.Flush(); err != nil {
+		return fmt.Errorf("writing delta stream failed: %v", err)
+	}
+	return nil
+}
+
+func (delta *deltaWriter) needsEveryGeneration() bool {
+	return true
+}
+
+func (delta *deltaWriter) writeGeneration(generation int, born, died Cells) error {
+	if _, err := fmt.Fprintf(delta.w, "#G %d\n", generation); err != nil {
+		return err
+	}
+	for cell := range born {
+		if _, err := fmt.Fprintf(delta.w, "+%d %d\n", cell.x, cell.y); err != nil {
+			return err
+		}
+	}
+	for cell := range died {
+		if _, err := fmt.Fprintf(delta.w, "-%d %d\n", cell.x, cell.y); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+const (
+	// maxDensityPixels bounds the size of an image drawn as densities: large
+	// enough to show the structure of a universe, small enough to look at.
+	maxDensityPixels = 1 << 22
+	// maxDensitySide bounds its width and height, within what a GIF can hold.
+	maxDensitySide = 1 << 15
+	// densityLevels is how many shades between dead and alive a density is
+	// drawn in.
+	densityLevels = 16
+	// maxDensityBoardSide bounds the width and height of a board printed as
+	// densities, to fit a terminal.
+	maxDensityBoardSide = 1 << 8
+)
+
+// boardDensities are the characters of a board printed as densities, from
+// empty to full.
+var boardDensities = []string{boardDead, "░", "▒", "▓", boardAlive}
+
+// densityBlock is the width and height in cells of the blocks a w by h
+// viewport is divided into so that there are at most maxBlocks of them, and
+// at most maxSide across and down.
+func densityBlock(w, h, maxBlocks, maxSide int64) int64 {
+	block := int64(math.Ceil(math.Sqrt(float64(w) / float64(maxBlocks) * float64(h))))
+	block = max(block, (max(w, h)-1)/maxSide+1, 1)
+	for {
+		columns, rows := (w-1)/block+1, (h-1)/block+1
+		if columns <= maxBlocks/rows {
+			return block
+		}
+		block += block/64 + 1
+	}
+}
+
+// densities divides the viewport of view into blocks of block by block cells
+// and counts the alive cells in each, row by row from the top as view draws
+// them. Hex rows are not shifted: a block spans many rows.
+func densities(cells Cells, view viewTransform, block int64) ([]int64, int, int) {
+	viewport := view.viewport
+	columns, rows := int((viewport.w-1)/block+1), int((viewport.h-1)/block+1)
+	counts := make([]int64, columns*rows)
+	for cell := range cells {
+		if !viewport.contains(cell) {
+			continue
+		}
+		column, row := cell.x-viewport.x, cell.y-viewport.y
+		if view.flipY {
+			row = viewport.h - 1 - row
+		}
+		counts[int(row/block)*columns+int(column/block)]++
+	}
+	return counts, columns, rows
+}
+
+// densityLevel is the shade of a block with count of its area cells alive,
+// from 0 for none to levels for all of them; a block with any alive cell is
+// at least 1, so that sparse objects stay visible.
+func densityLevel(count, area int64, levels int) int {
+	if count == 0 {
+		return 0
+	}
+	return max(1, int(math.Round(float64(count)*float64(levels)/float64(area))))
+}
+
+// densityView is the block size renderDensity divides the viewport of view
+// into, and the width and height of the image it draws.
+func densityView(view viewTransform) (int64, int, int) {
+	block := densityBlock(view.viewport.w, view.viewport.h, maxDensityPixels, maxDensitySide)
+	return block, int((view.viewport.w-1)/block + 1), int((view.viewport.h-1)/block + 1)
+}
+
+// renderDensity draws the viewport of view with each pixel a block of cells,
+// shaded from deadColor to aliveColor by the share of the block that is
+// alive, for viewports too large to draw a pixel per cell. Overlays,
+// annotations and decaying cells are not drawn on it.
+func renderDensity(cells Cells, view viewTransform) *image.Paletted {
+	block, _, _ := densityView(view)
+	counts, width, height := densities(cells, view, block)
+	palette := make(color.Palette, densityLevels+1)
+	for i := range palette {
+		palette[i] = color.Gray{uint8(int(deadColor.Y) - i*(int(deadColor.Y)-int(aliveColor.Y))/densityLevels)}
+	}
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	for i, count := range counts {
+		img.Pix[i] = uint8(densityLevel(count, block*block, densityLevels))
+	}
+	return img
+}
+
+// logDensity tells that the viewport of view is drawn as densities.
+func logDensity(view viewTransform, block int64) {
+	logger(logRenderer).Info("Drawing the density of the cells, the viewport being too large for a cell per pixel", "viewport", view.viewport.String(), "block", fmt.Sprintf("%dx%d", block, block))
+}
+
+// printDensityBoard prints the viewport of view as printBoard does, with a
+// character per block of cells from boardDensities, for viewports too large
+// to print a character per cell. Decaying cells are not shown.
+func printDensityBoard(out io.Writer, cells Cells, view viewTransform) error {
+	block := densityBlock(view.viewport.w, view.viewport.h, maxBoardCells, maxDensityBoardSide)
+	logDensity(view, block)
+	counts, columns, _ := densities(cells, view, block)
+	w := bufio.NewWriter(out)
+	for i, count := range counts {
+		w.WriteString(boardDensities[densityLevel(count, block*block, len(boardDensities)-1)])
+		if (i+1)%columns == 0 {
+			w.WriteString("\n")
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// maxSideBySideWidth and maxSideBySideHeight bound the -side-by-side
+// rendering, which draws every cell of the combined bounding box.
+const (
+	maxSideBySideWidth  = 200
+	maxSideBySideHeight = 1000
+)
+
+// runDiff compares two Life files, printing the cells only found in the first,
+// only found in the second and found in both.
+func runDiff(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	normalizeArg := flags.Bool("normalize", false, "Translate both patterns so their bounding boxes start at 0,0 before comparing")
+	sideBySideArg := flags.Bool("side-by-side", false, "Also draw both patterns next to each other as ASCII art")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("expected two files to compare, got %d", flags.NArg())
+	}
+	nameA, nameB := flags.Arg(0), flags.Arg(1)
+
+	a, err := parseCells(nameA, nil)
+	if err != nil {
+		return fmt.Errorf("parsing %s failed: %v", nameA, err)
+	}
+	b, err := parseCells(nameB, nil)
+	if err != nil {
+		return fmt.Errorf("parsing %s failed: %v", nameB, err)
+	}
+	if *normalizeArg {
+		a, b = a.normalized(), b.normalized()
+	}
+
+	onlyA, onlyB, common := make(Cells), make(Cells), make(Cells)
+	for cell := range a {
+		if b.hasCell(cell) {
+			common.addCell(cell)
+		} else {
+			onlyA.addCell(cell)
+		}
+	}
+	for cell := range b {
+		if !a.hasCell(cell) {
+			onlyB.addCell(cell)
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	for _, section := range []struct {
+		title string
+		cells Cells
+	}{
+		{"only in " + nameA, onlyA},
+		{"only in " + nameB, onlyB},
+		{"common", common},
+	} {
+		fmt.Fprintf(w, "# %s: %d\n", section.title, len(section.cells))
+		for _, cell := range section.cells.sorted() {
+			fmt.Fprintf(w, "%d %d\n", cell.x, cell.y)
+		}
+	}
+	if *sideBySideArg {
+		fmt.Fprintln(w)
+		if err := printSideBySide(w, a, b); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// normalized returns cells translated so their bounding box starts at 0,0.
+func (cells Cells) normalized() Cells {
+	min, _, ok := cells.boundingBox()
+	if !ok {
+		return cells
+	}
+	normalized := make(Cells, len(cells))
+	for cell := range cells {
+		normalized.addCell(Cell{cell.x - min.x, cell.y - min.y})
+	}
+	return normalized
+}
+
+// printSideBySide draws the combined bounding box of a and b twice, a on the
+// left and b on the right, marking cells only alive on one side with '+'.
+func printSideBySide(w io.Writer, a, b Cells) error {
+	min, max, ok := union(a, b).boundingBox()
+	if !ok {
+		return nil
+	}
+	if max.x-min.x+1 > maxSideBySideWidth {
+		return fmt.Errorf("patterns are %d cells wide, side by side rendering supports at most %d", max.x-min.x+1, maxSideBySideWidth)
+	}
+	if max.y-min.y+1 > maxSideBySideHeight {
+		return fmt.Errorf("patterns are %d cells tall, side by side rendering supports at most %d", max.y-min.y+1, maxSideBySideHeight)
+	}
+
+	row := func(cells, other Cells, y int64) []byte {
+		line := make([]byte, 0, max.x-min.x+1)
+		for x := min.x; x <= max.x; x++ {
+			cell := Cell{x, y}
+			switch {
+			case !cells.hasCell(cell):
+				line = append(line, '.')
+			case other.hasCell(cell):
+				line = append(line, 'o')
+			default:
+				line = append(line, '+')
+			}
+		}
+		return line
+	}
+	for y := min.y; y <= max.y; y++ {
+		if _, err := fmt.Fprintf(w, "%s | %s\n", row(a, b, y), row(b, a, y)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// Engine advances a universe one generation at a time.
+type Engine interface {
+	// step advances cells by one generation, returning the next generation
+	// and the cells that were born and the cells that died. The next
+	// generation may be cells itself or a buffer of the engine's; either way
+	// cells belongs to the engine afterwards, which may reuse it for a later
+	// generation, and so must not be used once the engine steps again.
+	step(cells Cells) (next, born, died Cells)
+}
+
+// newEngine picks the engine for a run: the Generations engine for rules of
+// that family, starting from the decaying cells in decay, or else the naive
+// engine, or the parallel engine when more than one worker is asked for.
+// Larger than Life rules count over their range rather than neighborhood.
+// Rule tables run on the table engine, which takes the cells in their other
+// states from decay.
+func newEngine(rule Rule, neighborhood Neighborhood, constraints constraints, workers int, decay Decay) Engine {
+	neighborhood = rule.countedOver(neighborhood)
+	if rule.table != nil {
+		return newTableEngine(rule.table, constraints, decay)
+	}
+	if rule.isGenerations() {
+		return newGenerationsEngine(rule, neighborhood, constraints, decay)
+	}
+	if workers <= 1 {
+		return newNaiveEngine(rule, neighborhood, constraints)
+	}
+	reflected := neighborhood.reflected()
+	return &parallelEngine{rule: rule, reflected: reflected, weights: rule.weights(reflected), radius: neighborhood.radius(), constraints: constraints, workers: workers}
+}
+
+// parallelEngine splits the universe into bands of rows with about as many
+// alive cells each, several per worker, and has the workers work out the
+// next generation of the bands, stealing bands from each other as they run
+// out (see runStealing). Each band only reads the alive cells within reach of its
+// rows and decides only the cells in its rows, so the bands never share
+// state and the result cannot depend on the number of workers or the order
+// they finish in; the bands' changes are merged in row order all the same.
+type parallelEngine struct {
+	rule        Rule
+	reflected   Neighborhood
+	weights     []uint8
+	radius      int64
+	constraints constraints
+	workers     int
+	// stats describes the scheduling of the last step.
+	stats schedulerStats
+}
+
+// rowBand is the rows from top up to but not including bottom.
+type rowBand struct {
+	top, bottom int64
+}
+
+// step applies the changes to cells in place, as the bands' changes are far
+// fewer than the cells of a large universe.
+func (engine *parallelEngine) step(cells Cells) (Cells, Cells, Cells) {
+	sorted := cells.sorted()
+	bands := engine.bands(sorted)
+
+	borns := make([]Cells, len(bands))
+	deaths := make([]Cells, len(bands))
+	engine.stats = runStealing(len(bands), engine.workers, func(i int) {
+		borns[i], deaths[i] = engine.stepBand(cells, sorted, bands[i])
+	})
+
+	birthedCells, dyingCells := make(Cells), make(Cells)
+	for i := range bands {
+		for cell := range borns[i] {
+			birthedCells.addCell(cell)
+		}
+		for cell := range deaths[i] {
+			dyingCells.addCell(cell)
+		}
+	}
+	for cell := range dyingCells {
+		cells.removeCell(cell)
+	}
+	for cell := range birthedCells {
+		cells.addCell(cell)
+	}
+	return cells, birthedCells, dyingCells
+}
+
+// bands splits the rows into up to tasksPerWorker bands per worker, cutting
+// the alive cells, sorted by row, into runs of about equal length. The first
+// and last bands reach out to the edges of the universe.
+func (engine *parallelEngine) bands(sorted []Cell) []rowBand {
+	bands := []rowBand{{math.MinInt64, math.MaxInt64}}
+	count := engine.workers * tasksPerWorker
+	for b := 1; b < count; b++ {
+		cut := sorted[b*len(sorted)/count:]
+		if len(cut) == 0 {
+			break
+		}
+		if top := cut[0].y; top > bands[len(bands)-1].top {
+			bands[len(bands)-1].bottom = top
+			bands = append(bands, rowBand{top, math.MaxInt64})
+		}
+	}
+	return bands
+}
+
+// stepBand works out which cells of the band's rows are born and die.
+func (engine *parallelEngine) stepBand(cells Cells, sorted []Cell, band rowBand) (Cells, Cells) {
+	// only alive cells within radius rows of the band can reach into it
+	from := sort.Search(len(sorted), func(i int) bool {
+		return band.top == math.MinInt64 || sorted[i].y >= band.top-engine.radius
+	})
+	to := sort.Search(len(sorted), func(i int) bool {
+		return band.bottom != math.MaxInt64 && sorted[i].y >= band.bottom+engine.radius
+	})
+	inBand := func(cell Cell) bool {
+		return cell.y >= band.top && cell.y < band.bottom
+	}
+
+	counts := make(map[Cell]uint8)
+	for _, cell := range sorted[from:to] {
+		for i, offset := range engine.reflected {
+			if neighbor, ok := cell.offset(offset); ok && inBand(neighbor) {
+				counts[neighbor] += engine.weights[i]
+			}
+		}
+	}
+
+	dyingCells := make(Cells)
+	for _, cell := range sorted[from:to] {
+		if inBand(cell) && engine.constraints.allowsDeath(cell) && !engine.rule.survives(counts[cell]) {
+			dyingCells.addCell(cell)
+		}
+	}
+	birthedCells := make(Cells)
+	for cell, aliveNeighbors := range counts {
+		if !cells.hasCell(cell) && engine.rule.births(aliveNeighbors) && engine.constraints.allowsBirth(cell) {
+			birthedCells.addCell(cell)
+		}
+	}
+	return birthedCells, dyingCells
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// fitnessByName scores runs by the metrics of measureRun, higher being
+// fitter; the names are those of the rulesweep metrics.
+var fitnessByName = map[string]func(runMetrics) float64{
+	"lifespan": func(metrics runMetrics) float64 {
+		return float64(metrics.lifespan)
+	},
+	"population": func(metrics runMetrics) float64 {
+		return float64(metrics.finalPopulation)
+	},
+	"growth": func(metrics runMetrics) float64 {
+		if metrics.initialPopulation == 0 {
+			return 0
+		}
+		return float64(metrics.finalPopulation) / float64(metrics.initialPopulation)
+	},
+}
+
+// tournamentSize is how many candidates compete to become each parent.
+const tournamentSize = 3
+
+type candidate struct {
+	cells   Cells
+	fitness float64
+}
+
+// runEvolve searches for initial patterns that score well under a fitness
+// metric with a simple genetic algorithm: each round the fittest patterns
+// are kept, and the rest of the population is replaced by children of
+// tournament-selected parents, crossed over and mutated by cell flips within
+// the soup. Runs are measured in parallel.
+func runEvolve(args []string) error {
+	flags := flag.NewFlagSet("evolve", flag.ContinueOnError)
+	populationArg := flags.Int("population", 200, "The number of patterns in each round")
+	generationsArg := flags.Int("generations", 50, "The number of rounds of selection")
+	fitnessArg := flags.String("fitness", "lifespan", "The metric to maximize: lifespan, population or growth")
+	soupArg := flags.String("soup", "16x16", "The size of the area patterns live in, as WxH")
+	densityArg := flags.Float64("density", 0.5, "The fraction of cells alive in the random patterns of the first round")
+	flipsArg := flags.Int("flips", 2, "The number of cells flipped in each child")
+	eliteArg := flags.Int("elite", 10, "The number of fittest patterns kept unchanged each round")
+	bestArg := flags.Int("best", 5, "The number of best patterns to print at the end")
+	seedArg := flags.Uint64("seed", 1, "The seed for the random choices")
+	maxGenerationsArg := flags.Int("max-generations", 1000, "The number of generations after which a run is cut off")
+	maxPopulationArg := flags.Int("max-population", 100000, "The population above which a run is treated as exploding and cut off")
+	workersArg := flags.Int("workers", runtime.NumCPU(), "The number of patterns simulated in parallel")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	fitness, found := fitnessByName[*fitnessArg]
+	if !found {
+		return fmt.Errorf("unknown fitness '%s', expected lifespan, population or growth", *fitnessArg)
+	}
+	width, height, err := parseSize(*soupArg)
+	if err != nil {
+		return fmt.Errorf("invalid -soup: %v", err)
+	}
+	if *populationArg < 2 {
+		return fmt.Errorf("invalid -population %d, at least 2 patterns are needed to breed", *populationArg)
+	}
+	elite := min(max(*eliteArg, 0), *populationArg)
+	bounds := Rect{0, 0, width, height}
+
+	rng := rand.New(rand.NewPCG(*seedArg, *seedArg))
+	population := make([]candidate, *populationArg)
+	for i := range population {
+		population[i].cells = randomInBounds(Rect{0, 0, width, height}, *densityArg, rng)
+	}
+
+	evaluate := func(population []candidate) {
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for worker := 0; worker < max(*workersArg, 1); worker++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					population[i].fitness = fitness(measureRun(population[i].cells, conwayRule, *maxGenerationsArg, *maxPopulationArg))
+				}
+			}()
+		}
+		for i := range population {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		// stable, so that ties keep their order and runs are reproducible
+		sort.SliceStable(population, func(i, j int) bool {
+			return population[i].fitness > population[j].fitness
+		})
+	}
+
+	evaluate(population)
+	for round := 1; round <= *generationsArg; round++ {
+		next := make([]candidate, 0, len(population))
+		next = append(next, population[:elite]...)
+		for len(next) < len(population) {
+			a, b := tournament(population, rng), tournament(population, rng)
+			child := crossover(a.cells, b.cells, rng)
+			next = append(next, candidate{cells: flipCells(child, bounds, *flipsArg, rng)})
+		}
+		population = next
+		evaluate(population)
+
+		sum := 0.0
+		for _, c := range population {
+			sum += c.fitness
+		}
+		logger(logTools).Info("Evolved a round", "round", round, "fitness", *fitnessArg, "best", population[0].fitness, "mean", sum/float64(len(population)))
+	}
+
+	for rank, c := range population[:min(max(*bestArg, 0), len(population))] {
+		fmt.Printf("#C rank %d, %s %g\n", rank+1, *fitnessArg, c.fitness)
+		if err := writeRLE(os.Stdout, Pattern{cells: c.cells}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tournament picks the fittest of a few random candidates.
+func tournament(population []candidate, rng *rand.Rand) candidate {
+	best := population[rng.IntN(len(population))]
+	for i := 1; i < tournamentSize; i++ {
+		if c := population[rng.IntN(len(population))]; c.fitness > best.fitness {
+			best = c
+		}
+	}
+	return best
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+func runExperiment(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing experiment, expected one of: rulesweep")
+	}
+	switch args[0] {
+	case "rulesweep":
+		return runRuleSweep(args[1:])
+	default:
+		return fmt.Errorf("unknown experiment '%s', expected one of: rulesweep", args[0])
+	}
+}
+
+// runRuleSweep runs one random soup under every combination of the given
+// birth and survival counts and prints a matrix of the chosen metric, with a
+// row per birth set and a column per survival set.
+func runRuleSweep(args []string) error {
+	flags := flag.NewFlagSet("experiment rulesweep", flag.ContinueOnError)
+	birthsArg := flags.String("births", "1-8", "The birth counts to combine, e.g. '1-8' or '3,6'")
+	survivalsArg := flags.String("survivals", "0-8", "The survival counts to combine, e.g. '0-8' or '2,3'")
+	soupArg := flags.String("soup", "64x64", "The size of the random soup, as WxH")
+	densityArg := flags.Float64("density", 0.5, "The fraction of soup cells that start alive")
+	seedArg := flags.Uint64("seed", 1, "The seed for the random soup")
+	metricArg := flags.String("metric", "lifespan", "The metric to report: lifespan, population or growth")
+	maxGenerationsArg := flags.Int("max-generations", 1000, "The number of generations after which a run is cut off")
+	maxPopulationArg := flags.Int("max-population", 100000, "The population above which a run is treated as exploding and cut off")
+	workersArg := flags.Int("workers", runtime.NumCPU(), "The number of rules simulated in parallel")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	births, err := parseCountSet(*birthsArg)
+	if err != nil {
+		return fmt.Errorf("invalid -births: %v", err)
+	}
+	if births&1 != 0 {
+		// B0 would turn the infinite dead background alive, which a sparse
+		// universe cannot represent.
+		logger(logParser).Warn("Ignoring birth count 0, B0 rules are not supported")
+		births &^= 1
+	}
+	survivals, err := parseCountSet(*survivalsArg)
+	if err != nil {
+		return fmt.Errorf("invalid -survivals: %v", err)
+	}
+	width, height, err := parseSize(*soupArg)
+	if err != nil {
+		return fmt.Errorf("invalid -soup: %v", err)
+	}
+	metric, found := runMetricsByName[*metricArg]
+	if !found {
+		return fmt.Errorf("unknown metric '%s', expected lifespan, population or growth", *metricArg)
+	}
+
+	soup := randomInBounds(Rect{0, 0, width, height}, *densityArg, rand.New(rand.NewPCG(*seedArg, *seedArg)))
+	birthSets, survivalSets := subsets(births), subsets(survivals)
+
+	type job struct{ row, column int }
+	results := make([][]string, len(birthSets))
+	for row := range results {
+		results[row] = make([]string, len(survivalSets))
+	}
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for worker := 0; worker < max(*workersArg, 1); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				rule := Rule{birth: birthSets[job.row], survival: survivalSets[job.column]}
+				metrics := measureRun(soup, rule, *maxGenerationsArg, *maxPopulationArg)
+				results[job.row][job.column] = metric(metrics)
+			}
+		}()
+	}
+	for row := range birthSets {
+		for column := range survivalSets {
+			jobs <- job{row, column}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return printMatrix(os.Stdout, birthSets, survivalSets, results)
+}
+
+func printMatrix(w io.Writer, birthSets, survivalSets []uint16, results [][]string) error {
+	header := []string{"B\\S"}
+	for _, survival := range survivalSets {
+		header = append(header, strings.TrimPrefix(Rule{survival: survival}.String(), "B/"))
+	}
+	if _, err := fmt.Fprintln(w, strings.Join(header, "\t")); err != nil {
+		return err
+	}
+	for row, birth := range birthSets {
+		line := append([]string{strings.TrimSuffix(Rule{birth: birth}.String(), "/S")}, results[row]...)
+		if _, err := fmt.Fprintln(w, strings.Join(line, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runMetrics summarizes how a pattern evolved under a rule.
+type runMetrics struct {
+	// lifespan is the number of generations until the universe died out or
+	// entered a cycle, or the generation the run was cut off at.
+	lifespan          int
+	initialPopulation int
+	finalPopulation   int
+}
+
+var runMetricsByName = map[string]func(runMetrics) string{
+	"lifespan": func(metrics runMetrics) string {
+		return strconv.Itoa(metrics.lifespan)
+	},
+	"population": func(metrics runMetrics) string {
+		return strconv.Itoa(metrics.finalPopulation)
+	},
+	"growth": func(metrics runMetrics) string {
+		if metrics.initialPopulation == 0 {
+			return "0"
+		}
+		return strconv.FormatFloat(float64(metrics.finalPopulation)/float64(metrics.initialPopulation), 'f', 3, 64)
+	},
+}
+
+const maxDetectedPeriod = 30
+
+// measureRun simulates a copy of initial under rule until it dies out, becomes
+// periodic, grows beyond maxPopulation or reaches maxGenerations.
+func measureRun(initial Cells, rule Rule, maxGenerations, maxPopulation int) runMetrics {
+	cells := initial.clone()
+	metrics := runMetrics{lifespan: maxGenerations, initialPopulation: len(cells)}
+
+	engine := newNaiveEngine(rule, mooreNeighborhood, constraints{})
+	detector := newPeriodDetector(maxDetectedPeriod)
+	hash := cells.hash()
+	detector.observe(0, hash)
+	for generation := 1; generation <= maxGenerations; generation++ {
+		var born, died Cells
+		cells, born, died = engine.step(cells)
+		for cell := range born {
+			hash ^= cellHash(cell)
+		}
+		for cell := range died {
+			hash ^= cellHash(cell)
+		}
+
+		if len(cells) == 0 {
+			metrics.lifespan = generation
+			break
+		}
+		if len(cells) > maxPopulation {
+			break
+		}
+		if period, found := detector.observe(generation, hash); found {
+			metrics.lifespan = generation - period
+			break
+		}
+	}
+	metrics.finalPopulation = len(cells)
+	return metrics
+}
+
+// parseCountSet parses neighbor counts such as "0-8" or "2,3,6" into a bit set.
+func parseCountSet(s string) (uint16, error) {
+	counts := uint16(0)
+	for _, part := range strings.Split(s, ",") {
+		low, high, isRange := strings.Cut(part, "-")
+		if !isRange {
+			high = low
+		}
+		from, err := strconv.Atoi(strings.TrimSpace(low))
+		if err != nil {
+			return 0, err
+		}
+		to, err := strconv.Atoi(strings.TrimSpace(high))
+		if err != nil {
+			return 0, err
+		}
+		if from < 0 || to > 8 || from > to {
+			return 0, fmt.Errorf("count range '%s' must lie within 0-8", part)
+		}
+		for n := from; n <= to; n++ {
+			counts |= 1 << n
+		}
+	}
+	return counts, nil
+}
+
+// subsets returns every subset of the bit set counts, in ascending order.
+func subsets(counts uint16) []uint16 {
+	var sets []uint16
+	for set := uint16(0); set <= counts; set++ {
+		if set&^counts == 0 {
+			sets = append(sets, set)
+		}
+	}
+	return sets
+}
+
+// parseSize parses a size given as WxH.
+func parseSize(s string) (int64, int64, error) {
+	w, h, found := strings.Cut(s, "x")
+	if !found {
+		return 0, 0, fmt.Errorf("size '%s' is not of the form WxH", s)
+	}
+	width, err := strconv.ParseInt(w, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	height, err := strconv.ParseInt(h, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("size '%s' must be positive", s)
+	}
+	return width, height, nil
+}
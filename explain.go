@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// runExplain reports why a cell is in the state it is at a generation: how
+// many of its neighbors were alive the generation before, and what the rule
+// does with that count. It is meant for debugging rules and for teaching.
+func runExplain(args []string) error {
+	flags := flag.NewFlagSet("explain", flag.ContinueOnError)
+	cellArg := flags.String("cell", "", "The cell x,y (or an anchor) to explain")
+	generationArg := flags.Int("generation", 1, "The generation whose state of the cell to explain")
+	ruleArg := flags.String("rule", "", "The rule to run under, by default the rule of the pattern or B3/S23")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one pattern file, got %d arguments", flags.NArg())
+	}
+	if *cellArg == "" {
+		return fmt.Errorf("missing -cell")
+	}
+	if *generationArg < 1 {
+		return fmt.Errorf("invalid -generation %d, the first generation with a cause is 1", *generationArg)
+	}
+	cell, err := anchorsArg.resolve(*cellArg)
+	if err != nil {
+		return fmt.Errorf("invalid -cell: %v", err)
+	}
+
+	pattern, err := parsePattern(flags.Arg(0), nil)
+	if err != nil {
+		return fmt.Errorf("parsing %s failed: %v", flags.Arg(0), err)
+	}
+	rule := conwayRule
+	switch {
+	case *ruleArg != "":
+		if rule, err = parseRule(*ruleArg); err != nil {
+			return err
+		}
+	case pattern.rule != "":
+		if rule, err = parseRule(pattern.rule); err != nil {
+			return err
+		}
+	}
+
+	if rule.table != nil {
+		return fmt.Errorf("rule tables such as %s give the next state of a cell, not counts to explain it by", rule)
+	}
+
+	// the cause of a state is the generation before it
+	cells := pattern.cells
+	cells = advance(cells, rule, *generationArg-1)
+	fmt.Print(explainCell(cells, cell, rule, *generationArg))
+	return nil
+}
+
+// explainCell describes the transition of cell from the universe cells, at
+// generation-1, to generation.
+func explainCell(cells Cells, cell Cell, rule Rule, generation int) string {
+	var b strings.Builder
+	alive, config := uint8(0), configuration(0)
+	for _, offset := range rule.countedOver(mooreNeighborhood) {
+		if neighbor, ok := cell.offset(offset); ok && cells.hasCell(neighbor) {
+			alive++
+			if rule.isotropic {
+				config |= configurationBit(offset)
+			}
+		}
+	}
+	// an isotropic rule goes by the arrangement, such as 2a, not the count
+	neighbors, arrangement := alive, fmt.Sprint(alive)
+	if rule.isotropic {
+		neighbors = config
+		if letter := henselClasses[config].letter; letter != 0 {
+			arrangement += string(letter)
+		}
+	}
+
+	var outcome, reason string
+	if cells.hasCell(cell) {
+		if rule.survives(neighbors) {
+			outcome, reason = "survived", fmt.Sprintf("%s keeps alive cells with %s alive neighbors", rule, arrangement)
+		} else {
+			outcome, reason = "died", fmt.Sprintf("%s only keeps alive cells with %s alive neighbors", rule, describeSurvivals(rule))
+		}
+	} else {
+		if rule.births(neighbors) {
+			outcome, reason = "was born", fmt.Sprintf("%s births dead cells with %s alive neighbors", rule, arrangement)
+		} else {
+			outcome, reason = "stayed dead", fmt.Sprintf("%s only births dead cells with %s alive neighbors", rule, describeBirths(rule))
+		}
+	}
+	state := "dead"
+	if cells.hasCell(cell) {
+		state = "alive"
+	}
+
+	fmt.Fprintf(&b, "Cell %d,%d %s at generation %d.\n", cell.x, cell.y, outcome, generation)
+	fmt.Fprintf(&b, "At generation %d it was %s with %s alive neighbors, and %s:\n\n", generation-1, state, arrangement, reason)
+	for dy := int64(-1); dy <= 1; dy++ {
+		var row strings.Builder
+		row.WriteString(" ")
+		for dx := int64(-1); dx <= 1; dx++ {
+			symbol := "."
+			if neighbor, ok := cell.offset(Offset{dx, dy}); ok && cells.hasCell(neighbor) {
+				symbol = "o"
+			}
+			if dx == 0 && dy == 0 {
+				symbol = "[" + symbol + "]"
+			} else {
+				symbol = " " + symbol + " "
+			}
+			row.WriteString(symbol)
+		}
+		b.WriteString(strings.TrimRight(row.String(), " ") + "\n")
+	}
+	return b.String()
+}
+
+// describeBirths and describeSurvivals describe the counts of alive neighbors
+// a rule births and keeps cells with, not counting the cell itself.
+func describeBirths(rule Rule) string {
+	if rule.isotropic {
+		return henselString(rule.birthConfigurations)
+	}
+	if rule.isLargerThanLife() {
+		return describeRange(int(rule.birthMin), int(rule.birthMax))
+	}
+	return describeCounts(rule.birth)
+}
+
+func describeSurvivals(rule Rule) string {
+	if rule.isotropic {
+		return henselString(rule.survivalConfigurations)
+	}
+	if rule.isLargerThanLife() {
+		if rule.middle {
+			return describeRange(max(int(rule.survivalMin)-1, 0), int(rule.survivalMax)-1)
+		}
+		return describeRange(int(rule.survivalMin), int(rule.survivalMax))
+	}
+	return describeCounts(rule.survival)
+}
+
+func describeRange(min, max int) string {
+	if min > max {
+		return "no"
+	}
+	if min == max {
+		return fmt.Sprint(min)
+	}
+	return fmt.Sprintf("%d to %d", min, max)
+}
+
+// describeCounts lists neighbor counts for a sentence, e.g. "2 or 3".
+func describeCounts(counts uint16) string {
+	var items []string
+	for n := 0; n <= 8; n++ {
+		if counts&(1<<n) != 0 {
+			items = append(items, fmt.Sprint(n))
+		}
+	}
+	switch len(items) {
+	case 0:
+		return "no"
+	case 1:
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " or " + items[len(items)-1]
+}
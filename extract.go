@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// runExtract writes one object of a pattern, such as a single still life of a
+// large ash field, to its own file. Files ending in .gz or .zz are compressed.
+func runExtract(args []string) error {
+	flags := flag.NewFlagSet("extract", flag.ContinueOnError)
+	componentAtArg := flags.String("component-at", "", "Extract the object containing the alive cell x,y (or an anchor)")
+	marginArg := flags.Int64("margin", 0, "Also extract the cells within this many cells of the object's bounding box")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("expected an input and an output file, got %d arguments", flags.NArg())
+	}
+	if *componentAtArg == "" {
+		return fmt.Errorf("missing -component-at")
+	}
+	if *marginArg < 0 {
+		return fmt.Errorf("invalid -margin %d, must not be negative", *marginArg)
+	}
+	at, err := anchorsArg.resolve(*componentAtArg)
+	if err != nil {
+		return fmt.Errorf("invalid -component-at: %v", err)
+	}
+	input, output := flags.Arg(0), flags.Arg(1)
+	inputFormat, found := formatForFile(input)
+	if !found {
+		return fmt.Errorf("unknown format of %s", input)
+	}
+	outputFormat, found := formatForFile(output)
+	if !found {
+		return fmt.Errorf("unknown format of %s", output)
+	}
+
+	pattern, err := readPatternFile(input, inputFormat, nil)
+	if err != nil {
+		return fmt.Errorf("parsing %s failed: %v", input, err)
+	}
+	component, found := pattern.cells.componentAt(at, objectGap)
+	if !found {
+		return fmt.Errorf("no alive cell at %d,%d", at.x, at.y)
+	}
+	if *marginArg > 0 {
+		min, max, _ := component.boundingBox()
+		around := Rect{min.x, min.y, max.x - min.x + 1, max.y - min.y + 1}.grown(*marginArg)
+		for cell := range pattern.cells {
+			if around.contains(cell) {
+				component.addCell(cell)
+			}
+		}
+	}
+
+	file, err := createOutput(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := outputFormat.write(file, Pattern{cells: component, rule: pattern.rule}); err != nil {
+		return fmt.Errorf("writing %s failed: %v", output, err)
+	}
+	logger(logTools).Info("Extracted the object", "cells", len(component), "of", len(pattern.cells))
+	return file.Close()
+}
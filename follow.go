@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseFollow parses -follow: "dx,dy/period" for a universe that moves by
+// dx,dy every period generations, such as "1,1/4" for a glider, or "auto"
+// for whatever motion the run turns out to have, given as a zero period.
+func parseFollow(s string) (motion, error) {
+	if s == "auto" {
+		return motion{}, nil
+	}
+	displacement, period, found := strings.Cut(s, "/")
+	if !found {
+		return motion{}, fmt.Errorf("'%s' is neither auto nor of the form dx,dy/period", s)
+	}
+	m := motion{}
+	var err error
+	if m.period, err = strconv.Atoi(strings.TrimSpace(period)); err != nil || m.period < 1 {
+		return motion{}, fmt.Errorf("period '%s' is not a positive number of generations", period)
+	}
+	dx, dy, found := strings.Cut(displacement, ",")
+	if !found {
+		return motion{}, fmt.Errorf("displacement '%s' is not of the form dx,dy", displacement)
+	}
+	if m.dx, err = strconv.ParseInt(strings.TrimSpace(dx), 10, 64); err != nil {
+		return motion{}, fmt.Errorf("displacement '%s': %v", displacement, err)
+	}
+	if m.dy, err = strconv.ParseInt(strings.TrimSpace(dy), 10, 64); err != nil {
+		return motion{}, fmt.Errorf("displacement '%s': %v", displacement, err)
+	}
+	return m, nil
+}
+
+// follower works out how far back to move each generation so that a moving
+// universe stays in place: by the displacement of its motion for every whole
+// period since start. Until the motion is known, a follower with a detector
+// watches for it and moves nothing.
+type follower struct {
+	motion   motion
+	start    int
+	started  bool
+	detector *motionDetector
+}
+
+func newFollower(m motion) *follower {
+	follower := &follower{motion: m}
+	if m.period == 0 {
+		follower.detector = newMotionDetector(maxDetectedPeriod)
+	}
+	return follower
+}
+
+func (follower *follower) see(generation int, cells Cells) {
+	if !follower.started {
+		follower.start, follower.started = generation, true
+	}
+	if follower.detector == nil {
+		return
+	}
+	if m, found := follower.detector.observe(generation, cells); found {
+		// the universe has moved on by a period since generation-period, whose
+		// period was drawn where it was
+		logger(logTools).Info("Following the motion of the universe", "generation", generation, "motion", m.String())
+		follower.motion, follower.start, follower.detector = m, generation-m.period, nil
+	}
+}
+
+// offset is how far generation is moved back.
+func (follower *follower) offset(generation int) Offset {
+	if follower.motion.period == 0 || generation < follower.start {
+		return Offset{}
+	}
+	periods := int64((generation - follower.start) / follower.motion.period)
+	return Offset{-follower.motion.dx * periods, -follower.motion.dy * periods}
+}
+
+// followSink hands the sinks that render a run each generation moved back by
+// its follower, so that videos of a spaceship stay steady and the coordinates
+// of their frames small after billions of cells of travel.
+type followSink struct {
+	follower *follower
+	sinks    []EventSink
+}
+
+func newFollowSink(m motion, sinks []EventSink) *followSink {
+	return &followSink{newFollower(m), sinks}
+}
+
+// needsEveryGeneration is true while the motion is to be detected, as well as
+// when any of the sinks needs it.
+func (sink *followSink) needsEveryGeneration() bool {
+	return sink.follower.detector != nil || needsEveryGeneration(sink.sinks)
+}
+
+func (sink *followSink) observe(event Event) error {
+	sink.follower.see(event.generation, event.cells)
+	offset := sink.follower.offset(event.generation)
+	if offset != (Offset{}) {
+		moved := Event{generation: event.generation}
+		var err error
+		if moved.cells, err = event.cells.translated(offset); err == nil {
+			if moved.born, err = event.born.translated(offset); err == nil {
+				if moved.died, err = event.died.translated(offset); err == nil {
+					moved.decay, err = event.decay.translated(offset)
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("following generation %d failed: %v", event.generation, err)
+		}
+		event = moved
+	}
+	for _, s := range sink.sinks {
+		if err := s.observe(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sink *followSink) close() error {
+	for _, s := range sink.sinks {
+		if err := s.close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// followed moves a report back by offset, into the coordinates of renders
+// that follow the run, recording how far so it can be moved back again.
+func (report *analysisReport) followed(offset Offset) {
+	if offset == (Offset{}) {
+		return
+	}
+	report.Centroid[0] += float64(offset.dx)
+	report.Centroid[1] += float64(offset.dy)
+	for i := range report.Components {
+		report.Components[i].Bounds.X += offset.dx
+		report.Components[i].Bounds.Y += offset.dy
+	}
+	report.Followed = &[2]int64{offset.dx, offset.dy}
+}
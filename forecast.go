@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// forecastSampleEvery is how often the forecast samples the universe, in
+	// generations, since the bounding box costs a pass over the cells.
+	forecastSampleEvery = 8
+	// forecastWindow is how many of the latest samples the forecast fits, so
+	// that it follows the current trend rather than the whole run's.
+	forecastWindow = 64
+	// forecastProgressEvery is how often the forecast is printed during a run.
+	forecastProgressEvery = 1000
+	// forecastZ widens the bands to about 95% under normal residuals.
+	forecastZ = 1.96
+)
+
+type forecastSample struct {
+	generation    int
+	population    int
+	width, height int64
+}
+
+// forecaster extrapolates the population and bounding box of a run to some
+// future generation by a least-squares line through the latest samples. The
+// bands are prediction intervals of the fit, assuming the recent trend goes
+// on; a pattern about to stabilize or explode will break the assumption, so
+// the forecast is a hint for whether a run is worth continuing and no more.
+type forecaster struct {
+	target  int
+	samples []forecastSample
+}
+
+func newForecaster(target int) *forecaster {
+	return &forecaster{target: target}
+}
+
+func (f *forecaster) observe(event Event) {
+	if event.generation%forecastSampleEvery != 0 {
+		return
+	}
+	sample := forecastSample{generation: event.generation, population: len(event.cells)}
+	if topLeft, bottomRight, ok := event.cells.boundingBox(); ok {
+		sample.width, sample.height = bottomRight.x-topLeft.x+1, bottomRight.y-topLeft.y+1
+	}
+	if len(f.samples) == forecastWindow {
+		f.samples = append(f.samples[:0], f.samples[1:]...)
+	}
+	f.samples = append(f.samples, sample)
+}
+
+// band is a forecast value with its prediction interval.
+type band struct {
+	value, low, high float64
+}
+
+func (b band) String() string {
+	return fmt.Sprintf("%.0f (%.0f to %.0f)", b.value, b.low, b.high)
+}
+
+// forecast fits value against the generation across the samples and
+// predicts it at the target generation. It needs three samples for a spread.
+func (f *forecaster) forecast(value func(forecastSample) float64) (band, bool) {
+	n := float64(len(f.samples))
+	if n < 3 {
+		return band{}, false
+	}
+	var sumT, sumV float64
+	for _, sample := range f.samples {
+		sumT += float64(sample.generation)
+		sumV += value(sample)
+	}
+	meanT, meanV := sumT/n, sumV/n
+	var sxx, sxy float64
+	for _, sample := range f.samples {
+		dt := float64(sample.generation) - meanT
+		sxx += dt * dt
+		sxy += dt * (value(sample) - meanV)
+	}
+	slope := sxy / sxx
+	var residuals float64
+	for _, sample := range f.samples {
+		r := value(sample) - (meanV + slope*(float64(sample.generation)-meanT))
+		residuals += r * r
+	}
+	s := math.Sqrt(residuals / (n - 2))
+	dt := float64(f.target) - meanT
+	predicted := meanV + slope*dt
+	spread := forecastZ * s * math.Sqrt(1+1/n+dt*dt/sxx)
+	// none of the values forecast can be negative
+	return band{math.Max(predicted, 0), math.Max(predicted-spread, 0), math.Max(predicted+spread, 0)}, true
+}
+
+func (f *forecaster) print(w io.Writer, prefix string) error {
+	population, ok := f.forecast(func(s forecastSample) float64 { return float64(s.population) })
+	if !ok {
+		_, err := fmt.Fprintf(w, "%sforecast for generation %d: too few generations seen\n", prefix, f.target)
+		return err
+	}
+	width, _ := f.forecast(func(s forecastSample) float64 { return float64(s.width) })
+	height, _ := f.forecast(func(s forecastSample) float64 { return float64(s.height) })
+	_, err := fmt.Fprintf(w, "%sforecast for generation %d: population %v, bounding box %v by %v\n", prefix, f.target, population, width, height)
+	return err
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Format reads and writes patterns in one file format.
+type Format struct {
+	name       string
+	extensions []string
+	// read parses a pattern, discarding cells outside region unless it is nil.
+	read  func(r io.Reader, region *Rect) (Pattern, error)
+	write func(w io.Writer, pattern Pattern) error
+	// keepsPosition is false for formats that store a pattern relative to its
+	// bounding box, so reading one back may translate the pattern.
+	keepsPosition bool
+}
+
+var formats = []Format{
+	{name: "life106", extensions: []string{".lif", ".life"}, read: parseLif, write: printPattern, keepsPosition: true},
+	// Life 1.05 files share the .lif extension and are told apart when read
+	{name: "life105", read: parseLif, write: writeLife105, keepsPosition: true},
+	{name: "rle", extensions: []string{".rle"}, read: parseRLE, write: writeRLE, keepsPosition: true},
+	{name: "cells", extensions: []string{".cells"}, read: parsePlaintext, write: writePlaintext},
+	{name: "npy", extensions: []string{".npy"}, read: parseNPY, write: writeNPY},
+	{name: "matrix", extensions: []string{".txt"}, read: parseMatrix, write: writeMatrix},
+	{name: "macrocell", extensions: []string{".mc"}, read: parseMacrocell, write: writeMacrocell, keepsPosition: true},
+	{name: "json", extensions: []string{".json"}, read: parseJSON, write: writeJSON, keepsPosition: true},
+}
+
+// formatByName looks up a format by the name given to -format.
+func formatByName(name string) (Format, error) {
+	names := make([]string, len(formats))
+	for i, format := range formats {
+		if format.name == name {
+			return format, nil
+		}
+		names[i] = format.name
+	}
+	return Format{}, fmt.Errorf("unknown format '%s', expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// sniffLength is how much of a file sniffFormat looks at.
+const sniffLength = 4096
+
+// sniffFormat recognises the format of a pattern from the start of its file:
+// the header of a Life file, the header or comments of an RLE file, the '!'
+// comments of a .cells file, the magic of a .npy file, or else rows that only
+// one format could write.
+func sniffFormat(prefix []byte) (Format, bool) {
+	if bytes.HasPrefix(prefix, []byte(NPY_MAGIC)) {
+		format, err := formatByName("npy")
+		return format, err == nil
+	}
+	lines := strings.Split(string(prefix), "\n")
+	if len(prefix) == sniffLength && len(lines) > 1 {
+		// the last line may have been cut short
+		lines = lines[:len(lines)-1]
+	}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		name := ""
+		switch {
+		case line == "":
+			continue
+		case line == FILE_HEADER:
+			name = "life106"
+		case line == LIFE105_HEADER:
+			name = "life105"
+		case strings.HasPrefix(line, MACROCELL_HEADER):
+			name = "macrocell"
+		case strings.HasPrefix(line, "{"):
+			name = "json"
+		case strings.HasPrefix(line, "#"), strings.HasPrefix(line, "x ") || strings.HasPrefix(line, "x="):
+			// Golly writes #C, #N, #O and #CXRLE comments before the header
+			name = "rle"
+		case strings.HasPrefix(line, "!"), strings.Trim(line, ".O*") == "":
+			name = "cells"
+		case strings.ContainsAny(line, " \t") && strings.Trim(line, "0123456789.eE+- \t") == "":
+			// entries of a matrix are separated by whitespace, which RLE rows
+			// have none of
+			name = "matrix"
+		case strings.Trim(line, "0123456789bo$!") == "":
+			name = "rle"
+		default:
+			return Format{}, false
+		}
+		format, err := formatByName(name)
+		return format, err == nil
+	}
+	return Format{}, false
+}
+
+// formatForFile picks the format of a file by its extension.
+func formatForFile(name string) (Format, bool) {
+	extension := strings.ToLower(filepath.Ext(withoutCodecExtension(name)))
+	for _, format := range formats {
+		for _, formatExtension := range format.extensions {
+			if extension == formatExtension {
+				return format, true
+			}
+		}
+	}
+	return Format{}, false
+}
+
+func runFormats(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing formats command, expected one of: roundtrip")
+	}
+	switch args[0] {
+	case "roundtrip":
+		return runFormatsRoundtrip(args[1:])
+	default:
+		return fmt.Errorf("unknown formats command '%s', expected one of: roundtrip", args[0])
+	}
+}
+
+// runFormatsRoundtrip converts every pattern in a directory through every
+// pair of formats and back, reporting conversions that fail or lose cells.
+func runFormatsRoundtrip(args []string) error {
+	flags := flag.NewFlagSet("formats roundtrip", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one directory of patterns, got %d arguments", flags.NArg())
+	}
+	dir := flags.Arg(0)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	files, conversions, problems := 0, 0, 0
+	for _, name := range names {
+		source, found := formatForFile(name)
+		if !found {
+			continue
+		}
+		files++
+
+		original, err := readFormatFile(filepath.Join(dir, name), source)
+		if err != nil {
+			fmt.Printf("%s: FAILED to read as %s: %v\n", name, source.name, err)
+			problems++
+			continue
+		}
+		for _, a := range formats {
+			for _, b := range formats {
+				conversions++
+				result, err := roundtrip(original, a, b)
+				if err != nil {
+					fmt.Printf("%s: FAILED %s -> %s: %v\n", name, a.name, b.name, err)
+					problems++
+					continue
+				}
+				if !result.equal(original) {
+					if (a.keepsPosition && b.keepsPosition) || !result.normalized().equal(original.normalized()) {
+						fmt.Printf("%s: LOSSY %s -> %s: %d cells in, %d cells out\n", name, a.name, b.name, len(original), len(result))
+						problems++
+					}
+				}
+			}
+		}
+	}
+
+	fmt.Printf("%d files, %d conversions, %d lossy or failing\n", files, conversions, problems)
+	if problems > 0 {
+		return fmt.Errorf("%d conversions were lossy or failed", problems)
+	}
+	return nil
+}
+
+func readFormatFile(name string, format Format) (Cells, error) {
+	pattern, err := readPatternFile(name, format, nil)
+	return pattern.cells, err
+}
+
+// readPatternFile reads a pattern from the file name, or from stdin when name
+// is "-".
+func readPatternFile(name string, format Format, region *Rect) (Pattern, error) {
+	in := os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return Pattern{}, err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	reader, err := decompressing(in, name)
+	if err != nil {
+		return Pattern{}, err
+	}
+	return format.read(reader, region)
+}
+
+// roundtrip writes and reads cells with format a, then writes and reads the
+// result with format b.
+func roundtrip(cells Cells, a, b Format) (Cells, error) {
+	pattern := Pattern{cells: cells}
+	for _, format := range []Format{a, b} {
+		var buf bytes.Buffer
+		if err := format.write(&buf, pattern); err != nil {
+			return nil, fmt.Errorf("writing %s: %v", format.name, err)
+		}
+		var err error
+		if pattern, err = format.read(&buf, nil); err != nil {
+			return nil, fmt.Errorf("reading %s: %v", format.name, err)
+		}
+	}
+	return pattern.cells, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+const (
+	// adaptiveFrameShare is how many of the cells of the last frame must
+	// change before an adaptive sampler takes the next one.
+	adaptiveFrameShare = 0.1
+	// adaptiveMaxGap is how many times -frame-every generations an adaptive
+	// sampler goes at most without a frame, so that quiet stretches still
+	// show.
+	adaptiveMaxGap = 64
+)
+
+// frameSampler picks the generations of a run that -gif and -frames-raw
+// record as frames: the first, then every every generations or, when
+// adaptive, more often the more cells change. An adaptive sampler takes a
+// frame once the cells that differ from the last one, within viewport when
+// it is given, add up to adaptiveFrameShare of its population there, but
+// never sooner than every generations after it nor later than
+// adaptiveMaxGap times that, so that a long run that settles down is shown
+// mostly where things happen. Cells that changed in each of the last two
+// generations are not counted, so that the blinkers of settled ash do not
+// keep it busy.
+type frameSampler struct {
+	every    int
+	adaptive bool
+	viewport Rect
+
+	started bool
+	// first is the generation of the first frame, last that of the last
+	// one, population its population and changed the cells that differ
+	// from it. flipped are the cells that changed the generation before.
+	first, last int
+	population  int
+	changed     Cells
+	flipped     Cells
+}
+
+// sample tells whether event is recorded as a frame.
+func (sampler *frameSampler) sample(event Event) bool {
+	if !sampler.started {
+		sampler.started, sampler.first = true, event.generation
+		sampler.take(event)
+		return true
+	}
+	if !sampler.adaptive {
+		return (event.generation-sampler.first)%sampler.every == 0
+	}
+	flipped := make(Cells, len(event.born)+len(event.died))
+	oscillating := 0
+	for _, changes := range []Cells{event.born, event.died} {
+		for cell := range changes {
+			if sampler.viewport.w > 0 && !sampler.viewport.contains(cell) {
+				continue
+			}
+			flipped.addCell(cell)
+			if sampler.changed.hasCell(cell) {
+				delete(sampler.changed, cell)
+			} else {
+				sampler.changed.addCell(cell)
+				if sampler.flipped.hasCell(cell) {
+					oscillating++
+				}
+			}
+		}
+	}
+	sampler.flipped = flipped
+
+	gap := event.generation - sampler.last
+	if gap < sampler.every {
+		return false
+	}
+	changes := len(sampler.changed) - oscillating
+	busy := changes > 0 && float64(changes) >= adaptiveFrameShare*float64(sampler.population)
+	if !busy && gap < adaptiveMaxGap*sampler.every {
+		return false
+	}
+	sampler.take(event)
+	return true
+}
+
+func (sampler *frameSampler) take(event Event) {
+	sampler.last, sampler.population, sampler.changed = event.generation, 0, make(Cells)
+	for cell := range event.cells {
+		if sampler.viewport.w == 0 || sampler.viewport.contains(cell) {
+			sampler.population++
+		}
+	}
+}
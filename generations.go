@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Decay holds the decaying cells of a universe under a Generations rule,
+// each with its state: 2 for a cell that was alive the generation before, up
+// to one less than the number of states of the rule.
+type Decay map[Cell]uint8
+
+func (decay Decay) translated(offset Offset) (Decay, error) {
+	if len(decay) == 0 {
+		return decay, nil
+	}
+	translated := make(Decay, len(decay))
+	for cell, state := range decay {
+		moved, ok := cell.offset(offset)
+		if !ok {
+			return nil, fmt.Errorf("cell %d,%d moved by %d,%d overflows", cell.x, cell.y, offset.dx, offset.dy)
+		}
+		translated[moved] = state
+	}
+	return translated, nil
+}
+
+// cells are the decaying cells, whatever their states.
+func (decay Decay) cells() Cells {
+	cells := make(Cells, len(decay))
+	for cell := range decay {
+		cells.addCell(cell)
+	}
+	return cells
+}
+
+// generationsEngine advances a universe under a rule of the Generations
+// family. The alive cells are the universe as for any other engine, and the
+// decaying cells, which are neither alive nor able to be born, are kept
+// aside in decay.
+type generationsEngine struct {
+	rule        Rule
+	reflected   Neighborhood
+	weights     []uint8
+	constraints constraints
+	counts      map[Cell]uint8
+	decay       Decay
+}
+
+func newGenerationsEngine(rule Rule, neighborhood Neighborhood, constraints constraints, decay Decay) *generationsEngine {
+	neighborhood = rule.countedOver(neighborhood)
+	reflected := neighborhood.reflected()
+	engine := &generationsEngine{rule: rule, reflected: reflected, weights: rule.weights(reflected), constraints: constraints, counts: make(map[Cell]uint8), decay: make(Decay, len(decay))}
+	for cell, state := range decay {
+		if state > 1 && state < rule.states && !constraints.keepsDead(cell) {
+			engine.decay[cell] = state
+		}
+	}
+	return engine
+}
+
+// step advances cells in place. Alive cells that do not survive start to
+// decay, and decaying cells move on to the next state until they are dead.
+func (engine *generationsEngine) step(cells Cells) (Cells, Cells, Cells) {
+	clear(engine.counts)
+	for cell := range cells {
+		for i, offset := range engine.reflected {
+			if neighbor, ok := cell.offset(offset); ok {
+				engine.counts[neighbor] += engine.weights[i]
+			}
+		}
+	}
+
+	decay := make(Decay, len(engine.decay))
+	for cell, state := range engine.decay {
+		switch {
+		case !engine.constraints.allowsDeath(cell):
+			decay[cell] = state
+		case state+1 < engine.rule.states:
+			decay[cell] = state + 1
+		}
+	}
+
+	dyingCells := make(Cells)
+	for cell := range cells {
+		if engine.constraints.allowsDeath(cell) && !engine.rule.survives(engine.counts[cell]) {
+			dyingCells.addCell(cell)
+			decay[cell] = 2
+		}
+	}
+	birthedCells := make(Cells)
+	for cell, aliveNeighbors := range engine.counts {
+		if _, decaying := engine.decay[cell]; !decaying && !cells.hasCell(cell) && engine.rule.births(aliveNeighbors) && engine.constraints.allowsBirth(cell) {
+			birthedCells.addCell(cell)
+		}
+	}
+
+	for cell := range dyingCells {
+		cells.removeCell(cell)
+	}
+	for cell := range birthedCells {
+		cells.addCell(cell)
+	}
+	engine.decay = decay
+	return cells, birthedCells, dyingCells
+}
+
+// rleState is the RLE symbol of a state of a multi-state pattern: '.' for
+// dead, 'A' for alive, 'B' to 'X' for the states after that, and pairs from
+// "pA" on for states above 24.
+func rleState(state uint8) string {
+	switch {
+	case state == 0:
+		return "."
+	case state <= 24:
+		return string(rune('A' + state - 1))
+	default:
+		return string([]byte{byte('p' + (state-25)/24), byte('A' + (state-25)%24)})
+	}
+}
+
+// writeMultistateRLEBody writes the alive and decaying cells as multi-state
+// RLE rows, as Golly writes patterns of Generations rules.
+func writeMultistateRLEBody(w io.Writer, cells Cells, decay Decay) error {
+	all := cells.clone()
+	for cell := range decay {
+		all.addCell(cell)
+	}
+	state := func(cell Cell) uint8 {
+		if cells.hasCell(cell) {
+			return 1
+		}
+		return decay[cell]
+	}
+
+	encoder := rleEncoder{w: bufio.NewWriter(w)}
+	min, max, ok := all.boundingBox()
+	if ok {
+		pendingRows := int64(0)
+		for y := min.y; y <= max.y; y++ {
+			runState, run := uint8(0), int64(0)
+			rowStarted := false
+			for x := min.x; x <= max.x; x++ {
+				next := state(Cell{x, y})
+				if next != 0 && !rowStarted {
+					encoder.run(pendingRows, '$')
+					pendingRows, rowStarted = 0, true
+				}
+				if next != runState {
+					encoder.runOf(run, rleState(runState))
+					runState, run = next, 0
+				}
+				run++
+			}
+			// trailing dead cells of a row are implied by the '$' that ends it
+			if runState != 0 {
+				encoder.runOf(run, rleState(runState))
+			}
+			pendingRows++
+		}
+	}
+	encoder.item("!")
+	encoder.item("\n")
+	return encoder.w.Flush()
+}
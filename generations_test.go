@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestGenerationsStep checks that cells of Generations rules decay through
+// their states, and that decaying cells are not born again until dead.
+func TestGenerationsStep(t *testing.T) {
+	tests := []struct {
+		name, rule, rle string
+		steps           int
+		want            string
+	}{
+		// the decaying cell on top keeps the one under it from being born
+		{"brian's brain", "B2/S/C3", ".AB$A2.A!", 1, "AB$B2AB!"},
+		{"decaying", "B3/S/C4", "A!", 2, "C!"},
+		{"dead", "B3/S/C4", "A!", 3, "!"},
+		{"surviving", "B3/S012345678/C3", "A!", 5, "A!"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule, err := parseRule(test.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pattern, err := parseRLE(strings.NewReader("x = 0, y = 0, rule = "+test.rule+"\n"+test.rle+"\n"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			engine := newGenerationsEngine(rule, mooreNeighborhood, constraints{}, pattern.decay)
+			cells := pattern.cells
+			for i := 0; i < test.steps; i++ {
+				cells, _, _ = engine.step(cells)
+			}
+			var b bytes.Buffer
+			if err := writeMultistateRLEBody(&b, cells, engine.decay); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(b.String()); got != test.want {
+				t.Errorf("%s after %d steps is %s, not %s", test.rle, test.steps, got, test.want)
+			}
+		})
+	}
+}
+
+// TestRLEState checks the symbols of the states of multi-state RLE, as
+// Golly writes them.
+func TestRLEState(t *testing.T) {
+	for state, want := range map[uint8]string{0: ".", 1: "A", 2: "B", 24: "X", 25: "pA", 48: "pX", 49: "qA", 255: "yO"} {
+		if got := rleState(state); got != want {
+			t.Errorf("state %d is written %s, not %s", state, got, want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"runtime"
+	"sync"
+)
+
+const (
+	// gifFrameDelay is how long each frame of a GIF is shown, in hundredths
+	// of a second.
+	gifFrameDelay = 5
+	// gifHeaderSize is the size of the header of a GIF with no global color
+	// table, as image/gif writes one: the signature and the logical screen
+	// descriptor.
+	gifHeaderSize = 13
+)
+
+// gifSink records the generations of a run sampler picks and encodes them as
+// an animated GIF. All frames share one viewport: that of view, or else the
+// bounding box of every recorded generation. Each frame has the annotations
+// shown at its generation drawn over it, and the decaying cells of a
+// Generations rule in decayColor. A viewport too large to draw a cell per
+// pixel is drawn as densities instead, see renderDensity.
+//
+// Frames are drawn and compressed by several encoders, each into a GIF of
+// its own from which the frame is cut and put in its place in the
+// animation. With a viewport given, the frames are queued to the encoders
+// as the run goes, the run only waiting for them once the queue is full;
+// otherwise the viewport is only known at the end, and they are encoded
+// then.
+type gifSink struct {
+	w           io.Writer
+	sampler     frameSampler
+	view        viewTransform
+	annotations []annotation
+	frames      []*gifFrame
+
+	queue   chan *gifFrame
+	encoded sync.WaitGroup
+	// err is the first error of an encoder.
+	mu  sync.Mutex
+	err error
+}
+
+// gifFrame is a recorded generation, until it is encoded.
+type gifFrame struct {
+	generation int
+	cells      Cells
+	decay      Decay
+	// encoded is the frame as image/gif writes it into an animation: its
+	// graphic control extension, image descriptor, color table and data.
+	encoded []byte
+}
+
+func newGIFSink(w io.Writer, sampler frameSampler, view viewTransform, annotations []annotation) *gifSink {
+	sampler.viewport = view.viewport
+	sink := &gifSink{w: w, sampler: sampler, view: view, annotations: annotations}
+	if view.viewport.w > 0 {
+		sink.start(view)
+	}
+	return sink
+}
+
+// start runs the encoders of frames in view.
+func (sink *gifSink) start(view viewTransform) {
+	workers := runtime.GOMAXPROCS(0)
+	sink.queue = make(chan *gifFrame, 2*workers)
+	for i := 0; i < workers; i++ {
+		sink.encoded.Add(1)
+		go func() {
+			defer sink.encoded.Done()
+			for frame := range sink.queue {
+				if err := sink.encode(view, frame); err != nil {
+					sink.mu.Lock()
+					if sink.err == nil {
+						sink.err = err
+					}
+					sink.mu.Unlock()
+				}
+			}
+		}()
+	}
+}
+
+// needsEveryGeneration is true since skipping ahead could jump over the
+// generations to record.
+func (sink *gifSink) needsEveryGeneration() bool {
+	return true
+}
+
+func (sink *gifSink) observe(event Event) error {
+	if !sink.sampler.sample(event) {
+		return nil
+	}
+	// only the cells in the viewport are kept, when it is known up front
+	frame := &gifFrame{generation: event.generation, cells: make(Cells)}
+	for cell := range event.cells {
+		if sink.view.viewport.w == 0 || sink.view.viewport.contains(cell) {
+			frame.cells.addCell(cell)
+		}
+	}
+	for cell, state := range event.decay {
+		if sink.view.viewport.w == 0 || sink.view.viewport.contains(cell) {
+			if frame.decay == nil {
+				frame.decay = make(Decay)
+			}
+			frame.decay[cell] = state
+		}
+	}
+	sink.frames = append(sink.frames, frame)
+	if sink.queue != nil {
+		sink.queue <- frame
+	}
+	return nil
+}
+
+func (sink *gifSink) close() error {
+	view := sink.view
+	view.viewport = sink.bounds()
+	width, height, err := view.size()
+	if err != nil {
+		var block int64
+		block, width, height = densityView(view)
+		logDensity(view, block)
+	}
+	if sink.queue == nil {
+		sink.start(view)
+		for _, frame := range sink.frames {
+			sink.queue <- frame
+		}
+	}
+	close(sink.queue)
+	sink.encoded.Wait()
+	if sink.err != nil {
+		return sink.err
+	}
+	if len(sink.frames) == 0 {
+		return fmt.Errorf("no generations were recorded")
+	}
+
+	// the header and looping extension image/gif writes for an animation
+	w := bufio.NewWriter(sink.w)
+	header := []byte("GIF89a")
+	header = binary.LittleEndian.AppendUint16(header, uint16(width))
+	header = binary.LittleEndian.AppendUint16(header, uint16(height))
+	header = append(header, 0, 0, 0)
+	if len(sink.frames) > 1 {
+		header = append(header, 0x21, 0xff, 0x0b)
+		header = append(header, "NETSCAPE2.0"...)
+		header = append(header, 0x03, 0x01, 0x00, 0x00, 0x00)
+	}
+	w.Write(header)
+	for _, frame := range sink.frames {
+		w.Write(frame.encoded)
+	}
+	w.WriteByte(0x3b)
+	return w.Flush()
+}
+
+// encode draws frame in view and compresses it into frame.encoded, letting go
+// of its cells.
+func (sink *gifSink) encode(view viewTransform, frame *gifFrame) error {
+	img := sink.draw(view, frame)
+	var encoded bytes.Buffer
+	if err := gif.EncodeAll(&encoded, &gif.GIF{Image: []*image.Paletted{img}, Delay: []int{gifFrameDelay}}); err != nil {
+		return err
+	}
+	// without the header and trailer of a GIF of its own
+	frame.encoded = encoded.Bytes()[gifHeaderSize : encoded.Len()-1]
+	frame.cells, frame.decay = nil, nil
+	return nil
+}
+
+// draw draws frame in view, or the density of its cells when view is too
+// large for a cell per pixel.
+func (sink *gifSink) draw(view viewTransform, frame *gifFrame) *image.Paletted {
+	width, height, err := view.size()
+	if err != nil {
+		return renderDensity(frame.cells, view)
+	}
+	palette := color.Palette{deadColor, aliveColor}
+	if len(sink.annotations) > 0 {
+		palette = append(palette, annotationColor)
+	}
+	if len(frame.decay) > 0 {
+		palette = append(palette, decayColor)
+	}
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	if len(frame.decay) > 0 {
+		view.paint(img, frame.decay.cells(), uint8(len(palette)-1))
+	}
+	view.paint(img, frame.cells, 1)
+	paintAnnotations(img, view, sink.annotations, frame.generation)
+	return img
+}
+
+// bounds is the viewport of the animation: the given one, or the bounding box
+// of every frame with a border of one cell.
+func (sink *gifSink) bounds() Rect {
+	if sink.view.viewport.w > 0 {
+		return sink.view.viewport
+	}
+	var topLeft, bottomRight Cell
+	found := false
+	for _, frame := range sink.frames {
+		for cell := range union(frame.cells, frame.decay.cells()) {
+			if !found {
+				topLeft, bottomRight, found = cell, cell, true
+				continue
+			}
+			topLeft.x, bottomRight.x = minInt64(topLeft.x, cell.x), maxInt64(bottomRight.x, cell.x)
+			topLeft.y, bottomRight.y = minInt64(topLeft.y, cell.y), maxInt64(bottomRight.y, cell.y)
+		}
+	}
+	if !found {
+		return Rect{0, 0, 1, 1}
+	}
+	return Rect{topLeft.x, topLeft.y, bottomRight.x - topLeft.x + 1, bottomRight.y - topLeft.y + 1}.grown(1)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// TestGIFEncoders checks that the frames the encoders stitch together make
+// the GIF image/gif writes for them in one go, with and without a viewport
+// given up front.
+func TestGIFEncoders(t *testing.T) {
+	pattern, err := readPreset("glider", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, viewport := range []Rect{{}, {-2, -2, 12, 12}} {
+		var frames []Cells
+		var got bytes.Buffer
+		sink := newGIFSink(&got, frameSampler{every: 1}, viewTransform{cellSize: 2, viewport: viewport}, nil)
+		cells := pattern.cells
+		engine := newNaiveEngine(conwayRule, mooreNeighborhood, constraints{})
+		for generation := 0; generation < 12; generation++ {
+			if err := sink.observe(Event{generation: generation, cells: cells}); err != nil {
+				t.Fatal(err)
+			}
+			frames = append(frames, cells.clone())
+			cells, _, _ = engine.step(cells.clone())
+		}
+		view := viewTransform{cellSize: 2, viewport: sink.bounds()}
+		if err := sink.close(); err != nil {
+			t.Fatal(err)
+		}
+
+		width, height, err := view.size()
+		if err != nil {
+			t.Fatal(err)
+		}
+		animation := &gif.GIF{}
+		for _, frame := range frames {
+			img := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{deadColor, aliveColor})
+			view.paint(img, frame, 1)
+			animation.Image = append(animation.Image, img)
+			animation.Delay = append(animation.Delay, gifFrameDelay)
+		}
+		var want bytes.Buffer
+		if err := gif.EncodeAll(&want, animation); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("viewport %v: the GIF differs from image/gif's", viewport)
+		}
+	}
+}
+
+// TestAdaptiveFrames checks that an adaptive sampler records every
+// generation while cells change and few while they do not, counting a
+// blinker as no change once it has blinked.
+func TestAdaptiveFrames(t *testing.T) {
+	vertical, horizontal := Cells{{10, 9}: {}, {10, 10}: {}, {10, 11}: {}}, Cells{{9, 10}: {}, {10, 10}: {}, {11, 10}: {}}
+	sampled := func(sampler frameSampler) []int {
+		var generations []int
+		cells := Cells{{0, 0}: {}, {1, 0}: {}, {0, 1}: {}, {1, 1}: {}}
+		blinker := vertical
+		for generation := 0; generation <= 200; generation++ {
+			event := Event{generation: generation, born: make(Cells), died: make(Cells)}
+			// a line eight cells a generation longer from 100 to 109
+			if generation >= 100 && generation < 110 {
+				for y := int64(0); y < 8; y++ {
+					cell := Cell{int64(generation), y}
+					cells.addCell(cell)
+					event.born.addCell(cell)
+				}
+			}
+			next := horizontal
+			if generation%2 == 0 {
+				next = vertical
+			}
+			event.born, event.died = union(event.born, next.difference(blinker)), blinker.difference(next)
+			blinker = next
+			event.cells = union(cells, blinker)
+			if sampler.sample(event) {
+				generations = append(generations, generation)
+			}
+		}
+		return generations
+	}
+	tests := []struct {
+		sampler frameSampler
+		want    []int
+	}{
+		{frameSampler{every: 50}, []int{0, 50, 100, 150, 200}},
+		{frameSampler{every: 1, adaptive: true}, []int{0, 1, 65, 100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 173}},
+		{frameSampler{every: 2, adaptive: true}, []int{0, 100, 102, 104, 106, 108, 110}},
+	}
+	for _, test := range tests {
+		if got := sampled(test.sampler); fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("every %d, adaptive %v: sampled %v, not %v", test.sampler.every, test.sampler.adaptive, got, test.want)
+		}
+	}
+}
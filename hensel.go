@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A configuration is the arrangement of the alive cells among the Moore
+// neighbors of a cell, a bit per neighbor in rows from the top-left,
+// skipping the cell itself:
+//
+//	0 1 2
+//	3 . 4
+//	5 6 7
+type configuration = uint8
+
+// configurationBit is the bit of a configuration for the neighbor at offset.
+func configurationBit(offset Offset) configuration {
+	index := (offset.dy+1)*3 + (offset.dx + 1)
+	if index > 4 {
+		index--
+	}
+	return 1 << index
+}
+
+// henselLetters are the letters Hensel's notation names the arrangements of
+// each number of alive neighbors by, in the order Golly lists them. Counts
+// above 4 use the letters of their complements, and 0 and 8 have none.
+var henselLetters = [5]string{1: "ce", 2: "ceaikn", 3: "ceaiknjqry", 4: "ceaiknjqrtwyz"}
+
+// henselPictures draw an arrangement of each letter, rows separated by '/'
+// with the cell itself in the middle; the others are its rotations and
+// reflections.
+var henselPictures = [5][]string{
+	1: {"o../.../...", ".o./.../..."},
+	2: {"o.o/.../...", ".o./o../...", "oo./.../...", ".../o.o/...", "o../..o/...", "..o/.../o.."},
+	3: {"o.o/.../o..", ".o./o.o/...", "oo./o../...", "ooo/.../...", ".o./..o/o..",
+		"o.o/o../...", ".oo/o../...", ".oo/.../o..", "o../o.o/...", "o../..o/o.."},
+	4: {"o.o/.../o.o", ".o./o.o/.o.", "ooo/o../...", "o.o/o.o/...", "oo./..o/o..", "oo./o.o/...",
+		"ooo/.../o..", "oo./o../..o", ".o./o.o/o..", "ooo/.../.o.", "oo./..o/..o", "o.o/..o/o..", "oo./.../.oo"},
+}
+
+// henselClasses gives every configuration its number of alive neighbors and
+// letter, the letter being 0 for 0 and 8 neighbors.
+var henselClasses = classifyConfigurations()
+
+type henselClass struct {
+	count  int
+	letter byte
+}
+
+func classifyConfigurations() [256]henselClass {
+	var classes [256]henselClass
+	for count := 1; count <= 4; count++ {
+		for i, picture := range henselPictures[count] {
+			letter := henselLetters[count][i]
+			for _, config := range symmetries(parsePicture(picture)) {
+				classes[config] = henselClass{count, letter}
+				if count < 4 {
+					classes[^config] = henselClass{8 - count, letter}
+				}
+			}
+		}
+	}
+	classes[0], classes[0xff] = henselClass{0, 0}, henselClass{8, 0}
+	return classes
+}
+
+func parsePicture(picture string) configuration {
+	config := configuration(0)
+	for dy, row := range strings.Split(picture, "/") {
+		for dx, c := range row {
+			if c == 'o' {
+				config |= configurationBit(Offset{int64(dx - 1), int64(dy - 1)})
+			}
+		}
+	}
+	return config
+}
+
+// symmetries returns config under each rotation and reflection of the grid.
+func symmetries(config configuration) []configuration {
+	var all []configuration
+	for _, reflect := range []bool{false, true} {
+		for turns := 0; turns < 4; turns++ {
+			moved := configuration(0)
+			for _, offset := range mooreNeighborhood {
+				if config&configurationBit(offset) == 0 {
+					continue
+				}
+				dx, dy := offset.dx, offset.dy
+				if reflect {
+					dx = -dx
+				}
+				for t := 0; t < turns; t++ {
+					dx, dy = -dy, dx
+				}
+				moved |= configurationBit(Offset{dx, dy})
+			}
+			all = append(all, moved)
+		}
+	}
+	return all
+}
+
+// configurations is a set of configurations.
+type configurations [4]uint64
+
+func (set *configurations) add(config configuration) {
+	set[config/64] |= 1 << (config % 64)
+}
+
+func (set configurations) has(config configuration) bool {
+	return set[config/64]&(1<<(config%64)) != 0
+}
+
+// parseHensel parses the counts of one half of an isotropic rule, such as
+// "2-a3" or "12ce", into the configurations they stand for: a digit alone
+// is every arrangement of that many neighbors, a digit and letters only
+// those arrangements, and a digit, '-' and letters all but those.
+func parseHensel(s string) (configurations, error) {
+	var set configurations
+	s = strings.ToLower(s)
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < '0' || c > '8' {
+			return configurations{}, fmt.Errorf("unexpected neighbor count '%c'", c)
+		}
+		count := int(c - '0')
+		i++
+		negated := i < len(s) && s[i] == '-'
+		if negated {
+			i++
+		}
+		start := i
+		for i < len(s) && s[i] >= 'a' && s[i] <= 'z' {
+			i++
+		}
+		letters := s[start:i]
+		if negated && letters == "" {
+			return configurations{}, fmt.Errorf("'%d-' excludes no arrangements", count)
+		}
+		for _, letter := range letters {
+			if !strings.ContainsRune(henselLetters[min(count, 8-count)], letter) {
+				return configurations{}, fmt.Errorf("%d neighbors have no arrangement '%c'", count, letter)
+			}
+		}
+		for config := 0; config < len(henselClasses); config++ {
+			class := henselClasses[config]
+			if class.count != count {
+				continue
+			}
+			listed := strings.IndexByte(letters, class.letter) >= 0
+			if letters == "" || listed != negated {
+				set.add(configuration(config))
+			}
+		}
+	}
+	return set, nil
+}
+
+// henselString formats a set of configurations in Hensel notation, listing
+// for each count the fewer of the letters it has and the letters it lacks.
+func henselString(set configurations) string {
+	var b strings.Builder
+	for count := 0; count <= 8; count++ {
+		letters := henselLetters[min(count, 8-count)]
+		var has, lacks strings.Builder
+		for i := 0; i < len(letters); i++ {
+			if set.hasClass(count, letters[i]) {
+				has.WriteByte(letters[i])
+			} else {
+				lacks.WriteByte(letters[i])
+			}
+		}
+		switch {
+		case count == 0 || count == 8:
+			if set.hasClass(count, 0) {
+				b.WriteByte(byte('0' + count))
+			}
+		case lacks.Len() == 0:
+			b.WriteByte(byte('0' + count))
+		case has.Len() == 0:
+		case has.Len() <= lacks.Len():
+			fmt.Fprintf(&b, "%d%s", count, has.String())
+		default:
+			fmt.Fprintf(&b, "%d-%s", count, lacks.String())
+		}
+	}
+	return b.String()
+}
+
+// hasClass reports whether the set has the arrangements of count neighbors
+// with letter, which are all in it or all not.
+func (set configurations) hasClass(count int, letter byte) bool {
+	for config := 0; config < len(henselClasses); config++ {
+		if henselClasses[config] == (henselClass{count, letter}) {
+			return set.has(configuration(config))
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package main
+
+import "testing"
+
+// TestHenselRoundTrip checks that Hensel notation parses into the
+// arrangements it names and formats back the way it is written, letters
+// being listed or excluded whichever is shorter.
+func TestHenselRoundTrip(t *testing.T) {
+	tests := []struct {
+		counts         string
+		configurations int
+		formatted      string
+	}{
+		{"2-a3", 20 + 56, "2-a3"},
+		{"12ce", 8 + 8, "12ce"},
+		{"1ce", 8, "1"},
+		{"2ceikn", 20, "2-a"},
+		{"3-jqry4w", 28 + 4, "3-jqry4w"},
+		{"3ceaikn", 28, "3-jqry"},
+		{"08", 2, "08"},
+		{"6-ak", 28 - 8 - 8, "6-ak"},
+		{"", 0, ""},
+	}
+	for _, test := range tests {
+		set, err := parseHensel(test.counts)
+		if err != nil {
+			t.Errorf("parsing %q failed: %v", test.counts, err)
+			continue
+		}
+		found := 0
+		for config := 0; config < 256; config++ {
+			if set.has(configuration(config)) {
+				found++
+			}
+		}
+		if found != test.configurations {
+			t.Errorf("%q has %d arrangements, not %d", test.counts, found, test.configurations)
+		}
+		if formatted := henselString(set); formatted != test.formatted {
+			t.Errorf("%q formatted as %q, not %q", test.counts, formatted, test.formatted)
+		}
+	}
+
+	for _, counts := range []string{"2-", "1a", "9", "4x", "c"} {
+		if _, err := parseHensel(counts); err == nil {
+			t.Errorf("parsed %q without an error", counts)
+		}
+	}
+}
+
+// TestHenselClasses checks that every configuration is classified, with as
+// many arrangements of each count as there are ways to pick the neighbors.
+func TestHenselClasses(t *testing.T) {
+	ways := [9]int{1, 8, 28, 56, 70, 56, 28, 8, 1}
+	var counts [9]int
+	for config, class := range henselClasses {
+		counts[class.count]++
+		if alive := bitCount(configuration(config)); alive != class.count {
+			t.Errorf("configuration %08b classified with %d neighbors, not %d", config, class.count, alive)
+		}
+	}
+	if counts != ways {
+		t.Errorf("classes have %v arrangements, not %v", counts, ways)
+	}
+}
+
+func bitCount(config configuration) int {
+	n := 0
+	for ; config != 0; config &= config - 1 {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	HISTORY_HEADER = "#Life History 1.0"
+)
+
+// historyWriter records a run for replay, storing full keyframes at some
+// generations and deltas in between. The format extends the delta stream:
+//
+//	#Life History 1.0
+//	#R B3/S23
+//	#K 0
+//	0 -1
+//	1 0
+//	#G 1
+//	-0 -1
+//	+1 1
+//
+// Each "#K n" line starts a keyframe of generation n, followed by one "x y"
+// line per alive cell, and each "#G n" line starts a delta as in the delta
+// stream. Keyframes are taken at exponentially spaced generations after the
+// start, so a long quiet run stores few of them, and additionally whenever the
+// deltas since the last keyframe add up to more than budget times the
+// population, so that rebuilding any generation replays at most that many
+// changes on top of one keyframe.
+type historyWriter struct {
+	w      *bufio.Writer
+	budget float64
+
+	started bool
+	start   int
+	// nextKeyframe is the number of generations after start of the next
+	// scheduled keyframe, doubling each time.
+	nextKeyframe int
+	// changes is the number of cells born or died since the last keyframe.
+	changes int
+}
+
+func newHistoryWriter(w io.Writer, rule Rule, budget float64) (*historyWriter, error) {
+	history := &historyWriter{w: bufio.NewWriter(w), budget: budget, nextKeyframe: 1}
+	if _, err := fmt.Fprintf(history.w, "%s\n#R %s\n", HISTORY_HEADER, rule); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func (history *historyWriter) observe(event Event) error {
+	if err := history.write(event); err != nil {
+		return fmt.Errorf("writing history failed: %v", err)
+	}
+	return nil
+}
+
+func (history *historyWriter) write(event Event) error {
+	changes := len(event.born) + len(event.died)
+	keyframe := !history.started
+	if history.started {
+		// the schedule is kept when the budget forces a keyframe in between
+		for event.generation-history.start >= history.nextKeyframe {
+			history.nextKeyframe *= 2
+			keyframe = true
+		}
+		if float64(history.changes+changes) > history.budget*float64(max(len(event.cells), 1)) {
+			keyframe = true
+		}
+	} else {
+		history.started = true
+		history.start = event.generation
+	}
+
+	if !keyframe {
+		history.changes += changes
+		if _, err := fmt.Fprintf(history.w, "#G %d\n", event.generation); err != nil {
+			return err
+		}
+		for cell := range event.born {
+			if _, err := fmt.Fprintf(history.w, "+%d %d\n", cell.x, cell.y); err != nil {
+				return err
+			}
+		}
+		for cell := range event.died {
+			if _, err := fmt.Fprintf(history.w, "-%d %d\n", cell.x, cell.y); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	history.changes = 0
+	if _, err := fmt.Fprintf(history.w, "#K %d\n", event.generation); err != nil {
+		return err
+	}
+	for cell := range event.cells {
+		if _, err := fmt.Fprintf(history.w, "%d %d\n", cell.x, cell.y); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (history *historyWriter) close() error {
+	return history.flush()
+}
+
+func (history *historyWriter) flush() error {
+	if err := history.w.Flush(); err != nil {
+		return fmt.Errorf("writing history failed: %v", err)
+	}
+	return nil
+}
+
+func (history *historyWriter) needsEveryGeneration() bool {
+	return true
+}
+
+// historyKeyframe is where a keyframe starts in a history file.
+type historyKeyframe struct {
+	generation int
+	offset     int64
+}
+
+// historyReader rebuilds generations of a recorded run. Opening a history only
+// indexes its keyframes; rebuilding a generation then reads from the keyframe
+// before it.
+type historyReader struct {
+	// open reads the plain contents of the history from offset on.
+	open      func(offset int64) (io.Reader, error)
+	rule      string
+	keyframes []historyKeyframe
+	// first and last are the range of generations recorded.
+	first, last int
+}
+
+// openHistoryFile opens a history file, which may be compressed. A plain
+// history is replayed by seeking to its keyframes. A compressed one cannot
+// be seeked in, so it is decompressed from the start again for each replay,
+// skipping to the keyframe; either way only a keyframe and its deltas are
+// held in memory.
+func openHistoryFile(file *os.File) (*historyReader, error) {
+	prefix := make([]byte, len(HISTORY_HEADER))
+	n, _ := io.ReadFull(file, prefix)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if string(prefix[:n]) == HISTORY_HEADER {
+		return openHistory(func(offset int64) (io.Reader, error) {
+			_, err := file.Seek(offset, io.SeekStart)
+			return file, err
+		})
+	}
+	return openHistory(func(offset int64) (io.Reader, error) {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		reader, err := decompressingFrom(file, HISTORY_HEADER)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+			return nil, fmt.Errorf("skipping to the keyframe failed: %v", err)
+		}
+		return reader, nil
+	})
+}
+
+// openHistory indexes the keyframes of the history open reads.
+func openHistory(open func(offset int64) (io.Reader, error)) (*historyReader, error) {
+	history := &historyReader{open: open}
+	file, err := open(0)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+	offset := int64(0)
+	lineNumber := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+		lineNumber++
+		start := offset
+		offset += int64(len(line))
+		line = strings.TrimRight(line, "\r\n")
+
+		if lineNumber == 1 {
+			if line != HISTORY_HEADER {
+				return nil, fmt.Errorf("expected header '%s', got '%s'", HISTORY_HEADER, line)
+			}
+			continue
+		}
+		if rule, found := strings.CutPrefix(line, "#R "); found {
+			history.rule = strings.TrimSpace(rule)
+			continue
+		}
+		generation, keyframe, ok, err := parseHistoryMarker(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		if !ok {
+			continue
+		}
+		if keyframe {
+			history.keyframes = append(history.keyframes, historyKeyframe{generation, start})
+			if len(history.keyframes) == 1 {
+				history.first = generation
+			}
+		} else if len(history.keyframes) == 0 {
+			return nil, fmt.Errorf("line %d: delta before the first keyframe", lineNumber)
+		}
+		history.last = generation
+	}
+	if len(history.keyframes) == 0 {
+		return nil, fmt.Errorf("no keyframes recorded")
+	}
+	return history, nil
+}
+
+// parseHistoryMarker parses a "#K n" or "#G n" line, reporting ok as false for
+// any other line.
+func parseHistoryMarker(line string) (generation int, keyframe bool, ok bool, err error) {
+	var rest string
+	if rest, keyframe = strings.CutPrefix(line, "#K "); !keyframe {
+		if rest, ok = strings.CutPrefix(line, "#G "); !ok {
+			return 0, false, false, nil
+		}
+	}
+	generation, err = strconv.Atoi(strings.TrimSpace(rest))
+	if err != nil {
+		return 0, false, false, fmt.Errorf("invalid generation '%s'", rest)
+	}
+	return generation, keyframe, true, nil
+}
+
+// at rebuilds the universe of the given generation.
+func (history *historyReader) at(generation int) (Cells, error) {
+	var cells Cells
+	err := history.replay(generation, generation, func(event Event) bool {
+		cells = event.cells
+		return false
+	})
+	return cells, err
+}
+
+// replay rebuilds the generations from to to in order, handing each to
+// visit until it returns false. The born and died cells of a generation
+// stored as a keyframe are worked out from the generation before, so replay
+// starts from the keyframe before from.
+func (history *historyReader) replay(from, to int, visit func(event Event) bool) error {
+	if from < history.first || to > history.last {
+		return fmt.Errorf("generations %d to %d were not all recorded, the history covers %d to %d", from, to, history.first, history.last)
+	}
+	i := sort.Search(len(history.keyframes), func(i int) bool {
+		return history.keyframes[i].generation > max(from-1, history.first)
+	}) - 1
+	file, err := history.open(history.keyframes[i].offset)
+	if err != nil {
+		return err
+	}
+
+	var cells, previous, born, died Cells
+	generation := 0
+	inKeyframe := false
+	// finish hands the generation read so far to visit, reporting whether to
+	// go on reading
+	finish := func() bool {
+		if cells == nil || generation < from {
+			return true
+		}
+		if inKeyframe {
+			if previous == nil {
+				born, died = cells, make(Cells)
+			} else {
+				born, died = cells.difference(previous), previous.difference(cells)
+			}
+		}
+		return visit(Event{generation, cells, born, died, nil}) && generation < to
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		g, keyframe, ok, err := parseHistoryMarker(line)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if !finish() {
+				return nil
+			}
+			generation, inKeyframe = g, keyframe
+			born, died = make(Cells), make(Cells)
+			if keyframe {
+				// the generation before is only needed when it is visited too
+				if cells != nil && generation > from {
+					previous = cells
+				}
+				cells = make(Cells)
+			}
+			continue
+		}
+
+		var x, y int64
+		// keyframe cells are plain coordinates, which may start with a minus sign
+		sign := byte(0)
+		if !inKeyframe && (line[0] == '+' || line[0] == '-') {
+			sign, line = line[0], line[1:]
+		}
+		if _, err := fmt.Sscanf(line, "%d %d", &x, &y); err != nil {
+			return fmt.Errorf("invalid cell '%s'", line)
+		}
+		cell := Cell{x, y}
+		switch sign {
+		case '-':
+			cells.removeCell(cell)
+			died.addCell(cell)
+		case '+':
+			cells.addCell(cell)
+			born.addCell(cell)
+		default:
+			cells.addCell(cell)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	finish()
+	return nil
+}
+
+func runHistory(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing history command, expected one of: at, bisect")
+	}
+	switch args[0] {
+	case "at":
+		return runHistoryAt(args[1:])
+	case "bisect":
+		return runHistoryBisect(args[1:])
+	default:
+		return fmt.Errorf("unknown history command '%s', expected one of: at, bisect", args[0])
+	}
+}
+
+// runHistoryAt prints one generation of a recorded run as Life 1.06.
+func runHistoryAt(args []string) error {
+	flags := flag.NewFlagSet("history at", flag.ContinueOnError)
+	generationArg := flags.Int("generation", 0, "The generation to rebuild")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one history file, got %d arguments", flags.NArg())
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	history, err := openHistoryFile(file)
+	if err != nil {
+		return fmt.Errorf("reading history failed: %v", err)
+	}
+	cells, err := history.at(*generationArg)
+	if err != nil {
+		return err
+	}
+	return printPattern(os.Stdout, Pattern{cells: cells, generation: *generationArg, rule: history.rule})
+}
+
+// runHistoryBisect finds the first generation of a recorded run at which a
+// predicate holds, such as "population>10000". Rather than replaying the
+// whole run it binary searches the keyframes, then replays only the spans
+// either side of the last keyframe where the predicate did not hold. This
+// assumes that once the predicate holds it keeps holding, as for "when did X
+// first happen" questions; a predicate that comes and goes may be reported at
+// a later occurrence than its first, or missed, and unless the whole run was
+// replayed the answer says it rests on that assumption.
+func runHistoryBisect(args []string) error {
+	flags := flag.NewFlagSet("history bisect", flag.ContinueOnError)
+	predicateArg := flags.String("predicate", "", "The condition to find the first generation of, in the syntax of -stop, such as 'population>10000'; stable() is not supported. The search assumes that once the condition holds it keeps holding: one that comes and goes may be found late or not at all")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one history file, got %d arguments", flags.NArg())
+	}
+	if *predicateArg == "" {
+		return fmt.Errorf("missing -predicate")
+	}
+	predicate, err := parseCondition(*predicateArg)
+	if err != nil {
+		return fmt.Errorf("invalid -predicate: %v", err)
+	}
+	if needsPeriod(predicate) {
+		return fmt.Errorf("invalid -predicate: stable() cannot be bisected, a history does not record periods")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	history, err := openHistoryFile(file)
+	if err != nil {
+		return fmt.Errorf("reading history failed: %v", err)
+	}
+	generation, found, evaluated, err := history.bisect(predicate)
+	if err != nil {
+		return err
+	}
+	complete := evaluated == history.last-history.first+1
+	switch {
+	case !found && complete:
+		return fmt.Errorf("%s never holds in generations %d to %d (all %d generations evaluated)", *predicateArg, history.first, history.last, evaluated)
+	case !found:
+		return fmt.Errorf("%s holds at none of the %d generations evaluated in %d to %d, assuming that once it holds it keeps holding", *predicateArg, evaluated, history.first, history.last)
+	case generation == history.first:
+		fmt.Printf("%s holds from the first generation recorded, %d\n", *predicateArg, generation)
+	case complete:
+		fmt.Printf("%s first holds at generation %d (all %d generations evaluated)\n", *predicateArg, generation, evaluated)
+	default:
+		fmt.Printf("%s first holds at generation %d, assuming that once it holds it keeps holding (%d generations evaluated)\n", *predicateArg, generation, evaluated)
+	}
+	return nil
+}
+
+// bisect returns the first generation predicate is found to hold at, and how
+// many distinct generations it evaluated, which is all of them when the
+// answer does not rest on the predicate holding for good once it holds.
+func (history *historyReader) bisect(predicate condition) (generation int, found bool, evaluated int, err error) {
+	seen := make(map[int]bool)
+	holds := func(event Event) bool {
+		if !seen[event.generation] {
+			seen[event.generation] = true
+			evaluated++
+		}
+		return predicate.holds(runState{event.generation, len(event.cells), len(event.born), len(event.died), 0})
+	}
+	holdsAt := func(g int) (bool, error) {
+		result := false
+		err := history.replay(g, g, func(event Event) bool {
+			result = holds(event)
+			return false
+		})
+		return result, err
+	}
+
+	if result, err := holdsAt(history.first); err != nil || result {
+		return history.first, result, evaluated, err
+	}
+
+	// find the first keyframe where the predicate holds
+	var searchErr error
+	first := sort.Search(len(history.keyframes), func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		result, err := holdsAt(history.keyframes[i].generation)
+		searchErr = err
+		return result
+	})
+	if searchErr != nil {
+		return 0, false, evaluated, searchErr
+	}
+
+	// then the first generation after the keyframe before it, scanning the
+	// span before that keyframe too, in case the predicate held there and
+	// stopped again
+	from, to := history.first, history.last
+	if first > 1 {
+		from = history.keyframes[first-2].generation + 1
+	}
+	if first < len(history.keyframes) {
+		to = history.keyframes[first].generation
+	}
+	err = history.replay(from, to, func(event Event) bool {
+		if holds(event) {
+			generation, found = event.generation, true
+			return false
+		}
+		return true
+	})
+	return generation, found, evaluated, err
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// placedInput is a pattern file to load into the universe moved by offset,
+// given to -input as file@x,y (or file@anchor), or a built in pattern given to
+// -pattern the same way.
+type placedInput struct {
+	file string
+	// preset is the name of the built in pattern to load instead of a file.
+	preset string
+	offset Offset
+}
+
+// name is the file of the input, or pattern:name for a built in pattern.
+func (input placedInput) name() string {
+	if input.preset != "" {
+		return "pattern:" + input.preset
+	}
+	return input.file
+}
+
+func (input placedInput) String() string {
+	if input.offset == (Offset{}) {
+		return input.name()
+	}
+	return fmt.Sprintf("%s@%d,%d", input.name(), input.offset.dx, input.offset.dy)
+}
+
+// parsePlacedInput parses file or file@x,y. When what follows the last @ is
+// not a coordinate or anchor, the @ is taken to be part of the file name.
+func parsePlacedInput(s string, anchors Anchors) placedInput {
+	at := strings.LastIndex(s, "@")
+	if at < 0 {
+		return placedInput{file: s}
+	}
+	cell, err := anchors.resolve(s[at+1:])
+	if err != nil {
+		return placedInput{file: s}
+	}
+	return placedInput{file: s[:at], offset: Offset{cell.x, cell.y}}
+}
+
+// readInputManifest reads a manifest of the patterns to compose, one file or
+// file@x,y per line, skipping blank lines and # comments. Relative file names
+// are relative to the manifest.
+func readInputManifest(name string, anchors Anchors) ([]placedInput, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var inputs []placedInput
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		input := parsePlacedInput(line, anchors)
+		if !filepath.IsAbs(input.file) && input.file != "-" {
+			input.file = filepath.Join(filepath.Dir(name), input.file)
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, scanner.Err()
+}
+
+// readInputs reads every input and composes them into one universe, each moved
+// by its offset. The generation and rule are those of the first input, and so
+// is the format returned. Only the cells that land inside region are kept.
+// Inputs spread out over astronomically large and sparse bounding boxes are
+// warned about, and with recenter each input is moved so its median cell is
+// at the origin before its offset applies.
+func readInputs(inputs []placedInput, format *Format, region *Rect, recenter bool) (Pattern, Format, error) {
+	var composed Pattern
+	var composedFormat Format
+	for i, input := range inputs {
+		// the region is in the coordinates of the universe, not of the file
+		var shifted *Rect
+		if region != nil {
+			corner, ok := Cell{region.x, region.y}.offset(Offset{-input.offset.dx, -input.offset.dy})
+			if !ok {
+				return Pattern{}, Format{}, fmt.Errorf("%v: the region moved by the offset overflows", input)
+			}
+			shifted = &Rect{corner.x, corner.y, region.w, region.h}
+		}
+
+		var pattern Pattern
+		var err error
+		inputFormat := Format{}
+		switch {
+		case input.preset != "":
+			inputFormat, _ = formatByName("rle")
+			pattern, err = readPreset(input.preset, shifted)
+		case format != nil:
+			inputFormat = *format
+			pattern, err = readPatternFile(input.file, inputFormat, shifted)
+		default:
+			pattern, inputFormat, err = parsePatternFormat(input.file, shifted)
+		}
+		if err != nil {
+			return Pattern{}, Format{}, fmt.Errorf("%v: %v", input, err)
+		}
+		if pattern.cells, err = checkInputScale(input, pattern.cells, recenter); err != nil {
+			return Pattern{}, Format{}, fmt.Errorf("%v: %v", input, err)
+		}
+		if pattern.cells, err = pattern.cells.translated(input.offset); err != nil {
+			return Pattern{}, Format{}, fmt.Errorf("%v: %v", input, err)
+		}
+		if pattern.decay, err = pattern.decay.translated(input.offset); err != nil {
+			return Pattern{}, Format{}, fmt.Errorf("%v: %v", input, err)
+		}
+
+		if i == 0 {
+			composed, composedFormat = pattern, inputFormat
+			continue
+		}
+		for cell := range pattern.cells {
+			if composed.cells.hasCell(cell) {
+				logger(logParser).Debug("Inputs overlap", "input", input.String(), "cell", fmt.Sprintf("%d,%d", cell.x, cell.y))
+			}
+			composed.cells.addCell(cell)
+		}
+		for cell, state := range pattern.decay {
+			if composed.decay == nil {
+				composed.decay = make(Decay)
+			}
+			composed.decay[cell] = state
+		}
+	}
+	return composed, composedFormat, nil
+}
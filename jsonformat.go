@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonPattern is the JSON form of a pattern, for tools that would rather not
+// parse a Life format:
+//
+//	{
+//	  "schema": "urn:gameoflife:schema:state:1",
+//	  "generation": 4,
+//	  "rule": "B3/S23",
+//	  "name": "Glider",
+//	  "comments": ["The smallest spaceship"],
+//	  "population": 5,
+//	  "bounds": {"x": 0, "y": 0, "w": 3, "h": 3},
+//	  "cells": [[1, 0], [2, 1], [0, 2], [1, 2], [2, 2]]
+//	}
+//
+// Cells are [x, y] pairs sorted by row. The population and bounds are
+// written for the convenience of readers and ignored when reading. The
+// schema is that `schema print state` prints.
+type jsonPattern struct {
+	Schema     string      `json:"schema,omitempty"`
+	Generation int         `json:"generation"`
+	Rule       string      `json:"rule,omitempty"`
+	Name       string      `json:"name,omitempty"`
+	Author     string      `json:"author,omitempty"`
+	Comments   []string    `json:"comments,omitempty"`
+	Population int         `json:"population"`
+	Bounds     *jsonBounds `json:"bounds,omitempty"`
+	Cells      [][2]int64  `json:"cells"`
+	// Decay is the decaying cells of a Generations rule as [x, y, state].
+	Decay [][3]int64 `json:"decay,omitempty"`
+}
+
+type jsonBounds struct {
+	X int64 `json:"x"`
+	Y int64 `json:"y"`
+	W int64 `json:"w"`
+	H int64 `json:"h"`
+}
+
+func parseJSON(r io.Reader, region *Rect) (Pattern, error) {
+	var decoded jsonPattern
+	if err := json.NewDecoder(r).Decode(&decoded); err != nil {
+		return Pattern{}, err
+	}
+	if len(decoded.Rule) > maxHeaderValueLength {
+		return Pattern{}, fmt.Errorf("rule is longer than %d characters", maxHeaderValueLength)
+	}
+	if len(decoded.Cells)+len(decoded.Decay) > maxParsedCells {
+		return Pattern{}, errTooManyCells
+	}
+	var meta metadata
+	var err error
+	if meta.name, err = checkMetadataValue(decoded.Name); err != nil {
+		return Pattern{}, err
+	}
+	if meta.author, err = checkMetadataValue(decoded.Author); err != nil {
+		return Pattern{}, err
+	}
+	for _, comment := range decoded.Comments {
+		if err := meta.addComment(comment); err != nil {
+			return Pattern{}, err
+		}
+	}
+
+	pattern := Pattern{cells: make(Cells, len(decoded.Cells)), generation: decoded.Generation, rule: decoded.Rule, metadata: meta}
+	for _, pair := range decoded.Cells {
+		cell := Cell{pair[0], pair[1]}
+		if err := checkCoordinates(cell); err != nil {
+			return Pattern{}, err
+		}
+		if region == nil || region.contains(cell) {
+			pattern.cells.addCell(cell)
+		}
+	}
+	for _, triple := range decoded.Decay {
+		cell := Cell{triple[0], triple[1]}
+		if err := checkCoordinates(cell); err != nil {
+			return Pattern{}, err
+		}
+		if triple[2] < 2 || triple[2] > maxStates {
+			return Pattern{}, fmt.Errorf("decaying cell %d,%d has state %d, not between 2 and %d", cell.x, cell.y, triple[2], maxStates)
+		}
+		if region == nil || region.contains(cell) {
+			if pattern.decay == nil {
+				pattern.decay = make(Decay)
+			}
+			pattern.decay[cell] = uint8(triple[2])
+		}
+	}
+	return pattern, nil
+}
+
+func writeJSON(w io.Writer, pattern Pattern) error {
+	encoded := jsonPattern{
+		Schema:     SCHEMA_STATE,
+		Generation: pattern.generation,
+		Rule:       pattern.rule,
+		Name:       pattern.metadata.name,
+		Author:     pattern.metadata.author,
+		Comments:   pattern.metadata.comments,
+		Population: len(pattern.cells),
+		Cells:      make([][2]int64, 0, len(pattern.cells)),
+	}
+	if min, max, ok := pattern.cells.boundingBox(); ok {
+		encoded.Bounds = &jsonBounds{min.x, min.y, max.x - min.x + 1, max.y - min.y + 1}
+	}
+	for _, cell := range pattern.cells.sorted() {
+		encoded.Cells = append(encoded.Cells, [2]int64{cell.x, cell.y})
+	}
+	decaying := make(Cells, len(pattern.decay))
+	for cell := range pattern.decay {
+		decaying.addCell(cell)
+	}
+	for _, cell := range decaying.sorted() {
+		encoded.Decay = append(encoded.Decay, [3]int64{cell.x, cell.y, int64(pattern.decay[cell])})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(encoded)
+}
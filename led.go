@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	wledDefaultPort     = 21324
+	flaschenDefaultPort = 1337
+
+	// wledDNRGB is the WLED realtime protocol that addresses LEDs from a
+	// start index, so a frame can be split over several packets.
+	wledDNRGB = 4
+	// wledTimeout is how many seconds WLED keeps showing the last frame
+	// before returning to its own effects, should the run stop.
+	wledTimeout = 2
+	// wledMaxLEDsPerPacket keeps each packet below WLED's UDP buffer size.
+	wledMaxLEDsPerPacket = 489
+)
+
+// ledSink pushes a fixed viewport of the universe to a hobbyist LED display
+// once per generation. It speaks the WLED UDP realtime protocol
+// ("wled://host[:port]"), and the flaschen-taschen protocol accepted by the
+// rpi-rgb-led-matrix UDP daemon ("flaschen://host[:port]").
+type ledSink struct {
+	conn     net.Conn
+	protocol string
+
+	viewport   Rect
+	brightness float64
+	// serpentine reverses every other row, for strips wired in a zigzag.
+	serpentine bool
+
+	frameInterval time.Duration
+	lastFrame     time.Time
+}
+
+type ledOptions struct {
+	target     string
+	viewport   Rect
+	brightness float64
+	fps        float64
+	serpentine bool
+}
+
+func newLEDSink(opts ledOptions) (*ledSink, error) {
+	target, err := url.Parse(opts.target)
+	if err != nil {
+		return nil, err
+	}
+	port := target.Port()
+	switch target.Scheme {
+	case "wled":
+		if port == "" {
+			port = strconv.Itoa(wledDefaultPort)
+		}
+	case "flaschen":
+		if port == "" {
+			port = strconv.Itoa(flaschenDefaultPort)
+		}
+	default:
+		return nil, fmt.Errorf("unknown LED display '%s', expected wled://host or flaschen://host", opts.target)
+	}
+	if opts.brightness < 0 || opts.brightness > 1 {
+		return nil, fmt.Errorf("brightness %v must be between 0 and 1", opts.brightness)
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort(target.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	sink := &ledSink{
+		conn:       conn,
+		protocol:   target.Scheme,
+		viewport:   opts.viewport,
+		brightness: opts.brightness,
+		serpentine: opts.serpentine,
+	}
+	if opts.fps > 0 {
+		sink.frameInterval = time.Duration(float64(time.Second) / opts.fps)
+	}
+	return sink, nil
+}
+
+func (sink *ledSink) observe(event Event) error {
+	// pace frames so that the display updates at a steady rate however fast
+	// the generations are computed
+	if wait := sink.frameInterval - time.Since(sink.lastFrame); wait > 0 {
+		time.Sleep(wait)
+	}
+	sink.lastFrame = time.Now()
+
+	// a display that is restarting refuses frames for a moment, which should
+	// not end a long unattended run
+	if err := sink.send(sink.render(event.cells)); err != nil && !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("sending frame to LED display failed: %v", err)
+	}
+	return nil
+}
+
+func (sink *ledSink) close() error {
+	return sink.conn.Close()
+}
+
+// render returns the viewport as RGB triplets, row by row.
+func (sink *ledSink) render(cells Cells) []byte {
+	level := byte(255 * sink.brightness)
+	pixels := make([]byte, 0, 3*sink.viewport.w*sink.viewport.h)
+	for row := int64(0); row < sink.viewport.h; row++ {
+		for column := int64(0); column < sink.viewport.w; column++ {
+			x := column
+			if sink.serpentine && row%2 == 1 {
+				x = sink.viewport.w - 1 - column
+			}
+			value := byte(0)
+			if cells.hasCell(Cell{sink.viewport.x + x, sink.viewport.y + row}) {
+				value = level
+			}
+			pixels = append(pixels, value, value, value)
+		}
+	}
+	return pixels
+}
+
+func (sink *ledSink) send(pixels []byte) error {
+	if sink.protocol == "flaschen" {
+		header := fmt.Sprintf("P6\n%d %d\n255\n", sink.viewport.w, sink.viewport.h)
+		_, err := sink.conn.Write(append([]byte(header), pixels...))
+		return err
+	}
+
+	for start := 0; start < len(pixels)/3; start += wledMaxLEDsPerPacket {
+		end := min(start+wledMaxLEDsPerPacket, len(pixels)/3)
+		packet := []byte{wledDNRGB, wledTimeout, byte(start >> 8), byte(start)}
+		packet = append(packet, pixels[3*start:3*end]...)
+		if _, err := sink.conn.Write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
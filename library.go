@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	LIBRARY_HEADER = "#Life Library 1.0"
+)
+
+// libraryObject is an object learned from censuses.
+type libraryObject struct {
+	name           string
+	count          int
+	classification string
+	// form is the canonical RLE of the object, see canonicalForm.
+	form string
+}
+
+// library is a user's catalog of the settled objects their censuses have
+// found. It is stored as a tab separated file with one object per line:
+//
+//	#Life Library 1.0
+//	still-4-1	25	still life	2o$2o!
+//	p2-3-1	14	oscillator period 2	3o!
+//
+// giving the name, the number of times the object was counted, how it
+// repeats and its canonical form. Names are generated when an object is first
+// seen, and can be edited by hand afterwards.
+type library struct {
+	objects map[string]*libraryObject
+	names   map[string]bool
+}
+
+// loadLibrary reads a library, or returns an empty one when the file does not
+// exist yet.
+func loadLibrary(path string) (*library, error) {
+	lib := &library{objects: make(map[string]*libraryObject), names: make(map[string]bool)}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return lib, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: expected name, count, classification and form separated by tabs", lineNumber)
+		}
+		count, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid count '%s'", lineNumber, fields[1])
+		}
+		object := &libraryObject{fields[0], count, fields[2], fields[3]}
+		lib.objects[object.form] = object
+		lib.names[object.name] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lib, nil
+}
+
+// learn adds the counts of a census to the library, naming the settled
+// objects it has not seen before. Objects that did not repeat within the
+// census' limits are not learned. It returns the number of objects added.
+func (lib *library) learn(entries map[string]*censusEntry) int {
+	// name new objects in a stable order, so that the same census always
+	// produces the same names
+	forms := make([]string, 0, len(entries))
+	for form := range entries {
+		forms = append(forms, form)
+	}
+	sort.Strings(forms)
+
+	added := 0
+	for _, form := range forms {
+		entry := entries[form]
+		if entry.motion == nil {
+			continue
+		}
+		if object, found := lib.objects[form]; found {
+			object.count += entry.count
+			continue
+		}
+		lib.objects[form] = &libraryObject{lib.newName(entry), entry.count, entry.classification, form}
+		added++
+	}
+	return added
+}
+
+// newName names an object by its kind, period and population, such as
+// "still-4-1" or "ship-p4-5-1", numbered to be unique.
+func (lib *library) newName(entry *censusEntry) string {
+	var kind string
+	switch {
+	case entry.motion.isMoving():
+		kind = fmt.Sprintf("ship-p%d-%d", entry.motion.period, entry.population)
+	case entry.motion.period == 1:
+		kind = fmt.Sprintf("still-%d", entry.population)
+	default:
+		kind = fmt.Sprintf("p%d-%d", entry.motion.period, entry.population)
+	}
+	for n := 1; ; n++ {
+		name := fmt.Sprintf("%s-%d", kind, n)
+		if !lib.names[name] {
+			lib.names[name] = true
+			return name
+		}
+	}
+}
+
+// save writes the library with the most common objects first.
+func (lib *library) save(path string) error {
+	objects := make([]*libraryObject, 0, len(lib.objects))
+	for _, object := range lib.objects {
+		objects = append(objects, object)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].count != objects[j].count {
+			return objects[i].count > objects[j].count
+		}
+		return objects[i].name < objects[j].name
+	})
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	fmt.Fprintf(w, "%s\n", LIBRARY_HEADER)
+	for _, object := range objects {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", object.name, object.count, object.classification, object.form)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
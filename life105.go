@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	LIFE105_HEADER = "#Life 1.05"
+)
+
+// parseLif reads a .lif file, which may be in either Life 1.05 or Life 1.06
+// as both share the extension; the header line tells them apart.
+func parseLif(r io.Reader, region *Rect) (Pattern, error) {
+	reader := bufio.NewReader(r)
+	if header, _ := reader.Peek(len(LIFE105_HEADER)); string(header) == LIFE105_HEADER {
+		return parseLife105(reader, region)
+	}
+	return parseLife106(reader, region)
+}
+
+// parseLife105 reads a Life 1.05 file: blocks of rows of '.' (dead) and '*'
+// (alive) cells, each starting at the cell given by the "#P x y" line before
+// it. "#N" marks the pattern as using Conway's rule and "#R 23/3" gives
+// another rule; "#D" description lines are kept as the pattern's metadata.
+func parseLife105(r io.Reader, region *Rect) (Pattern, error) {
+	pattern := Pattern{cells: make(Cells)}
+	cells := pattern.cells
+
+	headerFound := false
+	inBlock := false
+	var x, y int64
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			switch {
+			case line == LIFE105_HEADER && lineNumber == 1:
+				headerFound = true
+			case line == "#N":
+				pattern.rule = conwayRule.String()
+			case strings.HasPrefix(line, "#R"):
+				if pattern.rule = strings.TrimSpace(line[2:]); len(pattern.rule) > maxHeaderValueLength {
+					return Pattern{}, fmt.Errorf("rule is longer than %d characters", maxHeaderValueLength)
+				}
+			case strings.HasPrefix(line, "#D"):
+				if err := pattern.metadata.parseLabelledComment(line[2:]); err != nil {
+					return Pattern{}, fmt.Errorf("line %d: %v", lineNumber, err)
+				}
+			case strings.HasPrefix(line, "#P"):
+				var err error
+				if x, y, err = parseBlockPosition(line[2:]); err != nil {
+					return Pattern{}, fmt.Errorf("invalid block position on line %d: %v", lineNumber, err)
+				}
+				inBlock = true
+			}
+			continue
+		}
+
+		if !inBlock {
+			return Pattern{}, fmt.Errorf("cells on line %d before the first #P line", lineNumber)
+		}
+		for i, c := range line {
+			switch c {
+			case '.':
+			case '*':
+				cell := Cell{x + int64(i), y}
+				if err := checkCoordinates(cell); err != nil {
+					return Pattern{}, err
+				}
+				if region == nil || region.contains(cell) {
+					if len(cells) >= maxParsedCells {
+						return Pattern{}, errTooManyCells
+					}
+					cells.addCell(cell)
+				}
+			default:
+				return Pattern{}, fmt.Errorf("unexpected character '%c' on line %d", c, lineNumber)
+			}
+		}
+		y++
+	}
+	if err := scanner.Err(); err != nil {
+		return Pattern{}, err
+	}
+
+	if !headerFound {
+		return Pattern{}, fmt.Errorf("Invalid Game of Life file: needed %s indicator as first line", LIFE105_HEADER)
+	}
+	return pattern, nil
+}
+
+// parseBlockPosition parses the "x y" of a #P line.
+func parseBlockPosition(s string) (int64, int64, error) {
+	var x, y int64
+	if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d %d", &x, &y); err != nil {
+		return 0, 0, err
+	}
+	if err := checkCoordinates(Cell{x, y}); err != nil {
+		return 0, 0, err
+	}
+	return x, y, nil
+}
+
+// writeLife105 writes a Life 1.05 file with one block per object, so that
+// the empty space between the objects of a sparse pattern is not written out
+// row by row.
+func writeLife105(w io.Writer, pattern Pattern) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\n", LIFE105_HEADER)
+	bw.WriteString(pattern.metadata.labelledComments("#D "))
+	if rule, err := parseRule(pattern.rule); pattern.rule == "" || (err == nil && rule == conwayRule) {
+		fmt.Fprintf(bw, "#N\n")
+	} else if err == nil && !rule.isLargerThanLife() && !rule.isotropic && rule.table == nil {
+		// Life 1.05 gives rules in S/B notation
+		var counts strings.Builder
+		writeCounts(&counts, rule.survival)
+		counts.WriteByte('/')
+		writeCounts(&counts, rule.birth)
+		if rule.isGenerations() {
+			fmt.Fprintf(&counts, "/%d", rule.states)
+		}
+		fmt.Fprintf(bw, "#R %s\n", counts.String())
+	} else {
+		fmt.Fprintf(bw, "#R %s\n", pattern.rule)
+	}
+
+	for _, component := range pattern.cells.components(objectGap) {
+		min, max, _ := component.boundingBox()
+		fmt.Fprintf(bw, "#P %d %d\n", min.x, min.y)
+		for y := min.y; y <= max.y; y++ {
+			// trailing dead cells of a row are left out
+			end := min.x - 1
+			for x := max.x; x >= min.x; x-- {
+				if component.hasCell(Cell{x, y}) {
+					end = x
+					break
+				}
+			}
+			row := make([]byte, 0, end-min.x+1)
+			for x := min.x; x <= end; x++ {
+				if component.hasCell(Cell{x, y}) {
+					row = append(row, '*')
+				} else {
+					row = append(row, '.')
+				}
+			}
+			if len(row) == 0 {
+				row = append(row, '.')
+			}
+			fmt.Fprintf(bw, "%s\n", row)
+		}
+	}
+	return bw.Flush()
+}
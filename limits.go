@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Limits on what the parsers accept, so that a corrupt or hostile file fails
+// with an error rather than hanging or running out of memory.
+const (
+	// maxParsedCells is the most cells a pattern may have when it is read into
+	// memory, about a couple of gigabytes of Cells.
+	maxParsedCells = 1 << 25
+	// maxRunLength is the longest RLE run; longer runs are almost certainly a
+	// corrupt count rather than a pattern.
+	maxRunLength = 1 << 32
+	// maxCoordinate bounds the coordinates of parsed cells, so that widths of
+	// bounding boxes and offsets between cells cannot overflow an int64.
+	maxCoordinate = 1 << 61
+	// maxHeaderValueLength bounds header values such as the rule.
+	maxHeaderValueLength = 256
+	// maxStates is the most states a Generations rule may have, as many as
+	// RLE can name.
+	maxStates = 255
+	// maxRuleTransitions bounds the transitions of a rule table once its
+	// bound variables and symmetries are spelled out, and the nodes of a rule
+	// tree.
+	maxRuleTransitions = 1 << 20
+	// maxComments and maxCommentLength bound the comments kept from a file.
+	maxComments      = 1 << 10
+	maxCommentLength = 1 << 12
+)
+
+// errTooManyCells is returned by parsers when a pattern exceeds maxParsedCells.
+var errTooManyCells = fmt.Errorf("pattern has more than %d cells", maxParsedCells)
+
+func checkCoordinates(cell Cell) error {
+	if cell.x < -maxCoordinate || cell.x > maxCoordinate || cell.y < -maxCoordinate || cell.y > maxCoordinate {
+		return fmt.Errorf("cell %d,%d is outside of the supported coordinates, -%d to %d", cell.x, cell.y, int64(maxCoordinate), int64(maxCoordinate))
+	}
+	return nil
+}
+
+// ParseLife106 parses a Life 1.06 file held in memory. It is the entry point
+// for fuzzing the parser.
+func ParseLife106(data []byte) (Cells, error) {
+	pattern, err := parseLife106(bytes.NewReader(data), nil)
+	return pattern.cells, err
+}
+
+// ParseRLE parses an RLE pattern held in memory. It is the entry point for
+// fuzzing the parser.
+func ParseRLE(data []byte) (Cells, error) {
+	pattern, err := parseRLE(bytes.NewReader(data), nil)
+	return pattern.cells, err
+}
+
+// ParseLife105 parses a Life 1.05 file held in memory. It is the entry point
+// for fuzzing the parser.
+func ParseLife105(data []byte) (Cells, error) {
+	pattern, err := parseLife105(bytes.NewReader(data), nil)
+	return pattern.cells, err
+}
+
+// ParseCells parses a plaintext .cells file held in memory. It is the entry
+// point for fuzzing the parser.
+func ParseCells(data []byte) (Cells, error) {
+	pattern, err := parsePlaintext(bytes.NewReader(data), nil)
+	return pattern.cells, err
+}
+
+// ParseMacrocell parses a macrocell file held in memory. It is the entry point
+// for fuzzing the parser.
+func ParseMacrocell(data []byte) (Cells, error) {
+	pattern, err := parseMacrocell(bytes.NewReader(data), nil)
+	return pattern.cells, err
+}
+
+// ParseMatrix parses a text matrix held in memory. It is the entry point for
+// fuzzing the parser.
+func ParseMatrix(data []byte) (Cells, error) {
+	pattern, err := parseMatrix(bytes.NewReader(data), nil)
+	return pattern.cells, err
+}
+
+// ParseNPY parses a .npy array held in memory. It is the entry point for
+// fuzzing the parser.
+func ParseNPY(data []byte) (Cells, error) {
+	pattern, err := parseNPY(bytes.NewReader(data), nil)
+	return pattern.cells, err
+}
+
+// ParseJSON parses a JSON pattern held in memory. It is the entry point for
+// fuzzing the parser.
+func ParseJSON(data []byte) (Cells, error) {
+	pattern, err := parseJSON(bytes.NewReader(data), nil)
+	return pattern.cells, err
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// beyondCoordinates is a coordinate past maxCoordinate.
+const beyondCoordinates = "4611686018427387904"
+
+var overlongValue = strings.Repeat("B3", maxHeaderValueLength)
+
+// npyFile is a .npy file of the given header and data.
+func npyFile(header string, data string) []byte {
+	file := []byte(NPY_MAGIC + "\x01\x00")
+	file = binary.LittleEndian.AppendUint16(file, uint16(len(header)))
+	return append(append(file, header...), data...)
+}
+
+// checkParsed fails the test when a parser accepted data it should have
+// rejected within the limits.
+func checkParsed(t *testing.T, cells Cells, err error) {
+	t.Helper()
+	if err != nil {
+		return
+	}
+	if len(cells) > maxParsedCells {
+		t.Fatalf("parsed %d cells, more than %d", len(cells), maxParsedCells)
+	}
+	for cell := range cells {
+		if err := checkCoordinates(cell); err != nil {
+			t.Fatalf("parsed a cell beyond the supported coordinates: %v", err)
+		}
+	}
+}
+
+func fuzzParser(f *testing.F, parse func([]byte) (Cells, error), seeds ...string) {
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		cells, err := parse(data)
+		checkParsed(t, cells, err)
+	})
+}
+
+func FuzzParseLife106(f *testing.F) {
+	fuzzParser(f, ParseLife106,
+		"#Life 1.06\n0 0\n1 0\n2 0\n",
+		"#Life 1.06\n"+beyondCoordinates+" 0\n",
+		"#Life 1.06\n0 -"+beyondCoordinates+"\n",
+		"#Life 1.06\n99999999999999999999 0\n",
+		"#Life 1.06\n#N "+overlongValue+"\n0 0\n")
+}
+
+func FuzzParseRLE(f *testing.F) {
+	fuzzParser(f, ParseRLE,
+		"x = 3, y = 3, rule = B3/S23\nbo$2bo$3o!\n",
+		"x = 1, y = 1\n99999999999999999999o!\n",
+		"x = 1, y = 1\n4294967297o!\n",
+		"x = 1, y = 1\n4294967296$o!\n",
+		"#CXRLE Pos="+beyondCoordinates+",0\no!\n",
+		"#CXRLE Pos=0,-"+beyondCoordinates+"\no!\n",
+		"x = 1, y = 1, rule = "+overlongValue+"\no!\n",
+		"#N "+overlongValue+"\no!\n",
+		"x = 3, y = 1, rule = B2/S/C3\nABC!\n")
+}
+
+func FuzzParseLife105(f *testing.F) {
+	fuzzParser(f, ParseLife105,
+		"#Life 1.05\n#N\n#P -1 -1\n.*.\n..*\n***\n",
+		"#Life 1.05\n#P "+beyondCoordinates+" 0\n*\n",
+		"#Life 1.05\n#P 0 -"+beyondCoordinates+"\n*\n",
+		"#Life 1.05\n#R "+overlongValue+"\n#P 0 0\n*\n",
+		"#Life 1.05\n#D "+strings.Repeat(".", maxCommentLength+1)+"\n")
+}
+
+func FuzzParseCells(f *testing.F) {
+	fuzzParser(f, ParseCells,
+		"!Name: Glider\n.O\n..O\nOOO\n",
+		"!Name: "+strings.Repeat("O", maxCommentLength+1)+"\nO\n",
+		strings.Repeat("\n", 1<<10)+"O\n")
+}
+
+func FuzzParseMacrocell(f *testing.F) {
+	fuzzParser(f, ParseMacrocell,
+		"[M2] (golly 4.2)\n#R B3/S23\n#G 0\n.*$..*$***$\n4 0 1 0 0\n",
+		"[M2]\n#R "+overlongValue+"\n*$\n",
+		"[M2]\n*$\n4 1 1 1 1\n64 2 2 2 2\n",
+		"[M2]\n********$********$********$********$********$********$********$********$\n4 1 1 1 1\n5 2 2 2 2\n6 3 3 3 3\n7 4 4 4 4\n8 5 5 5 5\n9 6 6 6 6\n10 7 7 7 7\n11 8 8 8 8\n12 9 9 9 9\n13 10 10 10 10\n14 11 11 11 11\n",
+		"[M2]\n4 9 9 9 9\n")
+}
+
+func FuzzParseMatrix(f *testing.F) {
+	fuzzParser(f, ParseMatrix,
+		"0 1 0\n0 0 1\n1 1 1\n",
+		"# comment\n1.0 0.0\n0.0 1.0\n",
+		"1 1\n1\n",
+		"2 0\n")
+}
+
+func FuzzParseNPY(f *testing.F) {
+	fuzzParser(f, ParseNPY,
+		string(npyFile("{'descr': '|u1', 'fortran_order': False, 'shape': (2, 2), }\n", "\x01\x00\x00\x01")),
+		string(npyFile("{'descr': '|u1', 'fortran_order': False, 'shape': ("+beyondCoordinates+", "+beyondCoordinates+"), }\n", "\x01")),
+		string(npyFile("{'descr': '<f8', 'fortran_order': True, 'shape': (1, 1), }\n", "\x00\x00\x00\x00\x00\x00\xf0\x3f")),
+		string(npyFile("{'descr': '"+overlongValue+"', 'fortran_order': False, 'shape': (1, 1), }\n", "\x01")),
+		NPY_MAGIC+"\x02\x00\xff\xff\xff\xff")
+}
+
+func FuzzParseJSON(f *testing.F) {
+	fuzzParser(f, ParseJSON,
+		`{"generation": 4, "rule": "B3/S23", "cells": [[1, 0], [2, 1], [0, 2], [1, 2], [2, 2]]}`,
+		`{"cells": [[`+beyondCoordinates+`, 0]]}`,
+		`{"cells": [[0, -`+beyondCoordinates+`]]}`,
+		`{"rule": "`+overlongValue+`", "cells": []}`,
+		`{"rule": "B2/S/C3", "cells": [], "decay": [[0, 0, 300]]}`)
+}
+
+// TestParserLimits checks that the parsers reject the files the limits guard
+// against.
+func TestParserLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func([]byte) (Cells, error)
+		data  string
+	}{
+		{"life106 coordinate", ParseLife106, "#Life 1.06\n" + beyondCoordinates + " 0\n"},
+		{"rle run count", ParseRLE, "x = 1, y = 1\n4294967297o!\n"},
+		{"rle overflowing run count", ParseRLE, "x = 1, y = 1\n99999999999999999999o!\n"},
+		{"rle position", ParseRLE, "#CXRLE Pos=" + beyondCoordinates + ",0\no!\n"},
+		{"rle rule", ParseRLE, "x = 1, y = 1, rule = " + overlongValue + "\no!\n"},
+		{"life105 position", ParseLife105, "#Life 1.05\n#P " + beyondCoordinates + " 0\n*\n"},
+		{"life105 rule", ParseLife105, "#Life 1.05\n#R " + overlongValue + "\n#P 0 0\n*\n"},
+		{"macrocell rule", ParseMacrocell, "[M2]\n#R " + overlongValue + "\n*$\n"},
+		{"macrocell unknown node", ParseMacrocell, "[M2]\n4 9 9 9 9\n"},
+		{"npy shape", ParseNPY, string(npyFile("{'descr': '|u1', 'fortran_order': False, 'shape': ("+beyondCoordinates+", "+beyondCoordinates+"), }\n", "\x01"))},
+		{"json coordinate", ParseJSON, `{"cells": [[` + beyondCoordinates + `, 0]]}`},
+		{"json rule", ParseJSON, `{"rule": "` + overlongValue + `", "cells": []}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.parse([]byte(test.data)); err == nil {
+				t.Errorf("parsed %q without an error", test.data)
+			}
+		})
+	}
+}
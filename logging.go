@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// The subsystems messages are logged under, which -log-subsystems picks from.
+const (
+	logParser   = "parser"
+	logEngine   = "engine"
+	logRenderer = "renderer"
+	logServer   = "server"
+	logTools    = "tools"
+)
+
+var logSubsystems = []string{logParser, logEngine, logRenderer, logServer, logTools}
+
+// logKeptFiles is how many rotated log files are kept besides the current
+// one, as file.1 (the newest) to file.3.
+const logKeptFiles = 3
+
+// logOptions configure where messages are logged and which ones.
+type logOptions struct {
+	level slog.Level
+	// file is where to log instead of stderr, rotated once it reaches
+	// maxBytes when that is positive.
+	file     string
+	maxBytes int64
+	// subsystems are the ones to log, or all of them when empty.
+	subsystems []string
+}
+
+var (
+	logHandler slog.Handler = slog.NewTextHandler(os.Stderr, nil)
+	logEnabled              = map[string]bool{}
+)
+
+// logger returns the logger of a subsystem, which discards everything when
+// the subsystem is filtered out.
+func logger(subsystem string) *slog.Logger {
+	if len(logEnabled) > 0 && !logEnabled[subsystem] {
+		return slog.New(slog.DiscardHandler)
+	}
+	return slog.New(logHandler).With("subsystem", subsystem)
+}
+
+// setUpLogging directs the loggers of every subsystem as configured. Messages
+// to stderr leave out the time, as a terminal shows them as they happen.
+func setUpLogging(opts logOptions) error {
+	enabled := map[string]bool{}
+	for _, subsystem := range opts.subsystems {
+		known := false
+		for _, name := range logSubsystems {
+			known = known || name == subsystem
+		}
+		if !known {
+			return fmt.Errorf("unknown subsystem '%s', expected some of: %s", subsystem, strings.Join(logSubsystems, ", "))
+		}
+		enabled[subsystem] = true
+	}
+
+	handlerOptions := &slog.HandlerOptions{Level: opts.level}
+	var w io.Writer = os.Stderr
+	if opts.file != "" {
+		file, err := openRotatingFile(opts.file, opts.maxBytes)
+		if err != nil {
+			return err
+		}
+		w = file
+	} else {
+		handlerOptions.ReplaceAttr = func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		}
+	}
+	logHandler, logEnabled = slog.NewTextHandler(w, handlerOptions), enabled
+	return nil
+}
+
+// parseLogSubsystems splits a comma-separated list of subsystems.
+func parseLogSubsystems(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// rotatingFile is a log file that is renamed aside once it grows past
+// maxBytes, keeping logKeptFiles old ones.
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	file     *os.File
+	size     int64
+}
+
+func openRotatingFile(path string, maxBytes int64) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxBytes: maxBytes}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size = file, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxBytes > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	for i := logKeptFiles - 1; i > 0; i-- {
+		// the oldest files may not exist yet
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The LZ4 frame format, as the lz4 command line tool reads and writes it:
+// a header, blocks of at most a maximum size each compressed on its own or
+// stored as they are, an empty block ending the frame, and a checksum of
+// the contents. Reading also takes blocks that refer back to the ones
+// before, block checksums, concatenated frames and skippable frames.
+
+const (
+	lz4Magic          = 0x184d2204
+	lz4SkippableMagic = 0x184d2a50
+	// lz4BlockSize is the size of the blocks written, which the descriptor
+	// gives as lz4BlockSizeCode.
+	lz4BlockSize     = 4 << 20
+	lz4BlockSizeCode = 7
+	// lz4Window is how far back a match can refer.
+	lz4Window = 1 << 16
+	// lz4MinMatch is the shortest match, lz4LastLiterals how many bytes a
+	// block always ends with as literals, and lz4MatchLimit how close to
+	// the end of a block the last match can start.
+	lz4MinMatch      = 4
+	lz4LastLiterals  = 5
+	lz4MatchLimit    = 12
+	lz4HashLog       = 16
+	lz4Uncompressed  = 1 << 31
+	lz4FlagVersion   = 1 << 6
+	lz4FlagIndep     = 1 << 5
+	lz4FlagBlockSum  = 1 << 4
+	lz4FlagSize      = 1 << 3
+	lz4FlagSum       = 1 << 2
+	lz4FlagDict      = 1 << 0
+	lz4FlagsReserved = 1 << 1
+)
+
+var lz4MagicBytes = []byte{0x04, 0x22, 0x4d, 0x18}
+
+var (
+	errLZ4Corrupt  = errors.New("corrupt lz4 block")
+	errCodecClosed = errors.New("write after close")
+)
+
+// lz4Writer compresses what is written to it into an LZ4 frame of
+// independent blocks, with a checksum of the contents.
+type lz4Writer struct {
+	w       io.Writer
+	started bool
+	buffer  []byte
+	block   []byte
+	table   []int32
+	sum     *xxh32
+	err     error
+}
+
+func newLZ4Writer(w io.Writer) *lz4Writer {
+	return &lz4Writer{w: w, sum: newXXH32()}
+}
+
+func (writer *lz4Writer) Write(p []byte) (int, error) {
+	if writer.err != nil {
+		return 0, writer.err
+	}
+	writer.sum.Write(p)
+	written := len(p)
+	for len(p) > 0 {
+		if writer.buffer == nil {
+			writer.buffer = make([]byte, 0, lz4BlockSize)
+		}
+		n := min(len(p), lz4BlockSize-len(writer.buffer))
+		writer.buffer = append(writer.buffer, p[:n]...)
+		p = p[n:]
+		if len(writer.buffer) == lz4BlockSize {
+			if writer.err = writer.flushBlock(); writer.err != nil {
+				return written - len(p), writer.err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (writer *lz4Writer) header() error {
+	if writer.started {
+		return nil
+	}
+	writer.started = true
+	descriptor := []byte{lz4FlagVersion | lz4FlagIndep | lz4FlagSum, lz4BlockSizeCode << 4}
+	checksum := newXXH32()
+	checksum.Write(descriptor)
+	header := append(append(append([]byte{}, lz4MagicBytes...), descriptor...), byte(checksum.Sum32()>>8))
+	_, err := writer.w.Write(header)
+	return err
+}
+
+func (writer *lz4Writer) flushBlock() error {
+	if err := writer.header(); err != nil {
+		return err
+	}
+	if len(writer.buffer) == 0 {
+		return nil
+	}
+	if writer.table == nil {
+		writer.table = make([]int32, 1<<lz4HashLog)
+	}
+	writer.block = lz4CompressBlock(writer.block[:0], writer.buffer, writer.table)
+	data, size := writer.block, uint32(len(writer.block))
+	if len(writer.block) >= len(writer.buffer) {
+		data, size = writer.buffer, uint32(len(writer.buffer))|lz4Uncompressed
+	}
+	if _, err := writer.w.Write(binary.LittleEndian.AppendUint32(nil, size)); err != nil {
+		return err
+	}
+	_, err := writer.w.Write(data)
+	writer.buffer = writer.buffer[:0]
+	return err
+}
+
+// Close ends the frame, without closing the writer under it.
+func (writer *lz4Writer) Close() error {
+	if writer.err != nil {
+		return writer.err
+	}
+	if writer.err = writer.flushBlock(); writer.err != nil {
+		return writer.err
+	}
+	trailer := binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, 0), writer.sum.Sum32())
+	if _, writer.err = writer.w.Write(trailer); writer.err != nil {
+		return writer.err
+	}
+	writer.err = errCodecClosed
+	return nil
+}
+
+// lz4CompressBlock appends src compressed as an LZ4 block to dst, taking
+// the first match a hash of the next four bytes finds, as lz4 does at its
+// fastest. table is the hash table, of which entries are cleared first.
+func lz4CompressBlock(dst, src []byte, table []int32) []byte {
+	clear(table)
+	anchor := 0
+	for i := 0; i+lz4MatchLimit <= len(src); {
+		sequence := binary.LittleEndian.Uint32(src[i:])
+		h := (sequence * 2654435761) >> (32 - lz4HashLog)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if candidate < 0 || i-candidate >= lz4Window || binary.LittleEndian.Uint32(src[candidate:]) != sequence {
+			i++
+			continue
+		}
+		length := lz4MinMatch
+		for i+length < len(src)-lz4LastLiterals && src[candidate+length] == src[i+length] {
+			length++
+		}
+		dst = lz4AppendSequence(dst, src[anchor:i], i-candidate, length)
+		i += length
+		anchor = i
+	}
+	return lz4AppendSequence(dst, src[anchor:], 0, 0)
+}
+
+// lz4AppendSequence appends literals followed by a match of length at
+// offset back, or by nothing when length is 0, which only the last
+// sequence of a block is.
+func lz4AppendSequence(dst, literals []byte, offset, length int) []byte {
+	token := byte(min(len(literals), 15)) << 4
+	if length > 0 {
+		token |= byte(min(length-lz4MinMatch, 15))
+	}
+	dst = append(dst, token)
+	if len(literals) >= 15 {
+		dst = lz4AppendLength(dst, len(literals)-15)
+	}
+	dst = append(dst, literals...)
+	if length == 0 {
+		return dst
+	}
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(offset))
+	if length-lz4MinMatch >= 15 {
+		dst = lz4AppendLength(dst, length-lz4MinMatch-15)
+	}
+	return dst
+}
+
+func lz4AppendLength(dst []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// lz4DecompressBlock appends the block src decompresses to to dst, whose
+// contents the matches of the block may refer back into.
+func lz4DecompressBlock(dst, src []byte, maxSize int) ([]byte, error) {
+	start := len(dst)
+	for i := 0; ; {
+		if i >= len(src) {
+			return nil, errLZ4Corrupt
+		}
+		token := src[i]
+		i++
+		literals := int(token >> 4)
+		if literals == 15 {
+			n, read, err := lz4ReadLength(src[i:])
+			if err != nil {
+				return nil, err
+			}
+			literals, i = literals+n, i+read
+		}
+		if literals > len(src)-i || len(dst)-start+literals > maxSize {
+			return nil, errLZ4Corrupt
+		}
+		dst = append(dst, src[i:i+literals]...)
+		i += literals
+		if i == len(src) {
+			return dst, nil
+		}
+
+		if i+2 > len(src) {
+			return nil, errLZ4Corrupt
+		}
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+		length := int(token&15) + lz4MinMatch
+		if token&15 == 15 {
+			n, read, err := lz4ReadLength(src[i:])
+			if err != nil {
+				return nil, err
+			}
+			length, i = length+n, i+read
+		}
+		if offset == 0 || offset > len(dst) || len(dst)-start+length > maxSize {
+			return nil, errLZ4Corrupt
+		}
+		from := len(dst) - offset
+		if offset >= length {
+			dst = append(dst, dst[from:from+length]...)
+			continue
+		}
+		// byte by byte, since the match overlaps what it copies
+		for j := 0; j < length; j++ {
+			dst = append(dst, dst[from+j])
+		}
+	}
+}
+
+func lz4ReadLength(src []byte) (int, int, error) {
+	n := 0
+	for i, b := range src {
+		n += int(b)
+		if b != 255 {
+			return n, i + 1, nil
+		}
+		if n > lz4BlockSize {
+			break
+		}
+	}
+	return 0, 0, errLZ4Corrupt
+}
+
+// lz4Reader decompresses the LZ4 frames read from r.
+type lz4Reader struct {
+	r io.Reader
+	// inFrame is true between the header of a frame and its end mark.
+	inFrame     bool
+	independent bool
+	blockSums   bool
+	contentSum  bool
+	maxSize     int
+	sum         *xxh32
+	// window holds what was decompressed: the last block, to be read, after
+	// the lz4Window bytes before it that blocks may refer back into.
+	window []byte
+	unread int
+	block  []byte
+}
+
+func newLZ4Reader(r io.Reader) (*lz4Reader, error) {
+	reader := &lz4Reader{r: r}
+	found, err := reader.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("empty lz4 stream")
+	}
+	return reader, nil
+}
+
+// readHeader reads the header of the next frame, skipping skippable ones,
+// reporting false at the end of the stream.
+func (reader *lz4Reader) readHeader() (bool, error) {
+	var magic [4]byte
+	for {
+		if _, err := io.ReadFull(reader.r, magic[:]); err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		value := binary.LittleEndian.Uint32(magic[:])
+		if value&0xfffffff0 != lz4SkippableMagic {
+			if value != lz4Magic {
+				return false, fmt.Errorf("not an lz4 frame")
+			}
+			break
+		}
+		var size [4]byte
+		if _, err := io.ReadFull(reader.r, size[:]); err != nil {
+			return false, err
+		}
+		if _, err := io.CopyN(io.Discard, reader.r, int64(binary.LittleEndian.Uint32(size[:]))); err != nil {
+			return false, err
+		}
+	}
+
+	descriptor := make([]byte, 2, 15)
+	if _, err := io.ReadFull(reader.r, descriptor); err != nil {
+		return false, err
+	}
+	flags, bd := descriptor[0], descriptor[1]
+	if flags>>6 != 1 || flags&lz4FlagsReserved != 0 || bd&0x8f != 0 {
+		return false, fmt.Errorf("unsupported lz4 frame descriptor")
+	}
+	if flags&lz4FlagDict != 0 {
+		return false, fmt.Errorf("lz4 frames with a dictionary are not supported")
+	}
+	code := int(bd >> 4)
+	if code < 4 {
+		return false, fmt.Errorf("invalid lz4 block size")
+	}
+	extra := 1
+	if flags&lz4FlagSize != 0 {
+		extra += 8
+	}
+	descriptor = descriptor[:2+extra]
+	if _, err := io.ReadFull(reader.r, descriptor[2:]); err != nil {
+		return false, err
+	}
+	checksum := newXXH32()
+	checksum.Write(descriptor[:len(descriptor)-1])
+	if byte(checksum.Sum32()>>8) != descriptor[len(descriptor)-1] {
+		return false, fmt.Errorf("lz4 frame header checksum mismatch")
+	}
+	reader.inFrame = true
+	reader.independent = flags&lz4FlagIndep != 0
+	reader.blockSums = flags&lz4FlagBlockSum != 0
+	reader.contentSum = flags&lz4FlagSum != 0
+	reader.maxSize = 1 << (8 + 2*code)
+	reader.sum = newXXH32()
+	reader.window = reader.window[:0]
+	return true, nil
+}
+
+func (reader *lz4Reader) Read(p []byte) (int, error) {
+	for reader.unread == 0 {
+		if !reader.inFrame {
+			found, err := reader.readHeader()
+			if err != nil {
+				return 0, err
+			}
+			if !found {
+				return 0, io.EOF
+			}
+		}
+		if err := reader.readBlock(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, reader.window[len(reader.window)-reader.unread:])
+	reader.unread -= n
+	return n, nil
+}
+
+// readBlock decompresses the next block of the frame, or reads its end.
+func (reader *lz4Reader) readBlock() error {
+	var header [4]byte
+	if _, err := io.ReadFull(reader.r, header[:]); err != nil {
+		return noEOF(err)
+	}
+	size := binary.LittleEndian.Uint32(header[:])
+	if size == 0 {
+		reader.inFrame = false
+		if reader.contentSum {
+			if _, err := io.ReadFull(reader.r, header[:]); err != nil {
+				return noEOF(err)
+			}
+			if binary.LittleEndian.Uint32(header[:]) != reader.sum.Sum32() {
+				return fmt.Errorf("lz4 content checksum mismatch")
+			}
+		}
+		return nil
+	}
+	stored := size&lz4Uncompressed != 0
+	size &^= lz4Uncompressed
+	if int(size) > reader.maxSize {
+		return errLZ4Corrupt
+	}
+	if cap(reader.block) < int(size) {
+		reader.block = make([]byte, size)
+	}
+	block := reader.block[:size]
+	if _, err := io.ReadFull(reader.r, block); err != nil {
+		return noEOF(err)
+	}
+	if reader.blockSums {
+		if _, err := io.ReadFull(reader.r, header[:]); err != nil {
+			return noEOF(err)
+		}
+		checksum := newXXH32()
+		checksum.Write(block)
+		if binary.LittleEndian.Uint32(header[:]) != checksum.Sum32() {
+			return fmt.Errorf("lz4 block checksum mismatch")
+		}
+	}
+
+	// keep what later blocks may refer back into
+	if reader.independent {
+		reader.window = reader.window[:0]
+	} else if len(reader.window) > lz4Window {
+		reader.window = append(reader.window[:0], reader.window[len(reader.window)-lz4Window:]...)
+	}
+	before := len(reader.window)
+	if stored {
+		reader.window = append(reader.window, block...)
+	} else {
+		var err error
+		if reader.window, err = lz4DecompressBlock(reader.window, block, reader.maxSize); err != nil {
+			return err
+		}
+	}
+	reader.unread = len(reader.window) - before
+	reader.sum.Write(reader.window[before:])
+	return nil
+}
+
+// noEOF turns the end of a stream in the middle of a frame into an error.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	MACROCELL_HEADER = "[M2]"
+)
+
+// macrocellLeafLevel is the level of the leaves of a macrocell quadtree,
+// 8x8 cells written out as rows.
+const macrocellLeafLevel = 3
+
+// macrocellNode is a square of 2^level cells on a side: either a leaf with
+// its alive cells relative to its top-left corner, or four quadrants given
+// by their node numbers, 0 for an empty one.
+type macrocellNode struct {
+	level      int
+	cells      []Cell
+	quadrants  [4]int
+	population int64
+}
+
+// parseMacrocell reads Golly's macrocell format, which stores a pattern as a
+// quadtree in which identical squares are written once, so that huge and
+// repetitive patterns stay small:
+//
+//	[M2] (golly 4.2)
+//	#R B3/S23
+//	#G 0
+//	.*$..*$***$
+//	4 0 1 0 0
+//
+// Lines of '.', '*' and '$' are 8x8 leaves, rows separated by '$'; lines of
+// "level nw ne sw se" are larger squares made of the nodes numbered by the
+// order of their lines, from 1. The last node is the whole universe,
+// centered on 0,0. "#R" and "#G" give the rule and generation.
+func parseMacrocell(r io.Reader, region *Rect) (Pattern, error) {
+	pattern := Pattern{cells: make(Cells)}
+	// node 0 is the empty node
+	nodes := []macrocellNode{{}}
+
+	headerFound := false
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case lineNumber == 1:
+			if !strings.HasPrefix(line, MACROCELL_HEADER) {
+				return Pattern{}, fmt.Errorf("Invalid macrocell file: needed %s indicator as first line", MACROCELL_HEADER)
+			}
+			headerFound = true
+		case line == "":
+		case strings.HasPrefix(line, "#R"):
+			if pattern.rule = strings.TrimSpace(line[2:]); len(pattern.rule) > maxHeaderValueLength {
+				return Pattern{}, fmt.Errorf("rule is longer than %d characters", maxHeaderValueLength)
+			}
+		case strings.HasPrefix(line, "#G"):
+			generation, err := strconv.Atoi(strings.TrimSpace(line[2:]))
+			if err != nil {
+				return Pattern{}, fmt.Errorf("invalid generation on line %d", lineNumber)
+			}
+			pattern.generation = generation
+		case strings.HasPrefix(line, "#"):
+			if _, err := pattern.metadata.parseHashLine(line); err != nil {
+				return Pattern{}, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+		case line[0] == '.' || line[0] == '*' || line[0] == '$':
+			node, err := parseMacrocellLeaf(line)
+			if err != nil {
+				return Pattern{}, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			nodes = append(nodes, node)
+		default:
+			node, err := parseMacrocellBranch(line, nodes)
+			if err != nil {
+				return Pattern{}, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Pattern{}, err
+	}
+	if !headerFound {
+		return Pattern{}, fmt.Errorf("Invalid macrocell file: needed %s indicator as first line", MACROCELL_HEADER)
+	}
+	if len(nodes) == 1 {
+		return pattern, nil
+	}
+
+	root := len(nodes) - 1
+	// a small file can describe far more cells than fit in memory
+	if nodes[root].population > maxParsedCells && region == nil {
+		return Pattern{}, errTooManyCells
+	}
+	half := int64(1) << (nodes[root].level - 1)
+	if err := expandMacrocell(nodes, root, -half, -half, region, pattern.cells); err != nil {
+		return Pattern{}, err
+	}
+	return pattern, nil
+}
+
+func parseMacrocellLeaf(line string) (macrocellNode, error) {
+	node := macrocellNode{level: macrocellLeafLevel}
+	x, y := int64(0), int64(0)
+	for _, c := range line {
+		// the last row may end in a $ like the others
+		if c == '$' && y < 8 {
+			x, y = 0, y+1
+			continue
+		}
+		if c != '.' && c != '*' && c != '$' {
+			return macrocellNode{}, fmt.Errorf("unexpected character '%c' in leaf", c)
+		}
+		if c == '$' || x >= 8 || y >= 8 {
+			return macrocellNode{}, fmt.Errorf("leaf is larger than 8x8")
+		}
+		if c == '*' {
+			node.cells = append(node.cells, Cell{x, y})
+		}
+		x++
+	}
+	node.population = int64(len(node.cells))
+	return node, nil
+}
+
+func parseMacrocellBranch(line string, nodes []macrocellNode) (macrocellNode, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 5 {
+		return macrocellNode{}, fmt.Errorf("expected a level and four node numbers, got '%s'", line)
+	}
+	level, err := strconv.Atoi(fields[0])
+	if err != nil || level <= macrocellLeafLevel || level > 62 {
+		return macrocellNode{}, fmt.Errorf("invalid level '%s'", fields[0])
+	}
+	node := macrocellNode{level: level}
+	for i, field := range fields[1:] {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 || n >= len(nodes) {
+			return macrocellNode{}, fmt.Errorf("invalid node number '%s'", field)
+		}
+		if n != 0 && nodes[n].level != level-1 {
+			return macrocellNode{}, fmt.Errorf("node %d is of level %d, expected %d", n, nodes[n].level, level-1)
+		}
+		node.quadrants[i] = n
+		// saturate rather than overflow on absurdly repetitive patterns
+		node.population = min(node.population+nodes[n].population, 1<<62)
+	}
+	return node, nil
+}
+
+// expandMacrocell adds the alive cells of node n, whose top-left corner is
+// x,y, to cells.
+func expandMacrocell(nodes []macrocellNode, n int, x, y int64, region *Rect, cells Cells) error {
+	node := nodes[n]
+	if n == 0 || node.population == 0 {
+		return nil
+	}
+	size := int64(1) << node.level
+	if region != nil && (x >= region.x+region.w || y >= region.y+region.h || x+size <= region.x || y+size <= region.y) {
+		return nil
+	}
+	if node.level == macrocellLeafLevel {
+		for _, cell := range node.cells {
+			cell = Cell{x + cell.x, y + cell.y}
+			if region == nil || region.contains(cell) {
+				if len(cells) >= maxParsedCells {
+					return errTooManyCells
+				}
+				cells.addCell(cell)
+			}
+		}
+		return nil
+	}
+	half := size / 2
+	for i, quadrant := range node.quadrants {
+		if err := expandMacrocell(nodes, quadrant, x+int64(i%2)*half, y+int64(i/2)*half, region, cells); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMacrocell writes a pattern as a macrocell quadtree, writing each
+// distinct square once.
+func writeMacrocell(w io.Writer, pattern Pattern) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\n", MACROCELL_HEADER)
+	if pattern.rule != "" {
+		fmt.Fprintf(bw, "#R %s\n", pattern.rule)
+	}
+	if pattern.generation != 0 {
+		fmt.Fprintf(bw, "#G %d\n", pattern.generation)
+	}
+	bw.WriteString(pattern.metadata.hashLines())
+
+	min, max, ok := pattern.cells.boundingBox()
+	if ok {
+		// the smallest root centered on 0,0 that holds every cell
+		level := macrocellLeafLevel + 1
+		for half := int64(1) << (level - 1); min.x < -half || min.y < -half || max.x >= half || max.y >= half; half <<= 1 {
+			level++
+		}
+		writer := macrocellWriter{w: bw, numbers: make(map[string]int)}
+		half := int64(1) << (level - 1)
+		cells := make([]Cell, 0, len(pattern.cells))
+		for cell := range pattern.cells {
+			cells = append(cells, cell)
+		}
+		writer.node(level, -half, -half, cells)
+	}
+	return bw.Flush()
+}
+
+// macrocellWriter numbers the nodes of a quadtree as it writes them, in the
+// order a reader needs them: children before their parents.
+type macrocellWriter struct {
+	w *bufio.Writer
+	// numbers maps the line of each node written to its number.
+	numbers map[string]int
+}
+
+// node writes the square of the given level with top-left corner x,y, which
+// holds cells, and returns its number.
+func (writer *macrocellWriter) node(level int, x, y int64, cells []Cell) int {
+	if len(cells) == 0 {
+		return 0
+	}
+	var line string
+	if level == macrocellLeafLevel {
+		var rows [8][8]bool
+		for _, cell := range cells {
+			rows[cell.y-y][cell.x-x] = true
+		}
+		var b strings.Builder
+		for _, row := range rows {
+			end := 8
+			for end > 0 && !row[end-1] {
+				end--
+			}
+			for _, alive := range row[:end] {
+				if alive {
+					b.WriteByte('*')
+				} else {
+					b.WriteByte('.')
+				}
+			}
+			b.WriteByte('$')
+		}
+		// trailing empty rows are implied
+		line = strings.TrimRight(b.String(), "$") + "$"
+	} else {
+		half := int64(1) << (level - 1)
+		var quadrants [4][]Cell
+		for _, cell := range cells {
+			i := 0
+			if cell.x >= x+half {
+				i++
+			}
+			if cell.y >= y+half {
+				i += 2
+			}
+			quadrants[i] = append(quadrants[i], cell)
+		}
+		var numbers [4]int
+		for i, quadrant := range quadrants {
+			numbers[i] = writer.node(level-1, x+int64(i%2)*half, y+int64(i/2)*half, quadrant)
+		}
+		line = fmt.Sprintf("%d %d %d %d %d", level, numbers[0], numbers[1], numbers[2], numbers[3])
+	}
+
+	if number, found := writer.numbers[line]; found {
+		return number
+	}
+	number := len(writer.numbers) + 1
+	writer.numbers[line] = number
+	fmt.Fprintf(writer.w, "%s\n", line)
+	return number
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+// TestParseMacrocellLeaf checks that leaves are read up to 8x8 and no
+// larger.
+func TestParseMacrocellLeaf(t *testing.T) {
+	tests := []struct {
+		line  string
+		cells []Cell
+		ok    bool
+	}{
+		{"$.*$", []Cell{{1, 1}}, true},
+		{".......*$$$$$$$.......*$", []Cell{{7, 0}, {7, 7}}, true},
+		{"$$$$$$$$*", nil, false},
+		{"$$$$$$$$.", nil, false},
+		{"........*", nil, false},
+		{".........", nil, false},
+		{"$$$$$$$$$", nil, false},
+		{"*o", nil, false},
+	}
+	for _, test := range tests {
+		node, err := parseMacrocellLeaf(test.line)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: got error %v", test.line, err)
+			continue
+		}
+		if test.ok && (len(node.cells) != len(test.cells) || node.population != int64(len(test.cells))) {
+			t.Errorf("%q: read %v, not %v", test.line, node.cells, test.cells)
+			continue
+		}
+		for i, cell := range test.cells {
+			if node.cells[i] != cell {
+				t.Errorf("%q: read %v, not %v", test.line, node.cells, test.cells)
+				break
+			}
+		}
+	}
+}
@@ -5,14 +5,92 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
 	"math"
 	"os"
+	"sort"
 	"strings"
+	"time"
 )
 
 var (
-	inputArg      = flag.String("input", "", "The game of life file to parse")
-	iterationsArg = flag.Int("iterations", 0, "The number of iterations to run")
+	inputsArg          = flag.String("inputs", "", "Read the patterns to compose from this manifest file, one file or file@x,y per line, as if each were given to -input")
+	recenterInputArg   = flag.Bool("recenter-input", false, "Move each input so that its median cell is at the origin before its offset applies, for inputs corrupted into astronomically large and sparse bounding boxes")
+	iterationsArg      = flag.Int("iterations", 0, "The number of iterations to run")
+	deltaArg           = flag.String("delta", "", "Write a per-generation stream of born and died cells to this file")
+	neighborhoodArg    = flag.String("neighborhood", "moore", "The neighborhood to count alive neighbors over: 'moore', 'vonneumann', 'hex' or a list of offsets such as '1,2;2,1;-1,2'; Larger than Life rules and rule tables count over their own instead")
+	kernelArg          = flag.String("kernel", "", "Read the neighborhood from a kernel file of '.' and 'o' rows centered on the cell, instead of -neighborhood")
+	fromClipboardArg   = flag.Bool("from-clipboard", false, "Read the input pattern as RLE from the system clipboard instead of -input")
+	toClipboardArg     = flag.Bool("to-clipboard", false, "Also copy the resulting pattern as RLE to the system clipboard")
+	analyzeArg         = flag.Bool("analyze", false, "Print an analysis of the run, such as the drift of the centroid, to stderr")
+	analysisJSONArg    = flag.String("analysis-json", "", "Write the analysis of the run to this JSON file, with the objects of the last generation and what they are, for -overlay")
+	annotationsArg     = flag.String("annotations", "", "Draw the rectangles, arrows and labels of this JSON file over -render and -gif, each in the generations it gives; labels are only written in SVG renders")
+	overlayArg         = flag.String("overlay", "", "Draw the objects, spaceship lanes and period of an -analysis-json file over -render")
+	forecastArg        = flag.Int("forecast", 0, "With -analyze, forecast the population and bounding box at this generation from the recent trend, printing it as the run goes")
+	strictResourcesArg = flag.Bool("strict-resources", false, "Refuse to run, instead of warning, when the run is likely to need more memory than is available")
+
+	frozenArg, maskedArg stringList
+	inputArg             stringList
+	patternArg           stringList
+	logLevelArg          slog.Level
+	anchorsArg           = make(Anchors)
+	fastForwardArg       = flag.Bool("fast-forward", false, "Skip simulating whole periods once the universe is seen to repeat itself, such as a lone spaceship")
+	loadRegionArg        = flag.String("load-region", "", "Only load the cells of the input inside the region x,y,w,h (or anchor,w,h), discarding the rest while parsing")
+	midiArg              = flag.String("midi", "", "Write the run as a MIDI file, playing population as melody and births and deaths as accents")
+	statsArg             = flag.String("stats", "", "Write the population, births, deaths and bounding box of every generation to this CSV file")
+	saveEveryArg         = flag.Int("save-every", 0, "Save every generation that is a multiple of this to -save-dir as a Life 1.06 file that can be -continued")
+	saveDirArg           = flag.String("save-dir", ".", "The directory -save-every writes to")
+	checkpointArg        = flag.String("checkpoint", "", "Save the state of the run to this file every -checkpoint-every generations and at the end, for -resume")
+	checkpointEveryArg   = flag.Int("checkpoint-every", 1000, "How often -checkpoint saves, in generations")
+	codecArg             = flag.String("codec", "none", "Compress -checkpoint and -history files with this codec: none, gzip, zlib, zstd or lz4")
+	resumeArg            = flag.String("resume", "", "Carry on the run saved in this -checkpoint file, up to the generation it was to end at unless -iterations is given")
+	provenanceArg        = flag.String("provenance", "", "Write how the run came about to this JSON file: the hashes of its inputs and outputs, its flags, the build of the tool, how long it took and the host")
+	renderArg            = flag.String("render", "", "Render the last generation of the run to this PNG file, or SVG file if it ends in .svg")
+	tilesArg             = flag.String("tiles", "", "Export the last generation of the run as a pyramid of 256 pixel PNG tiles in this directory, z/x/y.png for each zoom level, with an index.html that browses them with Leaflet")
+	cellSizeArg          = flag.Int("cell-size", 4, "The width and height of a cell in pixels for -render, -gif and -frames-raw, and at the deepest zoom level of -tiles")
+	flipYArg             = flag.Bool("flip-y", false, "Draw y growing upwards in -render, -tiles, -gif, -frames-raw and -print-board")
+	renderGenerationArg  = flag.Int("render-generation", -1, "Render this generation for -render and -tiles instead of the last one")
+	followArg            = flag.String("follow", "", "Draw -render, -gif and -frames-raw moved back along with a spaceship or fleet, by dx,dy every period generations given as dx,dy/period such as 1,1/4, or with 'auto' by the motion of the whole run once it repeats; -analysis-json is written in the same coordinates")
+	gifArg               = flag.String("gif", "", "Record the run as an animated GIF to this file")
+	frameEveryArg        = flag.Int("frame-every", 1, "Record every this many generations for -gif and -frames-raw, or with -sample adaptive at least this many apart")
+	sampleArg            = flag.String("sample", "every", "How -gif and -frames-raw pick the generations to record: 'every' for every -frame-every generations, or 'adaptive' for more often the more cells change, once the cells that differ from the last frame in the viewport add up to a tenth of its population there and at least every 64 times -frame-every generations")
+	gifViewportArg       = flag.String("gif-viewport", "", "The region x,y,w,h (or anchor,w,h) shown by -gif, by default the bounding box of every frame")
+	framesRawArg         = flag.Bool("frames-raw", false, "Write the generations -frame-every and -sample pick of the -frames-viewport to stdout as raw RGBA frames, for piping into ffmpeg, instead of printing the result")
+	framesViewportArg    = flag.String("frames-viewport", "", "The region x,y,w,h (or anchor,w,h) shown by -frames-raw")
+
+	ledArg               = flag.String("led", "", "Push every generation to an LED display at wled://host[:port] or flaschen://host[:port] (rpi-rgb-led-matrix)")
+	ledSizeArg           = flag.String("led-size", "32x16", "The size of the LED display, as WxH")
+	ledOriginArg         = flag.String("led-origin", "0,0", "The cell (x,y or an anchor) shown in the top-left corner of the LED display")
+	ledBrightnessArg     = flag.Float64("led-brightness", 0.5, "The brightness of alive cells on the LED display, between 0 and 1")
+	ledFPSArg            = flag.Float64("led-fps", 10, "The number of frames per second sent to the LED display, or 0 to send as fast as possible")
+	ledSerpentineArg     = flag.Bool("led-serpentine", false, "Reverse every other row for LED strips wired in a zigzag")
+	historyArg           = flag.String("history", "", "Record the run to this file for replay, as keyframes at exponentially spaced generations with deltas in between")
+	historyBudgetArg     = flag.Float64("history-budget", 4, "The most changes, as a multiple of the population, replayed on top of a keyframe to rebuild any generation of -history")
+	corpusArg            = flag.String("corpus", "", "Append the input, generations and a hash of the result of every successful run to this corpus file, for checking later versions with 'corpus verify'")
+	workersArg           = flag.Int("workers", 1, "The number of goroutines each generation is computed on")
+	verifyDeterminismArg = flag.Bool("verify-determinism", false, "Check every generation against a second engine with a different number of -workers, failing on any difference")
+	paranoidArg          = flag.Bool("paranoid", false, "Check after every generation that the engine's result is consistent, panicking with the details otherwise; slow")
+	gpsArg               = flag.Float64("gps", 0, "Run in real time at this many generations per second, reporting missed deadlines, dropping display frames and then analysis when falling behind; for -led displays, set -led-fps to 0")
+	formatArg            = flag.String("format", "", "The format of the input: life106, life105, rle, cells, npy, matrix, macrocell or json; by default it is recognised from the first lines of the file, or else its extension")
+	outputFormatArg      = flag.String("output-format", "", "The format to print the result in, by default that of the input")
+	gzipArg              = flag.Bool("gzip", false, "Compress the printed result with gzip")
+	unsortedArg          = flag.Bool("unsorted", false, "Print the cells of a Life 1.06 result in no particular order rather than by y and then x, which is faster for very large universes")
+	printBoardArg        = flag.Bool("print-board", false, "Print the result as rows of . and █ instead, over its bounding box or the -board-viewport")
+	boardViewportArg     = flag.String("board-viewport", "", "The region x,y,w,h (or anchor,w,h) -print-board shows")
+	logFileArg           = flag.String("log-file", "", "Log to this file instead of stderr")
+	logMaxSizeArg        = flag.Int64("log-max-size", 10<<20, "Rotate the -log-file once it grows past this many bytes, keeping 3 old files; 0 never rotates")
+	logSubsystemsArg     = flag.String("log-subsystems", "", "Only log these comma-separated subsystems: parser, engine, renderer, server and tools; by default all")
+	stopArg              = flag.String("stop", "", "End the run early once a condition holds, such as 'generation>=1e6 || population==0 || stable(period<=30)'; with no -iterations, run until it does")
+	roiArg               = flag.String("roi", "", "Only simulate the region x,y,w,h (or anchor,w,h) exactly, plus a margin wide enough that changes from outside cannot reach it, and freeze the rest")
+	roiMarginArg         = flag.Int64("roi-margin", -1, "The margin around -roi that is also simulated, by default as far as a change can travel in -iterations generations")
+	continueArg          = flag.String("continue", "", "Continue the run saved in this file from the generation and rule it records, instead of -input")
+	cacheDirArg          = flag.String("cache-dir", "", "The directory the results of runs are cached in, so that running the same input under the same rule for the same -iterations again prints the cached result; by default gameoflife in the user's cache directory. Only runs with no other outputs, -stop, -gps, constraints or checks are cached, and once the cache holds 1 GiB the results least recently used are dropped; see 'cache ls' and 'cache clear'")
+	noCacheArg           = flag.Bool("no-cache", false, "Neither look up nor cache the result of the run, whose cache takes up to 1 GiB of disk")
+	topologyArg          = flag.String("topology", "infinite", "The shape of the universe: 'infinite', 'plane:WxH' for a grid of W by H cells whose edges are dead, or 'torus:WxH' for one whose edges wrap around, reporting the period once its universe repeats, and how far it moves around each period; grids are centered on 0,0 as in Golly")
+	stagingDirArg        = flag.String("staging-dir", "", "The directory a run writes its output files, such as -gif, -history, -stats, -render, -tiles, -analysis-json and -provenance, and the result it prints, into first, to put them in place together once it succeeds: a failed run leaves the outputs before it, moving outputs a crashed run left half moved is finished by a later run, and the outputs of a run that crashed before then are removed after a week. With -checkpoint the outputs written as the run goes, -delta, -stats and an uncompressed -history, are also put in place at each checkpoint. By default staging in the user's cache directory")
+	noStagingArg         = flag.Bool("no-staging", false, "Write output files in place as the run goes rather than staging them")
+	ruleDirArg           = flag.String("rule-dir", ".", "The directory a rule given by name, such as the rule of a pattern, is looked up in as name.rule when it is no rulestring")
+	ruleArg              = flag.String("rule", "", "The rule to run under, in B/S notation such as B36/S23, B/S/C notation for Generations such as B2/S/C3, Hensel notation for isotropic non-totalistic rules such as B2-a/S12, Golly's notation for Larger than Life such as R5,C0,M1,S34..58,B34..45,NM, one of life, highlife, daynight, seeds, replicator, maze, brianbrain, starwars, bugs, majority and waffle, or a Golly .rule file with a @TABLE or @TREE, by path or by the name of the rule in -rule-dir; by default that of the input, or else B3/S23")
 )
 
 const (
@@ -23,29 +101,16 @@ type Cell struct {
 	x, y int64
 }
 
-func (cell Cell) neighbors() <-chan Cell {
+// neighbors yields the cells at each offset of neighborhood from cell,
+// skipping any that would fall outside the int64 coordinate space.
+func (cell Cell) neighbors(neighborhood Neighborhood) <-chan Cell {
 	neighborsCh := make(chan Cell)
 
-	yieldForX := func(x int64) {
-		if cell.y > math.MinInt64 {
-			neighborsCh <- Cell{x, cell.y - 1}
-		}
-		if cell.x != x {
-			neighborsCh <- Cell{x, cell.y}
-		}
-		if cell.y < math.MaxInt64 {
-			neighborsCh <- Cell{x, cell.y + 1}
-		}
-	}
-
 	go func() {
-		if cell.x > math.MinInt64 {
-			yieldForX(cell.x - 1)
-		}
-		yieldForX(cell.x)
-
-		if cell.x < math.MaxInt64 {
-			yieldForX(cell.x + 1)
+		for _, offset := range neighborhood {
+			if neighbor, ok := cell.offset(offset); ok {
+				neighborsCh <- neighbor
+			}
 		}
 
 		close(neighborsCh)
@@ -54,11 +119,30 @@ func (cell Cell) neighbors() <-chan Cell {
 	return neighborsCh
 }
 
+func (cell Cell) offset(offset Offset) (Cell, bool) {
+	x, ok := addCoordinate(cell.x, offset.dx)
+	if !ok {
+		return Cell{}, false
+	}
+	y, ok := addCoordinate(cell.y, offset.dy)
+	if !ok {
+		return Cell{}, false
+	}
+	return Cell{x, y}, true
+}
+
+func addCoordinate(value, delta int64) (int64, bool) {
+	if (delta > 0 && value > math.MaxInt64-delta) || (delta < 0 && value < math.MinInt64-delta) {
+		return 0, false
+	}
+	return value + delta, true
+}
+
 type Cells map[Cell]struct{}
 
-func (cells Cells) numAliveNeighbors(cell Cell) uint8 {
+func (cells Cells) numAliveNeighbors(cell Cell, neighborhood Neighborhood) uint8 {
 	aliveCount := uint8(0)
-	for neighbor := range cell.neighbors() {
+	for neighbor := range cell.neighbors(neighborhood) {
 		if cells.hasCell(neighbor) {
 			aliveCount++
 		}
@@ -66,134 +150,1322 @@ func (cells Cells) numAliveNeighbors(cell Cell) uint8 {
 	return aliveCount
 }
 
-func (cells Cells) deadNeighbors() <-chan Cell {
-	deadNeighborsCh := make(chan Cell)
-	go func() {
-		deadNeighborCells := make(Cells)
+func (cells Cells) addCell(cell Cell) {
+	cells[cell] = struct{}{}
+}
+
+func (cells Cells) hasCell(cell Cell) bool {
+	_, found := cells[cell]
+	return found
+}
+
+func (cells Cells) removeCell(cell Cell) {
+	delete(cells, cell)
+}
+
+// boundingBox returns the smallest and largest coordinates of any alive cell,
+// or false if there are no alive cells.
+func (cells Cells) boundingBox() (Cell, Cell, bool) {
+	first := true
+	var min, max Cell
+	for cell := range cells {
+		if first {
+			min, max, first = cell, cell, false
+			continue
+		}
+		min.x, max.x = minInt64(min.x, cell.x), maxInt64(max.x, cell.x)
+		min.y, max.y = minInt64(min.y, cell.y), maxInt64(max.y, cell.y)
+	}
+	return min, max, !first
+}
+
+// sorted returns the alive cells ordered by y and then x.
+func (cells Cells) sorted() []Cell {
+	sorted := make([]Cell, 0, len(cells))
+	for cell := range cells {
+		sorted = append(sorted, cell)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].y != sorted[j].y {
+			return sorted[i].y < sorted[j].y
+		}
+		return sorted[i].x < sorted[j].x
+	})
+	return sorted
+}
+
+// sortBufferCells is the most cells inOrder holds in memory at once, bar a
+// single band of rows with more than this many.
+const sortBufferCells = 1 << 22
+
+// sortBandShift groups rows into bands of 64 for inOrder's histogram.
+const sortBandShift = 6
+
+// inOrder visits the alive cells ordered by y and then x like sorted, but
+// without building a sorted copy of the whole universe. A first pass counts
+// the cells in each band of rows, the bands are grouped into chunks of at
+// most sortBufferCells, and each chunk is then collected by another pass over
+// the cells, sorted and visited in turn.
+func (cells Cells) inOrder(visit func(Cell) error) error {
+	counts := make(map[int64]int)
+	for cell := range cells {
+		counts[cell.y>>sortBandShift]++
+	}
+	bands := make([]int64, 0, len(counts))
+	for band := range counts {
+		bands = append(bands, band)
+	}
+	sort.Slice(bands, func(i, j int) bool { return bands[i] < bands[j] })
+
+	buffer := make([]Cell, 0, minInt64(int64(len(cells)), sortBufferCells))
+	for start := 0; start < len(bands); {
+		end, size := start, 0
+		for end < len(bands) && (end == start || size+counts[bands[end]] <= sortBufferCells) {
+			size += counts[bands[end]]
+			end++
+		}
+		first, last := bands[start], bands[end-1]
+		start = end
+
+		buffer = buffer[:0]
 		for cell := range cells {
-			for neighbor := range cell.neighbors() {
-				if !cells.hasCell(neighbor) { // neighbor is dead
-					deadNeighborCells.addCell(neighbor)
-				}
+			if band := cell.y >> sortBandShift; band >= first && band <= last {
+				buffer = append(buffer, cell)
+			}
+		}
+		sort.Slice(buffer, func(i, j int) bool {
+			if buffer[i].y != buffer[j].y {
+				return buffer[i].y < buffer[j].y
+			}
+			return buffer[i].x < buffer[j].x
+		})
+		for _, cell := range buffer {
+			if err := visit(cell); err != nil {
+				return err
 			}
 		}
+	}
+	return nil
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
 
-		for deadNeighbor := range deadNeighborCells {
-			deadNeighborsCh <- deadNeighbor
+func (cells Cells) equal(other Cells) bool {
+	if len(cells) != len(other) {
+		return false
+	}
+	for cell := range cells {
+		if !other.hasCell(cell) {
+			return false
 		}
+	}
+	return true
+}
 
-		close(deadNeighborsCh)
-	}()
-	return deadNeighborsCh
+// difference returns the cells alive in cells but not in other.
+func (cells Cells) difference(other Cells) Cells {
+	difference := make(Cells)
+	for cell := range cells {
+		if !other.hasCell(cell) {
+			difference.addCell(cell)
+		}
+	}
+	return difference
 }
 
-func (cells Cells) addCell(cell Cell) {
-	cells[cell] = struct{}{}
+// translated returns cells moved by offset, failing if any cell would leave
+// the int64 coordinate space.
+func (cells Cells) translated(offset Offset) (Cells, error) {
+	translated := make(Cells, len(cells))
+	for cell := range cells {
+		moved, ok := cell.offset(offset)
+		if !ok {
+			return nil, fmt.Errorf("cell %d,%d moved by %d,%d overflows", cell.x, cell.y, offset.dx, offset.dy)
+		}
+		translated.addCell(moved)
+	}
+	return translated, nil
 }
 
-func (cells Cells) hasCell(cell Cell) bool {
-	_, found := cells[cell]
-	return found
+func (cells Cells) clone() Cells {
+	clone := make(Cells, len(cells))
+	for cell := range cells {
+		clone.addCell(cell)
+	}
+	return clone
 }
 
-func (cells Cells) removeCell(cell Cell) {
-	delete(cells, cell)
+// Pattern is a universe as stored in a file: its cells and whatever the file
+// records about how they came about.
+type Pattern struct {
+	cells Cells
+	// generation is the number of generations the cells were run for.
+	generation int
+	// rule is the rulestring the cells evolve under, or empty if the file does
+	// not say.
+	rule string
+	// metadata is the name, author and comments the file gives.
+	metadata metadata
+	// decay is the decaying cells of a pattern of a Generations rule, which
+	// only some formats can hold.
+	decay Decay
 }
 
-func parseCells(inputFile string) (Cells, error) {
-	file, err := os.Open(inputFile)
+// parseCells reads the cells of a pattern file. When region is not nil,
+// cells outside it are discarded as they are read so that only the region is
+// ever held in memory.
+func parseCells(inputFile string, region *Rect) (Cells, error) {
+	pattern, err := parsePattern(inputFile, region)
+	return pattern.cells, err
+}
+
+// parsePattern reads a pattern file in whichever format it is in, see
+// parsePatternFormat.
+func parsePattern(inputFile string, region *Rect) (Pattern, error) {
+	pattern, _, err := parsePatternFormat(inputFile, region)
+	return pattern, err
+}
+
+// parsePatternFormat reads a pattern file, or stdin for "-", recognising its
+// format from its first lines, or else from its extension, or else taking it
+// to be Life 1.06. Compressed files are decompressed as they are read. It returns the
+// format it was read as.
+func parsePatternFormat(inputFile string, region *Rect) (Pattern, Format, error) {
+	in := os.Stdin
+	if inputFile != "-" {
+		file, err := os.Open(inputFile)
+		if err != nil {
+			return Pattern{}, Format{}, err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	reader, err := decompressing(in, inputFile)
 	if err != nil {
-		return nil, err
+		return Pattern{}, Format{}, err
+	}
+	// a short file makes Peek return what there is along with an error
+	prefix, _ := reader.Peek(sniffLength)
+	format, found := sniffFormat(prefix)
+	if !found {
+		if format, found = formatForFile(inputFile); !found {
+			format = formats[0]
+		}
 	}
-	defer file.Close()
+	pattern, err := format.read(reader, region)
+	if err == nil {
+		logger(logParser).Debug("Read the pattern", "file", inputFile, "format", format.name, "cells", len(pattern.cells))
+	}
+	return pattern, format, err
+}
 
-	cells := make(Cells)
+// parseLife106 reads a Life 1.06 file. Besides the header, the comment lines
+// written by printPattern are understood: "#G n" for the generation, "#R
+// rule" for the rulestring, as in Life 1.05, and "#N", "#O" and "#C" for the
+// name, author and comments, as in RLE.
+func parseLife106(r io.Reader, region *Rect) (Pattern, error) {
+	pattern := Pattern{cells: make(Cells)}
+	cells := pattern.cells
 
 	headerFound := false
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
+		if line == "" { // printCells separates the header with a blank line
+			continue
+		}
 		if strings.HasPrefix(line, "#") {
 			if line == FILE_HEADER && len(cells) == 0 {
 				headerFound = true
 			}
+			if generation, found := strings.CutPrefix(line, "#G "); found {
+				if _, err := fmt.Sscanf(generation, "%d", &pattern.generation); err != nil {
+					return Pattern{}, fmt.Errorf("failed to parse generation '%s', %v", generation, err)
+				}
+			}
+			if rule, found := strings.CutPrefix(line, "#R "); found {
+				if pattern.rule = strings.TrimSpace(rule); len(pattern.rule) > maxHeaderValueLength {
+					return Pattern{}, fmt.Errorf("rule is longer than %d characters", maxHeaderValueLength)
+				}
+			}
+			if _, err := pattern.metadata.parseHashLine(line); err != nil {
+				return Pattern{}, err
+			}
 			continue
 		}
 
 		cell := Cell{}
 		items, err := fmt.Fscanf(strings.NewReader(line), "%d %d", &cell.x, &cell.y)
 		if items < 2 || err != nil {
-			return nil, fmt.Errorf("failed to parse line '%d', %v", len(cells)+1, err)
+			return Pattern{}, fmt.Errorf("failed to parse line '%d', %v", len(cells)+1, err)
+		}
+		if err := checkCoordinates(cell); err != nil {
+			return Pattern{}, err
+		}
+		if region == nil || region.contains(cell) {
+			if len(cells) >= maxParsedCells {
+				return Pattern{}, errTooManyCells
+			}
+			cells.addCell(cell)
 		}
-		cells.addCell(cell)
 	}
 
 	if !headerFound {
-		return nil, fmt.Errorf("Invalid Game of Life file: needed %s indicator as first line", FILE_HEADER)
+		return Pattern{}, fmt.Errorf("Invalid Game of Life file: needed %s indicator as first line", FILE_HEADER)
 	}
 
-	return cells, nil
+	return pattern, nil
 }
 
 func printCells(w io.Writer, cells Cells) error {
-	if _, err := fmt.Fprintf(w, "%s\n\n", FILE_HEADER); err != nil {
+	return printPattern(w, Pattern{cells: cells})
+}
+
+// printPattern writes a Life 1.06 file, recording the generation and rule
+// when known so that a later run can -continue from it. The cells are written
+// in order, in bounded memory however large the universe is.
+func printPattern(w io.Writer, pattern Pattern) error {
+	return writeLife106(w, pattern, true)
+}
+
+// printUnsortedPattern is printPattern writing the cells in no particular
+// order, which saves the passes over the cells that sorting them takes.
+func printUnsortedPattern(w io.Writer, pattern Pattern) error {
+	return writeLife106(w, pattern, false)
+}
+
+func writeLife106(out io.Writer, pattern Pattern, sorted bool) error {
+	w := bufio.NewWriter(out)
+	if _, err := fmt.Fprintf(w, "%s\n", FILE_HEADER); err != nil {
 		return err
 	}
-	for cell := range cells {
-		if _, err := fmt.Fprintf(w, "%d %d\n", cell.x, cell.y); err != nil {
+	if pattern.generation != 0 {
+		if _, err := fmt.Fprintf(w, "#G %d\n", pattern.generation); err != nil {
 			return err
 		}
 	}
-	return nil
+	if pattern.rule != "" {
+		if _, err := fmt.Fprintf(w, "#R %s\n", pattern.rule); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(w, pattern.metadata.hashLines()); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w); err != nil {
+		return err
+	}
+	writeCell := func(cell Cell) error {
+		_, err := fmt.Fprintf(w, "%d %d\n", cell.x, cell.y)
+		return err
+	}
+	if sorted {
+		if err := pattern.cells.inOrder(writeCell); err != nil {
+			return err
+		}
+	} else {
+		for cell := range pattern.cells {
+			if err := writeCell(cell); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// naiveEngine advances a universe one generation at a time by counting the
+// alive neighbors of every cell next to an alive cell. It writes each
+// generation into a second buffer, the universe of the generation before,
+// swapping the two every step.
+type naiveEngine struct {
+	rule      Rule
+	reflected Neighborhood
+	// weights is what an alive cell adds to the count of the cell it reaches
+	// through each offset of reflected.
+	weights     []uint8
+	constraints constraints
+	// counts is reused between generations so its buckets are only allocated
+	// once for a universe of a given size.
+	counts map[Cell]uint8
+	// spread, when not nil, holds the only alive cells whose counts can
+	// matter: those within reach of the simulated region.
+	spread *Rect
+	// spare is the universe of the previous step, which the next generation
+	// is written into.
+	spare Cells
+}
+
+func newNaiveEngine(rule Rule, neighborhood Neighborhood, constraints constraints) *naiveEngine {
+	neighborhood = rule.countedOver(neighborhood)
+	// a cell sees an alive cell through offset d when the alive cell sees it
+	// through -d, so counts are spread from alive cells over the reflection
+	reflected := neighborhood.reflected()
+	engine := &naiveEngine{rule: rule, reflected: reflected, weights: rule.weights(reflected), constraints: constraints, counts: make(map[Cell]uint8)}
+	if constraints.simulated != nil {
+		spread := constraints.simulated.grown(neighborhood.radius())
+		engine.spread = &spread
+	}
+	return engine
+}
+
+// step writes the generation after cells into the spare buffer, returning it
+// together with the cells that were born and the cells that died. cells
+// becomes the spare buffer for the next step.
+func (engine *naiveEngine) step(cells Cells) (Cells, Cells, Cells) {
+	// Count the alive neighbors of every cell that has at least one, in a single
+	// pass over the alive cells.
+	clear(engine.counts)
+	for cell := range cells {
+		if engine.spread != nil && !engine.spread.contains(cell) {
+			continue
+		}
+		for i, offset := range engine.reflected {
+			if neighbor, ok := cell.offset(offset); ok {
+				engine.counts[neighbor] += engine.weights[i]
+			}
+		}
+	}
+
+	next := engine.spare
+	if next == nil {
+		next = make(Cells, len(cells))
+	}
+	clear(next)
+
+	// An "alive" cell whose count of alive neighbors (in any of the cells of its neighborhood) is a survival count stays alive.
+	dyingCells := make(Cells)
+	for cell := range cells {
+		if !engine.constraints.allowsDeath(cell) || engine.rule.survives(engine.counts[cell]) {
+			next.addCell(cell)
+		} else {
+			dyingCells.addCell(cell)
+		}
+	}
+
+	// A "dead" cell whose count of alive neighbors is a birth count becomes alive.
+	birthedCells := make(Cells)
+	for cell, aliveNeighbors := range engine.counts {
+		if !cells.hasCell(cell) && engine.rule.births(aliveNeighbors) && engine.constraints.allowsBirth(cell) {
+			next.addCell(cell)
+			birthedCells.addCell(cell)
+		}
+	}
+
+	engine.spare = cells
+	return next, birthedCells, dyingCells
+}
+
+type runOptions struct {
+	// inputs are composed into the universe to run; the first decides the
+	// format, generation and rule.
+	inputs []placedInput
+	// format and outputFormat, when not nil, override the format of the input
+	// and of the result.
+	format, outputFormat *Format
+	// gzip compresses the printed result.
+	gzip bool
+	// unsorted prints a Life 1.06 result without sorting its cells.
+	unsorted bool
+	// board, when not nil, prints the result as a board instead, over its
+	// viewport or else the bounding box of the result.
+	board *viewTransform
+	// rule, when not nil, is the rule to run under instead of that of the
+	// continued run or B3/S23.
+	rule        *Rule
+	continueRun bool
+	loadRegion  *Rect
+	// recenterInput moves each input to put its median cell at the origin.
+	recenterInput bool
+	iterations    int
+	stop          condition
+	// gps, when positive, paces the run in real time.
+	gps               float64
+	workers           int
+	verifyDeterminism bool
+	paranoid          bool
+	deltaFile         string
+	history           string
+	corpus            string
+	// cacheDir, when not empty, is where the results of cacheable runs are
+	// looked up and kept.
+	cacheDir string
+	// stagingDir, when not empty, is where the outputs of the run are
+	// staged, and staging is their staging once the run has started.
+	stagingDir string
+	staging    *outputStaging
+	// historyBudget bounds the work of rebuilding a generation of history.
+	historyBudget float64
+	midiFile      string
+	statsFile     string
+	// saveEvery, when positive, saves the generations that are multiples of it
+	// to saveDir.
+	saveEvery int
+	saveDir   string
+	// checkpoint saves the run every checkpointEvery generations, and resume
+	// carries on the run of a checkpoint instead of reading inputs.
+	checkpoint      string
+	checkpointEvery int
+	resume          string
+	// codec compresses checkpoints and histories.
+	codec      Codec
+	provenance string
+	// render is the PNG file to render generation renderGeneration to, or the
+	// last when it is negative.
+	render string
+	// tiles is the directory to export generation renderGeneration to as a
+	// tile pyramid.
+	tiles    string
+	cellSize int
+	flipY    bool
+	// hex draws the renders as a hex grid, for the hex neighborhood.
+	hex              bool
+	renderGeneration int
+	// gif records every gifFrameEvery generations, or more often the more
+	// cells change when adaptiveFrames, within gifViewport when it is not
+	// nil. -frames-raw is sampled alike.
+	gif            string
+	gifFrameEvery  int
+	adaptiveFrames bool
+	gifViewport    *Rect
+	// framesViewport, when not nil, is written to stdout as raw frames
+	// instead of the result.
+	framesViewport *Rect
+	led            ledOptions
+	neighborhood   Neighborhood
+	// topology is the shape of the universe, whose bounds are also among
+	// constraints.
+	topology    topology
+	constraints constraints
+	analyze     bool
+	// analysisJSON is where to write the analysis as JSON, if anywhere.
+	analysisJSON string
+	// follow, when not nil, is the motion renders and analysisJSON follow, or
+	// a zero period to follow whatever motion the run has.
+	follow *motion
+	// overlay, when not nil, is drawn over -render, and annotations over
+	// -render and -gif.
+	overlay     *analysisReport
+	annotations []annotation
+	forecast    int
+	fastForward bool
+
+	fromClipboard, toClipboard bool
+	strictResources            bool
 }
 
-func runGameOfLife(inputFile string, iterations int) error {
-	cells, err := parseCells(*inputArg)
+// runGameOfLife stages the outputs of the run described by opts, see
+// outputStaging, and moves them into place once it succeeds.
+func runGameOfLife(opts runOptions) error {
+	resumeStaged(opts.stagingDir)
+	staging, err := stageOutputs(opts.stagingDir, []string{opts.deltaFile, opts.history, opts.midiFile, opts.statsFile, opts.gif, opts.render, opts.tiles, opts.analysisJSON, opts.provenance})
+	if err != nil {
+		return fmt.Errorf("staging outputs failed: %v", err)
+	}
+	opts.staging = staging
+	if err := simulate(opts); err != nil {
+		staging.discard()
+		return err
+	}
+	return staging.commit()
+}
+
+// runRule is the rule a run of pattern is under: override, given by -rule,
+// or else the rule of the pattern, or else B3/S23. The rule of a pattern
+// that is continued must parse; that of any other is only warned about.
+func runRule(pattern Pattern, override *Rule, continuing bool) (Rule, error) {
+	rule := conwayRule
+	if pattern.rule != "" {
+		parsed, err := parseRule(pattern.rule)
+		switch {
+		case err != nil && continuing:
+			return Rule{}, err
+		case err != nil && override == nil:
+			// such as a rule with a bounded grid, B3/S23:T100,100
+			logger(logEngine).Warn("Running under "+conwayRule.String()+", the rule of the input is not supported; give -rule to run it under another", "error", err)
+		case err != nil:
+		case override != nil && override.String() != parsed.String():
+			logger(logEngine).Warn("Running under -rule instead of the rule of the input", "rule", override.String(), "input", parsed.String())
+		default:
+			rule = parsed
+		}
+	}
+	if override != nil {
+		rule = *override
+	}
+	return rule, nil
+}
+
+func simulate(opts runOptions) error {
+	started := time.Now()
+	var pattern Pattern
+	var err error
+	// the result is printed as Life 1.06 unless the input was in another format
+	output := formats[0]
+	// a resumed run picks up where its checkpoint left off
+	target := -1
+	switch {
+	case opts.resume != "":
+		var state checkpoint
+		state, err = readCheckpointFile(opts.resume)
+		pattern, target = state.pattern, state.target
+		if opts.iterations == 0 && target > pattern.generation {
+			opts.iterations = target - pattern.generation
+		}
+	case opts.fromClipboard:
+		pattern.cells, err = readClipboardCells(opts.loadRegion)
+	default:
+		pattern, output, err = readInputs(opts.inputs, opts.format, opts.loadRegion, opts.recenterInput)
+	}
+	if opts.outputFormat != nil {
+		output = *opts.outputFormat
+	}
+	if opts.unsorted && output.name == formats[0].name {
+		output.write = printUnsortedPattern
+	}
 	if err != nil {
 		return fmt.Errorf("parsing cells failed: %v", err)
 	}
+	// a continued run picks up the generation the file was saved with
+	startGeneration := 0
+	continuing := opts.continueRun || opts.resume != ""
+	if continuing {
+		startGeneration = pattern.generation
+	}
+	rule, err := runRule(pattern, opts.rule, continuing)
+	if err != nil {
+		return fmt.Errorf("continuing the run failed: %v", err)
+	}
+	if opts.topology.wraps && rule.isGenerations() {
+		return fmt.Errorf("-topology torus only supports rules of two states, not %s", rule)
+	}
+	pattern.keepStates(rule)
+	cells := opts.topology.wrapped(pattern.cells)
+	opts.constraints.apply(cells)
+	inputHash := cells.hash()
+
+	if err := checkResources(estimateMemory(cells, rule, opts.iterations), opts.strictResources); err != nil {
+		return err
+	}
+
+	var sinks []EventSink
+	// checkpointed is what checkpointedOutputs puts in place at checkpoints
+	checkpointed := &checkpointedOutputs{staging: opts.staging, every: opts.checkpointEvery}
+	if opts.deltaFile != "" {
+		file, err := os.Create(opts.staging.path(opts.deltaFile))
+		if err != nil {
+			return fmt.Errorf("creating delta stream failed: %v", err)
+		}
+		defer file.Close()
+
+		delta, err := newDeltaWriter(file)
+		if err != nil {
+			return fmt.Errorf("writing delta stream failed: %v", err)
+		}
+		sinks = append(sinks, delta)
+		checkpointed.sinks, checkpointed.targets = append(checkpointed.sinks, delta), append(checkpointed.targets, opts.deltaFile)
+	}
+	if opts.history != "" {
+		file, err := createCompressed(opts.staging.path(opts.history), opts.codec)
+		if err != nil {
+			return fmt.Errorf("creating history failed: %v", err)
+		}
+		defer file.Close()
+
+		history, err := newHistoryWriter(file, rule, opts.historyBudget)
+		if err != nil {
+			return fmt.Errorf("writing history failed: %v", err)
+		}
+		sinks = append(sinks, closingSink{history, file})
+		// a compressed history cut short cannot be read
+		if opts.codec.name == "none" {
+			checkpointed.sinks, checkpointed.targets = append(checkpointed.sinks, history), append(checkpointed.targets, opts.history)
+		}
+	}
+	if opts.midiFile != "" {
+		file, err := os.Create(opts.staging.path(opts.midiFile))
+		if err != nil {
+			return fmt.Errorf("creating MIDI file failed: %v", err)
+		}
+		defer file.Close()
+
+		sinks = append(sinks, newMIDISink(file))
+	}
+	if opts.checkpoint != "" {
+		if rule.isGenerations() {
+			return fmt.Errorf("-checkpoint cannot save the states of multi-state rules besides alive and dead")
+		}
+		if opts.resume == "" {
+			target = -1
+			if opts.iterations > 0 {
+				target = startGeneration + opts.iterations
+			}
+		}
+		sinks = append(sinks, newCheckpointSink(opts.checkpoint, opts.checkpointEvery, target, rule, opts.codec))
+	}
+	if opts.saveEvery > 0 {
+		save, err := newSaveSink(opts.saveDir, opts.saveEvery, rule)
+		if err != nil {
+			return fmt.Errorf("creating save directory failed: %v", err)
+		}
+		sinks = append(sinks, save)
+	}
+	var statsCSV *statsSink
+	if opts.statsFile != "" {
+		file, err := os.Create(opts.staging.path(opts.statsFile))
+		if err != nil {
+			return fmt.Errorf("creating stats file failed: %v", err)
+		}
+		defer file.Close()
+
+		if statsCSV, err = newStatsSink(file); err != nil {
+			return fmt.Errorf("writing stats failed: %v", err)
+		}
+		sinks = append(sinks, statsCSV)
+		checkpointed.sinks, checkpointed.targets = append(checkpointed.sinks, statsCSV), append(checkpointed.targets, opts.statsFile)
+	}
+	if opts.staging != nil && opts.checkpoint != "" && len(checkpointed.sinks) > 0 {
+		sinks = append(sinks, checkpointed)
+	}
+	// the sinks that draw the run, which -follow moves along with it
+	var rendered []EventSink
+	if opts.gif != "" {
+		file, err := os.Create(opts.staging.path(opts.gif))
+		if err != nil {
+			return fmt.Errorf("creating GIF failed: %v", err)
+		}
+		defer file.Close()
+
+		view := viewTransform{cellSize: opts.cellSize, flipY: opts.flipY, hex: opts.hex}
+		if opts.gifViewport != nil {
+			view.viewport = *opts.gifViewport
+		}
+		rendered = append(rendered, newGIFSink(file, frameSampler{every: opts.gifFrameEvery, adaptive: opts.adaptiveFrames}, view, opts.annotations))
+	}
+	if opts.framesViewport != nil {
+		view := viewTransform{*opts.framesViewport, opts.cellSize, opts.flipY, opts.hex}
+		frames, err := newRawFrameSink(os.Stdout, view, frameSampler{every: opts.gifFrameEvery, adaptive: opts.adaptiveFrames})
+		if err != nil {
+			return fmt.Errorf("invalid -frames-viewport: %v", err)
+		}
+		width, height, _ := view.size()
+		logger(logRenderer).Info("Writing raw frames", "ffmpeg", fmt.Sprintf("-f rawvideo -pix_fmt rgba -s %dx%d", width, height))
+		rendered = append(rendered, frames)
+	}
+	if opts.render != "" {
+		rendered = append(rendered, newSnapshotSink(opts.staging.path(opts.render), viewTransform{cellSize: opts.cellSize, flipY: opts.flipY, hex: opts.hex}, opts.renderGeneration, opts.overlay, opts.annotations))
+	}
+	if opts.tiles != "" {
+		rendered = append(rendered, newTilesSink(opts.staging.path(opts.tiles), opts.cellSize, opts.flipY, opts.renderGeneration))
+	}
+	var follow *followSink
+	if opts.follow != nil {
+		follow = newFollowSink(*opts.follow, rendered)
+		sinks = append(sinks, follow)
+	} else {
+		sinks = append(sinks, rendered...)
+	}
+	if opts.led.target != "" {
+		led, err := newLEDSink(opts.led)
+		if err != nil {
+			return fmt.Errorf("connecting to LED display failed: %v", err)
+		}
+		sinks = append(sinks, led)
+	}
+	if opts.topology.wraps {
+		sinks = append(sinks, newTorusPeriodSink(*opts.topology.bounds))
+	}
+	var stats *analysis
+	switch {
+	case opts.analyze:
+		stats = newAnalysis(os.Stderr, opts.forecast)
+	case opts.analysisJSON != "":
+		stats = newAnalysis(io.Discard, opts.forecast)
+	}
+
+	// a late generation is not shown on outputs that can do without it, such
+	// as displays, so that they catch up
+	emit := func(event Event, late bool) error {
+		for _, sink := range sinks {
+			if late && !needsEveryGeneration([]EventSink{sink}) {
+				continue
+			}
+			if err := sink.observe(event); err != nil {
+				return err
+			}
+		}
+		if stats != nil {
+			return stats.observe(event)
+		}
+		return nil
+	}
+	if err := emit(Event{generation: startGeneration, cells: cells, born: cells, decay: pattern.decay}, false); err != nil {
+		return err
+	}
+
+	// Skipping ahead is only exact when every generation follows from the one
+	// before by translation, which frozen or masked regions break, and when no
+	// output needs each generation.
+	// A stop condition could hold in the middle of a skipped stretch, and a
+	// real-time run is meant to show every generation, so those runs are
+	// simulated generation by generation too. The decaying cells of
+	// Generations rules are not seen repeating, so those are too.
+	fastForward := opts.fastForward && opts.stop == nil && opts.gps == 0 && !needsEveryGeneration(sinks) && opts.constraints.isEmpty() && !rule.isGenerations()
+	var detector *motionDetector
+	if stats != nil || fastForward || (opts.stop != nil && needsPeriod(opts.stop)) {
+		detector = newMotionDetector(maxDetectedPeriod)
+		detector.observe(0, cells)
+	}
+
+	// a run with nothing to show but its result may have been run before
+	var cache *resultCache
+	cacheHit := false
+	cacheEntry := ""
+	if opts.cacheDir != "" && cacheable(opts, rule, sinks, stats) {
+		cache = &resultCache{opts.cacheDir}
+		cacheEntry = cacheKey(cells, rule, opts.neighborhood, startGeneration, opts.iterations)
+		var cached Cells
+		if cached, cacheHit = cache.lookup(cacheEntry); cacheHit {
+			logger(logEngine).Info("Using the cached result", "key", cacheEntry)
+			cells = cached
+		}
+	}
 
 	// Run simulation
-	for iteration := 0; iteration < iterations; iteration++ {
-		// If an "alive" cell had less than 2 or more than 3 alive neighbors (in any of the 8 surrounding cells), it becomes dead.
-		dyingCells := make(Cells)
-		for cell := range cells {
-			aliveNeighbors := cells.numAliveNeighbors(cell)
-			if aliveNeighbors < 2 || aliveNeighbors > 3 {
-				dyingCells.addCell(cell)
+	engine := newEngine(rule, opts.neighborhood, opts.constraints, opts.workers, pattern.decay)
+	generationsRun, _ := engine.(*generationsEngine)
+	tableRun, _ := engine.(*tableEngine)
+	if parallel, ok := engine.(*parallelEngine); ok && statsCSV != nil {
+		statsCSV.scheduler = &parallel.stats
+	}
+	if opts.paranoid {
+		engine = newParanoidEngine(engine, rule.countedOver(opts.neighborhood), opts.constraints, startGeneration)
+	}
+	// the torus goes around the paranoid engine, which checks the step on the
+	// cells copied beyond the edges, where nothing travels faster than light
+	if opts.topology.wraps {
+		if engine, err = newTorusEngine(engine, *opts.topology.bounds, rule.countedOver(opts.neighborhood)); err != nil {
+			return err
+		}
+	}
+	if !cacheHit {
+		logger(logEngine).Debug("Starting the run", "rule", rule.String(), "workers", max(opts.workers, 1), "fast-forward", fastForward)
+	}
+	// a reference engine with another number of workers replays each step to
+	// check that the result does not depend on it
+	var reference Engine
+	if opts.verifyDeterminism {
+		referenceWorkers := 1
+		if opts.workers <= 1 {
+			referenceWorkers = 2
+		}
+		reference = newEngine(rule, opts.neighborhood, opts.constraints, referenceWorkers, pattern.decay)
+		if opts.topology.wraps {
+			reference, _ = newTorusEngine(reference, *opts.topology.bounds, rule.countedOver(opts.neighborhood))
+		}
+	}
+	// with a stop condition and no -iterations the run lasts until it holds
+	unbounded := opts.stop != nil && opts.iterations == 0
+	generations, period := 0, 0
+	if cacheHit {
+		generations = opts.iterations
+	}
+	var clock *realtimeClock
+	if opts.gps > 0 {
+		clock = newRealtimeClock(opts.gps)
+	}
+	// the last event, and whether it was too late for some outputs
+	var final Event
+	finalLate := false
+	for iteration := 0; !cacheHit && (unbounded || iteration < opts.iterations); iteration++ {
+		var before Cells
+		if reference != nil {
+			before = cells.clone()
+		}
+		var born, died Cells
+		cells, born, died = engine.step(cells)
+		if reference != nil {
+			referenceCells, referenceBorn, referenceDied := reference.step(before)
+			if !referenceBorn.equal(born) || !referenceDied.equal(died) || !referenceCells.equal(cells) {
+				return fmt.Errorf("generation %d differs between %d and another number of workers", startGeneration+iteration+1, max(opts.workers, 1))
 			}
 		}
+		generations = iteration + 1
+		late := false
+		if clock != nil {
+			late = !clock.wait()
+			if clock.shouldDegrade() && stats != nil {
+				clock.degradedAt = startGeneration + iteration + 1
+				stats = nil
+			}
+		}
+		var decay Decay
+		if generationsRun != nil {
+			decay = generationsRun.decay
+		}
+		final, finalLate = Event{startGeneration + iteration + 1, cells, born, died, decay}, late
+		if err := emit(final, late); err != nil {
+			return err
+		}
 
-		// If a "dead" cell had *exactly* 3 alive neighbors, it becomes alive.
-		birthedCells := make(Cells)
-		for cell := range cells.deadNeighbors() {
-			aliveNeighbors := cells.numAliveNeighbors(cell)
-			if aliveNeighbors == 3 {
-				birthedCells.addCell(cell)
+		if detector != nil {
+			if m, found := detector.observe(iteration+1, cells); found {
+				detector = nil
+				period = m.period
+				if stats != nil {
+					stats.motion = &m
+				}
+				if fastForward {
+					previous := cells
+					var skipped int
+					if cells, skipped = m.advance(cells, opts.iterations-iteration-1); skipped > 0 {
+						iteration += skipped
+						generations = iteration + 1
+						// the jump's born and died cells are whatever the translation changed
+						final, finalLate = Event{startGeneration + iteration + 1, cells, cells.difference(previous), previous.difference(cells), nil}, false
+						if err := emit(final, false); err != nil {
+							return err
+						}
+					}
+				}
 			}
 		}
 
-		// apply changes for next iteration
-		for cell := range dyingCells {
-			cells.removeCell(cell)
+		if opts.stop != nil {
+			state := runState{startGeneration + iteration + 1, len(cells), len(born), len(died), period}
+			if opts.stop.holds(state) {
+				break
+			}
 		}
-		for cell := range birthedCells {
-			cells.addCell(cell)
+	}
+
+	// the outputs that skipped the last generation for being late still end
+	// on it, since the engine reuses the universes they last saw
+	if finalLate {
+		for _, sink := range sinks {
+			if !needsEveryGeneration([]EventSink{sink}) {
+				if err := sink.observe(final); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, sink := range sinks {
+		if err := sink.close(); err != nil {
+			return err
 		}
 	}
 
-	if err := printCells(os.Stdout, cells); err != nil {
-		return fmt.Errorf("printing cells failed: %v", err)
+	result := Pattern{cells: cells, generation: startGeneration + generations, rule: rule.String(), metadata: pattern.metadata.evolved(generations, startGeneration+generations)}
+	if generationsRun != nil {
+		result.decay = generationsRun.decay
+	}
+	if tableRun != nil {
+		result.decay = tableRun.states
+	}
+	if cache != nil && !cacheHit {
+		if err := cache.store(cacheEntry, result, opts.codec); err != nil {
+			logger(logEngine).Warn("Not caching the result", "key", cacheEntry, "error", err)
+		}
+	}
+	switch {
+	case opts.framesViewport != nil:
+		// stdout carries the frames
+	default:
+		// the printed result is committed along with the outputs
+		out, err := opts.staging.resultWriter()
+		if err != nil {
+			return fmt.Errorf("printing cells failed: %v", err)
+		}
+		defer out.Close()
+		if opts.board != nil {
+			if err := printBoard(out, cells, result.decay, opts.board.fitted(union(cells, result.decay.cells()))); err != nil {
+				return fmt.Errorf("printing board failed: %v", err)
+			}
+		} else if err := printResult(out, output, result, opts.gzip); err != nil {
+			return fmt.Errorf("printing cells failed: %v", err)
+		}
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("printing cells failed: %v", err)
+		}
+	}
+
+	if opts.toClipboard {
+		if err := writeClipboardCells(cells); err != nil {
+			return fmt.Errorf("copying cells to clipboard failed: %v", err)
+		}
+	}
+
+	if stats != nil {
+		if err := stats.close(); err != nil {
+			return err
+		}
+		if opts.analysisJSON != "" {
+			report := stats.report(cells, rule)
+			if follow != nil {
+				report.followed(follow.follower.offset(report.Generation))
+			}
+			if err := writeAnalysisReport(opts.staging.path(opts.analysisJSON), report); err != nil {
+				return fmt.Errorf("writing analysis failed: %v", err)
+			}
+		}
+	} else if opts.analysisJSON != "" {
+		logger(logTools).Warn("Not writing the analysis: it was dropped for falling behind -gps", "analysis-json", opts.analysisJSON)
+	}
+
+	if clock != nil {
+		clock.report(os.Stderr)
+	}
+
+	if opts.corpus != "" {
+		// only what corpus verify can replay is recorded
+		if opts.fromClipboard || len(opts.inputs) != 1 || opts.inputs[0].file == "-" || opts.inputs[0].preset != "" || opts.inputs[0].offset != (Offset{}) || !opts.constraints.isEmpty() {
+			logger(logTools).Warn("Not recording the run: runs from the clipboard, stdin, built in patterns, composed inputs or with -freeze, -mask or -roi cannot be replayed", "corpus", opts.corpus)
+		} else {
+			entry := corpusEntry{opts.inputs[0].file, opts.loadRegion, inputHash, rule, opts.neighborhood, startGeneration, generations, cells.hash()}
+			if err := recordCorpusEntry(opts.corpus, entry); err != nil {
+				return fmt.Errorf("recording run in corpus failed: %v", err)
+			}
+		}
+	}
+
+	if opts.provenance != "" {
+		if err := writeProvenance(opts, started, result); err != nil {
+			return fmt.Errorf("writing provenance failed: %v", err)
+		}
 	}
 
 	return nil
 }
 
 func main() {
+	flag.Var(&inputArg, "input", "The game of life file to parse, or - to read it from stdin; given as file@x,y (or file@anchor) and repeated, the patterns are placed with those offsets into one universe")
+	flag.Var(&patternArg, "pattern", "A built in pattern to place into the universe, given as name or name@x,y (or name@anchor) and combinable with -input; may be repeated. One of "+strings.Join(presetNames(), ", "))
+	flag.Var(anchorsArg, "anchor", "Name a coordinate as name=x,y, usable wherever a flag takes a coordinate; may be repeated")
+	flag.Var(&frozenArg, "freeze", "A region x,y,w,h (or anchor,w,h) whose cells never change; may be repeated")
+	flag.Var(&maskedArg, "mask", "A region x,y,w,h (or anchor,w,h) whose cells are always dead; may be repeated")
+	flag.TextVar(&logLevelArg, "log-level", slog.LevelInfo, "Log messages of this level and above: debug, info, warn or error")
 	flag.Parse()
 
-	if err := runGameOfLife(*inputArg, *iterationsArg); err != nil {
+	if err := setUpLogging(logOptions{logLevelArg, *logFileArg, *logMaxSizeArg, parseLogSubsystems(*logSubsystemsArg)}); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags, err='%v'", err)
+		os.Exit(1)
+	}
+
+	ruleDir = *ruleDirArg
+
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Arg(0), flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to run %s, err='%v'", flag.Arg(0), err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	neighborhood, err := loadNeighborhood(*neighborhoodArg, *kernelArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid neighborhood, err='%v'", err)
+		os.Exit(1)
+	}
+	// a hex grid is drawn with its rows shifted, so it looks the part
+	hex := *neighborhoodArg == "hex" && *kernelArg == ""
+
+	var rule *Rule
+	if *ruleArg != "" {
+		parsed, err := parseRule(*ruleArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -rule, err='%v'", err)
+			os.Exit(1)
+		}
+		rule = &parsed
+		hex = hex || parsed.table != nil && parsed.table.hexagonal
+	}
+
+	topology, err := parseTopology(*topologyArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -topology, err='%v'", err)
+		os.Exit(1)
+	}
+
+	frozen, err := parseRects(frozenArg, anchorsArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -freeze, err='%v'", err)
+		os.Exit(1)
+	}
+	masked, err := parseRects(maskedArg, anchorsArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -mask, err='%v'", err)
+		os.Exit(1)
+	}
+
+	var loadRegion *Rect
+	if *loadRegionArg != "" {
+		region, err := parseRect(*loadRegionArg, anchorsArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -load-region, err='%v'", err)
+			os.Exit(1)
+		}
+		loadRegion = &region
+	}
+
+	ledWidth, ledHeight, err := parseSize(*ledSizeArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -led-size, err='%v'", err)
+		os.Exit(1)
+	}
+	ledOrigin, err := anchorsArg.resolve(*ledOriginArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -led-origin, err='%v'", err)
+		os.Exit(1)
+	}
+
+	var simulated *Rect
+	if *roiArg != "" {
+		roi, err := parseRect(*roiArg, anchorsArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -roi, err='%v'", err)
+			os.Exit(1)
+		}
+		// Nothing travels further than the radius of the neighborhood in one
+		// generation, so simulating the light cone of the region over the run
+		// keeps the region exact however the rest is frozen.
+		margin := *roiMarginArg
+		if margin < 0 {
+			if *iterationsArg == 0 {
+				fmt.Fprintf(os.Stderr, "Invalid -roi, a -roi-margin is needed for runs without -iterations")
+				os.Exit(1)
+			}
+			radius := neighborhood.radius()
+			if rule != nil {
+				radius = rule.countedOver(neighborhood).radius()
+			}
+			margin = radius * int64(*iterationsArg)
+		}
+		roi = roi.grown(margin)
+		simulated = &roi
+	}
+
+	var format, outputFormat *Format
+	if *formatArg != "" {
+		named, err := formatByName(*formatArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -format, err='%v'", err)
+			os.Exit(1)
+		}
+		format = &named
+	}
+	if *outputFormatArg != "" {
+		named, err := formatByName(*outputFormatArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -output-format, err='%v'", err)
+			os.Exit(1)
+		}
+		outputFormat = &named
+	}
+
+	if *cellSizeArg <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -cell-size %d, must be positive", *cellSizeArg)
+		os.Exit(1)
+	}
+
+	if *frameEveryArg <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -frame-every %d, must be positive", *frameEveryArg)
+		os.Exit(1)
+	}
+	if *sampleArg != "every" && *sampleArg != "adaptive" {
+		fmt.Fprintf(os.Stderr, "Invalid -sample '%s', expected every or adaptive", *sampleArg)
+		os.Exit(1)
+	}
+	var gifViewport *Rect
+	if *gifViewportArg != "" {
+		viewport, err := parseRect(*gifViewportArg, anchorsArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -gif-viewport, err='%v'", err)
+			os.Exit(1)
+		}
+		gifViewport = &viewport
+	}
+
+	var framesViewport *Rect
+	if *framesRawArg {
+		if *framesViewportArg == "" {
+			fmt.Fprintf(os.Stderr, "Invalid -frames-raw, a -frames-viewport is needed")
+			os.Exit(1)
+		}
+		viewport, err := parseRect(*framesViewportArg, anchorsArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -frames-viewport, err='%v'", err)
+			os.Exit(1)
+		}
+		framesViewport = &viewport
+	}
+
+	var overlay *analysisReport
+	if *overlayArg != "" {
+		if overlay, err = readAnalysisReport(*overlayArg); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -overlay, err='%v'", err)
+			os.Exit(1)
+		}
+	}
+
+	var annotations []annotation
+	if *annotationsArg != "" {
+		if annotations, err = readAnnotations(*annotationsArg); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -annotations, err='%v'", err)
+			os.Exit(1)
+		}
+	}
+
+	var follow *motion
+	if *followArg != "" {
+		parsed, err := parseFollow(*followArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -follow, err='%v'", err)
+			os.Exit(1)
+		}
+		follow = &parsed
+	}
+
+	var board *viewTransform
+	if *printBoardArg {
+		board = &viewTransform{flipY: *flipYArg, hex: hex}
+		if *boardViewportArg != "" {
+			if board.viewport, err = parseRect(*boardViewportArg, anchorsArg); err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid -board-viewport, err='%v'", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	codec, err := codecByName(*codecArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -codec, err='%v'", err)
+		os.Exit(1)
+	}
+
+	var stop condition
+	if *stopArg != "" {
+		if stop, err = parseCondition(*stopArg); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -stop, err='%v'", err)
+			os.Exit(1)
+		}
+	}
+
+	var inputs []placedInput
+	for _, input := range inputArg {
+		inputs = append(inputs, parsePlacedInput(input, anchorsArg))
+	}
+	for _, preset := range patternArg {
+		input, err := parsePresetInput(preset, anchorsArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -pattern, err='%v'", err)
+			os.Exit(1)
+		}
+		inputs = append(inputs, input)
+	}
+	if *inputsArg != "" {
+		manifest, err := readInputManifest(*inputsArg, anchorsArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -inputs, err='%v'", err)
+			os.Exit(1)
+		}
+		inputs = append(inputs, manifest...)
+	}
+	if *continueArg != "" {
+		if len(inputs) > 0 {
+			fmt.Fprintf(os.Stderr, "Only one of -input, -pattern and -continue may be given")
+			os.Exit(1)
+		}
+		inputs = []placedInput{{file: *continueArg}}
+	}
+	if *resumeArg != "" && len(inputs) > 0 {
+		fmt.Fprintf(os.Stderr, "Only one of -input, -pattern, -continue and -resume may be given")
+		os.Exit(1)
+	}
+	if len(inputs) == 0 && !*fromClipboardArg && *resumeArg == "" {
+		fmt.Fprintf(os.Stderr, "Missing -input, -inputs, -pattern, -continue or -resume")
+		os.Exit(1)
+	}
+
+	if err := runGameOfLife(runOptions{
+		inputs:            inputs,
+		format:            format,
+		outputFormat:      outputFormat,
+		gzip:              *gzipArg,
+		unsorted:          *unsortedArg,
+		board:             board,
+		rule:              rule,
+		continueRun:       *continueArg != "",
+		loadRegion:        loadRegion,
+		recenterInput:     *recenterInputArg,
+		iterations:        *iterationsArg,
+		stop:              stop,
+		gps:               *gpsArg,
+		workers:           *workersArg,
+		verifyDeterminism: *verifyDeterminismArg,
+		paranoid:          *paranoidArg,
+		cacheDir:          cacheDir(*cacheDirArg, *noCacheArg),
+		stagingDir:        stagingDir(*stagingDirArg, *noStagingArg),
+		deltaFile:         *deltaArg,
+		history:           *historyArg,
+		corpus:            *corpusArg,
+		historyBudget:     *historyBudgetArg,
+		midiFile:          *midiArg,
+		statsFile:         *statsArg,
+		saveEvery:         *saveEveryArg,
+		saveDir:           *saveDirArg,
+		checkpoint:        *checkpointArg,
+		checkpointEvery:   *checkpointEveryArg,
+		resume:            *resumeArg,
+		codec:             codec,
+		provenance:        *provenanceArg,
+		render:            *renderArg,
+		tiles:             *tilesArg,
+		cellSize:          *cellSizeArg,
+		flipY:             *flipYArg,
+		hex:               hex,
+		renderGeneration:  *renderGenerationArg,
+		gif:               *gifArg,
+		gifFrameEvery:     *frameEveryArg,
+		adaptiveFrames:    *sampleArg == "adaptive",
+		gifViewport:       gifViewport,
+		framesViewport:    framesViewport,
+		led: ledOptions{
+			target:     *ledArg,
+			viewport:   Rect{ledOrigin.x, ledOrigin.y, ledWidth, ledHeight},
+			brightness: *ledBrightnessArg,
+			fps:        *ledFPSArg,
+			serpentine: *ledSerpentineArg,
+		},
+		neighborhood: neighborhood,
+		topology:     topology,
+		constraints:  constraints{frozen: frozen, masked: masked, simulated: simulated, bounds: topology.bounds},
+		analyze:      *analyzeArg,
+		analysisJSON: *analysisJSONArg,
+		follow:       follow,
+		overlay:      overlay,
+		annotations:  annotations,
+		forecast:     *forecastArg,
+		fastForward:  *fastForwardArg,
+
+		fromClipboard: *fromClipboardArg,
+		toClipboard:   *toClipboardArg,
+
+		strictResources: *strictResourcesArg,
+	}); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to run Game of Life, err='%v'", err)
 		os.Exit(1)
 	}
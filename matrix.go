@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	NPY_MAGIC = "\x93NUMPY"
+)
+
+// maxMatrixCells bounds the bounding box written as a matrix, dead cells and
+// all, so that a sparse pattern cannot fill the disk.
+const maxMatrixCells = 1 << 32
+
+// maxNPYHeaderLength bounds the dictionary in the header of a .npy file.
+const maxNPYHeaderLength = 1 << 16
+
+// matrixSize is the size of the matrix holding the bounding box of cells, and
+// its top-left corner.
+func matrixSize(cells Cells) (Cell, int64, int64, error) {
+	min, max, ok := cells.boundingBox()
+	if !ok {
+		return Cell{}, 0, 0, nil
+	}
+	w, h := max.x-min.x+1, max.y-min.y+1
+	if w > maxMatrixCells/h {
+		return Cell{}, 0, 0, fmt.Errorf("bounding box of %dx%d cells is too large for a matrix of at most %d", w, h, int64(maxMatrixCells))
+	}
+	return min, w, h, nil
+}
+
+// matrixCell adds the cell at row and column of a matrix to cells, unless it
+// is outside region.
+func matrixCell(cells Cells, row, column int64, region *Rect) error {
+	cell := Cell{column, row}
+	if region != nil && !region.contains(cell) {
+		return nil
+	}
+	if len(cells) >= maxParsedCells {
+		return errTooManyCells
+	}
+	cells.addCell(cell)
+	return nil
+}
+
+// parseMatrixValue reads an entry of a 0/1 matrix. Besides 0 and 1, numbers
+// such as the "1.000000000000000000e+00" of NumPy's savetxt are accepted as
+// long as they are 0 or 1.
+func parseMatrixValue(s string) (bool, error) {
+	switch s {
+	case "0":
+		return false, nil
+	case "1":
+		return true, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || (v != 0 && v != 1) {
+		return false, fmt.Errorf("'%s' is not 0 or 1", s)
+	}
+	return v == 1, nil
+}
+
+// parseMatrix reads a matrix of whitespace-separated 0 (dead) and 1 (alive)
+// entries, one row per line, as written by NumPy's savetxt and read by its
+// loadtxt. The first entry of the first row is the cell at 0,0. Blank lines
+// and '#' comments are skipped, and every row must be as wide as the first.
+func parseMatrix(r io.Reader, region *Rect) (Pattern, error) {
+	pattern := Pattern{cells: make(Cells)}
+
+	row, width := int64(0), -1
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<30)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries := strings.Fields(line)
+		if width == -1 {
+			width = len(entries)
+		} else if len(entries) != width {
+			return Pattern{}, fmt.Errorf("line %d has %d entries, expected %d as on the first row", lineNumber, len(entries), width)
+		}
+		for column, entry := range entries {
+			alive, err := parseMatrixValue(entry)
+			if err != nil {
+				return Pattern{}, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			if alive {
+				if err := matrixCell(pattern.cells, row, int64(column), region); err != nil {
+					return Pattern{}, err
+				}
+			}
+		}
+		if row++; row > maxCoordinate {
+			return Pattern{}, fmt.Errorf("pattern on line %d extends beyond coordinate %d", lineNumber, int64(maxCoordinate))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Pattern{}, err
+	}
+	return pattern, nil
+}
+
+// writeMatrix writes the bounding box of a pattern as a matrix of 0 and 1
+// entries separated by spaces, which NumPy's loadtxt reads as it is. The rule
+// and metadata have no place in it and are left out.
+func writeMatrix(w io.Writer, pattern Pattern) error {
+	min, width, height, err := matrixSize(pattern.cells)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	row := make([]byte, 2*width)
+	for y := min.y; y < min.y+height; y++ {
+		for i := int64(0); i < width; i++ {
+			row[2*i], row[2*i+1] = '0', ' '
+			if pattern.cells.hasCell(Cell{min.x + i, y}) {
+				row[2*i] = '1'
+			}
+		}
+		row[len(row)-1] = '\n'
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// npyHeader is what parseNPY understands of the dictionary in the header of a
+// .npy file, such as
+//
+//	{'descr': '<i8', 'fortran_order': False, 'shape': (3, 4), }
+type npyHeader struct {
+	descr        string
+	fortranOrder bool
+	shape        []int64
+}
+
+// npyHeaderValue is the text of the value of key in the header dictionary, up
+// to the comma ending it.
+func npyHeaderValue(header, key string) (string, error) {
+	_, value, found := strings.Cut(header, "'"+key+"':")
+	if !found {
+		return "", fmt.Errorf("header has no '%s'", key)
+	}
+	value = strings.TrimSpace(value)
+	end := ","
+	if strings.HasPrefix(value, "(") {
+		end = ")"
+	}
+	value, _, found = strings.Cut(value, end)
+	if !found {
+		return "", fmt.Errorf("header has no end to '%s'", key)
+	}
+	if end == ")" {
+		value += end
+	}
+	return strings.TrimSpace(value), nil
+}
+
+func parseNPYHeader(header string) (npyHeader, error) {
+	var parsed npyHeader
+	descr, err := npyHeaderValue(header, "descr")
+	if err != nil {
+		return npyHeader{}, err
+	}
+	parsed.descr = strings.Trim(descr, "'\"")
+
+	fortranOrder, err := npyHeaderValue(header, "fortran_order")
+	if err != nil {
+		return npyHeader{}, err
+	}
+	switch fortranOrder {
+	case "True":
+		parsed.fortranOrder = true
+	case "False":
+	default:
+		return npyHeader{}, fmt.Errorf("fortran_order '%s' is neither True nor False", fortranOrder)
+	}
+
+	shape, err := npyHeaderValue(header, "shape")
+	if err != nil {
+		return npyHeader{}, err
+	}
+	for _, dimension := range strings.Split(strings.Trim(shape, "()"), ",") {
+		if dimension = strings.TrimSpace(dimension); dimension == "" {
+			continue
+		}
+		size, err := strconv.ParseInt(dimension, 10, 64)
+		if err != nil || size < 0 || size > maxCoordinate {
+			return npyHeader{}, fmt.Errorf("invalid dimension '%s' in shape %s", dimension, shape)
+		}
+		parsed.shape = append(parsed.shape, size)
+	}
+	return parsed, nil
+}
+
+// npyDecoder turns one entry of a .npy array, of the given dtype, into whether
+// it is 0 or 1.
+func npyDecoder(descr string) (int, func([]byte) (bool, error), error) {
+	if len(descr) < 3 {
+		return 0, nil, fmt.Errorf("unsupported dtype '%s'", descr)
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	switch descr[0] {
+	case '<', '|', '=':
+	case '>':
+		order = binary.BigEndian
+	default:
+		return 0, nil, fmt.Errorf("unsupported byte order in dtype '%s'", descr)
+	}
+	size, err := strconv.Atoi(descr[2:])
+	if err != nil {
+		return 0, nil, fmt.Errorf("unsupported dtype '%s'", descr)
+	}
+	unsigned := func(b []byte) uint64 {
+		switch len(b) {
+		case 1:
+			return uint64(b[0])
+		case 2:
+			return uint64(order.Uint16(b))
+		case 4:
+			return uint64(order.Uint32(b))
+		default:
+			return order.Uint64(b)
+		}
+	}
+
+	var value func([]byte) float64
+	switch kind := descr[1]; {
+	case (kind == 'b' || kind == 'u') && (size == 1 || size == 2 || size == 4 || size == 8):
+		value = func(b []byte) float64 { return float64(unsigned(b)) }
+	case kind == 'i' && (size == 1 || size == 2 || size == 4 || size == 8):
+		value = func(b []byte) float64 {
+			// sign extend from the entry's size
+			shift := 64 - 8*len(b)
+			return float64(int64(unsigned(b)<<shift) >> shift)
+		}
+	case kind == 'f' && size == 4:
+		value = func(b []byte) float64 { return float64(math.Float32frombits(uint32(unsigned(b)))) }
+	case kind == 'f' && size == 8:
+		value = func(b []byte) float64 { return math.Float64frombits(unsigned(b)) }
+	default:
+		return 0, nil, fmt.Errorf("unsupported dtype '%s', expected a bool, integer or float one", descr)
+	}
+	return size, func(b []byte) (bool, error) {
+		switch v := value(b); v {
+		case 0:
+			return false, nil
+		case 1:
+			return true, nil
+		default:
+			return false, fmt.Errorf("entry %v is not 0 or 1", v)
+		}
+	}, nil
+}
+
+// parseNPY reads a 2D array of 0 (dead) and 1 (alive) entries saved by NumPy's
+// save, of any bool, integer or float dtype, in C or Fortran order. Row i and
+// column j of the array is the cell at j,i.
+func parseNPY(r io.Reader, region *Rect) (Pattern, error) {
+	in := bufio.NewReader(r)
+	preamble := make([]byte, len(NPY_MAGIC)+2)
+	if _, err := io.ReadFull(in, preamble); err != nil || string(preamble[:len(NPY_MAGIC)]) != NPY_MAGIC {
+		return Pattern{}, errors.New("Invalid .npy file: needed \\x93NUMPY magic")
+	}
+	var headerLength uint32
+	switch major := preamble[len(NPY_MAGIC)]; major {
+	case 1:
+		var length uint16
+		if err := binary.Read(in, binary.LittleEndian, &length); err != nil {
+			return Pattern{}, fmt.Errorf("reading .npy header failed: %v", err)
+		}
+		headerLength = uint32(length)
+	case 2, 3:
+		if err := binary.Read(in, binary.LittleEndian, &headerLength); err != nil {
+			return Pattern{}, fmt.Errorf("reading .npy header failed: %v", err)
+		}
+	default:
+		return Pattern{}, fmt.Errorf("unsupported .npy version %d", major)
+	}
+	if headerLength > maxNPYHeaderLength {
+		return Pattern{}, fmt.Errorf(".npy header of %d bytes is longer than %d", headerLength, maxNPYHeaderLength)
+	}
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(in, header); err != nil {
+		return Pattern{}, fmt.Errorf("reading .npy header failed: %v", err)
+	}
+	parsed, err := parseNPYHeader(string(header))
+	if err != nil {
+		return Pattern{}, fmt.Errorf("Invalid .npy header: %v", err)
+	}
+	if len(parsed.shape) != 2 {
+		return Pattern{}, fmt.Errorf("expected a 2D array, got one of %d dimensions", len(parsed.shape))
+	}
+	size, decode, err := npyDecoder(parsed.descr)
+	if err != nil {
+		return Pattern{}, err
+	}
+
+	rows, columns := parsed.shape[0], parsed.shape[1]
+	if columns > 0 && rows > math.MaxInt64/columns {
+		return Pattern{}, fmt.Errorf("array of %dx%d entries is too large", rows, columns)
+	}
+	pattern := Pattern{cells: make(Cells)}
+	entry := make([]byte, size)
+	for i := int64(0); i < rows*columns; i++ {
+		if _, err := io.ReadFull(in, entry); err != nil {
+			return Pattern{}, fmt.Errorf("reading entry %d of %d failed: %v", i, rows*columns, err)
+		}
+		alive, err := decode(entry)
+		if err != nil {
+			return Pattern{}, err
+		}
+		if !alive {
+			continue
+		}
+		row, column := i/columns, i%columns
+		if parsed.fortranOrder {
+			row, column = i%rows, i/rows
+		}
+		if err := matrixCell(pattern.cells, row, column, region); err != nil {
+			return Pattern{}, err
+		}
+	}
+	return pattern, nil
+}
+
+// writeNPY writes the bounding box of a pattern as a 2D uint8 array of 0 and
+// 1 in version 1.0 of the .npy format, which numpy.load reads as it is. The
+// rule and metadata have no place in it and are left out.
+func writeNPY(w io.Writer, pattern Pattern) error {
+	min, width, height, err := matrixSize(pattern.cells)
+	if err != nil {
+		return err
+	}
+	header := fmt.Sprintf("{'descr': '|u1', 'fortran_order': False, 'shape': (%d, %d), }", height, width)
+	// the header is padded with spaces and a newline so the data is aligned to
+	// 64 bytes, as NumPy does
+	preamble := len(NPY_MAGIC) + 4
+	header += strings.Repeat(" ", 63-(preamble+len(header))%64) + "\n"
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(NPY_MAGIC)
+	bw.Write([]byte{1, 0})
+	binary.Write(bw, binary.LittleEndian, uint16(len(header)))
+	bw.WriteString(header)
+	row := make([]byte, width)
+	for y := min.y; y < min.y+height; y++ {
+		for i := range row {
+			row[i] = 0
+			if pattern.cells.hasCell(Cell{min.x + int64(i), y}) {
+				row[i] = 1
+			}
+		}
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runMerge combines two Life files into one universe, resolving the area
+// where their bounding boxes overlap according to -policy.
+func runMerge(args []string) error {
+	flags := flag.NewFlagSet("merge", flag.ContinueOnError)
+	policyArg := flags.String("policy", "union", "How to resolve overlapping patterns: union keeps every cell, a-wins keeps only the first pattern's cells where the bounding boxes overlap, error-on-overlap refuses to merge overlapping patterns")
+	offsetArg := flags.String("offset-b", "0,0", "Translate the second pattern by dx,dy before merging")
+	phaseAArg := flags.Int("phase-a", 0, "Advance the first pattern by this many generations before merging, to line up the phases of oscillators or guns")
+	phaseBArg := flags.Int("phase-b", 0, "Advance the second pattern by this many generations before merging")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("expected two files to merge, got %d", flags.NArg())
+	}
+	switch *policyArg {
+	case "union", "a-wins", "error-on-overlap":
+	default:
+		return fmt.Errorf("unknown policy '%s', expected union, a-wins or error-on-overlap", *policyArg)
+	}
+	dx, dy, err := parseCoordinates(*offsetArg)
+	if err != nil {
+		return fmt.Errorf("invalid -offset-b: %v", err)
+	}
+
+	a, err := parseCells(flags.Arg(0), nil)
+	if err != nil {
+		return fmt.Errorf("parsing %s failed: %v", flags.Arg(0), err)
+	}
+	b, err := parseCells(flags.Arg(1), nil)
+	if err != nil {
+		return fmt.Errorf("parsing %s failed: %v", flags.Arg(1), err)
+	}
+	if *phaseAArg < 0 || *phaseBArg < 0 {
+		return fmt.Errorf("phases must not be negative")
+	}
+	a = toPhase(flags.Arg(0), a, *phaseAArg)
+	b = toPhase(flags.Arg(1), b, *phaseBArg)
+	if b, err = b.translated(Offset{dx, dy}); err != nil {
+		return fmt.Errorf("translating %s failed: %v", flags.Arg(1), err)
+	}
+
+	merged := a.clone()
+	if overlap, found := overlappingBounds(a, b); found {
+		logger(logTools).Info("Patterns overlap", "region", overlap.String(),
+			"a", countInside(a, overlap), "b", countInside(b, overlap), "both", len(a)+len(b)-len(union(a, b)))
+		switch *policyArg {
+		case "error-on-overlap":
+			return fmt.Errorf("patterns overlap in %v", overlap)
+		case "a-wins":
+			for cell := range b {
+				if !overlap.contains(cell) {
+					merged.addCell(cell)
+				}
+			}
+			return printCells(os.Stdout, merged)
+		}
+	}
+	for cell := range b {
+		merged.addCell(cell)
+	}
+	return printCells(os.Stdout, merged)
+}
+
+// toPhase advances cells by phase generations. Whole periods of a pattern
+// that repeats itself are skipped rather than simulated, so that the phase
+// can be given relative to any generation such as the one where a glider
+// should arrive; patterns that do not repeat, like guns, are simulated.
+func toPhase(name string, cells Cells, phase int) Cells {
+	if phase == 0 {
+		return cells
+	}
+	stepped := phase
+	if m, found := detectMotion(cells, conwayRule, maxDetectedPeriod); found {
+		var skipped int
+		cells, skipped = m.advance(cells, phase)
+		stepped -= skipped
+		logger(logTools).Info("Skipped whole periods to the phase", "pattern", name, "motion", describeMotion(m, true), "phase", phase, "simulated", stepped)
+	}
+	return advance(cells, conwayRule, stepped)
+}
+
+// overlappingBounds returns the intersection of the bounding boxes of a and b.
+func overlappingBounds(a, b Cells) (Rect, bool) {
+	minA, maxA, okA := a.boundingBox()
+	minB, maxB, okB := b.boundingBox()
+	if !okA || !okB {
+		return Rect{}, false
+	}
+	min := Cell{maxInt64(minA.x, minB.x), maxInt64(minA.y, minB.y)}
+	max := Cell{minInt64(maxA.x, maxB.x), minInt64(maxA.y, maxB.y)}
+	if min.x > max.x || min.y > max.y {
+		return Rect{}, false
+	}
+	return Rect{min.x, min.y, max.x - min.x + 1, max.y - min.y + 1}, true
+}
+
+func countInside(cells Cells, rect Rect) int {
+	count := 0
+	for cell := range cells {
+		if rect.contains(cell) {
+			count++
+		}
+	}
+	return count
+}
+
+func union(a, b Cells) Cells {
+	union := a.clone()
+	for cell := range b {
+		union.addCell(cell)
+	}
+	return union
+}
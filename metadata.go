@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// metadata is what a pattern file says about the pattern besides its cells:
+// its name, its author and free form comments, kept so that converting or
+// running a pattern does not lose them.
+type metadata struct {
+	name     string
+	author   string
+	comments []string
+}
+
+// EVOLVED_COMMENT starts the comment a run adds to its result, replacing the
+// one a previous run added.
+const EVOLVED_COMMENT = "Evolved for "
+
+func (meta metadata) isEmpty() bool {
+	return meta.name == "" && meta.author == "" && len(meta.comments) == 0
+}
+
+// evolved returns the metadata with a comment saying how far the pattern was
+// run, dropping any comment an earlier run added. A pattern that was only
+// converted is left as it is.
+func (meta metadata) evolved(generations, generation int) metadata {
+	if generations == 0 {
+		return meta
+	}
+	comments := make([]string, 0, len(meta.comments)+1)
+	for _, comment := range meta.comments {
+		if !strings.HasPrefix(comment, EVOLVED_COMMENT) {
+			comments = append(comments, comment)
+		}
+	}
+	unit := "generations"
+	if generations == 1 {
+		unit = "generation"
+	}
+	meta.comments = append(comments, fmt.Sprintf("%s%d %s, to generation %d", EVOLVED_COMMENT, generations, unit, generation))
+	return meta
+}
+
+func checkMetadataValue(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if len(value) > maxCommentLength {
+		return "", fmt.Errorf("comment is longer than %d characters", maxCommentLength)
+	}
+	return value, nil
+}
+
+func (meta *metadata) addComment(comment string) error {
+	comment, err := checkMetadataValue(comment)
+	if err != nil {
+		return err
+	}
+	if len(meta.comments) >= maxComments {
+		return fmt.Errorf("pattern has more than %d comments", maxComments)
+	}
+	meta.comments = append(meta.comments, comment)
+	return nil
+}
+
+// parseHashLine reads a "#N name", "#O author" or "#C comment" (or "#c")
+// line, as RLE and Life 1.06 files have them, returning false for any other
+// line.
+func (meta *metadata) parseHashLine(line string) (bool, error) {
+	if len(line) < 2 || line[0] != '#' || len(line) > 2 && line[2] != ' ' {
+		return false, nil
+	}
+	var err error
+	switch line[1] {
+	case 'N':
+		meta.name, err = checkMetadataValue(line[2:])
+	case 'O':
+		meta.author, err = checkMetadataValue(line[2:])
+	case 'C', 'c':
+		err = meta.addComment(line[2:])
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+// hashLines is the metadata as "#N", "#O" and "#C" lines.
+func (meta metadata) hashLines() string {
+	var lines strings.Builder
+	if meta.name != "" {
+		fmt.Fprintf(&lines, "#N %s\n", meta.name)
+	}
+	if meta.author != "" {
+		fmt.Fprintf(&lines, "#O %s\n", meta.author)
+	}
+	for _, comment := range meta.comments {
+		fmt.Fprintf(&lines, "#C %s\n", comment)
+	}
+	return lines.String()
+}
+
+// parseLabelledComment reads a comment of a format with no dedicated lines
+// for the name and author, such as .cells and Life 1.05, which give them as
+// "Name: ..." and "Author: ..." comments.
+func (meta *metadata) parseLabelledComment(comment string) error {
+	comment = strings.TrimSpace(comment)
+	var err error
+	if name, found := strings.CutPrefix(comment, "Name:"); found {
+		meta.name, err = checkMetadataValue(name)
+	} else if author, found := strings.CutPrefix(comment, "Author:"); found {
+		meta.author, err = checkMetadataValue(author)
+	} else {
+		err = meta.addComment(comment)
+	}
+	return err
+}
+
+// labelledComments is the metadata as comments, each line starting with
+// prefix, the opposite of parseLabelledComment.
+func (meta metadata) labelledComments(prefix string) string {
+	var lines strings.Builder
+	if meta.name != "" {
+		fmt.Fprintf(&lines, "%sName: %s\n", prefix, meta.name)
+	}
+	if meta.author != "" {
+		fmt.Fprintf(&lines, "%sAuthor: %s\n", prefix, meta.author)
+	}
+	for _, comment := range meta.comments {
+		fmt.Fprintln(&lines, strings.TrimRight(prefix+comment, " "))
+	}
+	return lines.String()
+}
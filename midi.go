@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// midiTicksPerQuarter is the resolution of the file; each generation lasts
+	// an eighth note, four generations a second at the default 120 bpm.
+	midiTicksPerQuarter = 96
+	midiGenerationTicks = midiTicksPerQuarter / 2
+
+	midiPopulationChannel = 0
+	midiBirthChannel      = 1
+	midiDeathChannel      = 2
+)
+
+// midiScale is a major pentatonic scale, which sounds consonant whichever
+// notes the run happens to pick.
+var midiScale = []int{0, 2, 4, 7, 9}
+
+// midiSink turns a run into a Standard MIDI File. Every generation plays up
+// to three notes lasting one generation:
+//
+//   - the population, on channel 1, climbing the scale as the population
+//     doubles;
+//   - the born cells, on channel 2 an octave up, louder the more are born;
+//   - the dead cells, on channel 3 an octave down, louder the more die.
+//
+// The file is written when the run is over, since its header records the
+// length of the track.
+type midiSink struct {
+	w     io.Writer
+	track bytes.Buffer
+	// pendingTicks is the time since the last event written to the track.
+	pendingTicks uint32
+}
+
+func newMIDISink(w io.Writer) *midiSink {
+	sink := &midiSink{w: w}
+	// 500000 microseconds per quarter note, i.e. 120 bpm
+	sink.event(0xff, 0x51, 0x03, 0x07, 0xa1, 0x20)
+	return sink
+}
+
+func (sink *midiSink) needsEveryGeneration() bool {
+	return true
+}
+
+func (sink *midiSink) observe(event Event) error {
+	type note struct {
+		channel, pitch, velocity byte
+	}
+	var notes []note
+	if population := len(event.cells); population > 0 {
+		notes = append(notes, note{midiPopulationChannel, midiPitch(48, population), 80})
+	}
+	if born := len(event.born); born > 0 {
+		notes = append(notes, note{midiBirthChannel, midiPitch(60, born), midiVelocity(born)})
+	}
+	if died := len(event.died); died > 0 {
+		notes = append(notes, note{midiDeathChannel, midiPitch(36, died), midiVelocity(died)})
+	}
+
+	for _, n := range notes {
+		sink.event(0x90|n.channel, n.pitch, n.velocity)
+	}
+	sink.pendingTicks += midiGenerationTicks
+	for _, n := range notes {
+		sink.event(0x80|n.channel, n.pitch, 0)
+	}
+	return nil
+}
+
+func (sink *midiSink) close() error {
+	sink.event(0xff, 0x2f, 0x00) // end of track
+
+	var file bytes.Buffer
+	file.WriteString("MThd")
+	binary.Write(&file, binary.BigEndian, []uint32{6})
+	binary.Write(&file, binary.BigEndian, []uint16{0, 1, midiTicksPerQuarter}) // format 0, one track
+	file.WriteString("MTrk")
+	binary.Write(&file, binary.BigEndian, uint32(sink.track.Len()))
+	file.Write(sink.track.Bytes())
+
+	if _, err := sink.w.Write(file.Bytes()); err != nil {
+		return fmt.Errorf("writing MIDI file failed: %v", err)
+	}
+	return nil
+}
+
+// event appends a track event preceded by the time elapsed since the
+// previous one, as a variable length quantity.
+func (sink *midiSink) event(data ...byte) {
+	ticks := sink.pendingTicks
+	sink.pendingTicks = 0
+	var vlq [5]byte
+	i := len(vlq) - 1
+	vlq[i] = byte(ticks & 0x7f)
+	for ticks >>= 7; ticks > 0; ticks >>= 7 {
+		i--
+		vlq[i] = byte(ticks&0x7f) | 0x80
+	}
+	sink.track.Write(vlq[i:])
+	sink.track.Write(data)
+}
+
+// midiPitch climbs one scale degree from base each time count doubles.
+func midiPitch(base, count int) byte {
+	degree := int(math.Log2(float64(count)))
+	pitch := base + 12*(degree/len(midiScale)) + midiScale[degree%len(midiScale)]
+	return byte(min(pitch, 127))
+}
+
+func midiVelocity(count int) byte {
+	return byte(min(40+count, 127))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// motion describes a universe that repeats itself: every period generations
+// it is its earlier self translated by dx,dy. Oscillators and still lifes
+// have no displacement, spaceships and fleets of equal spaceships do.
+type motion struct {
+	period int
+	dx, dy int64
+}
+
+func (m motion) isMoving() bool {
+	return m.dx != 0 || m.dy != 0
+}
+
+// velocity returns the average cells moved per generation.
+func (m motion) velocity() (float64, float64) {
+	return float64(m.dx) / float64(m.period), float64(m.dy) / float64(m.period)
+}
+
+// String describes the motion in the usual notation, e.g. "period 4
+// moving by (1, 1), speed c/4".
+func (m motion) String() string {
+	if !m.isMoving() {
+		return fmt.Sprintf("period %d, not moving", m.period)
+	}
+	distance := max(absInt64(m.dx), absInt64(m.dy))
+	speed := fmt.Sprintf("%dc/%d", distance, m.period)
+	if distance == 1 {
+		speed = fmt.Sprintf("c/%d", m.period)
+	}
+	return fmt.Sprintf("period %d moving by (%d, %d), speed %s", m.period, m.dx, m.dy, speed)
+}
+
+// advance moves cells forward by a whole number of periods without simulating
+// them, returning how many generations were skipped. It skips nothing when
+// the translation would overflow the coordinate space.
+func (m motion) advance(cells Cells, generations int) (Cells, int) {
+	periods := int64(generations / m.period)
+	if periods == 0 {
+		return cells, 0
+	}
+	if (m.dx != 0 && periods > math.MaxInt64/absInt64(m.dx)) || (m.dy != 0 && periods > math.MaxInt64/absInt64(m.dy)) {
+		return cells, 0
+	}
+	advanced, err := cells.translated(Offset{m.dx * periods, m.dy * periods})
+	if err != nil {
+		return cells, 0
+	}
+	return advanced, int(periods) * m.period
+}
+
+// motionDetector recognises when a universe reappears, possibly translated,
+// within maxPeriod generations. It fingerprints each generation by the hash
+// of its cells relative to their bounding box, which does not change when
+// the whole universe moves, and compares the cells of generations whose
+// fingerprints match, since -fast-forward must not skip ahead on a
+// collision of hashes.
+type motionDetector struct {
+	maxPeriod int
+	seen      map[uint64]motionSample
+}
+
+type motionSample struct {
+	generation int
+	min        Cell
+	// cells is a copy, engines being free to reuse the sets they return.
+	cells Cells
+}
+
+func newMotionDetector(maxPeriod int) *motionDetector {
+	return &motionDetector{maxPeriod, make(map[uint64]motionSample)}
+}
+
+func (detector *motionDetector) observe(generation int, cells Cells) (motion, bool) {
+	min, _, ok := cells.boundingBox()
+	if !ok {
+		return motion{}, false
+	}
+	hash := uint64(0)
+	for cell := range cells {
+		hash ^= cellHash(Cell{cell.x - min.x, cell.y - min.y})
+	}
+
+	last, found := detector.seen[hash]
+	detector.seen[hash] = motionSample{generation, min, cells.clone()}
+	if expired := generation - detector.maxPeriod; expired >= 0 {
+		for h, sample := range detector.seen {
+			if sample.generation < expired {
+				delete(detector.seen, h)
+			}
+		}
+	}
+	if found && generation-last.generation <= detector.maxPeriod && translates(last.cells, cells, min.x-last.min.x, min.y-last.min.y) {
+		return motion{generation - last.generation, min.x - last.min.x, min.y - last.min.y}, true
+	}
+	return motion{}, false
+}
+
+// translates is true when to is from moved by dx,dy.
+func translates(from, to Cells, dx, dy int64) bool {
+	if len(from) != len(to) {
+		return false
+	}
+	for cell := range to {
+		if !from.hasCell(Cell{cell.x - dx, cell.y - dy}) {
+			return false
+		}
+	}
+	return true
+}
+
+func absInt64(value int64) int64 {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
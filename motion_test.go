@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+// TestMotionDetectorComparesCells checks that a glider is found to move by
+// 1,1 every 4 generations, and that a generation whose fingerprint matches
+// an earlier one with other cells is not taken for a repeat.
+func TestMotionDetectorComparesCells(t *testing.T) {
+	cells := Cells{{1, 0}: {}, {2, 1}: {}, {0, 2}: {}, {1, 2}: {}, {2, 2}: {}}
+	engine := newNaiveEngine(conwayRule, mooreNeighborhood, constraints{})
+	detector := newMotionDetector(maxDetectedPeriod)
+	detector.observe(0, cells)
+	var m motion
+	found := false
+	for generation := 1; !found && generation <= 8; generation++ {
+		cells, _, _ = engine.step(cells)
+		m, found = detector.observe(generation, cells)
+	}
+	if !found || m != (motion{4, 1, 1}) {
+		t.Fatalf("found %v, %v, not period 4 moving by 1,1", m, found)
+	}
+
+	// a sample of other cells under the fingerprint of the next generation
+	detector = newMotionDetector(maxDetectedPeriod)
+	detector.observe(0, Cells{{0, 0}: {}})
+	for hash, sample := range detector.seen {
+		delete(detector.seen, hash)
+		next, _, _ := engine.step(cells)
+		min, _, _ := next.boundingBox()
+		fingerprint := uint64(0)
+		for cell := range next {
+			fingerprint ^= cellHash(Cell{cell.x - min.x, cell.y - min.y})
+		}
+		detector.seen[fingerprint] = sample
+		if m, found := detector.observe(1, next); found {
+			t.Errorf("took a collision of fingerprints for %v", m)
+		}
+	}
+}
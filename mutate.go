@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+)
+
+// runMutate prints a random variant of a pattern, made by flipping cells and
+// optionally crossing it with a second pattern, as a primitive for searches
+// over patterns.
+func runMutate(args []string) error {
+	flags := flag.NewFlagSet("mutate", flag.ContinueOnError)
+	flipsArg := flags.Int("flips", 1, "The number of random cells to flip")
+	marginArg := flags.Int64("margin", 1, "How far outside the pattern's bounding box cells may be flipped")
+	seedArg := flags.Uint64("seed", 1, "The seed for the random choices")
+	killsArg := flags.Int("kills", 0, "The number of random alive cells to kill after flipping")
+	crossoverArg := flags.String("crossover", "", "Cross the pattern with this one first, taking the columns left of a random cut from the first and the rest from the second")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one pattern file, got %d arguments", flags.NArg())
+	}
+	if *flipsArg < 0 || *marginArg < 0 || *killsArg < 0 {
+		return fmt.Errorf("-flips, -margin and -kills must not be negative")
+	}
+
+	pattern, format, err := parsePatternFormat(flags.Arg(0), nil)
+	if err != nil {
+		return fmt.Errorf("parsing %s failed: %v", flags.Arg(0), err)
+	}
+	rng := rand.New(rand.NewPCG(*seedArg, 0))
+	cells := pattern.cells
+	if *crossoverArg != "" {
+		other, err := parseCells(*crossoverArg, nil)
+		if err != nil {
+			return fmt.Errorf("parsing %s failed: %v", *crossoverArg, err)
+		}
+		cells = crossover(cells, other, rng)
+	}
+	pattern.cells = flipCells(cells, mutationBounds(cells, *marginArg), *flipsArg, rng)
+	for cell := range pattern.cells.sample(*killsArg, rng) {
+		pattern.cells.removeCell(cell)
+	}
+	return format.write(os.Stdout, pattern)
+}
+
+// mutationBounds is the bounding box of cells grown by margin, or the margin
+// around the origin for an empty pattern.
+func mutationBounds(cells Cells, margin int64) Rect {
+	min, max, ok := cells.boundingBox()
+	if !ok {
+		return Rect{0, 0, 1, 1}.grown(margin)
+	}
+	return Rect{min.x, min.y, max.x - min.x + 1, max.y - min.y + 1}.grown(margin)
+}
+
+// flipCells returns a copy of cells with flips distinct random cells of
+// bounds toggled, or every cell of bounds when it has fewer.
+func flipCells(cells Cells, bounds Rect, flips int, rng *rand.Rand) Cells {
+	mutated := cells.clone()
+	for _, cell := range randomCellsInBounds(bounds, flips, rng) {
+		if mutated.hasCell(cell) {
+			mutated.removeCell(cell)
+		} else {
+			mutated.addCell(cell)
+		}
+	}
+	return mutated
+}
+
+// crossover combines a and b, aligned on the top-left corners of their
+// bounding boxes, taking the cells of a left of a random column and those of
+// b from it on.
+func crossover(a, b Cells, rng *rand.Rand) Cells {
+	a, b = a.normalized(), b.normalized()
+	_, maxA, okA := a.boundingBox()
+	_, maxB, okB := b.boundingBox()
+	width := int64(1)
+	if okA {
+		width = max(width, maxA.x+1)
+	}
+	if okB {
+		width = max(width, maxB.x+1)
+	}
+	cut := rng.Int64N(width + 1)
+
+	child := make(Cells)
+	for cell := range a {
+		if cell.x < cut {
+			child.addCell(cell)
+		}
+	}
+	for cell := range b {
+		if cell.x >= cut {
+			child.addCell(cell)
+		}
+	}
+	return child
+}
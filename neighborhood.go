@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Offset is the position of a neighbor relative to the cell whose neighbors
+// are being counted.
+type Offset struct {
+	dx, dy int64
+}
+
+// Neighborhood is the set of offsets whose alive cells are counted when
+// applying a rule.
+type Neighborhood []Offset
+
+// maxNeighborhoodSize keeps neighbor counts within what B/S rules can express.
+const maxNeighborhoodSize = 8
+
+var mooreNeighborhood = Neighborhood{
+	{-1, -1}, {-1, 0}, {-1, 1},
+	{0, -1}, {0, 1},
+	{1, -1}, {1, 0}, {1, 1},
+}
+
+// rangeNeighborhood is every cell within radius of the cell along both axes,
+// or, for vonNeumann, within radius steps along the axes, as Larger than Life
+// rules count over.
+func rangeNeighborhood(radius int64, vonNeumann bool) Neighborhood {
+	var neighborhood Neighborhood
+	for dx := -radius; dx <= radius; dx++ {
+		for dy := -radius; dy <= radius; dy++ {
+			if (dx == 0 && dy == 0) || (vonNeumann && absInt64(dx)+absInt64(dy) > radius) {
+				continue
+			}
+			neighborhood = append(neighborhood, Offset{dx, dy})
+		}
+	}
+	return neighborhood
+}
+
+// vonNeumannNeighborhood is the four cells sharing an edge with the cell.
+var vonNeumannNeighborhood = Neighborhood{
+	{0, -1}, {-1, 0}, {1, 0}, {0, 1},
+}
+
+// hexNeighborhood lays a hexagonal grid over the square one as Golly does:
+// the six neighbors are the Moore neighbors but the top-right and
+// bottom-left, as if each row were half a cell to the left of the one above.
+var hexNeighborhood = Neighborhood{
+	{-1, -1}, {0, -1},
+	{-1, 0}, {1, 0},
+	{0, 1}, {1, 1},
+}
+
+var namedNeighborhoods = map[string]Neighborhood{
+	"moore":      mooreNeighborhood,
+	"vonneumann": vonNeumannNeighborhood,
+	"hex":        hexNeighborhood,
+}
+
+func (neighborhood Neighborhood) reflected() Neighborhood {
+	reflected := make(Neighborhood, len(neighborhood))
+	for i, offset := range neighborhood {
+		reflected[i] = Offset{-offset.dx, -offset.dy}
+	}
+	return reflected
+}
+
+// radius is the farthest a neighborhood reaches along either axis, which is
+// also how far a change can travel in one generation.
+func (neighborhood Neighborhood) radius() int64 {
+	radius := int64(0)
+	for _, offset := range neighborhood {
+		radius = max(radius, absInt64(offset.dx), absInt64(offset.dy))
+	}
+	return radius
+}
+
+// loadNeighborhood resolves the -neighborhood and -kernel flags; a kernel file
+// takes precedence over the -neighborhood flag when given.
+func loadNeighborhood(spec, kernelFile string) (Neighborhood, error) {
+	if kernelFile != "" {
+		return parseKernelFile(kernelFile)
+	}
+	return parseNeighborhood(spec)
+}
+
+// String formats a neighborhood as the offsets parseNeighborhood accepts.
+func (neighborhood Neighborhood) String() string {
+	items := make([]string, len(neighborhood))
+	for i, offset := range neighborhood {
+		items[i] = fmt.Sprintf("%d,%d", offset.dx, offset.dy)
+	}
+	return strings.Join(items, ";")
+}
+
+// parseNeighborhood parses either a neighborhood name or a list of
+// semicolon-separated "dx,dy" offsets.
+func parseNeighborhood(spec string) (Neighborhood, error) {
+	if named, found := namedNeighborhoods[spec]; found {
+		return named, nil
+	}
+
+	neighborhood := Neighborhood{}
+	for _, item := range strings.Split(spec, ";") {
+		dx, dy, found := strings.Cut(strings.TrimSpace(item), ",")
+		if !found {
+			return nil, fmt.Errorf("offset '%s' is not of the form dx,dy", item)
+		}
+		offset := Offset{}
+		var err error
+		if offset.dx, err = strconv.ParseInt(strings.TrimSpace(dx), 10, 64); err != nil {
+			return nil, fmt.Errorf("offset '%s': %v", item, err)
+		}
+		if offset.dy, err = strconv.ParseInt(strings.TrimSpace(dy), 10, 64); err != nil {
+			return nil, fmt.Errorf("offset '%s': %v", item, err)
+		}
+		neighborhood = append(neighborhood, offset)
+	}
+	return neighborhood, neighborhood.validate()
+}
+
+// parseKernelFile reads a neighborhood drawn as rows of '.' (ignored) and 'o'
+// (counted) cells, with the cell itself at the center of an odd-sized grid.
+// Lines starting with '#' are comments.
+func parseKernelFile(kernelFile string) (Neighborhood, error) {
+	file, err := os.Open(kernelFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rows []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if len(rows) > 0 && len(line) != len(rows[0]) {
+			return nil, fmt.Errorf("kernel row %d has %d cells, expected %d", len(rows)+1, len(line), len(rows[0]))
+		}
+		rows = append(rows, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || len(rows)%2 == 0 || len(rows[0])%2 == 0 {
+		return nil, fmt.Errorf("kernel must be a grid with an odd number of rows and columns")
+	}
+
+	centerX, centerY := len(rows[0])/2, len(rows)/2
+	neighborhood := Neighborhood{}
+	for y, row := range rows {
+		for x, c := range row {
+			switch c {
+			case '.':
+			case 'o', 'O':
+				if x == centerX && y == centerY {
+					return nil, fmt.Errorf("kernel center cannot be its own neighbor")
+				}
+				neighborhood = append(neighborhood, Offset{int64(x - centerX), int64(y - centerY)})
+			default:
+				return nil, fmt.Errorf("unexpected character '%c' in kernel row %d", c, y+1)
+			}
+		}
+	}
+	return neighborhood, neighborhood.validate()
+}
+
+func (neighborhood Neighborhood) validate() error {
+	if len(neighborhood) == 0 {
+		return fmt.Errorf("neighborhood has no offsets")
+	}
+	if len(neighborhood) > maxNeighborhoodSize {
+		return fmt.Errorf("neighborhood has %d offsets, at most %d are supported", len(neighborhood), maxNeighborhoodSize)
+	}
+	seen := make(map[Offset]struct{})
+	for _, offset := range neighborhood {
+		if offset == (Offset{}) {
+			return fmt.Errorf("offset 0,0 is the cell itself")
+		}
+		if _, found := seen[offset]; found {
+			return fmt.Errorf("offset %d,%d is listed twice", offset.dx, offset.dy)
+		}
+		seen[offset] = struct{}{}
+	}
+	return nil
+}
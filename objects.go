@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// knownObject is an object of B3/S23 that has a name.
+type knownObject struct {
+	name   string
+	period int
+	// rle is the body of an RLE of the object in one of its phases.
+	rle string
+}
+
+// knownObjects are the common objects of B3/S23, by apgcode: the ones soups
+// leave behind most often, and the best known oscillators and spaceships.
+var knownObjects = map[string]knownObject{
+	"xs4_33":   {"block", 1, "2o$2o!"},
+	"xs6_696":  {"beehive", 1, "b2o$o2bo$b2o!"},
+	"xs7_2596": {"loaf", 1, "b2o$o2bo$bobo$2bo!"},
+	"xs5_253":  {"boat", 1, "2o$obo$bo!"},
+	"xs6_356":  {"ship", 1, "2o$obo$b2o!"},
+	"xs4_252":  {"tub", 1, "bo$obo$bo!"},
+	"xs8_6996": {"pond", 1, "b2o$o2bo$o2bo$b2o!"},
+	"xs7_25ac": {"long boat", 1, "2o$obo$bobo$2bo!"},
+	"xs6_25a4": {"barge", 1, "bo$obo$bobo$2bo!"},
+	"xs7_178c": {"eater 1", 1, "2o$obo$2bo$2b2o!"},
+	"xs6_bd":   {"snake", 1, "2obo$ob2o!"},
+	"xs6_39c":  {"aircraft carrier", 1, "2o$o2bo$2b2o!"},
+	"xs8_69ic": {"mango", 1, "b2o$o2bo$bo2bo$2b2o!"},
+	"xp2_7":    {"blinker", 2, "3o!"},
+	"xp2_7e":   {"toad", 2, "b3o$3o!"},
+	"xp2_318c": {"beacon", 2, "2o$o$3bo$2b2o!"},
+	"xp2_2a54": {"clock", 2, "2bo$obo$bobo$bo!"},
+	"xp3_co9nas0san9oczgoldlo0oldlogz1047210127401": {"pulsar", 3, "2b3o3b3o2$o4bobo4bo$o4bobo4bo$o4bobo4bo$2b3o3b3o2$2b3o3b3o$o4bobo4bo$o4bobo4bo$o4bobo4bo2$2b3o3b3o!"},
+	"xp15_4r4z4r4": {"pentadecathlon", 15, "2bo4bo$2ob4ob2o$2bo4bo!"},
+	"xq4_153":      {"glider", 4, "bo$2bo$3o!"},
+	"xq4_6frc":     {"lightweight spaceship", 4, "bo2bo$o$o3bo$4o!"},
+	"xq4_27dee6":   {"middleweight spaceship", 4, "3bo$bo3bo$o$o4bo$5o!"},
+	"xq4_27deee6":  {"heavyweight spaceship", 4, "3b2o$bo4bo$o$o5bo$6o!"},
+}
+
+// objectNames names objects by their apgcode: knownObjects under B3/S23,
+// and those of the user's -objects file under any rule.
+type objectNames map[string]string
+
+// loadObjectNames reads the names of objects under rule, with those of
+// the file at path, when given, over the known ones. The file has a tab
+// separated apgcode and name on each line:
+//
+//	# my ash
+//	xs4_33	block
+//	xs14_g88b96z123	elevener
+//
+// and lines starting with # are comments.
+func loadObjectNames(path string, rule Rule) (objectNames, error) {
+	names := make(objectNames)
+	if rule == conwayRule {
+		for code, object := range knownObjects {
+			names[code] = object.name
+		}
+	}
+	if path == "" {
+		return names, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		code, name, found := strings.Cut(line, "\t")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("line %d: expected an apgcode and a name separated by a tab", lineNumber)
+		}
+		if _, err := apgcodePeriod(code); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		names[code] = strings.TrimSpace(name)
+	}
+	return names, scanner.Err()
+}
+
+// describe is the name of the object of code, followed by how it repeats,
+// or only how it repeats when it has no name.
+func (names objectNames) describe(code string, m motion, found bool) string {
+	if name, known := names[code]; known && code != "" {
+		return fmt.Sprintf("%s, %s", name, describeMotion(m, found))
+	}
+	return describeMotion(m, found)
+}
+
+// apgcodeDigits are the digits of the extended Wechsler format.
+const apgcodeDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// apgcode is the code Catagolue names an object by, given how it repeats:
+// xs and the population for a still life, xp and the period for an
+// oscillator, or xq and the period for a spaceship, then the object in the
+// extended Wechsler format. The object is written in whichever phase and
+// orientation is shortest, and earliest in ASCII among those. Objects that
+// do not repeat have no apgcode.
+func apgcode(object Cells, rule Rule, m motion, found bool) string {
+	if !found {
+		return ""
+	}
+	var prefix string
+	switch {
+	case m.isMoving():
+		prefix = fmt.Sprintf("xq%d", m.period)
+	case m.period == 1:
+		prefix = fmt.Sprintf("xs%d", len(object))
+	default:
+		prefix = fmt.Sprintf("xp%d", m.period)
+	}
+
+	best := ""
+	phase := object.clone()
+	engine := newNaiveEngine(rule, mooreNeighborhood, constraints{})
+	for i := 0; i < m.period; i++ {
+		for _, orient := range orientations {
+			oriented := make(Cells, len(phase))
+			for cell := range phase {
+				oriented.addCell(orient(cell))
+			}
+			if code := wechsler(oriented); best == "" || len(code) < len(best) || len(code) == len(best) && code < best {
+				best = code
+			}
+		}
+		phase, _, _ = engine.step(phase)
+	}
+	return prefix + "_" + best
+}
+
+// wechsler writes cells in the extended Wechsler format: strips of five rows
+// from the top of their bounding box, separated by z, each a column at a
+// time as a digit whose bits are the cells of the column from the top.
+// Runs of empty columns are shortened to w for two, x for three, and y and a
+// digit for four to 39, and those at the end of a strip left out.
+func wechsler(cells Cells) string {
+	min, max, ok := cells.boundingBox()
+	if !ok {
+		return ""
+	}
+	var b strings.Builder
+	for top := min.y; top <= max.y; top += 5 {
+		if top != min.y {
+			b.WriteByte('z')
+		}
+		zeroes := 0
+		for x := min.x; x <= max.x; x++ {
+			column := 0
+			for row := int64(0); row < 5; row++ {
+				if cells.hasCell(Cell{x, top + row}) {
+					column |= 1 << row
+				}
+			}
+			if column == 0 {
+				zeroes++
+				continue
+			}
+			for ; zeroes > 39; zeroes -= 39 {
+				b.WriteString("yz")
+			}
+			switch {
+			case zeroes == 1:
+				b.WriteByte('0')
+			case zeroes == 2:
+				b.WriteByte('w')
+			case zeroes == 3:
+				b.WriteByte('x')
+			case zeroes > 3:
+				b.WriteByte('y')
+				b.WriteByte(apgcodeDigits[zeroes-4])
+			}
+			zeroes = 0
+			b.WriteByte(apgcodeDigits[column])
+		}
+	}
+	return b.String()
+}
+
+// apgcodePeriod is the period of the object of an apgcode, 1 for a still
+// life.
+func apgcodePeriod(code string) (int, error) {
+	prefix, _, found := strings.Cut(code, "_")
+	if !found || len(prefix) < 3 || !strings.HasPrefix(prefix, "x") {
+		return 0, fmt.Errorf("'%s' is not an apgcode such as xs4_33", code)
+	}
+	if prefix[1] == 's' {
+		return 1, nil
+	}
+	period, err := strconv.Atoi(prefix[2:])
+	if err != nil || (prefix[1] != 'p' && prefix[1] != 'q') || period < 1 {
+		return 0, fmt.Errorf("'%s' is not an apgcode such as xs4_33", code)
+	}
+	return period, nil
+}
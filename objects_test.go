@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestKnownObjects checks that each known object has the apgcode and period
+// it is listed under.
+func TestKnownObjects(t *testing.T) {
+	for code, object := range knownObjects {
+		pattern, err := parseRLE(strings.NewReader("x = 0, y = 0\n"+object.rle+"\n"), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", object.name, err)
+		}
+		m, found := detectMotion(pattern.cells, conwayRule, maxDetectedPeriod)
+		if !found || m.period != object.period {
+			t.Errorf("%s: repeats with %v, %v, not period %d", object.name, m, found, object.period)
+		}
+		if got := apgcode(pattern.cells, conwayRule, m, found); got != code {
+			t.Errorf("%s: apgcode %s, not %s", object.name, got, code)
+		}
+		if period, err := apgcodePeriod(code); err != nil || period != object.period {
+			t.Errorf("%s: the apgcode gives period %d, %v", object.name, period, err)
+		}
+	}
+}
+
+func TestWechsler(t *testing.T) {
+	tests := []struct {
+		rle, code string
+	}{
+		{"o!", "1"},
+		{"o5bo!", "1y11"},
+		{"o42bo!", "1yzx1"},
+		{"o$$$$$o!", "1z1"},
+		{"o2bo!", "1w1"},
+	}
+	for _, test := range tests {
+		pattern, err := parseRLE(strings.NewReader("x = 0, y = 0\n"+test.rle+"\n"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := wechsler(pattern.cells); got != test.code {
+			t.Errorf("%s: %s, not %s", test.rle, got, test.code)
+		}
+	}
+}
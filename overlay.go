@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// overlayColors are the colors -overlay draws each kind of component in.
+var overlayColors = map[string]color.Color{
+	KIND_STILL_LIFE:   color.RGBA{0x1f, 0x77, 0xb4, 0xff},
+	KIND_OSCILLATOR:   color.RGBA{0x2c, 0xa0, 0x2c, 0xff},
+	KIND_SPACESHIP:    color.RGBA{0xd6, 0x27, 0x28, 0xff},
+	KIND_UNCLASSIFIED: color.RGBA{0xff, 0x7f, 0x0e, 0xff},
+}
+
+// overlayKinds orders the kinds in the palette of a render with an overlay,
+// after the dead and alive colors.
+var overlayKinds = []string{KIND_STILL_LIFE, KIND_OSCILLATOR, KIND_SPACESHIP, KIND_UNCLASSIFIED}
+
+// overlayPalette is the palette of a render with an overlay or annotations,
+// which are drawn in annotationColor, the last one.
+func overlayPalette() color.Palette {
+	palette := color.Palette{deadColor, aliveColor}
+	for _, kind := range overlayKinds {
+		palette = append(palette, overlayColors[kind])
+	}
+	return append(palette, annotationColor)
+}
+
+func overlayColorIndex(kind string) uint8 {
+	for i, known := range overlayKinds {
+		if kind == known {
+			return uint8(2 + i)
+		}
+	}
+	return uint8(2 + len(overlayKinds) - 1)
+}
+
+// point returns where the corner x,y of the cell grid is drawn: cell x,y
+// covers the corners x,y to x+1,y+1. On a hex grid the corners shift with
+// their rows, so cells are drawn as the parallelograms they are.
+func (view viewTransform) point(x, y float64) (float64, float64) {
+	column, row := x-float64(view.viewport.x), y-float64(view.viewport.y)
+	if view.hex {
+		// the shift of the row at its middle matches that of its cells
+		column += (float64(view.viewport.h) - 0.5 - row) / 2
+	}
+	if view.flipY {
+		row = float64(view.viewport.h) - row
+	}
+	return column * float64(view.cellSize), row * float64(view.cellSize)
+}
+
+// box returns the pixels bounds covers, which may lie partly or wholly
+// outside the image.
+func (view viewTransform) box(bounds jsonBounds) (float64, float64, float64, float64) {
+	x0, y0 := view.point(float64(bounds.X), float64(bounds.Y))
+	x1, y1 := view.point(float64(bounds.X+bounds.W), float64(bounds.Y+bounds.H))
+	// the other corners are further out than these on a hex grid
+	x2, _ := view.point(float64(bounds.X+bounds.W), float64(bounds.Y))
+	x3, _ := view.point(float64(bounds.X), float64(bounds.Y+bounds.H))
+	return math.Min(math.Min(x0, x1), math.Min(x2, x3)), math.Min(y0, y1), math.Max(math.Max(x0, x1), math.Max(x2, x3)), math.Max(y0, y1)
+}
+
+// lane returns the ray a spaceship travels along from the centre of its
+// bounds, in pixels per step of the direction it is heading.
+func (view viewTransform) lane(component reportComponent) (x, y, dx, dy float64) {
+	left, top, right, bottom := view.box(component.Bounds)
+	dx, dy = float64(component.Motion.DX), float64(component.Motion.DY)
+	if view.hex {
+		dx -= dy / 2
+	}
+	if view.flipY {
+		dy = -dy
+	}
+	length := math.Hypot(dx, dy)
+	return (left + right) / 2, (top + bottom) / 2, dx / length, dy / length
+}
+
+func isLane(component reportComponent) bool {
+	return component.Motion != nil && (component.Motion.DX != 0 || component.Motion.DY != 0)
+}
+
+// paintOverlay draws the components of the report over img as outlines in
+// the color of their kind, and the lanes of spaceships as lines from them to
+// the edge of the image. img must have the overlayPalette.
+func paintOverlay(img *image.Paletted, view viewTransform, report *analysisReport) {
+	bounds := img.Bounds()
+	set := func(x, y float64, index uint8) {
+		if p := image.Pt(int(math.Floor(x)), int(math.Floor(y))); p.In(bounds) {
+			img.SetColorIndex(p.X, p.Y, index)
+		}
+	}
+	for _, component := range report.Components {
+		index := overlayColorIndex(component.Kind)
+		left, top, right, bottom := view.box(component.Bounds)
+		// the outline is drawn just outside the cells
+		left, top = left-1, top-1
+		for x := left; x <= right; x++ {
+			set(x, top, index)
+			set(x, bottom, index)
+		}
+		for y := top; y <= bottom; y++ {
+			set(left, y, index)
+			set(right, y, index)
+		}
+		if isLane(component) {
+			x, y, dx, dy := view.lane(component)
+			for image.Pt(int(x), int(y)).In(bounds.Inset(-1)) {
+				set(x, y, index)
+				x, y = x+dx, y+dy
+			}
+		}
+	}
+}
+
+// writeSVGOverlay writes the components of the report as SVG outlines in
+// the color of their kind with a label of what they are, the lanes of
+// spaceships as lines, and the motion of the whole universe in the top left
+// corner.
+func writeSVGOverlay(out *bufio.Writer, view viewTransform, report *analysisReport) {
+	width, height := float64(view.viewport.w*int64(view.cellSize)), float64(view.viewport.h*int64(view.cellSize))
+	fontSize := math.Max(float64(view.cellSize)*2, 10)
+	fmt.Fprintf(out, "<g fill=\"none\" stroke-width=\"1\" font-family=\"sans-serif\" font-size=\"%g\">\n", fontSize)
+	for _, component := range report.Components {
+		stroke := svgColor(overlayColors[KIND_UNCLASSIFIED])
+		if c, ok := overlayColors[component.Kind]; ok {
+			stroke = svgColor(c)
+		}
+		left, top, right, bottom := view.box(component.Bounds)
+		fmt.Fprintf(out, "<rect x=\"%g\" y=\"%g\" width=\"%g\" height=\"%g\" stroke=\"%s\"/>\n", left-0.5, top-0.5, right-left+1, bottom-top+1, stroke)
+		label := component.Kind
+		if component.Motion != nil {
+			label += " " + motion{component.Motion.Period, component.Motion.DX, component.Motion.DY}.String()
+		}
+		fmt.Fprintf(out, "<text x=\"%g\" y=\"%g\" fill=\"%s\" stroke=\"none\">%s</text>\n", left, top-2, stroke, label)
+		if isLane(component) {
+			x, y, dx, dy := view.lane(component)
+			// a lane as long as the image is wide and tall reaches its edge
+			reach := width + height
+			fmt.Fprintf(out, "<line x1=\"%g\" y1=\"%g\" x2=\"%g\" y2=\"%g\" stroke=\"%s\" stroke-dasharray=\"4 2\"/>\n", x, y, x+dx*reach, y+dy*reach, stroke)
+		}
+	}
+	if report.Motion != nil {
+		m := motion{report.Motion.Period, report.Motion.DX, report.Motion.DY}
+		fmt.Fprintf(out, "<text x=\"2\" y=\"%g\" fill=\"%s\" stroke=\"none\">generation %d: %v</text>\n", fontSize, svgColor(aliveColor), report.Generation, m)
+	}
+	fmt.Fprintf(out, "</g>\n")
+}
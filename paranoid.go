@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// paranoidSampleCells is how many offending cells a violation lists.
+const paranoidSampleCells = 8
+
+// paranoidEngine wraps another engine and checks after every step that the
+// result is one any correct engine could have produced, panicking with the
+// details of the first violation. It is slow, keeping a copy of every
+// generation, and meant for trying out new engines.
+type paranoidEngine struct {
+	engine      Engine
+	radius      int64
+	constraints constraints
+	generation  int
+}
+
+func newParanoidEngine(engine Engine, neighborhood Neighborhood, constraints constraints, generation int) *paranoidEngine {
+	return &paranoidEngine{engine, neighborhood.radius(), constraints, generation}
+}
+
+func (engine *paranoidEngine) step(cells Cells) (Cells, Cells, Cells) {
+	before := cells.clone()
+	next, born, died := engine.engine.step(cells)
+	engine.generation++
+	engine.check(before, next, born, died)
+	return next, born, died
+}
+
+// check panics unless the step from before to after is consistent with the
+// born and died cells it reported, the constraints, and the speed of light
+// of the neighborhood.
+func (engine *paranoidEngine) check(before, after, born, died Cells) {
+	var problems []string
+	report := func(what string, cells []Cell) {
+		if len(cells) > 0 {
+			problems = append(problems, fmt.Sprintf("%d %s, such as %s", len(cells), what, sampleCells(cells)))
+		}
+	}
+
+	var notNew, notAlive, notOld, stillAlive, frozenBorn, frozenDied []Cell
+	for cell := range born {
+		if before.hasCell(cell) {
+			notNew = append(notNew, cell)
+		}
+		if !after.hasCell(cell) {
+			notAlive = append(notAlive, cell)
+		}
+		if !engine.constraints.allowsBirth(cell) {
+			frozenBorn = append(frozenBorn, cell)
+		}
+	}
+	for cell := range died {
+		if !before.hasCell(cell) {
+			notOld = append(notOld, cell)
+		}
+		if after.hasCell(cell) {
+			stillAlive = append(stillAlive, cell)
+		}
+		if !engine.constraints.allowsDeath(cell) {
+			frozenDied = append(frozenDied, cell)
+		}
+	}
+	report("born cells that were already alive", notNew)
+	report("born cells that are not alive", notAlive)
+	report("dead cells that were not alive", notOld)
+	report("dead cells that are still alive", stillAlive)
+	report("cells born where the constraints forbid it", frozenBorn)
+	report("cells died where the constraints forbid it", frozenDied)
+	if expected := len(before) + len(born) - len(died); len(after) != expected {
+		problems = append(problems, fmt.Sprintf("population %d, but %d + %d born - %d died is %d", len(after), len(before), len(born), len(died), expected))
+	}
+
+	// nothing can appear further than the radius of the neighborhood from the
+	// cells of the generation before
+	if topLeft, bottomRight, ok := before.boundingBox(); ok {
+		reach := Rect{topLeft.x, topLeft.y, bottomRight.x - topLeft.x + 1, bottomRight.y - topLeft.y + 1}.grown(engine.radius)
+		var outside []Cell
+		for cell := range born {
+			if !reach.contains(cell) {
+				outside = append(outside, cell)
+			}
+		}
+		report(fmt.Sprintf("cells born outside %v, out of reach of the generation before", reach), outside)
+	} else {
+		report("cells born in an empty universe", born.sorted())
+	}
+
+	if len(problems) > 0 {
+		panic(fmt.Sprintf("paranoid: generation %d of %T is wrong:\n  %s", engine.generation, engine.engine, strings.Join(problems, "\n  ")))
+	}
+}
+
+// sampleCells lists the first few of cells in order.
+func sampleCells(cells []Cell) string {
+	sorted := make(Cells, len(cells))
+	for _, cell := range cells {
+		sorted.addCell(cell)
+	}
+	var sample []string
+	for _, cell := range sorted.sorted() {
+		if len(sample) == paranoidSampleCells {
+			sample = append(sample, "...")
+			break
+		}
+		sample = append(sample, fmt.Sprintf("%d,%d", cell.x, cell.y))
+	}
+	return strings.Join(sample, " ")
+}
@@ -0,0 +1,49 @@
+package main
+
+// cellHash scrambles a cell with splitmix64 so that XOR-ing the hashes of all
+// alive cells gives an order-independent fingerprint of a universe, which can
+// be updated incrementally from the born and died cells of each generation.
+func cellHash(cell Cell) uint64 {
+	h := uint64(cell.x)*0x9e3779b97f4a7c15 ^ uint64(cell.y)
+	h += 0x9e3779b97f4a7c15
+	h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+	h = (h ^ (h >> 27)) * 0x94d049bb133111eb
+	return h ^ (h >> 31)
+}
+
+func (cells Cells) hash() uint64 {
+	h := uint64(0)
+	for cell := range cells {
+		h ^= cellHash(cell)
+	}
+	return h
+}
+
+// periodDetector notices when a universe returns to a state it was in at most
+// maxPeriod generations ago.
+type periodDetector struct {
+	maxPeriod int
+	seen      map[uint64]int // universe hash -> last generation it was seen
+}
+
+func newPeriodDetector(maxPeriod int) *periodDetector {
+	return &periodDetector{maxPeriod, make(map[uint64]int)}
+}
+
+// observe records the hash of the universe at generation and returns the
+// period if the same universe was seen within the last maxPeriod generations.
+func (detector *periodDetector) observe(generation int, hash uint64) (int, bool) {
+	last, found := detector.seen[hash]
+	detector.seen[hash] = generation
+	if expired := generation - detector.maxPeriod; expired >= 0 {
+		for h, g := range detector.seen {
+			if g < expired {
+				delete(detector.seen, h)
+			}
+		}
+	}
+	if found && generation-last <= detector.maxPeriod {
+		return generation - last, true
+	}
+	return 0, false
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// parsePlaintext reads the plaintext .cells format of LifeWiki: rows of '.'
+// (dead) and 'O' (alive) cells starting at 0,0, with '!' comment lines such
+// as "!Name: Glider", which are kept as the pattern's metadata. Blank lines are rows of dead cells, and '*' is accepted
+// for alive cells as some older files use it.
+func parsePlaintext(r io.Reader, region *Rect) (Pattern, error) {
+	pattern := Pattern{cells: make(Cells)}
+	cells := pattern.cells
+
+	y := int64(0)
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if comment, found := strings.CutPrefix(line, "!"); found {
+			// the rule comment writePlaintext adds is not metadata
+			if !strings.HasPrefix(comment, "Rule:") {
+				if err := pattern.metadata.parseLabelledComment(comment); err != nil {
+					return Pattern{}, fmt.Errorf("line %d: %v", lineNumber, err)
+				}
+			}
+			continue
+		}
+		for i, c := range line {
+			switch c {
+			case '.':
+			case 'O', '*':
+				cell := Cell{int64(i), y}
+				if region == nil || region.contains(cell) {
+					if len(cells) >= maxParsedCells {
+						return Pattern{}, errTooManyCells
+					}
+					cells.addCell(cell)
+				}
+			default:
+				return Pattern{}, fmt.Errorf("unexpected character '%c' on line %d", c, lineNumber)
+			}
+		}
+		if y++; y > maxCoordinate {
+			return Pattern{}, fmt.Errorf("pattern on line %d extends beyond coordinate %d", lineNumber, int64(maxCoordinate))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Pattern{}, err
+	}
+	return pattern, nil
+}
+
+// writePlaintext writes the bounding box of a pattern in the .cells format,
+// leaving out the trailing dead cells of each row.
+func writePlaintext(w io.Writer, pattern Pattern) error {
+	bw := bufio.NewWriter(w)
+	cells := pattern.cells
+	bw.WriteString(pattern.metadata.labelledComments("!"))
+	if pattern.rule != "" {
+		// .cells has no place for a rule, but a comment keeps it for readers
+		fmt.Fprintf(bw, "!Rule: %s\n", pattern.rule)
+	}
+	min, max, ok := cells.boundingBox()
+	for y := min.y; ok && y <= max.y; y++ {
+		var row strings.Builder
+		for x := min.x; x <= max.x; x++ {
+			if cells.hasCell(Cell{x, y}) {
+				row.WriteByte('O')
+			} else {
+				row.WriteByte('.')
+			}
+		}
+		line := strings.TrimRight(row.String(), ".")
+		if line == "" {
+			line = "."
+		}
+		fmt.Fprintf(bw, "%s\n", line)
+	}
+	return bw.Flush()
+}
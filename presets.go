@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// presets are the well known patterns built into the tool for -pattern, in
+// RLE with their top left cell at the origin.
+var presets = map[string]string{
+	"glider":      "x = 3, y = 3, rule = B3/S23\nbo$2bo$3o!\n",
+	"gosper-gun":  "x = 36, y = 9, rule = B3/S23\n24bo$22bobo$12b2o6b2o12b2o$11bo3bo4b2o12b2o$2o8bo5bo3b2o$2o8bo3bob2o4bobo$10bo5bo7bo$11bo3bo$12b2o!\n",
+	"r-pentomino": "x = 3, y = 3, rule = B3/S23\nb2o$2o$bo!\n",
+	"acorn":       "x = 7, y = 3, rule = B3/S23\nbo$3bo$2o2b3o!\n",
+	"pulsar":      "x = 13, y = 13, rule = B3/S23\n2b3o3b3o2$o4bobo4bo$o4bobo4bo$o4bobo4bo$2b3o3b3o2$2b3o3b3o$o4bobo4bo$o4bobo4bo$o4bobo4bo2$2b3o3b3o!\n",
+	"lwss":        "x = 5, y = 4, rule = B3/S23\nbo2bo$o4b$o3bo$4o!\n",
+}
+
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parsePresetInput parses name or name@x,y (or name@anchor) given to -pattern.
+func parsePresetInput(s string, anchors Anchors) (placedInput, error) {
+	input := parsePlacedInput(s, anchors)
+	name := strings.ToLower(input.file)
+	if _, ok := presets[name]; !ok {
+		return placedInput{}, fmt.Errorf("unknown pattern %q, expected one of %s", input.file, strings.Join(presetNames(), ", "))
+	}
+	return placedInput{preset: name, offset: input.offset}, nil
+}
+
+// readPreset reads a built in pattern, keeping only the cells inside region.
+// The patterns are of no rule in particular, so that a run of one under
+// -rule is not warned about running under another.
+func readPreset(name string, region *Rect) (Pattern, error) {
+	pattern, err := parseRLE(strings.NewReader(presets[name]), region)
+	pattern.rule = ""
+	return pattern, err
+}
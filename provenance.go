@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// provenance records how a run's results came about, for -provenance: what
+// was read and written, with which flags, by which build on which host. The
+// schema is that `schema print provenance` prints.
+type provenance struct {
+	Schema   string            `json:"schema"`
+	Tool     provenanceTool    `json:"tool"`
+	Args     []string          `json:"args"`
+	Flags    map[string]string `json:"flags"`
+	Inputs   []provenanceFile  `json:"inputs"`
+	Outputs  []provenanceFile  `json:"outputs"`
+	Started  time.Time         `json:"started"`
+	Duration float64           `json:"duration_seconds"`
+	Host     provenanceHost    `json:"host"`
+	Result   provenanceResult  `json:"result"`
+}
+
+type provenanceTool struct {
+	Version  string `json:"version"`
+	Revision string `json:"revision,omitempty"`
+	Modified bool   `json:"modified,omitempty"`
+	Go       string `json:"go"`
+}
+
+// provenanceFile is a file read or written by the run. The hash is left out
+// for what cannot be read back, such as stdin.
+type provenanceFile struct {
+	Name   string `json:"name"`
+	Offset string `json:"offset,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+type provenanceHost struct {
+	Hostname string `json:"hostname"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	CPUs     int    `json:"cpus"`
+}
+
+type provenanceResult struct {
+	Generation int    `json:"generation"`
+	Population int    `json:"population"`
+	Hash       string `json:"hash"`
+}
+
+// writeProvenance writes the provenance of a run that started at started and
+// ended with result to opts.provenance.
+func writeProvenance(opts runOptions, started time.Time, result Pattern) error {
+	record := provenance{
+		Schema:   SCHEMA_PROVENANCE,
+		Tool:     buildTool(),
+		Args:     os.Args[1:],
+		Flags:    map[string]string{},
+		Inputs:   []provenanceFile{},
+		Outputs:  []provenanceFile{},
+		Started:  started.UTC(),
+		Duration: time.Since(started).Seconds(),
+		Result:   provenanceResult{result.generation, len(result.cells), fmt.Sprintf("%016x", result.cells.hash())},
+	}
+	flag.Visit(func(f *flag.Flag) {
+		record.Flags[f.Name] = f.Value.String()
+	})
+	record.Host.Hostname, _ = os.Hostname()
+	record.Host.OS, record.Host.Arch, record.Host.CPUs = runtime.GOOS, runtime.GOARCH, runtime.NumCPU()
+
+	for _, input := range opts.inputs {
+		file := provenanceFile{Name: input.name()}
+		if input.preset == "" {
+			file.SHA256 = fileSHA256(input.file)
+		}
+		if input.offset != (Offset{}) {
+			file.Offset = fmt.Sprintf("%d,%d", input.offset.dx, input.offset.dy)
+		}
+		record.Inputs = append(record.Inputs, file)
+	}
+	for _, name := range []string{opts.deltaFile, opts.history, opts.midiFile, opts.statsFile, opts.render, opts.gif, opts.corpus} {
+		if name != "" {
+			record.Outputs = append(record.Outputs, provenanceFile{Name: name, SHA256: fileSHA256(opts.staging.path(name))})
+		}
+	}
+
+	file, err := os.Create(opts.staging.path(opts.provenance))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(record); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// buildTool describes the build of the running binary, including the
+// commit it was built from when the build recorded it.
+func buildTool() provenanceTool {
+	tool := provenanceTool{Version: "unknown", Go: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return tool
+	}
+	if info.Main.Version != "" {
+		tool.Version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			tool.Revision = setting.Value
+		case "vcs.modified":
+			tool.Modified = setting.Value == "true"
+		}
+	}
+	return tool
+}
+
+// fileSHA256 returns the hex SHA-256 of a file, or "" if it cannot be read.
+func fileSHA256(name string) string {
+	if name == "-" {
+		return ""
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"image/color"
+	"io"
+)
+
+// rawFrameSink writes the generations of a run sampler picks as raw RGBA frames of
+// the fixed viewport of view, for piping into a video encoder
+// such as ffmpeg -f rawvideo -pix_fmt rgba. Unlike a GIF, nothing is kept
+// between frames, so runs of any length can be recorded.
+type rawFrameSink struct {
+	w       *bufio.Writer
+	view    viewTransform
+	sampler frameSampler
+	// frame is reused for every frame, and blank is a frame of dead cells.
+	frame, blank []byte
+}
+
+func newRawFrameSink(w io.Writer, view viewTransform, sampler frameSampler) (*rawFrameSink, error) {
+	width, height, err := view.size()
+	if err != nil {
+		return nil, err
+	}
+	r, g, b, a := deadColor.RGBA()
+	blank := bytes.Repeat([]byte{byte(r >> 8), byte(g >> 8), byte(b >> 8), byte(a >> 8)}, width*height)
+	sampler.viewport = view.viewport
+	return &rawFrameSink{
+		w:       bufio.NewWriter(w),
+		view:    view,
+		sampler: sampler,
+		frame:   make([]byte, len(blank)),
+		blank:   blank,
+	}, nil
+}
+
+// needsEveryGeneration is true since a dropped frame would throw the
+// video's timing off.
+func (sink *rawFrameSink) needsEveryGeneration() bool {
+	return true
+}
+
+func (sink *rawFrameSink) observe(event Event) error {
+	if !sink.sampler.sample(event) {
+		return nil
+	}
+
+	copy(sink.frame, sink.blank)
+	sink.paint(event.decay.cells(), decayColor)
+	sink.paint(event.cells, aliveColor)
+	_, err := sink.w.Write(sink.frame)
+	return err
+}
+
+// paint draws cells into the frame in c.
+func (sink *rawFrameSink) paint(cells Cells, c color.Color) {
+	r, g, b, a := c.RGBA()
+	pixel := []byte{byte(r >> 8), byte(g >> 8), byte(b >> 8), byte(a >> 8)}
+	stride := int(sink.view.width()) * 4
+	for cell := range cells {
+		square, ok := sink.view.pixels(cell)
+		if !ok {
+			continue
+		}
+		for y := square.Min.Y; y < square.Max.Y; y++ {
+			for x := square.Min.X; x < square.Max.X; x++ {
+				copy(sink.frame[y*stride+x*4:], pixel)
+			}
+		}
+	}
+}
+
+func (sink *rawFrameSink) close() error {
+	return sink.w.Flush()
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// stablePeriods is how many whole periods the population must repeat for
+// before a reaction is considered to have settled.
+const stablePeriods = 3
+
+// runReact collides two objects and classifies what is left once the
+// reaction has settled, ignoring anything that survived untouched.
+func runReact(args []string) error {
+	flags := flag.NewFlagSet("react", flag.ContinueOnError)
+	offsetArg := flags.String("offset", "0,0", "Place the second object translated by dx,dy relative to the first")
+	phaseArg := flags.Int("phase", 0, "Advance the second object by this many generations before placing it")
+	maxGenerationsArg := flags.Int("max-generations", 10000, "Give up if the reaction has not settled after this many generations")
+	objectsArg := flags.String("objects", "", "Name products by the apgcodes of this file, a tab separated apgcode and name on each line, as well as the common objects of B3/S23 built in")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("expected two object files, got %d", flags.NArg())
+	}
+	dx, dy, err := parseCoordinates(*offsetArg)
+	if err != nil {
+		return fmt.Errorf("invalid -offset: %v", err)
+	}
+	names, err := loadObjectNames(*objectsArg, conwayRule)
+	if err != nil {
+		return fmt.Errorf("loading -objects failed: %v", err)
+	}
+
+	a, err := parseCells(flags.Arg(0), nil)
+	if err != nil {
+		return fmt.Errorf("parsing %s failed: %v", flags.Arg(0), err)
+	}
+	b, err := parseCells(flags.Arg(1), nil)
+	if err != nil {
+		return fmt.Errorf("parsing %s failed: %v", flags.Arg(1), err)
+	}
+	b = advance(b, conwayRule, *phaseArg)
+	if b, err = b.translated(Offset{dx, dy}); err != nil {
+		return err
+	}
+
+	reaction := union(a, b)
+	reaction, generations, settled := settle(reaction, conwayRule, *maxGenerationsArg)
+	if !settled {
+		return fmt.Errorf("reaction did not settle within %d generations", *maxGenerationsArg)
+	}
+
+	// what the objects would have become had they never met
+	a = advance(a, conwayRule, generations)
+	b = advance(b, conwayRule, generations)
+	undisturbed := union(a, b)
+	survivors := make(map[Cell]int)
+	for i, component := range undisturbed.components(objectGap) {
+		for cell := range component {
+			survivors[cell] = i
+		}
+	}
+
+	fmt.Printf("# settled after %d generations with %d cells\n", generations, len(reaction))
+	products := 0
+	for _, component := range reaction.components(objectGap) {
+		if isSurvivor(component, survivors, undisturbed) {
+			continue
+		}
+		products++
+		var rle bytes.Buffer
+		writeRLEBody(&rle, component)
+		min, _, _ := component.boundingBox()
+		fmt.Printf("product %d: %s, %d cells at %d,%d: %s\n", products, classify(component, conwayRule, names), len(component), min.x, min.y, strings.TrimSpace(rle.String()))
+	}
+	switch {
+	case products > 0:
+	case len(reaction) == 0:
+		fmt.Println("# no products, the objects annihilated")
+	default:
+		fmt.Println("# no products, both objects survived unchanged")
+	}
+	return nil
+}
+
+// isSurvivor reports whether component is exactly one of the undisturbed
+// objects, i.e. the reaction never touched it.
+func isSurvivor(component Cells, survivors map[Cell]int, undisturbed Cells) bool {
+	index := -1
+	for cell := range component {
+		i, found := survivors[cell]
+		if !found || (index >= 0 && i != index) {
+			return false
+		}
+		index = i
+	}
+	count := 0
+	for _, i := range survivors {
+		if i == index {
+			count++
+		}
+	}
+	return count == len(component)
+}
+
+// classify names an isolated object by how it repeats itself, and by its
+// apgcode, with its name when names has one.
+func classify(object Cells, rule Rule, names objectNames) string {
+	m, found := detectMotion(object, rule, maxDetectedPeriod)
+	if code := apgcode(object, rule, m, found); code != "" {
+		return fmt.Sprintf("%s %s", names.describe(code, m, found), code)
+	}
+	return describeMotion(m, found)
+}
+
+func describeMotion(m motion, found bool) string {
+	switch {
+	case !found:
+		return fmt.Sprintf("unclassified, no repetition within %d generations", maxDetectedPeriod)
+	case m.isMoving():
+		return "spaceship " + m.String()
+	case m.period == 1:
+		return "still life"
+	default:
+		return fmt.Sprintf("oscillator period %d", m.period)
+	}
+}
+
+// detectMotion simulates a copy of cells until it repeats itself.
+func detectMotion(cells Cells, rule Rule, maxPeriod int) (motion, bool) {
+	cells = cells.clone()
+	engine := newNaiveEngine(rule, mooreNeighborhood, constraints{})
+	detector := newMotionDetector(maxPeriod)
+	detector.observe(0, cells)
+	for generation := 1; generation <= 2*maxPeriod; generation++ {
+		cells, _, _ = engine.step(cells)
+		if m, found := detector.observe(generation, cells); found {
+			return m, true
+		}
+	}
+	return motion{}, false
+}
+
+// settle runs cells until the reaction is over: every object left repeats
+// itself and no two of them will ever meet again. The population repeating
+// for stablePeriods periods is used as a cheap hint of when that may be the
+// case. It returns the cells and the generation reached; cells itself is
+// used up.
+func settle(cells Cells, rule Rule, maxGenerations int) (Cells, int, bool) {
+	engine := newNaiveEngine(rule, mooreNeighborhood, constraints{})
+	populations := []int{len(cells)}
+	for generation := 1; generation <= maxGenerations; generation++ {
+		cells, _, _ = engine.step(cells)
+		populations = append(populations, len(cells))
+		for period := 1; period <= maxDetectedPeriod; period++ {
+			if isPeriodic(populations, period, stablePeriods) {
+				if isSettled(cells, rule) {
+					return cells, generation, true
+				}
+				break
+			}
+		}
+	}
+	return cells, maxGenerations, false
+}
+
+// isSettled reports whether every object of cells repeats itself in
+// isolation and no two objects are on course to meet.
+func isSettled(cells Cells, rule Rule) bool {
+	objects := cells.components(objectGap)
+	motions := make([]motion, len(objects))
+	for i, object := range objects {
+		m, found := detectMotion(object, rule, maxDetectedPeriod)
+		if !found {
+			return false
+		}
+		motions[i] = m
+	}
+	for i := range objects {
+		for j := i + 1; j < len(objects); j++ {
+			if willMeet(objects[i], motions[i], objects[j], motions[j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// meetMargin widens bounding boxes to cover the other phases of an object
+// and the reach of its neighborhood.
+const meetMargin = 3
+
+// willMeet reports whether the bounding boxes of two objects, widened by
+// meetMargin and following their motions, overlap in the future. Objects
+// keeping their distance never meet, since they are already far enough
+// apart to be separate objects.
+func willMeet(a Cells, ma motion, b Cells, mb motion) bool {
+	ax, ay := ma.velocity()
+	bx, by := mb.velocity()
+	if ax == bx && ay == by {
+		return false
+	}
+	minA, maxA, _ := a.boundingBox()
+	minB, maxB, _ := b.boundingBox()
+	fromX, toX := overlapTimes(float64(minA.x-meetMargin), float64(maxA.x+meetMargin), float64(minB.x), float64(maxB.x), bx-ax)
+	fromY, toY := overlapTimes(float64(minA.y-meetMargin), float64(maxA.y+meetMargin), float64(minB.y), float64(maxB.y), by-ay)
+	from, to := max(fromX, fromY, 0), min(toX, toY)
+	return from <= to
+}
+
+// overlapTimes returns the times at which the interval [b1, b2], moving at
+// velocity v, overlaps the fixed interval [a1, a2].
+func overlapTimes(a1, a2, b1, b2, v float64) (float64, float64) {
+	if v == 0 {
+		if b2 < a1 || b1 > a2 {
+			return math.Inf(1), math.Inf(-1)
+		}
+		return math.Inf(-1), math.Inf(1)
+	}
+	from, to := (a1-b2)/v, (a2-b1)/v
+	return min(from, to), max(from, to)
+}
+
+func isPeriodic(values []int, period, periods int) bool {
+	window := period * periods
+	if len(values) < window+period {
+		return false
+	}
+	for i := len(values) - window; i < len(values); i++ {
+		if values[i] != values[i-period] {
+			return false
+		}
+	}
+	return true
+}
+
+// advance runs cells for the given number of generations, returning the
+// result; cells itself is used up.
+func advance(cells Cells, rule Rule, generations int) Cells {
+	engine := newNaiveEngine(rule, mooreNeighborhood, constraints{})
+	for generation := 0; generation < generations; generation++ {
+		cells, _, _ = engine.step(cells)
+	}
+	return cells
+}
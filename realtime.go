@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// realtimeDegradeAfter is how many deadlines in a row may be missed before
+// a real-time run sheds its analysis to catch up.
+const realtimeDegradeAfter = 10
+
+// realtimeClock paces a run at a fixed number of generations per second, for
+// driving displays and installations, and accounts for the generations that
+// could not be computed in time.
+type realtimeClock struct {
+	interval time.Duration
+	// deadline is when the current generation is due.
+	deadline time.Time
+
+	generations int
+	missed      int
+	missedInRow int
+	worst       time.Duration
+	// degradedAt is the generation analysis was shed at, or 0.
+	degradedAt int
+}
+
+func newRealtimeClock(gps float64) *realtimeClock {
+	interval := time.Duration(float64(time.Second) / gps)
+	return &realtimeClock{interval: interval, deadline: time.Now().Add(interval)}
+}
+
+// wait blocks until the current generation is due and reports whether it was
+// ready in time. A late generation moves the following deadlines back rather
+// than having the run rush to catch up, which would look worse on a display
+// than an occasional stall.
+func (clock *realtimeClock) wait() bool {
+	clock.generations++
+	now := time.Now()
+	late := now.Sub(clock.deadline)
+	if late <= 0 {
+		time.Sleep(-late)
+		clock.deadline = clock.deadline.Add(clock.interval)
+		clock.missedInRow = 0
+		return true
+	}
+	clock.missed++
+	clock.missedInRow++
+	clock.worst = max(clock.worst, late)
+	clock.deadline = now.Add(clock.interval)
+	return false
+}
+
+// shouldDegrade is whether the run has fallen behind for long enough that
+// it should shed work.
+func (clock *realtimeClock) shouldDegrade() bool {
+	return clock.degradedAt == 0 && clock.missedInRow >= realtimeDegradeAfter
+}
+
+func (clock *realtimeClock) report(w io.Writer) {
+	fmt.Fprintf(w, "Real-time: %d generations at %v each, %d deadlines missed", clock.generations, clock.interval, clock.missed)
+	if clock.missed > 0 {
+		fmt.Fprintf(w, ", the worst by %v", clock.worst.Round(time.Microsecond))
+	}
+	if clock.degradedAt > 0 {
+		fmt.Fprintf(w, ", analysis shed at generation %d", clock.degradedAt)
+	}
+	fmt.Fprintln(w)
+}
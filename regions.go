@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rect is a rectangle of cells whose top-left corner is x,y.
+type Rect struct {
+	x, y, w, h int64
+}
+
+func (rect Rect) contains(cell Cell) bool {
+	return cell.x >= rect.x && cell.x-rect.x < rect.w &&
+		cell.y >= rect.y && cell.y-rect.y < rect.h
+}
+
+// grown is the rectangle extended by margin cells on every side.
+func (rect Rect) grown(margin int64) Rect {
+	return Rect{rect.x - margin, rect.y - margin, rect.w + 2*margin, rect.h + 2*margin}
+}
+
+func (rect Rect) String() string {
+	return fmt.Sprintf("%d,%d,%d,%d", rect.x, rect.y, rect.w, rect.h)
+}
+
+// parseRect parses a rectangle given as x,y,w,h, or as name,w,h where name is
+// an anchor marking the top-left corner.
+func parseRect(s string, anchors Anchors) (Rect, error) {
+	parts := strings.Split(s, ",")
+	var corner, size string
+	switch len(parts) {
+	case 3:
+		corner, size = parts[0], parts[1]+","+parts[2]
+	case 4:
+		corner, size = parts[0]+","+parts[1], parts[2]+","+parts[3]
+	default:
+		return Rect{}, fmt.Errorf("rectangle '%s' is not of the form x,y,w,h or anchor,w,h", s)
+	}
+	topLeft, err := anchors.resolve(corner)
+	if err != nil {
+		return Rect{}, fmt.Errorf("rectangle '%s': %v", s, err)
+	}
+	w, h, err := parseCoordinates(size)
+	if err != nil {
+		return Rect{}, fmt.Errorf("rectangle '%s': %v", s, err)
+	}
+	if w <= 0 || h <= 0 {
+		return Rect{}, fmt.Errorf("rectangle '%s' must have a positive width and height", s)
+	}
+	return Rect{topLeft.x, topLeft.y, w, h}, nil
+}
+
+// parseRects parses every rectangle of a repeated flag.
+func parseRects(specs []string, anchors Anchors) (Rects, error) {
+	rects := make(Rects, 0, len(specs))
+	for _, spec := range specs {
+		rect, err := parseRect(spec, anchors)
+		if err != nil {
+			return nil, err
+		}
+		rects = append(rects, rect)
+	}
+	return rects, nil
+}
+
+// parseCoordinates parses a pair of integers given as a,b.
+func parseCoordinates(s string) (int64, int64, error) {
+	first, second, found := strings.Cut(s, ",")
+	if !found {
+		return 0, 0, fmt.Errorf("'%s' is not of the form x,y", s)
+	}
+	a, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := strconv.ParseInt(strings.TrimSpace(second), 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return a, b, nil
+}
+
+type Rects []Rect
+
+func (rects Rects) contains(cell Cell) bool {
+	for _, rect := range rects {
+		if rect.contains(cell) {
+			return true
+		}
+	}
+	return false
+}
+
+// constraints pin parts of the universe in place while the rest evolves,
+// which is handy for emulating walls or isolating part of a large pattern.
+type constraints struct {
+	// frozen cells never change state but are still counted as neighbors.
+	frozen Rects
+	// masked cells are permanently dead.
+	masked Rects
+	// simulated, when not nil, is the only region whose cells change; every
+	// cell outside it is frozen.
+	simulated *Rect
+	// bounds, when not nil, is the grid of a bounded topology; every cell
+	// outside it is permanently dead.
+	bounds *Rect
+}
+
+// isEmpty is whether the constraints leave every cell free to change.
+func (c constraints) isEmpty() bool {
+	return len(c.frozen) == 0 && len(c.masked) == 0 && c.simulated == nil && c.bounds == nil
+}
+
+func (c constraints) allowsBirth(cell Cell) bool {
+	return c.allowsDeath(cell) && !c.keepsDead(cell)
+}
+
+// keepsDead is whether cell is masked or outside the bounds.
+func (c constraints) keepsDead(cell Cell) bool {
+	return c.masked.contains(cell) || (c.bounds != nil && !c.bounds.contains(cell))
+}
+
+func (c constraints) allowsDeath(cell Cell) bool {
+	return (c.simulated == nil || c.simulated.contains(cell)) && !c.frozen.contains(cell)
+}
+
+// apply removes the alive cells that lie in a masked region or outside the
+// bounds.
+func (c constraints) apply(cells Cells) {
+	if len(c.masked) == 0 && c.bounds == nil {
+		return
+	}
+	for cell := range cells {
+		if c.keepsDead(cell) {
+			cells.removeCell(cell)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+func runRender(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing render command, expected one of: thumbs")
+	}
+	switch args[0] {
+	case "thumbs":
+		return runRenderThumbs(args[1:])
+	default:
+		return fmt.Errorf("unknown render command '%s', expected one of: thumbs", args[0])
+	}
+}
+
+// runRenderThumbs renders every pattern in a directory to a square PNG
+// thumbnail, for browsing a collection of patterns.
+func runRenderThumbs(args []string) error {
+	flags := flag.NewFlagSet("render thumbs", flag.ContinueOnError)
+	sizeArg := flags.Int("size", 128, "The width and height of the thumbnails in pixels")
+	gensArg := flags.Int("gens", 0, "The number of generations to run each pattern for before rendering it")
+	outArg := flags.String("out", "", "The directory to write the thumbnails to, by default the directory of the patterns")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one directory of patterns, got %d arguments", flags.NArg())
+	}
+	if *sizeArg <= 0 {
+		return fmt.Errorf("invalid -size %d, must be positive", *sizeArg)
+	}
+	dir := flags.Arg(0)
+	out := *outArg
+	if out == "" {
+		out = dir
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	rendered, failed := 0, 0
+	for _, name := range names {
+		format, found := formatForFile(name)
+		if !found {
+			continue
+		}
+		// the extension is kept so that glider.lif and glider.rle do not collide
+		thumbnail := filepath.Join(out, name+".png")
+		if err := renderThumbnail(filepath.Join(dir, name), format, thumbnail, *sizeArg, *gensArg); err != nil {
+			logger(logRenderer).Error("Rendering a thumbnail failed", "pattern", name, "err", err)
+			failed++
+			continue
+		}
+		rendered++
+	}
+
+	fmt.Printf("%d thumbnails rendered, %d failed\n", rendered, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d patterns could not be rendered", failed)
+	}
+	return nil
+}
+
+func renderThumbnail(name string, format Format, thumbnail string, size, generations int) error {
+	pattern, err := readPatternFile(name, format, nil)
+	if err != nil {
+		return err
+	}
+	rule := conwayRule
+	if pattern.rule != "" {
+		if rule, err = parseRule(pattern.rule); err != nil {
+			return err
+		}
+	}
+	engine := newNaiveEngine(rule, mooreNeighborhood, constraints{})
+	for generation := 0; generation < generations; generation++ {
+		pattern.cells, _, _ = engine.step(pattern.cells)
+	}
+
+	file, err := os.Create(thumbnail)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, renderCells(pattern.cells, size)); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+var (
+	deadColor  = color.Gray{0xff}
+	aliveColor = color.Gray{0x20}
+	// decayColor is the color of the decaying cells of Generations rules.
+	decayColor = color.Gray{0xa0}
+)
+
+// renderCells draws the bounding box of cells centered in a size by size
+// image. Small patterns are scaled up by a whole number of pixels per cell;
+// large ones are scaled down, drawing a pixel alive when any cell it covers
+// is alive so that sparse patterns stay visible.
+func renderCells(cells Cells, size int) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{deadColor, aliveColor})
+	topLeft, bottomRight, ok := cells.boundingBox()
+	if !ok {
+		return img
+	}
+	width, height := bottomRight.x-topLeft.x+1, bottomRight.y-topLeft.y+1
+	extent := float64(max(width, height))
+	scale := float64(size) / extent
+	if scale >= 1 {
+		// keep cells square and crisp
+		scale = float64(int(scale))
+	}
+	offsetX := (float64(size) - float64(width)*scale) / 2
+	offsetY := (float64(size) - float64(height)*scale) / 2
+
+	for cell := range cells {
+		left := int(offsetX + float64(cell.x-topLeft.x)*scale)
+		top := int(offsetY + float64(cell.y-topLeft.y)*scale)
+		right := max(int(offsetX+float64(cell.x-topLeft.x+1)*scale), left+1)
+		bottom := max(int(offsetY+float64(cell.y-topLeft.y+1)*scale), top+1)
+		for y := top; y < bottom && y < size; y++ {
+			for x := left; x < right && x < size; x++ {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// analysisReport is the analysis of a run as -analysis-json writes it, for
+// other tools and for drawing over renders with -overlay:
+//
+//	{
+//	  "schema": "urn:gameoflife:schema:analysis:1",
+//	  "generation": 100,
+//	  "population": 5,
+//	  "centroid": [26.2, 26.2],
+//	  "drift": [0.25, 0.25],
+//	  "motion": {"period": 4, "dx": 1, "dy": 1},
+//	  "components": [
+//	    {"bounds": {"x": 25, "y": 25, "w": 3, "h": 3}, "population": 5,
+//	     "kind": "spaceship", "motion": {"period": 4, "dx": 1, "dy": 1}}
+//	  ]
+//	}
+//
+// The components are the objects of the last generation, each classified by
+// simulating it on its own. The schema is that `schema print analysis`
+// prints.
+type analysisReport struct {
+	Schema     string            `json:"schema,omitempty"`
+	Generation int               `json:"generation"`
+	Population int               `json:"population"`
+	Centroid   [2]float64        `json:"centroid"`
+	Drift      [2]float64        `json:"drift"`
+	Motion     *reportMotion     `json:"motion,omitempty"`
+	Components []reportComponent `json:"components"`
+	// Followed is how far the report was moved back with -follow.
+	Followed *[2]int64 `json:"followed,omitempty"`
+}
+
+type reportMotion struct {
+	Period int   `json:"period"`
+	DX     int64 `json:"dx"`
+	DY     int64 `json:"dy"`
+}
+
+type reportComponent struct {
+	Bounds     jsonBounds    `json:"bounds"`
+	Population int           `json:"population"`
+	Kind       string        `json:"kind"`
+	Motion     *reportMotion `json:"motion,omitempty"`
+}
+
+// The kinds of components in a report.
+const (
+	KIND_STILL_LIFE   = "still life"
+	KIND_OSCILLATOR   = "oscillator"
+	KIND_SPACESHIP    = "spaceship"
+	KIND_UNCLASSIFIED = "unclassified"
+)
+
+func newReportMotion(m motion) *reportMotion {
+	return &reportMotion{m.period, m.dx, m.dy}
+}
+
+// report is the analysis of the run so far, of which cells is the last
+// generation.
+func (a *analysis) report(cells Cells, rule Rule) analysisReport {
+	vx, vy := a.drift.velocity()
+	report := analysisReport{
+		Schema:     SCHEMA_ANALYSIS,
+		Generation: a.generation,
+		Population: a.population,
+		Centroid:   [2]float64{a.centroid.x, a.centroid.y},
+		Drift:      [2]float64{vx, vy},
+		Components: []reportComponent{},
+	}
+	if a.motion != nil {
+		report.Motion = newReportMotion(*a.motion)
+	}
+	for _, object := range cells.components(objectGap) {
+		min, max, _ := object.boundingBox()
+		component := reportComponent{
+			Bounds:     jsonBounds{min.x, min.y, max.x - min.x + 1, max.y - min.y + 1},
+			Population: len(object),
+			Kind:       KIND_UNCLASSIFIED,
+		}
+		if m, found := detectMotion(object, rule, maxDetectedPeriod); found {
+			component.Motion = newReportMotion(m)
+			switch {
+			case m.isMoving():
+				component.Kind = KIND_SPACESHIP
+			case m.period == 1:
+				component.Kind = KIND_STILL_LIFE
+			default:
+				component.Kind = KIND_OSCILLATOR
+			}
+		}
+		report.Components = append(report.Components, component)
+	}
+	return report
+}
+
+func writeAnalysisReport(path string, report analysisReport) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func readAnalysisReport(path string) (*analysisReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var report analysisReport
+	if err := json.NewDecoder(file).Decode(&report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// bytesPerCell approximates one entry of a Cells map including the map's
+	// own overhead and the slack left after it last doubled in size.
+	bytesPerCell = 48
+	// bytesPerCount approximates one entry of the engine's neighbor counts.
+	bytesPerCount = 40
+	// countsPerCell is how many cells of the counts map each alive cell is
+	// responsible for on average; isolated cells add a whole neighborhood,
+	// cells inside clusters share most of theirs.
+	countsPerCell = 3
+	// settledGrowth bounds how much a non-explosive pattern tends to grow.
+	settledGrowth = 2
+)
+
+// memoryEstimate is a rough upper bound on the memory a run will need.
+type memoryEstimate struct {
+	peakPopulation uint64
+	bytes          uint64
+}
+
+// estimateMemory guesses the peak memory of running cells for iterations
+// generations. Rules that give birth on 1 or 2 neighbors make almost any
+// pattern fill a square growing at the speed of light, so for those the
+// estimate assumes half of that square ends up alive; other rules are
+// assumed to settle at a small multiple of the initial population.
+func estimateMemory(cells Cells, rule Rule, iterations int) memoryEstimate {
+	population := uint64(len(cells))
+	peak := population * settledGrowth
+	if rule.birthsWith(1) || rule.birthsWith(2) {
+		if min, max, ok := cells.boundingBox(); ok {
+			width := float64(max.x-min.x+1) + 2*float64(iterations)
+			height := float64(max.y-min.y+1) + 2*float64(iterations)
+			peak = uint64(min64f(width*height/2, 1<<62))
+		}
+	}
+	peak = maxUint64(peak, population)
+	// the alive cells, the born and died cells of one step and the counts
+	return memoryEstimate{peak, peak * (2*bytesPerCell + countsPerCell*bytesPerCount)}
+}
+
+// checkResources warns when estimate exceeds the memory available to this
+// process, or refuses to run when strict is set. Platforms where the
+// available memory cannot be read are not checked.
+func checkResources(estimate memoryEstimate, strict bool) error {
+	available, ok := availableMemory()
+	if !ok || estimate.bytes <= available {
+		return nil
+	}
+	message := fmt.Sprintf("run may need about %s for a peak population of about %d, but only %s is available",
+		formatBytes(estimate.bytes), estimate.peakPopulation, formatBytes(available))
+	if strict {
+		return fmt.Errorf("%s (refusing because of -strict-resources)", message)
+	}
+	logger(logEngine).Warn(message)
+	return nil
+}
+
+// availableMemory returns the smaller of the cgroup memory limit and the
+// kernel's estimate of available memory, on Linux.
+func availableMemory() (uint64, bool) {
+	available, ok := readMemInfoAvailable()
+	if limit, found := readCgroupLimit(); found && (!ok || limit < available) {
+		return limit, true
+	}
+	return available, ok
+}
+
+func readMemInfoAvailable() (uint64, bool) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "MemAvailable:" && fields[2] == "kB" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			return kb * 1024, err == nil
+		}
+	}
+	return 0, false
+}
+
+func readCgroupLimit() (uint64, bool) {
+	data, err := os.ReadFile("/sys/fs/cgroup/memory.max")
+	if err != nil {
+		return 0, false
+	}
+	limit, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	return limit, err == nil // "max" means unlimited
+}
+
+func formatBytes(bytes uint64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value, exponent := float64(bytes)/unit, 0
+	for value >= unit && exponent < 4 {
+		value /= unit
+		exponent++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTP"[exponent])
+}
+
+func min64f(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxUint64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// rleLineLength is the width RLE rows are wrapped at, as Golly does.
+const rleLineLength = 70
+
+// parseRLE decodes a run length encoded pattern, as pasted from Golly. The
+// "x = ..., y = ..., rule = ..." header and '#' comment lines are optional, so
+// the bare snippet Golly places on the clipboard is accepted too; of the
+// header only the rule is kept, and of the comments the "#N" name, "#O"
+// author and "#C" comments. The first row starts at 0,0, unless a
+// "#CXRLE Pos=x,y Gen=n" line, Golly's extension for saving where a pattern
+// is and how far it was run, says otherwise. When region is not nil only the
+// cells inside it are kept. Of the states of a multi-state pattern, 'A' is
+// alive, and the states after it are the decaying cells of a Generations
+// rule, or alive under any other rule. Only built in rules are told apart
+// here: the states of a pattern whose header names some other rule, such as
+// a rule table, are kept for the run to settle with keepStates once it has
+// looked the rule up.
+func parseRLE(r io.Reader, region *Rect) (Pattern, error) {
+	pattern := Pattern{cells: make(Cells), decay: make(Decay)}
+	header, err := scanRLE(r, region, func(cell Cell, state uint8) error {
+		if len(pattern.cells)+len(pattern.decay) >= maxParsedCells {
+			return errTooManyCells
+		}
+		if state > 1 {
+			pattern.decay[cell] = state
+		} else {
+			pattern.cells.addCell(cell)
+		}
+		return nil
+	})
+	if err != nil {
+		return Pattern{}, err
+	}
+	pattern.generation, pattern.rule, pattern.metadata = header.generation, header.rule, header.metadata
+	if rule, err := parseRulestring(pattern.rule); err == nil {
+		pattern.keepStates(rule)
+	}
+	if len(pattern.decay) == 0 {
+		pattern.decay = nil
+	}
+	return pattern, nil
+}
+
+// keepStates makes the cells of pattern in states after alive alive unless
+// rule has those states, as Generations rules and rule tables do.
+func (pattern *Pattern) keepStates(rule Rule) {
+	if rule.isGenerations() && (len(pattern.decay) == 0 || maxState(pattern.decay) < rule.states) {
+		return
+	}
+	for cell := range pattern.decay {
+		pattern.cells.addCell(cell)
+	}
+	pattern.decay = nil
+}
+
+func maxState(decay Decay) uint8 {
+	highest := uint8(0)
+	for _, state := range decay {
+		highest = max(highest, state)
+	}
+	return highest
+}
+
+// rleHeader is what the header lines of an RLE pattern say about it.
+type rleHeader struct {
+	rule       string
+	generation int
+	metadata   metadata
+}
+
+// scanRLE decodes a run length encoded pattern like parseRLE, but hands each
+// alive cell to add as it is decoded instead of collecting them, which lets
+// callers process patterns far too large to hold in memory. Cells arrive row
+// by row, from left to right, with their state: 1 for 'o' and 'A', 2 for
+// 'B' and so on, and scanning stops at the first error add returns.
+func scanRLE(r io.Reader, region *Rect, add func(cell Cell, state uint8) error) (rleHeader, error) {
+	header := rleHeader{}
+	originX := int64(0)
+	x, y := int64(0), int64(0)
+	count := int64(0)
+	// prefix is the 'p' to 'y' that starts a two letter state, or 0
+	prefix := rune(0)
+
+	var err error
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if extension, found := strings.CutPrefix(line, "#CXRLE"); found {
+			if originX, y, header.generation, err = parseCXRLE(extension); err != nil {
+				return rleHeader{}, fmt.Errorf("invalid #CXRLE line %d: %v", lineNumber, err)
+			}
+			x = originX
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if _, err := header.metadata.parseHashLine(line); err != nil {
+				return rleHeader{}, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "x ") || strings.HasPrefix(line, "x=") {
+			items := strings.Split(line, ",")
+			for i, item := range items {
+				key, _, _ := strings.Cut(item, "=")
+				if strings.TrimSpace(key) == "rule" {
+					// the rule is last, and Larger than Life rules have commas
+					_, value, _ := strings.Cut(strings.Join(items[i:], ","), "=")
+					if header.rule = strings.TrimSpace(value); len(header.rule) > maxHeaderValueLength {
+						return rleHeader{}, fmt.Errorf("rule on line %d is longer than %d characters", lineNumber, maxHeaderValueLength)
+					}
+					break
+				}
+			}
+			continue
+		}
+
+		for _, c := range line {
+			switch {
+			case c >= '0' && c <= '9':
+				if count = count*10 + int64(c-'0'); count > maxRunLength {
+					return rleHeader{}, fmt.Errorf("run on line %d is longer than %d", lineNumber, int64(maxRunLength))
+				}
+				continue
+			case c == ' ' || c == '\t':
+				continue
+			case c >= 'p' && c <= 'y' && prefix == 0:
+				prefix = c
+				continue
+			}
+
+			run := max(count, 1)
+			count = 0
+			statePrefix := prefix
+			prefix = 0
+			switch c {
+			case 'b', '.':
+				x += run
+			case '$':
+				x = originX
+				y += run
+			case '!':
+				return header, nil
+			default:
+				if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+					return rleHeader{}, fmt.Errorf("unexpected character '%c' on line %d", c, lineNumber)
+				}
+				// any other state letter is alive, or one of the later states
+				state := 1
+				switch {
+				case c >= 'A' && c <= 'X' && statePrefix != 0:
+					state = 25 + 24*int(statePrefix-'p') + int(c-'A')
+				case c >= 'A' && c <= 'X':
+					state = 1 + int(c-'A')
+				}
+				if state > maxStates {
+					return rleHeader{}, fmt.Errorf("state %d on line %d is above %d", state, lineNumber, maxStates)
+				}
+				from, to := x, x+run
+				if region != nil {
+					if y < region.y || y-region.y >= region.h {
+						from = to
+					}
+					from, to = max(from, region.x), min(to, region.x+region.w)
+				}
+				for cellX := from; cellX < to; cellX++ {
+					if err := add(Cell{cellX, y}, uint8(state)); err != nil {
+						return rleHeader{}, err
+					}
+				}
+				x += run
+			}
+			if x > maxCoordinate || y > maxCoordinate {
+				return rleHeader{}, fmt.Errorf("pattern on line %d extends beyond coordinate %d", lineNumber, int64(maxCoordinate))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return rleHeader{}, err
+	}
+	return header, nil
+}
+
+// parseCXRLE parses the "Pos=x,y Gen=n" fields of a #CXRLE line; both are
+// optional.
+func parseCXRLE(fields string) (x, y int64, generation int, err error) {
+	for _, field := range strings.Fields(fields) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "Pos":
+			if x, y, err = parseCoordinates(value); err != nil {
+				return 0, 0, 0, err
+			}
+			if err := checkCoordinates(Cell{x, y}); err != nil {
+				return 0, 0, 0, err
+			}
+		case "Gen":
+			if generation, err = strconv.Atoi(value); err != nil {
+				return 0, 0, 0, fmt.Errorf("invalid generation '%s'", value)
+			}
+		}
+	}
+	return x, y, generation, nil
+}
+
+// writeRLE writes a complete RLE file as Golly saves it: the name, author and
+// comment lines, a #CXRLE line with the position of the pattern and its
+// generation, the header with its size and rule, then the rows.
+func writeRLE(w io.Writer, pattern Pattern) error {
+	// the decaying cells of Generations rules are written as further states
+	multistate := len(pattern.decay) > 0
+	if rule, err := parseRule(pattern.rule); err == nil && rule.isGenerations() {
+		multistate = true
+	}
+	all := pattern.cells
+	if len(pattern.decay) > 0 {
+		all = pattern.cells.clone()
+		for cell := range pattern.decay {
+			all.addCell(cell)
+		}
+	}
+	min, max, ok := all.boundingBox()
+	width, height := int64(0), int64(0)
+	if ok {
+		width, height = max.x-min.x+1, max.y-min.y+1
+	}
+	rule := pattern.rule
+	if rule == "" {
+		rule = conwayRule.String()
+	}
+	if _, err := io.WriteString(w, pattern.metadata.hashLines()); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "#CXRLE Pos=%d,%d", min.x, min.y); err != nil {
+		return err
+	}
+	if pattern.generation != 0 {
+		if _, err := fmt.Fprintf(w, " Gen=%d", pattern.generation); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "\nx = %d, y = %d, rule = %s\n", width, height, rule); err != nil {
+		return err
+	}
+	if multistate {
+		return writeMultistateRLEBody(w, pattern.cells, pattern.decay)
+	}
+	return writeRLEBody(w, pattern.cells)
+}
+
+// writeRLEBody encodes the bounding box of cells as RLE rows terminated by
+// '!', without a header line; this is the snippet Golly pastes.
+func writeRLEBody(w io.Writer, cells Cells) error {
+	encoder := rleEncoder{w: bufio.NewWriter(w)}
+	min, max, ok := cells.boundingBox()
+	if ok {
+		pendingRows := int64(0)
+		for y := min.y; y <= max.y; y++ {
+			deadRun, aliveRun := int64(0), int64(0)
+			rowStarted := false
+			for x := min.x; x <= max.x; x++ {
+				if cells.hasCell(Cell{x, y}) {
+					if !rowStarted && pendingRows > 0 {
+						encoder.run(pendingRows, '$')
+						pendingRows = 0
+					}
+					rowStarted = true
+					encoder.run(deadRun, 'b')
+					deadRun = 0
+					aliveRun++
+				} else {
+					encoder.run(aliveRun, 'o')
+					aliveRun = 0
+					deadRun++
+				}
+			}
+			// trailing dead cells of a row are implied by the '$' that ends it
+			encoder.run(aliveRun, 'o')
+			pendingRows++
+		}
+	}
+	encoder.item("!")
+	encoder.item("\n")
+	return encoder.w.Flush()
+}
+
+// rleEncoder writes RLE items while wrapping lines at rleLineLength.
+type rleEncoder struct {
+	w          *bufio.Writer
+	lineLength int
+}
+
+func (encoder *rleEncoder) run(count int64, tag byte) {
+	encoder.runOf(count, string(tag))
+}
+
+func (encoder *rleEncoder) runOf(count int64, symbol string) {
+	switch {
+	case count == 0:
+	case count == 1:
+		encoder.item(symbol)
+	default:
+		encoder.item(fmt.Sprintf("%d%s", count, symbol))
+	}
+}
+
+func (encoder *rleEncoder) item(item string) {
+	if item != "\n" && encoder.lineLength+len(item) > rleLineLength {
+		encoder.w.WriteString("\n")
+		encoder.lineLength = 0
+	}
+	encoder.w.WriteString(item)
+	encoder.lineLength += len(item)
+}
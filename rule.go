@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rule is an outer totalistic Life-like rule. Bit n of birth is set when a
+// dead cell with n alive neighbors becomes alive, and bit n of survival is set
+// when an alive cell with n alive neighbors stays alive.
+type Rule struct {
+	birth, survival uint16
+	// states is the number of states of a rule of the Generations family,
+	// such as 3 for Brian's Brain: alive, dead and the states an alive cell
+	// that does not survive decays through before it is dead, during which it
+	// can not be born again. It is 0 for the two states of a Life-like rule.
+	states uint8
+	// radius is the range of a Larger than Life rule, which counts the alive
+	// cells within radius of a cell, over a square or, for vonNeumann, a
+	// diamond, instead of over its neighborhood. Its births and survivals are
+	// the ranges of counts from birthMin to birthMax and from survivalMin to
+	// survivalMax, and middle counts the cell itself among its neighbors. It
+	// is 0 for rules given by the counts of birth and survival.
+	radius                   uint8
+	vonNeumann, middle       bool
+	birthMin, birthMax       uint8
+	survivalMin, survivalMax uint8
+	// isotropic rules, given in Hensel's notation, tell the arrangements of
+	// the alive neighbors apart rather than only counting them: a dead cell
+	// is born when the configuration of its neighbors is in
+	// birthConfigurations, and an alive one survives when it is in
+	// survivalConfigurations.
+	isotropic                                   bool
+	birthConfigurations, survivalConfigurations configurations
+	// table is the rule table of a rule loaded from a Golly .rule file,
+	// which gives the next state of a cell instead of births and survivals;
+	// states is then its number of states, or 0 for two.
+	table *ruleTable
+}
+
+// maxRuleRadius is the largest range of a Larger than Life rule, so that its
+// counts of up to (2*7+1)^2 cells fit in the byte the engines count in.
+const maxRuleRadius = 7
+
+var conwayRule = Rule{birth: 1 << 3, survival: 1<<2 | 1<<3}
+
+// namedRules are well known rules that may be given by name instead of
+// rulestring.
+var namedRules = map[string]string{
+	"life":       "B3/S23",
+	"highlife":   "B36/S23",
+	"daynight":   "B3678/S34678",
+	"seeds":      "B2/S",
+	"replicator": "B1357/S1357",
+	"maze":       "B3/S12345",
+	"brianbrain": "B2/S/C3",
+	"starwars":   "B2/S345/C4",
+	"bugs":       "R5,C0,M1,S34..58,B34..45,NM",
+	"majority":   "R4,C0,M1,S41..81,B41..81,NM",
+	"waffle":     "R7,C0,M1,S100..200,B75..170,NM",
+}
+
+// isGenerations reports whether the rule has states besides alive and dead:
+// the decaying states of the Generations family, or those of a rule table.
+func (rule Rule) isGenerations() bool {
+	return rule.states > 2
+}
+
+// isLargerThanLife reports whether the rule counts over a range of its own.
+func (rule Rule) isLargerThanLife() bool {
+	return rule.radius > 0
+}
+
+// births and survives are given the number of alive neighbors of a cell, or
+// for an isotropic rule their configuration, which engines work out by
+// summing the weights of the neighborhood instead of counting.
+func (rule Rule) births(aliveNeighbors uint8) bool {
+	if rule.isotropic {
+		return rule.birthConfigurations.has(aliveNeighbors)
+	}
+	if rule.isLargerThanLife() {
+		return aliveNeighbors >= rule.birthMin && aliveNeighbors <= rule.birthMax
+	}
+	return rule.birth&(1<<aliveNeighbors) != 0
+}
+
+func (rule Rule) survives(aliveNeighbors uint8) bool {
+	if rule.isotropic {
+		return rule.survivalConfigurations.has(aliveNeighbors)
+	}
+	if rule.isLargerThanLife() {
+		if rule.middle {
+			// the alive cell counts itself
+			aliveNeighbors++
+		}
+		return aliveNeighbors >= rule.survivalMin && aliveNeighbors <= rule.survivalMax
+	}
+	return rule.survival&(1<<aliveNeighbors) != 0
+}
+
+// birthsWith reports whether the rule births cells with some arrangement of
+// count alive neighbors.
+func (rule Rule) birthsWith(count int) bool {
+	if !rule.isotropic {
+		return rule.births(uint8(count))
+	}
+	for config := 0; config < len(henselClasses); config++ {
+		if henselClasses[config].count == count && rule.birthConfigurations.has(configuration(config)) {
+			return true
+		}
+	}
+	return false
+}
+
+// countedOver is the neighborhood the rule counts alive cells over: its range
+// for a Larger than Life rule, the Moore neighborhood that configurations are
+// of for an isotropic rule, that of its table for a rule table, or else
+// neighborhood.
+func (rule Rule) countedOver(neighborhood Neighborhood) Neighborhood {
+	switch {
+	case rule.table != nil:
+		return rule.table.neighborhood
+	case rule.isLargerThanLife():
+		return rangeNeighborhood(int64(rule.radius), rule.vonNeumann)
+	case rule.isotropic:
+		return mooreNeighborhood
+	}
+	return neighborhood
+}
+
+// weights is what an alive cell adds to the count of each cell it reaches
+// through the offsets of reflected, the reflection of the neighborhood
+// counted over: 1 to count it, or for an isotropic rule its bit in the
+// configuration of that cell's neighbors.
+func (rule Rule) weights(reflected Neighborhood) []uint8 {
+	weights := make([]uint8, len(reflected))
+	for i, offset := range reflected {
+		weights[i] = 1
+		if rule.isotropic {
+			weights[i] = configurationBit(Offset{-offset.dx, -offset.dy})
+		}
+	}
+	return weights
+}
+
+// String formats the rule in B/S notation, e.g. "B3/S23", or B/S/C notation
+// for the Generations family, e.g. "B2/S/C3", or the notation of Golly for
+// Larger than Life, e.g. "R5,C0,M1,S34..58,B34..45,NM", or Hensel's notation
+// for isotropic rules, e.g. "B2-a/S12". A rule table goes by its name.
+func (rule Rule) String() string {
+	if rule.table != nil {
+		return rule.table.name
+	}
+	var b strings.Builder
+	if rule.isotropic {
+		fmt.Fprintf(&b, "B%s/S%s", henselString(rule.birthConfigurations), henselString(rule.survivalConfigurations))
+		if rule.isGenerations() {
+			fmt.Fprintf(&b, "/C%d", rule.states)
+		}
+		return b.String()
+	}
+	if rule.isLargerThanLife() {
+		middle, shape := 0, "M"
+		if rule.middle {
+			middle = 1
+		}
+		if rule.vonNeumann {
+			shape = "N"
+		}
+		fmt.Fprintf(&b, "R%d,C%d,M%d,S%d..%d,B%d..%d,N%s", rule.radius, rule.states, middle, rule.survivalMin, rule.survivalMax, rule.birthMin, rule.birthMax, shape)
+		return b.String()
+	}
+	b.WriteString("B")
+	writeCounts(&b, rule.birth)
+	b.WriteString("/S")
+	writeCounts(&b, rule.survival)
+	if rule.isGenerations() {
+		fmt.Fprintf(&b, "/C%d", rule.states)
+	}
+	return b.String()
+}
+
+func writeCounts(b *strings.Builder, counts uint16) {
+	for n := 0; n <= 8; n++ {
+		if counts&(1<<n) != 0 {
+			b.WriteByte(byte('0' + n))
+		}
+	}
+}
+
+// parseRule parses a rulestring in B/S notation, such as "B3/S23", or in the
+// older S/B notation, such as "23/3", or the name of one of namedRules. A
+// third part gives the number of states of a Generations rule, as in
+// "B2/S/C3" or "/2/3". Larger than Life rules are given in the notation of
+// Golly, as in "R5,C0,M1,S34..58,B34..45,NM", and isotropic rules in Hensel's
+// notation, as in "B2-a/S12". Golly's .rule files are given by path, as in
+// "rules/WireWorld.rule", or by the name of a file in ruleDir, as in
+// "WireWorld". Rules with B0 are rejected wherever they come from: they would
+// turn the infinite dead background alive, which a sparse universe cannot
+// represent.
+func parseRule(s string) (Rule, error) {
+	rule, err := findRule(s)
+	if err == nil && rule.births(0) {
+		return Rule{}, fmt.Errorf("rule '%s': B0 rules are not supported", s)
+	}
+	return rule, err
+}
+
+func findRule(s string) (Rule, error) {
+	if strings.HasSuffix(strings.ToLower(strings.TrimSpace(s)), RULE_FILE_EXTENSION) {
+		table, err := loadRuleFile(strings.TrimSpace(s))
+		if err != nil {
+			return Rule{}, fmt.Errorf("rule '%s': %v", s, err)
+		}
+		return table.rule(), nil
+	}
+	rule, err := parseRulestring(s)
+	if err != nil {
+		table, findErr := findRuleTable(strings.TrimSpace(s))
+		if findErr != nil {
+			return Rule{}, fmt.Errorf("rule '%s': %v", s, findErr)
+		}
+		if table != nil {
+			return table.rule(), nil
+		}
+	}
+	return rule, err
+}
+
+func parseRulestring(s string) (Rule, error) {
+	if named, ok := namedRules[strings.ToLower(strings.TrimSpace(s))]; ok {
+		s = named
+	}
+	rule := Rule{}
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	if strings.HasPrefix(upper, "R") && strings.Contains(upper, ",") {
+		return parseLargerThanLife(s, upper)
+	}
+	if strings.Count(upper, "/") == 2 {
+		at := strings.LastIndex(upper, "/")
+		states, err := parseStates(upper[at+1:])
+		if err != nil {
+			return Rule{}, fmt.Errorf("rule '%s': %v", s, err)
+		}
+		if states > 2 {
+			rule.states = states
+		}
+		upper = upper[:at]
+	}
+	first, second, found := strings.Cut(upper, "/")
+	if !found {
+		return Rule{}, fmt.Errorf("rule '%s' is not of the form B3/S23", s)
+	}
+
+	var births, survivals string
+	switch {
+	case strings.HasPrefix(first, "B") && strings.HasPrefix(second, "S"):
+		births, survivals = first[1:], second[1:]
+	case strings.HasPrefix(first, "S") && strings.HasPrefix(second, "B"):
+		births, survivals = second[1:], first[1:]
+	default:
+		// S/B notation lists the survival counts first
+		births, survivals = second, first
+	}
+
+	var err error
+	if strings.ContainsAny(births+survivals, "-ABCDEFGHIJKLMNOPQRSTUVWXYZ") {
+		rule.isotropic = true
+		if rule.birthConfigurations, err = parseHensel(births); err != nil {
+			return Rule{}, fmt.Errorf("rule '%s': %v", s, err)
+		}
+		if rule.survivalConfigurations, err = parseHensel(survivals); err != nil {
+			return Rule{}, fmt.Errorf("rule '%s': %v", s, err)
+		}
+		return rule, nil
+	}
+	if rule.birth, err = parseCounts(births); err != nil {
+		return Rule{}, fmt.Errorf("rule '%s': %v", s, err)
+	}
+	if rule.survival, err = parseCounts(survivals); err != nil {
+		return Rule{}, fmt.Errorf("rule '%s': %v", s, err)
+	}
+	return rule, nil
+}
+
+// parseStates parses the number of states of a Generations rule, "C3" or "3".
+func parseStates(s string) (uint8, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "C"), "G")
+	states, err := strconv.Atoi(digits)
+	if err != nil || states < 2 || states > maxStates {
+		return 0, fmt.Errorf("the number of states '%s' is not between 2 and %d", s, maxStates)
+	}
+	return uint8(states), nil
+}
+
+// parseLargerThanLife parses the fields of a Larger than Life rule: R for the
+// range, C for the number of states (0 or 2 for two), M for whether the cell
+// counts itself, S and B for the ranges of counts and N for the shape of the
+// range, M for a square or N for a diamond. C, M and N may be left out.
+func parseLargerThanLife(s, upper string) (Rule, error) {
+	rule := Rule{}
+	seen := make(map[byte]bool)
+	for _, field := range strings.Split(upper, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return Rule{}, fmt.Errorf("rule '%s' has an empty field", s)
+		}
+		key, value := field[0], field[1:]
+		if seen[key] {
+			return Rule{}, fmt.Errorf("rule '%s' gives %c twice", s, key)
+		}
+		seen[key] = true
+		var err error
+		switch key {
+		case 'R':
+			var radius int
+			if radius, err = strconv.Atoi(value); err == nil && (radius < 1 || radius > maxRuleRadius) {
+				err = fmt.Errorf("range %d is not between 1 and %d", radius, maxRuleRadius)
+			}
+			rule.radius = uint8(radius)
+		case 'C':
+			if value != "0" {
+				var states uint8
+				if states, err = parseStates(value); states > 2 {
+					rule.states = states
+				}
+			}
+		case 'M':
+			if value != "0" && value != "1" {
+				err = fmt.Errorf("M%s is neither M0 nor M1", value)
+			}
+			rule.middle = value == "1"
+		case 'S':
+			rule.survivalMin, rule.survivalMax, err = parseCountRange(value)
+		case 'B':
+			rule.birthMin, rule.birthMax, err = parseCountRange(value)
+		case 'N':
+			if value != "M" && value != "N" {
+				err = fmt.Errorf("N%s is neither NM for a square nor NN for a diamond", value)
+			}
+			rule.vonNeumann = value == "N"
+		default:
+			err = fmt.Errorf("unexpected field '%s'", field)
+		}
+		if err != nil {
+			return Rule{}, fmt.Errorf("rule '%s': %v", s, err)
+		}
+	}
+	for _, key := range "RSB" {
+		if !seen[byte(key)] {
+			return Rule{}, fmt.Errorf("rule '%s' is missing its %c field", s, key)
+		}
+	}
+	return rule, nil
+}
+
+// parseCountRange parses a range of counts such as "34..58".
+func parseCountRange(s string) (uint8, uint8, error) {
+	low, high, found := strings.Cut(s, "..")
+	if !found {
+		return 0, 0, fmt.Errorf("counts '%s' are not of the form 34..58", s)
+	}
+	min, err := strconv.ParseUint(low, 10, 8)
+	if err != nil {
+		return 0, 0, fmt.Errorf("counts '%s': %v", s, err)
+	}
+	max, err := strconv.ParseUint(high, 10, 8)
+	if err != nil {
+		return 0, 0, fmt.Errorf("counts '%s': %v", s, err)
+	}
+	if min > max {
+		return 0, 0, fmt.Errorf("counts '%s' run from more to fewer", s)
+	}
+	return uint8(min), uint8(max), nil
+}
+
+func parseCounts(digits string) (uint16, error) {
+	counts := uint16(0)
+	for _, c := range digits {
+		if c < '0' || c > '8' {
+			return 0, fmt.Errorf("unexpected neighbor count '%c'", c)
+		}
+		counts |= 1 << (c - '0')
+	}
+	return counts, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRuleRejectsB0(t *testing.T) {
+	for _, rule := range []string{"B03/S23", "23/03", "B0/S/C3", "B02a/S23", "R1,C0,M0,S2..3,B0..3,NM"} {
+		if _, err := parseRule(rule); err == nil {
+			t.Errorf("parsed %s without an error", rule)
+		}
+	}
+	if _, err := parseRule("B3/S023"); err != nil {
+		t.Errorf("parsing B3/S023 failed: %v", err)
+	}
+}
+
+// TestContinueRejectsB0 checks that a B0 rule is rejected when it comes from
+// the file a run continues, and not only from -rule.
+func TestContinueRejectsB0(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "b0.rle")
+	if err := os.WriteFile(path, []byte("x = 3, y = 1, rule = B03/S23\n3o!\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := simulate(runOptions{inputs: []placedInput{{file: path}}, continueRun: true, iterations: 1})
+	if err == nil || !strings.Contains(err.Error(), "B0") {
+		t.Errorf("continuing under B03/S23 gave %v, not that B0 is not supported", err)
+	}
+}
+
+// TestRunRule checks that a run is under the rule of its input unless -rule
+// overrides it.
+func TestRunRule(t *testing.T) {
+	life := conwayRule
+	tests := []struct {
+		name       string
+		parse      func(io.Reader, *Rect) (Pattern, error)
+		data       string
+		override   *Rule
+		continuing bool
+		rule       string
+	}{
+		{"rle", parseRLE, "x = 3, y = 1, rule = B36/S23\n3o!\n", nil, false, "B36/S23"},
+		{"generations rle", parseRLE, "x = 3, y = 1, rule = B2/S/C3\nABA!\n", nil, false, "B2/S/C3"},
+		{"macrocell", parseMacrocell, "[M2]\n#R B36/S23\n***$\n", nil, false, "B36/S23"},
+		{"no rule", parseRLE, "x = 3, y = 1\n3o!\n", nil, false, "B3/S23"},
+		{"-rule", parseRLE, "x = 3, y = 1, rule = B36/S23\n3o!\n", &life, false, "B3/S23"},
+		{"unsupported rule", parseRLE, "x = 3, y = 1, rule = B3/S23:T10,10\n3o!\n", nil, false, "B3/S23"},
+		{"continued", parseRLE, "x = 3, y = 1, rule = B36/S23\n3o!\n", nil, true, "B36/S23"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pattern, err := test.parse(bytes.NewReader([]byte(test.data)), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rule, err := runRule(pattern, test.override, test.continuing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rule.String() != test.rule {
+				t.Errorf("ran under %s, not %s", rule, test.rule)
+			}
+		})
+	}
+}
+
+// TestLargerThanLifeCounts checks that Larger than Life rules count the
+// cells within their range, over a square or a diamond, and the cell itself
+// with M1.
+func TestLargerThanLifeCounts(t *testing.T) {
+	tests := []struct {
+		rule  string
+		cells []Cell
+		want  int
+	}{
+		// a cell 3 across and 3 down is within range 3 of a square only
+		{"R3,C0,M0,S1..1,B2..2,NM", []Cell{{0, 0}, {3, 3}}, 2 + 14},
+		{"R3,C0,M0,S1..1,B2..2,NN", []Cell{{0, 0}, {3, 3}}, 4},
+		{"R2,C0,M0,S0..0,B1..1,NM", []Cell{{0, 0}}, 1 + 24},
+		{"R2,C0,M0,S1..1,B1..1,NN", []Cell{{0, 0}}, 12},
+		{"R1,C0,M1,S1..1,B9..9,NM", []Cell{{0, 0}}, 1},
+		{"R1,C0,M0,S1..1,B8..8,NM", []Cell{{0, 0}}, 0},
+	}
+	for _, test := range tests {
+		rule, err := parseRule(test.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rule.String() != test.rule {
+			t.Errorf("%s formatted as %s", test.rule, rule)
+		}
+		cells := make(Cells)
+		for _, cell := range test.cells {
+			cells.addCell(cell)
+		}
+		next, _, _ := newNaiveEngine(rule, mooreNeighborhood, constraints{}).step(cells)
+		if len(next) != test.want {
+			t.Errorf("%s gave %d cells, not %d", test.rule, len(next), test.want)
+		}
+	}
+	for radius, want := range map[int64][2]int{1: {8, 4}, 5: {120, 60}, 7: {224, 112}} {
+		if square, diamond := len(rangeNeighborhood(radius, false)), len(rangeNeighborhood(radius, true)); square != want[0] || diamond != want[1] {
+			t.Errorf("range %d covers %d and %d cells, not %d and %d", radius, square, diamond, want[0], want[1])
+		}
+	}
+}
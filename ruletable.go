@@ -0,0 +1,825 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	RULE_FILE_EXTENSION = ".rule"
+)
+
+// ruleTable is a rule loaded from one of Golly's .rule files, which gives
+// the next state of a cell, out of as many as maxStates, for every state of
+// the cell and of its neighbors: as a @TABLE of transitions, or as a @TREE
+// deciding on one neighbor after another. State 0 is dead and state 1 alive
+// to the rest of the program; the states above it are kept aside, as the
+// decaying states of a Generations rule are.
+type ruleTable struct {
+	name   string
+	states int
+	// neighborhood lists the neighbors in the order transitions is given
+	// their states.
+	neighborhood Neighborhood
+	hexagonal    bool
+	transitions  transitionFunction
+}
+
+type transitionFunction interface {
+	// next is the next state of a cell in state center whose neighbors are in
+	// the states neighbors.
+	next(center uint8, neighbors []uint8) uint8
+}
+
+// rule is the Rule that runs under the table.
+func (table *ruleTable) rule() Rule {
+	rule := Rule{table: table}
+	if table.states > 2 {
+		rule.states = uint8(table.states)
+	}
+	return rule
+}
+
+// ruleDir is the directory rules given by name are looked up in, as
+// name.rule; see -rule-dir.
+var ruleDir = "."
+
+// loadedRules are the rule tables loaded so far, by path, so that the many
+// places a rulestring is parsed read each file once.
+var (
+	loadedRulesMu sync.Mutex
+	loadedRules   = map[string]*ruleTable{}
+)
+
+// loadRuleFile loads the rule table of a .rule file.
+func loadRuleFile(path string) (*ruleTable, error) {
+	loadedRulesMu.Lock()
+	defer loadedRulesMu.Unlock()
+	path = filepath.Clean(path)
+	if table, ok := loadedRules[path]; ok {
+		return table, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	table, err := parseRuleFile(file, strings.TrimSuffix(filepath.Base(path), RULE_FILE_EXTENSION))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s failed: %v", path, err)
+	}
+	loadedRules[path] = table
+	return table, nil
+}
+
+// findRuleTable finds the rule table of a rule given by name, as patterns
+// record rule tables: one already loaded from a file of another name, or
+// else name.rule in ruleDir. It returns nil if there is neither.
+func findRuleTable(name string) (*ruleTable, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, nil
+	}
+	loadedRulesMu.Lock()
+	for _, table := range loadedRules {
+		if table.name == name {
+			loadedRulesMu.Unlock()
+			return table, nil
+		}
+	}
+	loadedRulesMu.Unlock()
+
+	table, err := loadRuleFile(filepath.Join(ruleDir, name+RULE_FILE_EXTENSION))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return table, err
+}
+
+// ruleFileLine is a line of a .rule file, without its comment.
+type ruleFileLine struct {
+	number int
+	text   string
+}
+
+// parseRuleFile reads a .rule file: the name of its @RULE line, or else
+// name, and the first @TABLE or @TREE section. The other sections, such as
+// @COLORS and @ICONS, are for Golly's display and are skipped.
+func parseRuleFile(r io.Reader, name string) (*ruleTable, error) {
+	scanner := bufio.NewScanner(r)
+	section, kind := "", ""
+	var lines []ruleFileLine
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "@") {
+			keyword, rest, _ := strings.Cut(line, " ")
+			section = strings.ToUpper(keyword)
+			if section == "@RULE" && strings.TrimSpace(rest) != "" {
+				name = strings.TrimSpace(rest)
+			}
+			if kind == "" && (section == "@TABLE" || section == "@TREE") {
+				kind = section
+			}
+			continue
+		}
+		if section != kind || kind == "" {
+			continue
+		}
+		if at := strings.IndexByte(line, '#'); at >= 0 {
+			line = strings.TrimSpace(line[:at])
+		}
+		if line != "" {
+			lines = append(lines, ruleFileLine{lineNumber, line})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(name) > maxHeaderValueLength {
+		return nil, fmt.Errorf("rule name of %d bytes is longer than %d", len(name), maxHeaderValueLength)
+	}
+
+	table := &ruleTable{name: name}
+	var err error
+	switch kind {
+	case "@TABLE":
+		err = table.parseTable(lines)
+	case "@TREE":
+		err = table.parseTree(lines)
+	default:
+		return nil, errors.New("no @TABLE or @TREE section")
+	}
+	if err != nil {
+		return nil, err
+	}
+	// a sparse universe cannot hold empty space that turns into something
+	if next := table.transitions.next(0, make([]uint8, len(table.neighborhood))); next != 0 {
+		return nil, fmt.Errorf("rule turns empty space into state %d, which is not supported", next)
+	}
+	return table, nil
+}
+
+// parseSetting parses a "key:value" or "key=value" line of a section.
+func parseSetting(line ruleFileLine) (string, string, bool) {
+	at := strings.IndexAny(line.text, ":=")
+	if at < 0 {
+		return "", "", false
+	}
+	return strings.ToLower(strings.TrimSpace(line.text[:at])), strings.TrimSpace(line.text[at+1:]), true
+}
+
+func (table *ruleTable) parseStates(value string) error {
+	states, err := strconv.Atoi(value)
+	if err != nil || states < 2 || states > maxStates {
+		return fmt.Errorf("the number of states '%s' is not between 2 and %d", value, maxStates)
+	}
+	table.states = states
+	return nil
+}
+
+// tableNeighborhoods are the neighborhoods a @TABLE may be over, their
+// neighbors in the order its transitions list their states after the cell's:
+// clockwise from the north.
+var tableNeighborhoods = map[string]Neighborhood{
+	"moore":          {{0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}},
+	"vonneumann":     {{0, -1}, {1, 0}, {0, 1}, {-1, 0}},
+	"hexagonal":      {{0, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 0}, {-1, -1}},
+	"onedimensional": {{-1, 0}, {1, 0}},
+}
+
+// tableSymmetries are the symmetries a @TABLE over each neighborhood may
+// declare, as the permutations of its neighbors that generate them: turns
+// clockwise and reflections left to right. "permute", every arrangement of
+// the neighbors, is allowed over any of them and is handled apart.
+var tableSymmetries = map[string]map[string][]permutation{
+	"moore": {
+		"none":               nil,
+		"rotate4":            {rotation(8, 2)},
+		"rotate8":            {rotation(8, 1)},
+		"reflect_horizontal": {reflection(8)},
+		"rotate4reflect":     {rotation(8, 2), reflection(8)},
+		"rotate8reflect":     {rotation(8, 1), reflection(8)},
+	},
+	"vonneumann": {
+		"none":               nil,
+		"rotate4":            {rotation(4, 1)},
+		"reflect_horizontal": {reflection(4)},
+		"rotate4reflect":     {rotation(4, 1), reflection(4)},
+	},
+	"hexagonal": {
+		"none":           nil,
+		"rotate2":        {rotation(6, 3)},
+		"rotate3":        {rotation(6, 2)},
+		"rotate6":        {rotation(6, 1)},
+		"rotate6reflect": {rotation(6, 1), reflection(6)},
+	},
+	"onedimensional": {
+		"none":    nil,
+		"reflect": {rotation(2, 1)},
+	},
+}
+
+// A permutation moves the neighbor at index p[i] to index i.
+type permutation []int
+
+func rotation(n, steps int) permutation {
+	p := make(permutation, n)
+	for i := range p {
+		p[i] = (i + n - steps) % n
+	}
+	return p
+}
+
+// reflection mirrors neighbors listed clockwise from the north, which stays.
+func reflection(n int) permutation {
+	p := make(permutation, n)
+	for i := range p {
+		p[i] = (n - i) % n
+	}
+	return p
+}
+
+// generatedGroup returns every permutation of n neighbors the generators
+// lead to, starting with the identity.
+func generatedGroup(n int, generators []permutation) []permutation {
+	group := []permutation{rotation(n, 0)}
+	seen := map[string]bool{fmt.Sprint(group[0]): true}
+	for i := 0; i < len(group); i++ {
+		for _, generator := range generators {
+			next := make(permutation, n)
+			for j := range next {
+				next[j] = group[i][generator[j]]
+			}
+			if key := fmt.Sprint(next); !seen[key] {
+				seen[key] = true
+				group = append(group, next)
+			}
+		}
+	}
+	return group
+}
+
+// stateSet is a set of states.
+type stateSet [4]uint64
+
+func (set *stateSet) add(state uint8) {
+	set[state/64] |= 1 << (state % 64)
+}
+
+func (set stateSet) has(state uint8) bool {
+	return set[state/64]&(1<<(state%64)) != 0
+}
+
+func (set stateSet) states() []uint8 {
+	var states []uint8
+	for state := 0; state <= maxStates; state++ {
+		if set.has(uint8(state)) {
+			states = append(states, uint8(state))
+		}
+	}
+	return states
+}
+
+// parseTable parses a @TABLE section: its n_states, neighborhood and
+// symmetries, variables such as "var a={0,1,2}", and transitions listing
+// the states of the cell, of its neighbors and the state it turns into, as in
+// "0,1,a,0,0,0,0,0,0,1" or, for fewer than 11 states, "01a0000001". A
+// variable that appears more than once in a transition is bound, standing
+// for the same state each time. Transitions are tried in order, and a cell
+// that none matches keeps its state.
+func (table *ruleTable) parseTable(lines []ruleFileLine) error {
+	neighborhoodName, symmetry := "moore", "none"
+	variables := map[string]stateSet{}
+	var transitions []tableTransition
+	for _, line := range lines {
+		key, value, isSetting := parseSetting(line)
+		var err error
+		switch {
+		case strings.HasPrefix(line.text, "var "):
+			err = table.parseVariable(strings.TrimPrefix(line.text, "var "), variables)
+		case isSetting && (key == "n_states" || key == "num_states"):
+			err = table.parseStates(value)
+		case isSetting && key == "neighborhood":
+			neighborhoodName = strings.ToLower(value)
+			if _, ok := tableNeighborhoods[neighborhoodName]; !ok {
+				err = fmt.Errorf("unknown neighborhood '%s'", value)
+			}
+		case isSetting && key == "symmetries":
+			symmetry = strings.ToLower(value)
+		case isSetting:
+			err = fmt.Errorf("unexpected setting '%s'", key)
+		default:
+			if table.states == 0 {
+				err = errors.New("transition before n_states")
+				break
+			}
+			var parsed []tableTransition
+			if parsed, err = table.parseTransition(line.text, len(tableNeighborhoods[neighborhoodName]), variables); err == nil {
+				transitions = append(transitions, parsed...)
+			}
+		}
+		if err == nil && len(transitions) > maxRuleTransitions {
+			err = fmt.Errorf("more than %d transitions once spelled out", maxRuleTransitions)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line.number, err)
+		}
+	}
+	if table.states == 0 {
+		return errors.New("missing n_states")
+	}
+	generators, ok := tableSymmetries[neighborhoodName][symmetry]
+	if !ok && symmetry != "permute" {
+		return fmt.Errorf("unknown symmetries '%s' for the %s neighborhood", symmetry, neighborhoodName)
+	}
+
+	table.neighborhood = tableNeighborhoods[neighborhoodName]
+	table.hexagonal = neighborhoodName == "hexagonal"
+	n := len(table.neighborhood)
+	group := generatedGroup(n, generators)
+	var expanded []tableTransition
+	for _, transition := range transitions {
+		var arrangements [][]stateSet
+		if symmetry == "permute" {
+			arrangements = permutedArrangements(transition.inputs[1:])
+		} else {
+			arrangements = symmetricArrangements(transition.inputs[1:], group)
+		}
+		for _, arrangement := range arrangements {
+			expanded = append(expanded, tableTransition{append([]stateSet{transition.inputs[0]}, arrangement...), transition.output})
+		}
+		if len(expanded) > maxRuleTransitions {
+			return fmt.Errorf("more than %d transitions once spelled out", maxRuleTransitions)
+		}
+	}
+	table.transitions = newTransitionTable(table.states, n, expanded)
+	return nil
+}
+
+// parseVariable parses "a={0,1,2}", whose states may name variables defined
+// before it.
+func (table *ruleTable) parseVariable(s string, variables map[string]stateSet) error {
+	name, value, found := strings.Cut(s, "=")
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if !found || name == "" {
+		return fmt.Errorf("variable '%s' is not of the form var a={0,1}", s)
+	}
+	if !strings.HasPrefix(value, "{") {
+		return fmt.Errorf("variable %s is not a set of states in braces", name)
+	}
+	set, err := table.parseState(value, variables)
+	if err != nil {
+		return fmt.Errorf("variable %s: %v", name, err)
+	}
+	variables[name] = set
+	return nil
+}
+
+// parseState parses a state, the name of a variable or a set of those in
+// braces into the states it allows.
+func (table *ruleTable) parseState(s string, variables map[string]stateSet) (stateSet, error) {
+	var set stateSet
+	if strings.HasPrefix(s, "{") {
+		if !strings.HasSuffix(s, "}") {
+			return set, fmt.Errorf("unclosed set '%s'", s)
+		}
+		for _, item := range splitTopLevel(s[1 : len(s)-1]) {
+			states, err := table.parseState(item, variables)
+			if err != nil {
+				return set, err
+			}
+			for i := range set {
+				set[i] |= states[i]
+			}
+		}
+		return set, nil
+	}
+	if states, ok := variables[s]; ok {
+		return states, nil
+	}
+	state, err := strconv.Atoi(s)
+	if err != nil {
+		return set, fmt.Errorf("unknown variable '%s'", s)
+	}
+	if state < 0 || state >= table.states {
+		return set, fmt.Errorf("state %d is not below the %d states", state, table.states)
+	}
+	set.add(uint8(state))
+	return set, nil
+}
+
+// splitTopLevel splits s at the commas outside braces.
+func splitTopLevel(s string) []string {
+	var items []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(items, strings.TrimSpace(s[start:]))
+}
+
+// tableTransition turns a cell whose state and neighbors' states are in the
+// sets of inputs, the cell's first, into output.
+type tableTransition struct {
+	inputs []stateSet
+	output uint8
+}
+
+// parseTransition parses a transition over n neighbors into one transition
+// for every combination of states of its bound variables.
+func (table *ruleTable) parseTransition(s string, n int, variables map[string]stateSet) ([]tableTransition, error) {
+	var items []string
+	if strings.ContainsAny(s, ",{") {
+		items = splitTopLevel(s)
+	} else {
+		items = strings.Split(s, "")
+	}
+	if len(items) != n+2 {
+		return nil, fmt.Errorf("transition has %d states, expected the cell's, %d neighbors' and the next", len(items), n)
+	}
+
+	uses := map[string]int{}
+	for _, item := range items {
+		if _, ok := variables[item]; ok {
+			uses[item]++
+		}
+	}
+	output := items[n+1]
+	if _, ok := variables[output]; ok && uses[output] < 2 {
+		return nil, fmt.Errorf("next state %s is a variable the inputs do not bind", output)
+	}
+	var bound []string
+	for name, count := range uses {
+		if count > 1 {
+			bound = append(bound, name)
+		}
+	}
+	sort.Strings(bound)
+
+	var transitions []tableTransition
+	binding := map[string]stateSet{}
+	var bind func(i int) error
+	bind = func(i int) error {
+		if i < len(bound) {
+			for _, state := range variables[bound[i]].states() {
+				var set stateSet
+				set.add(state)
+				binding[bound[i]] = set
+				if err := bind(i + 1); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if len(transitions) > maxRuleTransitions {
+			return fmt.Errorf("more than %d transitions once spelled out", maxRuleTransitions)
+		}
+		transition := tableTransition{inputs: make([]stateSet, n+1)}
+		for j, item := range items[:n+1] {
+			set, ok := binding[item]
+			if !ok {
+				var err error
+				if set, err = table.parseState(item, variables); err != nil {
+					return err
+				}
+			}
+			transition.inputs[j] = set
+		}
+		next, ok := binding[output]
+		if !ok {
+			var err error
+			if next, err = table.parseState(output, variables); err != nil {
+				return err
+			}
+		}
+		states := next.states()
+		if len(states) != 1 {
+			return fmt.Errorf("next state '%s' is not a single state", output)
+		}
+		transition.output = states[0]
+		transitions = append(transitions, transition)
+		return nil
+	}
+	if err := bind(0); err != nil {
+		return nil, err
+	}
+	return transitions, nil
+}
+
+// symmetricArrangements returns the distinct arrangements of neighbors under
+// the permutations of group.
+func symmetricArrangements(neighbors []stateSet, group []permutation) [][]stateSet {
+	var arrangements [][]stateSet
+	seen := map[string]bool{}
+	for _, p := range group {
+		arrangement := make([]stateSet, len(neighbors))
+		for i := range arrangement {
+			arrangement[i] = neighbors[p[i]]
+		}
+		if key := fmt.Sprint(arrangement); !seen[key] {
+			seen[key] = true
+			arrangements = append(arrangements, arrangement)
+		}
+	}
+	return arrangements
+}
+
+// permutedArrangements returns every distinct arrangement of neighbors, going
+// through the permutations of their sets in lexicographic order so that sets
+// repeated among the neighbors do not repeat arrangements.
+func permutedArrangements(neighbors []stateSet) [][]stateSet {
+	var distinct []stateSet
+	ids := make([]int, len(neighbors))
+	for i, set := range neighbors {
+		ids[i] = len(distinct)
+		for j, other := range distinct {
+			if other == set {
+				ids[i] = j
+			}
+		}
+		if ids[i] == len(distinct) {
+			distinct = append(distinct, set)
+		}
+	}
+	sort.Ints(ids)
+
+	var arrangements [][]stateSet
+	for {
+		arrangement := make([]stateSet, len(ids))
+		for i, id := range ids {
+			arrangement[i] = distinct[id]
+		}
+		arrangements = append(arrangements, arrangement)
+		if !nextPermutation(ids) || len(arrangements) > maxRuleTransitions {
+			return arrangements
+		}
+	}
+}
+
+// nextPermutation rearranges ids into the next permutation in lexicographic
+// order, reporting false once they are in the last.
+func nextPermutation(ids []int) bool {
+	i := len(ids) - 2
+	for i >= 0 && ids[i] >= ids[i+1] {
+		i--
+	}
+	if i < 0 {
+		return false
+	}
+	j := len(ids) - 1
+	for ids[j] <= ids[i] {
+		j--
+	}
+	ids[i], ids[j] = ids[j], ids[i]
+	for a, b := i+1, len(ids)-1; a < b; a, b = a+1, b-1 {
+		ids[a], ids[b] = ids[b], ids[a]
+	}
+	return true
+}
+
+// transitionTable finds the first transition a cell matches as Golly does:
+// for each input and each of its states, a bitmask of the transitions that
+// allow it, which are and-ed together 64 transitions at a time.
+type transitionTable struct {
+	words   int
+	masks   [][]uint64
+	outputs []uint8
+}
+
+func newTransitionTable(states, n int, transitions []tableTransition) *transitionTable {
+	table := &transitionTable{words: (len(transitions) + 63) / 64, masks: make([][]uint64, n+1), outputs: make([]uint8, len(transitions))}
+	for input := range table.masks {
+		table.masks[input] = make([]uint64, states*table.words)
+	}
+	for t, transition := range transitions {
+		table.outputs[t] = transition.output
+		for input, set := range transition.inputs {
+			for _, state := range set.states() {
+				table.masks[input][int(state)*table.words+t/64] |= 1 << (t % 64)
+			}
+		}
+	}
+	return table
+}
+
+func (table *transitionTable) next(center uint8, neighbors []uint8) uint8 {
+	for w := 0; w < table.words; w++ {
+		match := table.masks[0][int(center)*table.words+w]
+		for i := 0; match != 0 && i < len(neighbors); i++ {
+			match &= table.masks[i+1][int(neighbors[i])*table.words+w]
+		}
+		if match != 0 {
+			return table.outputs[w*64+bits.TrailingZeros64(match)]
+		}
+	}
+	return center
+}
+
+// treeNeighborhoods are the neighborhoods a @TREE may be over, by its
+// num_neighbors, their neighbors in the order the tree decides on them before
+// the cell itself.
+var treeNeighborhoods = map[int]Neighborhood{
+	4: {{0, -1}, {-1, 0}, {1, 0}, {0, 1}},
+	8: {{-1, -1}, {1, -1}, {-1, 1}, {1, 1}, {0, -1}, {-1, 0}, {1, 0}, {0, 1}},
+}
+
+// ruleTree is a decision tree with a node for each neighbor, and the cell
+// itself last, choosing the next node by the state of that neighbor; nodes
+// at level 1 choose the next state.
+type ruleTree struct {
+	states int
+	// nodes holds states entries per node, the last node being the root.
+	nodes []int
+	root  int
+}
+
+// parseTree parses a @TREE section: num_states, num_neighbors, num_nodes and
+// a line per node of its level and the node, or at level 1 the state, for
+// each state of its neighbor. Nodes refer to the nodes before them.
+func (table *ruleTable) parseTree(lines []ruleFileLine) error {
+	tree := &ruleTree{}
+	levels := []int{}
+	neighbors, count := 0, -1
+	for _, line := range lines {
+		key, value, isSetting := parseSetting(line)
+		var err error
+		switch {
+		case isSetting && (key == "num_states" || key == "n_states"):
+			err = table.parseStates(value)
+			tree.states = table.states
+		case isSetting && key == "num_neighbors":
+			if neighbors, err = strconv.Atoi(value); err == nil && treeNeighborhoods[neighbors] == nil {
+				err = fmt.Errorf("num_neighbors %d is neither 4 nor 8", neighbors)
+			}
+		case isSetting && key == "num_nodes":
+			if count, err = strconv.Atoi(value); err == nil && (count < 1 || count > maxRuleTransitions) {
+				err = fmt.Errorf("num_nodes %d is not between 1 and %d", count, maxRuleTransitions)
+			}
+		case isSetting:
+			err = fmt.Errorf("unexpected setting '%s'", key)
+		case tree.states == 0 || neighbors == 0 || count < 0:
+			err = errors.New("node before num_states, num_neighbors and num_nodes")
+		default:
+			err = tree.parseNode(line.text, &levels, neighbors)
+		}
+		if err == nil && count >= 0 && len(levels) > count {
+			err = fmt.Errorf("more than the %d nodes of num_nodes", count)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line.number, err)
+		}
+	}
+	if count < 0 {
+		return errors.New("missing num_nodes")
+	}
+	if len(levels) != count {
+		return fmt.Errorf("expected the %d nodes of num_nodes, got %d", count, len(levels))
+	}
+	if levels[count-1] != neighbors+1 {
+		return fmt.Errorf("the last node, the root, is at level %d rather than %d", levels[count-1], neighbors+1)
+	}
+	tree.root = count - 1
+	table.neighborhood = treeNeighborhoods[neighbors]
+	table.transitions = tree
+	return nil
+}
+
+func (tree *ruleTree) parseNode(s string, levels *[]int, neighbors int) error {
+	fields := strings.Fields(s)
+	if len(fields) != tree.states+1 {
+		return fmt.Errorf("node has %d fields, expected its level and %d more", len(fields), tree.states)
+	}
+	level, err := strconv.Atoi(fields[0])
+	if err != nil || level < 1 || level > neighbors+1 {
+		return fmt.Errorf("level '%s' is not between 1 and %d", fields[0], neighbors+1)
+	}
+	for _, field := range fields[1:] {
+		value, err := strconv.Atoi(field)
+		switch {
+		case err != nil:
+			return fmt.Errorf("invalid entry '%s'", field)
+		case level == 1 && (value < 0 || value >= tree.states):
+			return fmt.Errorf("state %d is not below the %d states", value, tree.states)
+		case level > 1 && (value < 0 || value >= len(*levels) || (*levels)[value] != level-1):
+			return fmt.Errorf("entry %d is not a node at level %d before this one", value, level-1)
+		}
+		tree.nodes = append(tree.nodes, value)
+	}
+	*levels = append(*levels, level)
+	return nil
+}
+
+func (tree *ruleTree) next(center uint8, neighbors []uint8) uint8 {
+	node := tree.root
+	for _, state := range neighbors {
+		node = tree.nodes[node*tree.states+int(state)]
+	}
+	return uint8(tree.nodes[node*tree.states+int(center)])
+}
+
+// tableEngine advances a universe under a rule table. The cells in state 1
+// are the universe as for any other engine; those in the states above are
+// kept aside in states.
+type tableEngine struct {
+	table       *ruleTable
+	reflected   Neighborhood
+	constraints constraints
+	states      Decay
+}
+
+func newTableEngine(table *ruleTable, constraints constraints, states Decay) *tableEngine {
+	engine := &tableEngine{table: table, reflected: table.neighborhood.reflected(), constraints: constraints, states: make(Decay, len(states))}
+	for cell, state := range states {
+		if state > 1 && int(state) < table.states && !constraints.keepsDead(cell) {
+			engine.states[cell] = state
+		}
+	}
+	return engine
+}
+
+func (engine *tableEngine) state(cells Cells, cell Cell) uint8 {
+	if cells.hasCell(cell) {
+		return 1
+	}
+	return engine.states[cell]
+}
+
+// step works out the next state of every cell that is not in state 0 and of
+// their neighbors; the other cells stay in state 0, as loading the table
+// checked. A cell keeps its state where the constraints keep it from being
+// born or from dying, which for a rule table is any state but 0.
+func (engine *tableEngine) step(cells Cells) (Cells, Cells, Cells) {
+	candidates := make(Cells, len(cells)+len(engine.states))
+	visit := func(cell Cell) {
+		candidates.addCell(cell)
+		for _, offset := range engine.reflected {
+			if neighbor, ok := cell.offset(offset); ok {
+				candidates.addCell(neighbor)
+			}
+		}
+	}
+	for cell := range cells {
+		visit(cell)
+	}
+	for cell := range engine.states {
+		visit(cell)
+	}
+
+	neighbors := make([]uint8, len(engine.table.neighborhood))
+	states := make(Decay, len(engine.states))
+	birthedCells, dyingCells := make(Cells), make(Cells)
+	for cell := range candidates {
+		state := engine.state(cells, cell)
+		for i, offset := range engine.table.neighborhood {
+			neighbors[i] = 0
+			if neighbor, ok := cell.offset(offset); ok {
+				neighbors[i] = engine.state(cells, neighbor)
+			}
+		}
+		next := engine.table.transitions.next(state, neighbors)
+		allowed := (next == 0 || engine.constraints.allowsBirth(cell)) && (state == 0 || engine.constraints.allowsDeath(cell))
+		if !allowed {
+			next = state
+		}
+		switch {
+		case next > 1:
+			states[cell] = next
+		case next == 1 && state != 1:
+			birthedCells.addCell(cell)
+		}
+		if state == 1 && next != 1 {
+			dyingCells.addCell(cell)
+		}
+	}
+
+	for cell := range dyingCells {
+		cells.removeCell(cell)
+	}
+	for cell := range birthedCells {
+		cells.addCell(cell)
+	}
+	engine.states = states
+	return cells, birthedCells, dyingCells
+}
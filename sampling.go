@@ -0,0 +1,57 @@
+package main
+
+import "math/rand/v2"
+
+// The random primitives below are what soups, mutations and noise are built
+// from. Each draws from rng in a fixed order, never in map order, so that a
+// seed always gives the same result.
+
+// sample returns n distinct alive cells chosen uniformly at random, or all of
+// them when there are no more than n.
+func (cells Cells) sample(n int, rng *rand.Rand) Cells {
+	sorted := cells.sorted()
+	if n >= len(sorted) {
+		return cells.clone()
+	}
+	// a partial Fisher-Yates shuffle leaves the chosen cells at the front
+	chosen := make(Cells, n)
+	for i := 0; i < n; i++ {
+		j := i + rng.IntN(len(sorted)-i)
+		sorted[i], sorted[j] = sorted[j], sorted[i]
+		chosen.addCell(sorted[i])
+	}
+	return chosen
+}
+
+// randomInBounds returns a soup of bounds, each cell of which is alive with
+// probability density.
+func randomInBounds(bounds Rect, density float64, rng *rand.Rand) Cells {
+	cells := make(Cells)
+	for y := bounds.y; y < bounds.y+bounds.h; y++ {
+		for x := bounds.x; x < bounds.x+bounds.w; x++ {
+			if rng.Float64() < density {
+				cells.addCell(Cell{x, y})
+			}
+		}
+	}
+	return cells
+}
+
+// randomCellsInBounds returns n distinct cells of bounds chosen uniformly at
+// random, or every cell of bounds when it has fewer.
+func randomCellsInBounds(bounds Rect, n int, rng *rand.Rand) []Cell {
+	if area := bounds.w * bounds.h; int64(n) > area {
+		n = int(area)
+	}
+	chosen := make([]Cell, 0, n)
+	seen := make(Cells, n)
+	for len(chosen) < n {
+		cell := Cell{bounds.x + rng.Int64N(bounds.w), bounds.y + rng.Int64N(bounds.h)}
+		if seen.hasCell(cell) {
+			continue
+		}
+		seen.addCell(cell)
+		chosen = append(chosen, cell)
+	}
+	return chosen
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// saveSink saves every Nth generation of a run as a Life 1.06 file named
+// after the generation, such as gen-00001000.lif, so that a long run that
+// crashes can be picked up again with -continue.
+type saveSink struct {
+	dir     string
+	every   int
+	rule    string
+	started bool
+}
+
+func newSaveSink(dir string, every int, rule Rule) (*saveSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &saveSink{dir: dir, every: every, rule: rule.String()}, nil
+}
+
+func (sink *saveSink) needsEveryGeneration() bool {
+	return true
+}
+
+func (sink *saveSink) observe(event Event) error {
+	// the generation the run starts from is already saved, as its input
+	if !sink.started {
+		sink.started = true
+		return nil
+	}
+	if event.generation%sink.every != 0 {
+		return nil
+	}
+
+	name := filepath.Join(sink.dir, fmt.Sprintf("gen-%08d.lif", event.generation))
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := printPattern(file, Pattern{cells: event.cells, generation: event.generation, rule: sink.rule}); err != nil {
+		return fmt.Errorf("saving %s failed: %v", name, err)
+	}
+	return file.Close()
+}
+
+func (sink *saveSink) close() error {
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// An input whose bounding box is wider or taller than sparseInputSpan with
+// fewer than one cell in sparseInputArea of it is almost always a corrupt or
+// misconverted file, say with a few stray cells far away from the rest.
+const (
+	sparseInputSpan = 1 << 20
+	sparseInputArea = 1 << 16
+	// outlierDistance is how far from the median cell a cell has to be, along
+	// either axis, to count as an outlier in the warning.
+	outlierDistance = 1 << 10
+)
+
+// inputScale describes how the cells of an input are spread out.
+type inputScale struct {
+	cells         int
+	topLeft       Cell
+	bottomRight   Cell
+	width, height float64
+	// density is the fraction of the bounding box that is alive.
+	density float64
+}
+
+func measureInput(cells Cells) (inputScale, bool) {
+	topLeft, bottomRight, ok := cells.boundingBox()
+	if !ok {
+		return inputScale{}, false
+	}
+	// in floats, as the widths of the widest boxes overflow an int64
+	width := float64(bottomRight.x) - float64(topLeft.x) + 1
+	height := float64(bottomRight.y) - float64(topLeft.y) + 1
+	return inputScale{len(cells), topLeft, bottomRight, width, height, float64(len(cells)) / (width * height)}, true
+}
+
+func (scale inputScale) sparse() bool {
+	return (scale.width > sparseInputSpan || scale.height > sparseInputSpan) && scale.density < 1.0/sparseInputArea
+}
+
+// medianCell is the cell at the median x and the median y of the cells, which
+// stray cells far away do not move much, unlike the centre of the bounding box.
+func medianCell(cells Cells) Cell {
+	xs := make([]int64, 0, len(cells))
+	ys := make([]int64, 0, len(cells))
+	for cell := range cells {
+		xs, ys = append(xs, cell.x), append(ys, cell.y)
+	}
+	sort.Slice(xs, func(i, j int) bool { return xs[i] < xs[j] })
+	sort.Slice(ys, func(i, j int) bool { return ys[i] < ys[j] })
+	return Cell{xs[len(xs)/2], ys[len(ys)/2]}
+}
+
+// outliers counts the cells further than outlierDistance from center.
+func outliers(cells Cells, center Cell) int {
+	count := 0
+	for cell := range cells {
+		if absDistance(cell.x, center.x) > outlierDistance || absDistance(cell.y, center.y) > outlierDistance {
+			count++
+		}
+	}
+	return count
+}
+
+func absDistance(a, b int64) float64 {
+	d := float64(a) - float64(b)
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// checkInputScale warns about an input that is spread out over an
+// astronomically large and sparse bounding box, which makes for unusable
+// renders and slow runs, and moves it so that its median cell is at the
+// origin when recenter is set.
+func checkInputScale(input placedInput, cells Cells, recenter bool) (Cells, error) {
+	scale, ok := measureInput(cells)
+	if !ok || !scale.sparse() && !recenter {
+		return cells, nil
+	}
+	median := medianCell(cells)
+	if scale.sparse() {
+		advice := "pass -recenter-input to move its median cell to the origin, or check how the file was converted"
+		if recenter {
+			advice = "recentering it on its median cell"
+		}
+		logger(logParser).Warn("Input is spread out over an astronomically large and sparse bounding box",
+			"input", input.String(),
+			"cells", scale.cells,
+			"bounds", fmt.Sprintf("%d,%d to %d,%d", scale.topLeft.x, scale.topLeft.y, scale.bottomRight.x, scale.bottomRight.y),
+			"size", fmt.Sprintf("%.3gx%.3g", scale.width, scale.height),
+			"density", fmt.Sprintf("%.3g", scale.density),
+			"median", fmt.Sprintf("%d,%d", median.x, median.y),
+			"outliers", outliers(cells, median),
+			"advice", advice)
+	}
+	if !recenter {
+		return cells, nil
+	}
+	recentered, err := cells.translated(Offset{-median.x, -median.y})
+	if err != nil {
+		return nil, fmt.Errorf("recentering failed: %v", err)
+	}
+	return recentered, nil
+}
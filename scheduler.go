@@ -0,0 +1,114 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// tasksPerWorker is how many bands the parallel engine cuts the universe into
+// per worker. A band with far more activity than the rest, such as a hot
+// corner in an otherwise quiet field of ash, then only holds up the worker
+// that has it, while the others steal the remaining bands.
+const tasksPerWorker = 8
+
+// schedulerStats describes how the work of the last generation was spread
+// over the workers.
+type schedulerStats struct {
+	// tasks is the number of bands the generation was cut into.
+	tasks int
+	// steals is the number of bands a worker took from another's queue.
+	steals int
+	// busy is how long each worker spent stepping bands.
+	busy []time.Duration
+}
+
+// imbalance is the time the busiest worker spent over the mean for all of
+// them: 1 when the work was spread evenly, up to the number of workers when
+// one did all of it.
+func (stats schedulerStats) imbalance() float64 {
+	var total, busiest time.Duration
+	for _, busy := range stats.busy {
+		total += busy
+		busiest = max(busiest, busy)
+	}
+	if total == 0 {
+		return 1
+	}
+	return float64(busiest) * float64(len(stats.busy)) / float64(total)
+}
+
+// taskQueue is a worker's queue of tasks. The worker takes tasks from the
+// front, and other workers steal from the back, so that a thief takes the
+// work furthest from what the owner is doing.
+type taskQueue struct {
+	mu    sync.Mutex
+	tasks []int
+}
+
+func (queue *taskQueue) pop() (int, bool) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if len(queue.tasks) == 0 {
+		return 0, false
+	}
+	task := queue.tasks[0]
+	queue.tasks = queue.tasks[1:]
+	return task, true
+}
+
+func (queue *taskQueue) steal() (int, bool) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if len(queue.tasks) == 0 {
+		return 0, false
+	}
+	task := queue.tasks[len(queue.tasks)-1]
+	queue.tasks = queue.tasks[:len(queue.tasks)-1]
+	return task, true
+}
+
+// runStealing runs tasks 0 to n-1 on the given number of workers. Each worker
+// starts with a queue of neighbouring tasks and, once it runs out, steals
+// from the other queues in turn until every queue is empty. No task is added
+// once the workers start, so a worker that finds every queue empty is done.
+func runStealing(n, workers int, run func(task int)) schedulerStats {
+	workers = max(min(workers, n), 1)
+	queues := make([]*taskQueue, workers)
+	for w := range queues {
+		queue := &taskQueue{}
+		for task := w * n / workers; task < (w+1)*n/workers; task++ {
+			queue.tasks = append(queue.tasks, task)
+		}
+		queues[w] = queue
+	}
+
+	stats := schedulerStats{tasks: n, busy: make([]time.Duration, workers)}
+	steals := make([]int, workers)
+	var wg sync.WaitGroup
+	for w := range queues {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			started := time.Now()
+			for {
+				task, ok := queues[w].pop()
+				for i := 1; !ok && i < workers; i++ {
+					if task, ok = queues[(w+i)%workers].steal(); ok {
+						steals[w]++
+					}
+				}
+				if !ok {
+					break
+				}
+				run(task)
+			}
+			stats.busy[w] = time.Since(started)
+		}(w)
+	}
+	wg.Wait()
+
+	for _, count := range steals {
+		stats.steals += count
+	}
+	return stats
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The identifiers of the JSON Schemas, which the JSON outputs name in their
+// "schema" field. The number is the version of the schema, and goes up with
+// any change a reader valid against the previous one could trip on: a field
+// removed, renamed, made required or given another type. Fields can be added
+// within a version, so readers should ignore those they do not know.
+const (
+	SCHEMA_STATE       = "urn:gameoflife:schema:state:1"
+	SCHEMA_ANALYSIS    = "urn:gameoflife:schema:analysis:1"
+	SCHEMA_PROVENANCE  = "urn:gameoflife:schema:provenance:1"
+	SCHEMA_ANNOTATIONS = "urn:gameoflife:schema:annotations:1"
+)
+
+// schemas are the JSON Schemas of the JSON the tool reads and writes, by the
+// name `schema print` takes: the state of a pattern as -output-format json
+// writes it and -input reads it, the result summary of -analysis-json, the
+// run record of -provenance, and -annotations files.
+var schemas = map[string]string{
+	"state": `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "` + SCHEMA_STATE + `",
+  "title": "Pattern",
+  "description": "A generation of a pattern, as -output-format json writes it and -input reads it. Population and bounds are ignored when reading.",
+  "type": "object",
+  "required": ["generation", "population", "cells"],
+  "properties": {
+    "schema": {"const": "` + SCHEMA_STATE + `"},
+    "generation": {"type": "integer"},
+    "rule": {"type": "string", "maxLength": 256},
+    "name": {"type": "string"},
+    "author": {"type": "string"},
+    "comments": {"type": "array", "items": {"type": "string"}},
+    "population": {"type": "integer", "minimum": 0},
+    "bounds": {"$ref": "#/$defs/bounds"},
+    "cells": {
+      "description": "The alive cells as [x, y], sorted by row.",
+      "type": "array",
+      "items": {"$ref": "#/$defs/cell"}
+    },
+    "decay": {
+      "description": "The decaying cells of a Generations rule as [x, y, state].",
+      "type": "array",
+      "items": {
+        "type": "array",
+        "prefixItems": [{"type": "integer"}, {"type": "integer"}, {"type": "integer", "minimum": 2, "maximum": 255}],
+        "items": false,
+        "minItems": 3
+      }
+    }
+  },
+  "$defs": {
+    "cell": {
+      "type": "array",
+      "prefixItems": [{"type": "integer"}, {"type": "integer"}],
+      "items": false,
+      "minItems": 2
+    },
+    "bounds": {
+      "type": "object",
+      "required": ["x", "y", "w", "h"],
+      "properties": {
+        "x": {"type": "integer"},
+        "y": {"type": "integer"},
+        "w": {"type": "integer", "minimum": 1},
+        "h": {"type": "integer", "minimum": 1}
+      }
+    }
+  }
+}
+`,
+	"analysis": `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "` + SCHEMA_ANALYSIS + `",
+  "title": "Analysis",
+  "description": "The analysis of a run as -analysis-json writes it and -overlay reads it.",
+  "type": "object",
+  "required": ["generation", "population", "centroid", "drift", "components"],
+  "properties": {
+    "schema": {"const": "` + SCHEMA_ANALYSIS + `"},
+    "generation": {"type": "integer"},
+    "population": {"type": "integer", "minimum": 0},
+    "centroid": {"$ref": "#/$defs/point"},
+    "drift": {
+      "description": "How far the centroid moves each generation.",
+      "$ref": "#/$defs/point"
+    },
+    "motion": {"$ref": "#/$defs/motion"},
+    "components": {
+      "description": "The objects of the last generation, each classified by simulating it on its own.",
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["bounds", "population", "kind"],
+        "properties": {
+          "bounds": {"$ref": "#/$defs/bounds"},
+          "population": {"type": "integer", "minimum": 1},
+          "kind": {"enum": ["` + KIND_STILL_LIFE + `", "` + KIND_OSCILLATOR + `", "` + KIND_SPACESHIP + `", "` + KIND_UNCLASSIFIED + `"]},
+          "motion": {"$ref": "#/$defs/motion"}
+        }
+      }
+    },
+    "followed": {
+      "description": "How far the report was moved back with -follow.",
+      "type": "array",
+      "prefixItems": [{"type": "integer"}, {"type": "integer"}],
+      "items": false,
+      "minItems": 2
+    }
+  },
+  "$defs": {
+    "point": {
+      "type": "array",
+      "prefixItems": [{"type": "number"}, {"type": "number"}],
+      "items": false,
+      "minItems": 2
+    },
+    "motion": {
+      "type": "object",
+      "required": ["period", "dx", "dy"],
+      "properties": {
+        "period": {"type": "integer", "minimum": 1},
+        "dx": {"type": "integer"},
+        "dy": {"type": "integer"}
+      }
+    },
+    "bounds": {
+      "type": "object",
+      "required": ["x", "y", "w", "h"],
+      "properties": {
+        "x": {"type": "integer"},
+        "y": {"type": "integer"},
+        "w": {"type": "integer", "minimum": 1},
+        "h": {"type": "integer", "minimum": 1}
+      }
+    }
+  }
+}
+`,
+	"provenance": `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "` + SCHEMA_PROVENANCE + `",
+  "title": "Provenance",
+  "description": "How the results of a run came about, as -provenance writes it.",
+  "type": "object",
+  "required": ["tool", "args", "flags", "inputs", "outputs", "started", "duration_seconds", "host", "result"],
+  "properties": {
+    "schema": {"const": "` + SCHEMA_PROVENANCE + `"},
+    "tool": {
+      "type": "object",
+      "required": ["version", "go"],
+      "properties": {
+        "version": {"type": "string"},
+        "revision": {"type": "string"},
+        "modified": {"type": "boolean"},
+        "go": {"type": "string"}
+      }
+    },
+    "args": {"type": "array", "items": {"type": "string"}},
+    "flags": {
+      "description": "The flags given, by name.",
+      "type": "object",
+      "additionalProperties": {"type": "string"}
+    },
+    "inputs": {"type": "array", "items": {"$ref": "#/$defs/file"}},
+    "outputs": {"type": "array", "items": {"$ref": "#/$defs/file"}},
+    "started": {"type": "string", "format": "date-time"},
+    "duration_seconds": {"type": "number", "minimum": 0},
+    "host": {
+      "type": "object",
+      "required": ["hostname", "os", "arch", "cpus"],
+      "properties": {
+        "hostname": {"type": "string"},
+        "os": {"type": "string"},
+        "arch": {"type": "string"},
+        "cpus": {"type": "integer", "minimum": 1}
+      }
+    },
+    "result": {
+      "type": "object",
+      "required": ["generation", "population", "hash"],
+      "properties": {
+        "generation": {"type": "integer"},
+        "population": {"type": "integer", "minimum": 0},
+        "hash": {"type": "string", "pattern": "^[0-9a-f]{16}$"}
+      }
+    }
+  },
+  "$defs": {
+    "file": {
+      "description": "A file read or written by the run, without a hash when it cannot be read back, such as stdin.",
+      "type": "object",
+      "required": ["name"],
+      "properties": {
+        "name": {"type": "string"},
+        "offset": {"type": "string", "pattern": "^-?[0-9]+,-?[0-9]+$"},
+        "sha256": {"type": "string", "pattern": "^[0-9a-f]{64}$"}
+      }
+    }
+  }
+}
+`,
+	"annotations": `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "` + SCHEMA_ANNOTATIONS + `",
+  "title": "Annotations",
+  "description": "Rectangles, arrows and labels drawn over -render and -gif, as -annotations reads them.",
+  "type": "array",
+  "items": {
+    "type": "object",
+    "oneOf": [
+      {"required": ["rect"], "not": {"anyOf": [{"required": ["arrow"]}, {"required": ["at"]}]}},
+      {"required": ["arrow"], "not": {"anyOf": [{"required": ["rect"]}, {"required": ["at"]}]}},
+      {"required": ["at"], "not": {"anyOf": [{"required": ["rect"]}, {"required": ["arrow"]}]}}
+    ],
+    "properties": {
+      "rect": {
+        "type": "object",
+        "required": ["x", "y", "w", "h"],
+        "properties": {
+          "x": {"type": "integer"},
+          "y": {"type": "integer"},
+          "w": {"type": "integer", "minimum": 1},
+          "h": {"type": "integer", "minimum": 1}
+        }
+      },
+      "arrow": {
+        "description": "From the first cell to the second.",
+        "type": "array",
+        "prefixItems": [{"$ref": "#/$defs/cell"}, {"$ref": "#/$defs/cell"}],
+        "items": false,
+        "minItems": 2
+      },
+      "at": {"$ref": "#/$defs/cell"},
+      "label": {"type": "string"},
+      "from": {"type": "integer"},
+      "to": {"type": "integer"}
+    }
+  },
+  "$defs": {
+    "cell": {
+      "type": "array",
+      "prefixItems": [{"type": "integer"}, {"type": "integer"}],
+      "items": false,
+      "minItems": 2
+    }
+  }
+}
+`,
+}
+
+func schemaNames() []string {
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func runSchema(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing schema command, expected one of: list, print")
+	}
+	switch args[0] {
+	case "list":
+		for _, name := range schemaNames() {
+			fmt.Println(name)
+		}
+		return nil
+	case "print":
+		if len(args) != 2 {
+			return fmt.Errorf("expected one schema name, one of: %s", strings.Join(schemaNames(), ", "))
+		}
+		schema, found := schemas[args[1]]
+		if !found {
+			return fmt.Errorf("unknown schema '%s', expected one of: %s", args[1], strings.Join(schemaNames(), ", "))
+		}
+		_, err := os.Stdout.WriteString(schema)
+		return err
+	default:
+		return fmt.Errorf("unknown schema command '%s', expected one of: list, print", args[0])
+	}
+}
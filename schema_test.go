@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+// TestSchemasDescribeOutputs checks that each schema is JSON, and that the
+// JSON the tool writes has the fields the schema requires and no others.
+func TestSchemasDescribeOutputs(t *testing.T) {
+	var state bytes.Buffer
+	glider := Pattern{cells: Cells{{1, 0}: {}, {2, 1}: {}, {0, 2}: {}, {1, 2}: {}, {2, 2}: {}}, rule: "B3/S23", decay: Decay{{5, 5}: 2}}
+	if err := writeJSON(&state, glider); err != nil {
+		t.Fatal(err)
+	}
+	a := newAnalysis(io.Discard, 0)
+	a.observe(Event{cells: glider.cells})
+	analysis, err := json.Marshal(a.report(glider.cells, conwayRule))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := map[string][]byte{"state": state.Bytes(), "analysis": analysis}
+
+	for name, text := range schemas {
+		var schema struct {
+			ID         string                     `json:"$id"`
+			Required   []string                   `json:"required"`
+			Properties map[string]json.RawMessage `json:"properties"`
+		}
+		if err := json.Unmarshal([]byte(text), &schema); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		output, found := outputs[name]
+		if !found {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(output, &fields); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(fields["schema"]); got != `"`+schema.ID+`"` {
+			t.Errorf("%s: written with schema %s, not %s", name, got, schema.ID)
+		}
+		for field := range fields {
+			if _, found := schema.Properties[field]; !found {
+				t.Errorf("%s: %s is written but not in the schema", name, field)
+			}
+		}
+		for _, field := range schema.Required {
+			if _, found := fields[field]; !found {
+				t.Errorf("%s: %s is required but not written", name, field)
+			}
+		}
+	}
+}
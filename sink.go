@@ -0,0 +1,62 @@
+package main
+
+import "io"
+
+// Event is what a run reports to its sinks: the starting generation with
+// every initial cell born, then one event after every generation.
+type Event struct {
+	generation int
+	// cells is the universe after the generation; sinks must not modify it.
+	cells      Cells
+	born, died Cells
+	// decay is the decaying cells of a Generations rule, which are neither
+	// alive nor dead: the phases between the two that the rule shows.
+	decay Decay
+}
+
+// EventSink receives the events of a run. Optional outputs plug into the run
+// as sinks so that the simulation loop needs no knowledge of them.
+type EventSink interface {
+	observe(event Event) error
+	// close is called once the run is over.
+	close() error
+}
+
+// everyGenerationSink is implemented by sinks whose output would be wrong if
+// generations were skipped, which rules out -fast-forward.
+type everyGenerationSink interface {
+	needsEveryGeneration() bool
+}
+
+func needsEveryGeneration(sinks []EventSink) bool {
+	for _, sink := range sinks {
+		if s, ok := sink.(everyGenerationSink); ok && s.needsEveryGeneration() {
+			return true
+		}
+	}
+	return false
+}
+
+// flushingSink is implemented by sinks that write their output as the run
+// goes, to write out what they buffered, as at a checkpoint.
+type flushingSink interface {
+	flush() error
+}
+
+// closingSink closes the file a sink writes to once the sink is closed, so
+// that a compressed file is complete by the end of the run.
+type closingSink struct {
+	EventSink
+	file io.Closer
+}
+
+func (sink closingSink) close() error {
+	if err := sink.EventSink.close(); err != nil {
+		return err
+	}
+	return sink.file.Close()
+}
+
+func (sink closingSink) needsEveryGeneration() bool {
+	return needsEveryGeneration([]EventSink{sink.EventSink})
+}
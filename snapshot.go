@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSnapshotPixels bounds the size of a snapshot, since a sparse universe
+// can span far more cells than an image could hold.
+const maxSnapshotPixels = 1 << 28
+
+// snapshotSink renders one generation of a run to a PNG file, or an SVG file
+// when its name ends in .svg, through view fitted to the alive cells. With
+// generation negative it renders the last generation of the run. When
+// overlay is not nil, what it found is drawn over the cells, and so are the
+// annotations shown at the generation rendered. The decaying cells of a
+// Generations rule are drawn in decayColor.
+type snapshotSink struct {
+	path        string
+	view        viewTransform
+	generation  int
+	overlay     *analysisReport
+	annotations []annotation
+	// last is the latest universe observed, for rendering the run's last one.
+	last      Cells
+	lastDecay Decay
+	lastAt    int
+	rendered  bool
+}
+
+func newSnapshotSink(path string, view viewTransform, generation int, overlay *analysisReport, annotations []annotation) *snapshotSink {
+	return &snapshotSink{path: path, view: view, generation: generation, overlay: overlay, annotations: annotations}
+}
+
+// needsEveryGeneration is true when rendering a given generation, which
+// skipping ahead could jump over.
+func (sink *snapshotSink) needsEveryGeneration() bool {
+	return sink.generation >= 0
+}
+
+func (sink *snapshotSink) observe(event Event) error {
+	if sink.generation < 0 {
+		sink.last, sink.lastDecay, sink.lastAt = event.cells, event.decay, event.generation
+		return nil
+	}
+	if event.generation != sink.generation {
+		return nil
+	}
+	sink.rendered = true
+	return sink.render(event.cells, event.decay, event.generation)
+}
+
+func (sink *snapshotSink) close() error {
+	if sink.generation < 0 {
+		return sink.render(sink.last, sink.lastDecay, sink.lastAt)
+	}
+	if !sink.rendered {
+		return fmt.Errorf("generation %d to render was never reached", sink.generation)
+	}
+	return nil
+}
+
+func (sink *snapshotSink) render(cells Cells, decay Decay, generation int) error {
+	file, err := os.Create(sink.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	view := sink.view.fitted(union(cells, decay.cells()))
+	if strings.ToLower(filepath.Ext(sink.path)) == ".svg" {
+		if err := writeSVG(file, cells, decay, view, sink.overlay, sink.annotations, generation); err != nil {
+			return err
+		}
+		return file.Close()
+	}
+
+	img, err := renderGrid(cells, decay, view, sink.overlay, sink.annotations, generation)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		return err
+	}
+	logger(logRenderer).Debug("Rendered a snapshot", "file", sink.path, "size", img.Bounds().Size().String())
+	return file.Close()
+}
+
+// renderGrid draws the alive and decaying cells in the viewport of view, with
+// the overlay over them when it is not nil and the annotations shown at
+// generation, or the density of the alive cells when the viewport is too
+// large for that.
+func renderGrid(cells Cells, decay Decay, view viewTransform, overlay *analysisReport, annotations []annotation, generation int) (*image.Paletted, error) {
+	width, height, err := view.size()
+	if err != nil {
+		// too large to draw a cell per pixel
+		block, _, _ := densityView(view)
+		logDensity(view, block)
+		return renderDensity(cells, view), nil
+	}
+	palette := color.Palette{deadColor, aliveColor}
+	if overlay != nil || len(annotations) > 0 {
+		palette = overlayPalette()
+	}
+	if len(decay) > 0 {
+		palette = append(palette, decayColor)
+	}
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	if len(decay) > 0 {
+		view.paint(img, decay.cells(), uint8(len(palette)-1))
+	}
+	view.paint(img, cells, 1)
+	if overlay != nil {
+		paintOverlay(img, view, overlay)
+	}
+	paintAnnotations(img, view, annotations, generation)
+	return img, nil
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// STAGING_MANIFEST is the name of a manifest, followed by the pid of the
+	// run moving its outputs.
+	STAGING_MANIFEST = "manifest.json"
+	// STAGED_RESULT is the result of the run as printed, which is printed to
+	// stdout once the outputs are committed.
+	STAGED_RESULT = "result"
+)
+
+const (
+	// stagingClaimTimeout is how long a run has to move the outputs of a
+	// manifest into place before another run takes it for a crashed one and
+	// finishes the move itself.
+	stagingClaimTimeout = time.Hour
+	// stagingExpiry is how long the outputs of a run that crashed before
+	// writing its manifest are kept.
+	stagingExpiry = 7 * 24 * time.Hour
+)
+
+// outputStaging has a run write its output files into a directory of its own
+// under the staging directory, and moves them to where they were asked for
+// only once the run has succeeded, so that a run that fails or crashes part
+// way, say while encoding its GIF, leaves the outputs of the run before
+// rather than a half written, misleading set. The result printed to stdout
+// is held back the same way. Before moving the outputs it writes a manifest
+// of them, named for the run moving them: a run that crashes while moving
+// them leaves the manifest behind, and a later run claims it and finishes
+// the move, see resumeStaged. A run that saves a
+// -checkpoint also puts the outputs it writes as it goes in place at each
+// checkpoint, see checkpointedOutputs.
+type outputStaging struct {
+	dir     string
+	outputs []stagedOutput
+}
+
+// stagedOutput is an output file, or directory, by its absolute path, so that
+// a run started elsewhere can finish moving it, and its name in the run's
+// staging directory.
+type stagedOutput struct {
+	Target string `json:"target"`
+	Staged string `json:"staged"`
+}
+
+// defaultStagingDir is where outputs are staged unless -staging-dir says
+// otherwise: staging beside the results cache, in the user's cache
+// directory.
+func defaultStagingDir() (string, error) {
+	dir, err := defaultCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "staging"), nil
+}
+
+// stagingDir resolves -staging-dir and -no-staging, returning "" for writing
+// outputs in place.
+func stagingDir(dir string, disabled bool) string {
+	if disabled {
+		return ""
+	}
+	if dir == "" {
+		var err error
+		if dir, err = defaultStagingDir(); err != nil {
+			logger(logTools).Warn("Not staging outputs: no cache directory to stage them in", "error", err)
+			return ""
+		}
+	}
+	return dir
+}
+
+// stageOutputs sets up the staging of targets, leaving out empty names, under
+// root. It returns nil, for writing outputs in place, when root is empty or
+// there is nothing to stage.
+func stageOutputs(root string, targets []string) (*outputStaging, error) {
+	if root == "" {
+		return nil, nil
+	}
+	var outputs []stagedOutput
+	seen := make(map[string]bool)
+	for _, target := range targets {
+		if target == "" {
+			continue
+		}
+		absolute, err := filepath.Abs(target)
+		if err != nil {
+			return nil, err
+		}
+		if seen[absolute] {
+			continue
+		}
+		seen[absolute] = true
+		outputs = append(outputs, stagedOutput{absolute, fmt.Sprintf("%d-%s", len(outputs), filepath.Base(target))})
+	}
+	if len(outputs) == 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(root, "run-")
+	if err != nil {
+		return nil, err
+	}
+	return &outputStaging{dir, outputs}, nil
+}
+
+// path is where to write target: its staged name, or target itself when it is
+// not staged.
+func (staging *outputStaging) path(target string) string {
+	if staging == nil || target == "" {
+		return target
+	}
+	absolute, err := filepath.Abs(target)
+	if err != nil {
+		return target
+	}
+	for _, output := range staging.outputs {
+		if output.Target == absolute {
+			return filepath.Join(staging.dir, output.Staged)
+		}
+	}
+	return target
+}
+
+// resultWriter is where to print the result of the run: a file in the
+// staging directory, which commit prints, or stdout when nothing is staged.
+func (staging *outputStaging) resultWriter() (io.WriteCloser, error) {
+	if staging == nil {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(filepath.Join(staging.dir, STAGED_RESULT))
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// publish puts a copy of the targets as far as they are written in place,
+// leaving them staged for commit.
+func (staging *outputStaging) publish(targets []string) error {
+	for _, target := range targets {
+		staged := staging.path(target)
+		if staged == target {
+			continue
+		}
+		if err := copyFile(staged, target); err != nil {
+			return fmt.Errorf("putting %s in place failed: %v", target, err)
+		}
+	}
+	return nil
+}
+
+// discard removes the outputs of a run that failed.
+func (staging *outputStaging) discard() {
+	if staging == nil {
+		return
+	}
+	if err := os.RemoveAll(staging.dir); err != nil {
+		logger(logTools).Warn("Removing staged outputs failed", "dir", staging.dir, "error", err)
+	}
+	os.Remove(filepath.Dir(staging.dir))
+}
+
+// commit moves the outputs of a run that succeeded into place, those the run
+// wrote at least, after recording them in the manifest.
+func (staging *outputStaging) commit() error {
+	if staging == nil {
+		return nil
+	}
+	var written []stagedOutput
+	for _, output := range staging.outputs {
+		if _, err := os.Stat(filepath.Join(staging.dir, output.Staged)); err == nil {
+			written = append(written, output)
+		}
+	}
+	manifest, err := json.MarshalIndent(written, "", "  ")
+	if err != nil {
+		return err
+	}
+	staged := filepath.Join(staging.dir, STAGING_MANIFEST+".tmp")
+	if err := os.WriteFile(staged, manifest, 0o644); err != nil {
+		return fmt.Errorf("writing staging manifest failed: %v", err)
+	}
+	if err := os.Rename(staged, claimedManifest(staging.dir)); err != nil {
+		return fmt.Errorf("writing staging manifest failed: %v", err)
+	}
+	if err := printStagedResult(filepath.Join(staging.dir, STAGED_RESULT)); err != nil {
+		return fmt.Errorf("printing cells failed: %v", err)
+	}
+	return finishStaged(staging.dir, written)
+}
+
+// claimedManifest is the name of the manifest of dir while this run moves its
+// outputs.
+func claimedManifest(dir string) string {
+	return filepath.Join(dir, fmt.Sprintf("%s.%d", STAGING_MANIFEST, os.Getpid()))
+}
+
+func printStagedResult(path string) error {
+	result, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+	_, err = io.Copy(os.Stdout, result)
+	return err
+}
+
+// finishStaged moves the outputs of dir into place, skipping those moved
+// already, and removes dir once they all are, and the staging directory
+// holding it when no other run has outputs there.
+func finishStaged(dir string, outputs []stagedOutput) error {
+	for _, output := range outputs {
+		if err := moveStaged(filepath.Join(dir, output.Staged), output.Target); err != nil {
+			return fmt.Errorf("moving %s into place failed: %v", output.Target, err)
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	os.Remove(filepath.Dir(dir))
+	return nil
+}
+
+// moveStaged moves a staged file over target, or the files of a staged
+// directory into target, copying when they cannot be renamed, as across
+// filesystems. It does nothing for a file already moved.
+func moveStaged(staged, target string) error {
+	info, err := os.Stat(staged)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return moveFile(staged, target)
+	}
+	return filepath.WalkDir(staged, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relative, err := filepath.Rel(staged, path)
+		if err != nil {
+			return err
+		}
+		destination := filepath.Join(target, relative)
+		if err := os.MkdirAll(filepath.Dir(destination), 0o755); err != nil {
+			return err
+		}
+		return moveFile(path, destination)
+	})
+}
+
+func moveFile(staged, target string) error {
+	if os.Rename(staged, target) == nil {
+		return nil
+	}
+	if err := copyFile(staged, target); err != nil {
+		return err
+	}
+	return os.Remove(staged)
+}
+
+// copyFile copies staged beside target, from where a rename replaces target
+// in one go.
+func copyFile(staged, target string) error {
+	in, err := os.Open(staged)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	copied := target + ".tmp"
+	out, err := os.Create(copied)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(copied, target)
+	}
+	if err != nil {
+		os.Remove(copied)
+	}
+	return err
+}
+
+// checkpointedOutputs puts the outputs a run writes as it goes, such as
+// -stats, in place each time the run saves its -checkpoint, as far as they
+// are written then, so that a run killed after a checkpoint keeps them up
+// to it. Outputs only written once the run is over, such as -gif, wait for
+// commit.
+type checkpointedOutputs struct {
+	staging *outputStaging
+	every   int
+	sinks   []flushingSink
+	targets []string
+}
+
+func (sink *checkpointedOutputs) needsEveryGeneration() bool {
+	return true
+}
+
+func (sink *checkpointedOutputs) observe(event Event) error {
+	if sink.every <= 0 || event.generation%sink.every != 0 {
+		return nil
+	}
+	for _, flushing := range sink.sinks {
+		if err := flushing.flush(); err != nil {
+			return err
+		}
+	}
+	return sink.staging.publish(sink.targets)
+}
+
+func (sink *checkpointedOutputs) close() error {
+	return nil
+}
+
+// resumeStaged finishes moving the outputs of runs that crashed while moving
+// them, as their manifests under root record, and removes the outputs of
+// runs that crashed before then once they have expired. A manifest is
+// claimed by renaming it for this run before its outputs are moved, so that
+// two runs never move the same ones, and only once the run that named it
+// has had stagingClaimTimeout to finish. Failing to finish another run's
+// outputs does not fail this run: they are left for a later run to retry.
+func resumeStaged(root string) {
+	if root == "" {
+		return
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger(logTools).Warn("Reading staged outputs failed", "dir", root, "error", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		if err := resumeStagedDir(dir); err != nil {
+			logger(logTools).Warn("Finishing the outputs of an interrupted run failed, leaving them for a later run", "dir", dir, "error", err)
+		}
+	}
+}
+
+func resumeStagedDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	manifest := ""
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasPrefix(name, STAGING_MANIFEST+".") && !strings.HasSuffix(name, ".tmp") {
+			manifest = filepath.Join(dir, name)
+		}
+	}
+
+	if manifest == "" {
+		age, err := stagedAge(dir, entries)
+		if err != nil {
+			return err
+		}
+		if age < stagingExpiry {
+			logger(logTools).Debug("Leaving outputs staged by a run that has not finished", "dir", dir)
+			return nil
+		}
+		logger(logTools).Info("Removing the expired outputs of a run that never finished", "dir", dir, "age", age.Round(time.Hour).String())
+		return os.RemoveAll(dir)
+	}
+
+	info, err := os.Stat(manifest)
+	if errors.Is(err, fs.ErrNotExist) {
+		// another run claimed it first
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if time.Since(info.ModTime()) < stagingClaimTimeout {
+		logger(logTools).Debug("Leaving outputs another run is moving into place", "dir", dir)
+		return nil
+	}
+	claimed := claimedManifest(dir)
+	if err := os.Rename(manifest, claimed); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	now := time.Now()
+	if err := os.Chtimes(claimed, now, now); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(claimed)
+	if err != nil {
+		return err
+	}
+	var outputs []stagedOutput
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return fmt.Errorf("reading staging manifest failed: %v", err)
+	}
+	logger(logTools).Info("Finishing moving the outputs of an interrupted run into place", "dir", dir, "outputs", len(outputs))
+	return finishStaged(dir, outputs)
+}
+
+// stagedAge is how long ago anything in the staging directory dir, of
+// entries, was last written.
+func stagedAge(dir string, entries []fs.DirEntry) (time.Duration, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return 0, err
+	}
+	latest := info.ModTime()
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return time.Since(latest), err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// statsSink writes a CSV row of statistics for every generation of a run,
+// for plotting population dynamics. The bounding box columns are empty once
+// the universe has died out.
+type statsSink struct {
+	w       *csv.Writer
+	started bool
+	// scheduler, when the run has a parallel engine, is how it scheduled the
+	// generation just stepped, for the scheduler columns.
+	scheduler *schedulerStats
+}
+
+func newStatsSink(w io.Writer) (*statsSink, error) {
+	sink := &statsSink{w: csv.NewWriter(w)}
+	header := []string{"generation", "population", "births", "deaths", "min_x", "min_y", "max_x", "max_y", "tasks", "steals", "imbalance"}
+	if err := sink.w.Write(header); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (sink *statsSink) needsEveryGeneration() bool {
+	return true
+}
+
+func (sink *statsSink) observe(event Event) error {
+	births, deaths := len(event.born), len(event.died)
+	initial := !sink.started
+	if initial {
+		// the first event brings the initial cells, which were not born
+		births, sink.started = 0, true
+	}
+	row := []string{strconv.Itoa(event.generation), strconv.Itoa(len(event.cells)), strconv.Itoa(births), strconv.Itoa(deaths), "", "", "", "", "", "", ""}
+	if topLeft, bottomRight, ok := event.cells.boundingBox(); ok {
+		row[4] = strconv.FormatInt(topLeft.x, 10)
+		row[5] = strconv.FormatInt(topLeft.y, 10)
+		row[6] = strconv.FormatInt(bottomRight.x, 10)
+		row[7] = strconv.FormatInt(bottomRight.y, 10)
+	}
+	if sink.scheduler != nil && !initial {
+		row[8] = strconv.Itoa(sink.scheduler.tasks)
+		row[9] = strconv.Itoa(sink.scheduler.steals)
+		row[10] = strconv.FormatFloat(sink.scheduler.imbalance(), 'f', 2, 64)
+	}
+	return sink.w.Write(row)
+}
+
+func (sink *statsSink) close() error {
+	return sink.flush()
+}
+
+func (sink *statsSink) flush() error {
+	sink.w.Flush()
+	return sink.w.Error()
+}
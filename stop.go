@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// runState is what a stop condition can see of a run after each generation.
+type runState struct {
+	generation int
+	population int
+	born, died int
+	// period is the period the universe was seen to repeat with, up to
+	// translation, or 0 while it has not.
+	period int
+}
+
+// condition is a parsed -stop expression.
+type condition interface {
+	holds(state runState) bool
+}
+
+// value is an operand of a comparison.
+type value interface {
+	of(state runState) float64
+}
+
+type orCondition struct{ left, right condition }
+
+func (c orCondition) holds(state runState) bool { return c.left.holds(state) || c.right.holds(state) }
+
+type andCondition struct{ left, right condition }
+
+func (c andCondition) holds(state runState) bool { return c.left.holds(state) && c.right.holds(state) }
+
+type notCondition struct{ operand condition }
+
+func (c notCondition) holds(state runState) bool { return !c.operand.holds(state) }
+
+// stableCondition holds once the universe repeats with a period satisfying
+// its own condition; stable() on its own holds for any detected period.
+type stableCondition struct{ period condition }
+
+func (c stableCondition) holds(state runState) bool {
+	return state.period > 0 && (c.period == nil || c.period.holds(state))
+}
+
+type comparison struct {
+	left, right value
+	operator    string
+}
+
+func (c comparison) holds(state runState) bool {
+	left, right := c.left.of(state), c.right.of(state)
+	switch c.operator {
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	case ">":
+		return left > right
+	case ">=":
+		return left >= right
+	case "==":
+		return left == right
+	default:
+		return left != right
+	}
+}
+
+type literal float64
+
+func (l literal) of(runState) float64 { return float64(l) }
+
+type variable string
+
+func (v variable) of(state runState) float64 {
+	switch v {
+	case "generation":
+		return float64(state.generation)
+	case "population":
+		return float64(state.population)
+	case "born":
+		return float64(state.born)
+	case "died":
+		return float64(state.died)
+	default:
+		return float64(state.period)
+	}
+}
+
+// needsPeriod is whether evaluating c needs the period of the universe, which
+// costs hashing every generation.
+func needsPeriod(c condition) bool {
+	switch c := c.(type) {
+	case orCondition:
+		return needsPeriod(c.left) || needsPeriod(c.right)
+	case andCondition:
+		return needsPeriod(c.left) || needsPeriod(c.right)
+	case notCondition:
+		return needsPeriod(c.operand)
+	case stableCondition:
+		return true
+	}
+	return false
+}
+
+// parseCondition parses a stop expression such as
+// "generation>=1e6 || population==0 || stable(period<=30)". Conditions combine
+// with ||, && and !, and compare generation, population, born and died to
+// numbers; period can only be compared inside stable().
+func parseCondition(s string) (condition, error) {
+	tokens, err := tokenizeCondition(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &conditionParser{tokens: tokens}
+	c, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.position < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s'", p.tokens[p.position])
+	}
+	return c, nil
+}
+
+func tokenizeCondition(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case strings.ContainsRune("()", c):
+			tokens = append(tokens, s[i:i+1])
+			i++
+		case strings.HasPrefix(s[i:], "||"), strings.HasPrefix(s[i:], "&&"),
+			strings.HasPrefix(s[i:], "<="), strings.HasPrefix(s[i:], ">="),
+			strings.HasPrefix(s[i:], "=="), strings.HasPrefix(s[i:], "!="):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		case strings.ContainsRune("<>!", c):
+			tokens = append(tokens, s[i:i+1])
+			i++
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(s) && (unicode.IsLetter(rune(s[i])) || unicode.IsDigit(rune(s[i])) || s[i] == '.' ||
+				// the sign of an exponent, as in 1e+6
+				((s[i] == '+' || s[i] == '-') && (s[i-1] == 'e' || s[i-1] == 'E') && unicode.IsDigit(rune(s[start])))) {
+				i++
+			}
+			tokens = append(tokens, s[start:i])
+		default:
+			return nil, fmt.Errorf("unexpected character '%c'", c)
+		}
+	}
+	return tokens, nil
+}
+
+type conditionParser struct {
+	tokens   []string
+	position int
+	// inStable is whether period can be referred to.
+	inStable bool
+}
+
+func (p *conditionParser) peek() string {
+	if p.position < len(p.tokens) {
+		return p.tokens[p.position]
+	}
+	return ""
+}
+
+func (p *conditionParser) next() string {
+	token := p.peek()
+	p.position++
+	return token
+}
+
+func (p *conditionParser) expect(token string) error {
+	if got := p.next(); got != token {
+		if got == "" {
+			return fmt.Errorf("expected '%s' at the end", token)
+		}
+		return fmt.Errorf("expected '%s', got '%s'", token, got)
+	}
+	return nil
+}
+
+func (p *conditionParser) or() (condition, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orCondition{left, right}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) and() (condition, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = andCondition{left, right}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) unary() (condition, error) {
+	switch p.peek() {
+	case "!":
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notCondition{operand}, nil
+	case "(":
+		p.next()
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(")")
+	case "stable":
+		p.next()
+		if p.inStable {
+			return nil, fmt.Errorf("stable() cannot be nested")
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		if p.peek() == ")" {
+			p.next()
+			return stableCondition{}, nil
+		}
+		p.inStable = true
+		c, err := p.or()
+		p.inStable = false
+		if err != nil {
+			return nil, err
+		}
+		return stableCondition{c}, p.expect(")")
+	}
+	return p.comparison()
+}
+
+func (p *conditionParser) comparison() (condition, error) {
+	left, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	operator := p.next()
+	switch operator {
+	case "<", "<=", ">", ">=", "==", "!=":
+	case "":
+		return nil, fmt.Errorf("expected a comparison at the end")
+	default:
+		return nil, fmt.Errorf("expected a comparison, got '%s'", operator)
+	}
+	right, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	return comparison{left, right, operator}, nil
+}
+
+func (p *conditionParser) value() (value, error) {
+	token := p.next()
+	switch token {
+	case "generation", "population", "born", "died":
+		return variable(token), nil
+	case "period":
+		if !p.inStable {
+			return nil, fmt.Errorf("period can only be compared inside stable()")
+		}
+		return variable(token), nil
+	case "":
+		return nil, fmt.Errorf("expected a value at the end")
+	}
+	number, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unknown value '%s'", token)
+	}
+	return literal(number), nil
+}
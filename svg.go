@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+)
+
+// writeSVG draws the viewport of view as an SVG. The alive cells of each row
+// are merged into runs, and all the runs into a single path, so that dense
+// patterns do not need a rectangle per cell, and the decaying cells of a
+// Generations rule into another. The overlay, when not nil, is drawn over
+// the cells, and so are the annotations shown at generation.
+func writeSVG(w io.Writer, cells Cells, decay Decay, view viewTransform, overlay *analysisReport, annotations []annotation, generation int) error {
+	// an SVG holds no pixels, so it can be as large as the viewport is
+	width, height := view.width(), view.viewport.h*int64(view.cellSize)
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", width, height, width, height)
+	fmt.Fprintf(out, "<rect width=\"%d\" height=\"%d\" fill=\"%s\"/>\n", width, height, svgColor(deadColor))
+	if len(decay) > 0 {
+		writeSVGRuns(out, decay.cells(), view, decayColor)
+	}
+	writeSVGRuns(out, cells, view, aliveColor)
+	if overlay != nil {
+		writeSVGOverlay(out, view, overlay)
+	}
+	if len(annotations) > 0 {
+		writeSVGAnnotations(out, view, annotations, generation)
+	}
+	fmt.Fprintf(out, "</svg>\n")
+	return out.Flush()
+}
+
+// writeSVGRuns writes the cells in the viewport of view as a path of runs
+// along their rows, filled with fill.
+func writeSVGRuns(out *bufio.Writer, cells Cells, view viewTransform, fill color.Color) {
+	fmt.Fprintf(out, "<path fill=\"%s\" d=\"", svgColor(fill))
+	var inside []Cell
+	for _, cell := range cells.sorted() {
+		if view.viewport.contains(cell) {
+			inside = append(inside, cell)
+		}
+	}
+	for start := 0; start < len(inside); {
+		end := start + 1
+		for end < len(inside) && inside[end].y == inside[start].y && inside[end].x == inside[end-1].x+1 {
+			end++
+		}
+		first, _ := view.pixels(inside[start])
+		last, _ := view.pixels(inside[end-1])
+		fmt.Fprintf(out, "M%d %dh%dv%dh-%dz", first.Min.X, first.Min.Y, last.Max.X-first.Min.X, view.cellSize, last.Max.X-first.Min.X)
+		start = end
+	}
+	fmt.Fprintf(out, "\"/>\n")
+}
+func svgColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
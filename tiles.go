@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// tileSize is the width and height of a tile in pixels, as slippy maps
+	// expect.
+	tileSize = 256
+	// maxTileZoom is the deepest zoom level of a tile pyramid. Universes too
+	// wide to draw at -cell-size within it are drawn smaller at that level.
+	maxTileZoom = 24
+)
+
+// tilesSink exports one generation of a run as a tile pyramid, see
+// writeTiles. With generation negative it exports the last generation.
+type tilesSink struct {
+	dir        string
+	cellSize   int
+	flipY      bool
+	generation int
+	// last is the latest universe observed, for exporting the run's last one.
+	last     Cells
+	lastAt   int
+	exported bool
+}
+
+func newTilesSink(dir string, cellSize int, flipY bool, generation int) *tilesSink {
+	return &tilesSink{dir: dir, cellSize: cellSize, flipY: flipY, generation: generation}
+}
+
+// needsEveryGeneration is true when exporting a given generation, which
+// skipping ahead could jump over.
+func (sink *tilesSink) needsEveryGeneration() bool {
+	return sink.generation >= 0
+}
+
+func (sink *tilesSink) observe(event Event) error {
+	if sink.generation < 0 {
+		sink.last, sink.lastAt = event.cells, event.generation
+		return nil
+	}
+	if event.generation != sink.generation {
+		return nil
+	}
+	sink.exported = true
+	return writeTiles(sink.dir, event.cells, event.generation, newTilePyramid(event.cells, sink.cellSize, sink.flipY))
+}
+
+func (sink *tilesSink) close() error {
+	if sink.generation < 0 {
+		return writeTiles(sink.dir, sink.last, sink.lastAt, newTilePyramid(sink.last, sink.cellSize, sink.flipY))
+	}
+	if !sink.exported {
+		return fmt.Errorf("generation %d to export as tiles was never reached", sink.generation)
+	}
+	return nil
+}
+
+// tilePyramid lays a universe out on the tiles of a slippy map: the bounding
+// box of its cells starts at the top-left corner of the one tile of zoom 0,
+// and each zoom level doubles the size of the tiles before it, down to
+// maxZoom, where a cell is scale pixels wide.
+type tilePyramid struct {
+	topLeft, bottomRight Cell
+	maxZoom              int
+	scale                float64
+	flipY                bool
+}
+
+func newTilePyramid(cells Cells, cellSize int, flipY bool) tilePyramid {
+	topLeft, bottomRight, ok := cells.boundingBox()
+	if !ok {
+		return tilePyramid{scale: float64(cellSize), flipY: flipY}
+	}
+	extent := float64(max(bottomRight.x-topLeft.x+1, bottomRight.y-topLeft.y+1))
+	zoom := 0
+	for zoom < maxTileZoom && extent*float64(cellSize) > tileSize*math.Exp2(float64(zoom)) {
+		zoom++
+	}
+	scale := min(float64(cellSize), tileSize*math.Exp2(float64(zoom))/extent)
+	return tilePyramid{topLeft, bottomRight, zoom, scale, flipY}
+}
+
+// pixels is the rectangle of pixels cell covers at zoom, as left, top, right
+// and bottom, at least one pixel however far out, so that sparse patterns stay
+// visible.
+func (pyramid tilePyramid) pixels(cell Cell, zoom int) (int64, int64, int64, int64) {
+	scale := pyramid.scale / math.Exp2(float64(pyramid.maxZoom-zoom))
+	x, y := float64(cell.x-pyramid.topLeft.x), float64(cell.y-pyramid.topLeft.y)
+	if pyramid.flipY {
+		y = float64(pyramid.bottomRight.y - cell.y)
+	}
+	left, top := int64(x*scale), int64(y*scale)
+	return left, top, max(int64((x+1)*scale), left+1), max(int64((y+1)*scale), top+1)
+}
+
+// writeTiles writes cells as a pyramid of tileSize PNG tiles, dir/z/x/y.png
+// for each zoom level z from 0 to the deepest, leaving out the tiles with no
+// alive cells, and an index.html that browses them with Leaflet. Each level
+// only holds its cells sorted into tiles, never an image of the universe.
+func writeTiles(dir string, cells Cells, generation int, pyramid tilePyramid) error {
+	written := 0
+	palette := color.Palette{deadColor, aliveColor}
+	for zoom := 0; zoom <= pyramid.maxZoom && len(cells) > 0; zoom++ {
+		tiles := make(map[[2]int64][]Cell)
+		for cell := range cells {
+			left, top, right, bottom := pyramid.pixels(cell, zoom)
+			for tx := left / tileSize; tx <= (right-1)/tileSize; tx++ {
+				for ty := top / tileSize; ty <= (bottom-1)/tileSize; ty++ {
+					tiles[[2]int64{tx, ty}] = append(tiles[[2]int64{tx, ty}], cell)
+				}
+			}
+		}
+
+		for tile, tileCells := range tiles {
+			img := image.NewPaletted(image.Rect(0, 0, tileSize, tileSize), palette)
+			origin := image.Pt(int(tile[0]*tileSize), int(tile[1]*tileSize))
+			for _, cell := range tileCells {
+				left, top, right, bottom := pyramid.pixels(cell, zoom)
+				covered := image.Rect(int(left), int(top), int(right), int(bottom)).Sub(origin).Intersect(img.Rect)
+				for y := covered.Min.Y; y < covered.Max.Y; y++ {
+					for x := covered.Min.X; x < covered.Max.X; x++ {
+						img.SetColorIndex(x, y, 1)
+					}
+				}
+			}
+			if err := writeTile(filepath.Join(dir, strconv.Itoa(zoom), strconv.FormatInt(tile[0], 10)), strconv.FormatInt(tile[1], 10)+".png", img); err != nil {
+				return fmt.Errorf("writing tile %d/%d/%d failed: %v", zoom, tile[0], tile[1], err)
+			}
+			written++
+		}
+	}
+	logger(logRenderer).Info("Exported tiles", "dir", dir, "zoom-levels", pyramid.maxZoom+1, "tiles", written)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "index.html"), []byte(tilesPage(generation, pyramid)), 0o644)
+}
+
+func writeTile(dir, name string, img image.Image) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, img); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// tilesPage is a page showing the tiles with Leaflet in its plain
+// coordinates, where the tile of zoom 0 spans 256 units, with the cell under
+// the pointer in the corner. Zooming on past the deepest level scales its
+// tiles up.
+func tilesPage(generation int, pyramid tilePyramid) string {
+	dead := color.RGBAModel.Convert(deadColor).(color.RGBA)
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Generation %d</title>
+<link rel="stylesheet" href="https://unpkg.com/leaflet@1.9.4/dist/leaflet.css">
+<script src="https://unpkg.com/leaflet@1.9.4/dist/leaflet.js"></script>
+<style>
+html, body, #map { height: 100%%; margin: 0; }
+#map { background: #%02x%02x%02x; }
+</style>
+</head>
+<body>
+<div id="map"></div>
+<script>
+const topLeft = [%d, %d], bottom = %d, maxZoom = %d, scale = %g, flipY = %t;
+const bounds = L.latLngBounds([[-%d, 0], [0, %d]]);
+const map = L.map('map', {crs: L.CRS.Simple, minZoom: 0, maxZoom: maxZoom + 3});
+L.tileLayer('{z}/{x}/{y}.png', {tileSize: %d, minZoom: 0, maxNativeZoom: maxZoom, maxZoom: maxZoom + 3, noWrap: true, bounds: bounds}).addTo(map);
+map.fitBounds(bounds);
+
+const position = L.control({position: 'bottomleft'});
+position.onAdd = () => L.DomUtil.create('div', 'leaflet-control-attribution');
+position.addTo(map);
+map.on('mousemove', (event) => {
+  const cellsPerUnit = Math.pow(2, maxZoom) / scale;
+  const x = topLeft[0] + Math.floor(event.latlng.lng * cellsPerUnit);
+  const down = Math.floor(-event.latlng.lat * cellsPerUnit);
+  const y = flipY ? bottom - down : topLeft[1] + down;
+  position.getContainer().textContent = x + ',' + y;
+});
+</script>
+</body>
+</html>
+`, generation, dead.R, dead.G, dead.B,
+		pyramid.topLeft.x, pyramid.topLeft.y, pyramid.bottomRight.y, pyramid.maxZoom, pyramid.scale, pyramid.flipY,
+		tileSize, tileSize, tileSize)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// topology is the shape of the universe: the infinite plane, or a finite
+// grid whose edges are either dead or joined into a torus.
+type topology struct {
+	// bounds, when not nil, is the grid, centered on 0,0 as Golly centers
+	// its bounded grids.
+	bounds *Rect
+	// wraps joins the opposite edges of bounds.
+	wraps bool
+}
+
+// parseTopology parses -topology: "infinite", "plane:WxH" or "torus:WxH".
+func parseTopology(s string) (topology, error) {
+	if s == "infinite" {
+		return topology{}, nil
+	}
+	kind, size, found := strings.Cut(s, ":")
+	if !found || (kind != "plane" && kind != "torus") {
+		return topology{}, fmt.Errorf("'%s' is not infinite, plane:WxH or torus:WxH", s)
+	}
+	width, height, found := strings.Cut(size, "x")
+	if !found {
+		return topology{}, fmt.Errorf("size '%s' is not of the form WxH", size)
+	}
+	w, err := strconv.ParseInt(strings.TrimSpace(width), 10, 64)
+	if err != nil || w < 1 || w > maxCoordinate {
+		return topology{}, fmt.Errorf("width '%s' is not between 1 and %d", width, int64(maxCoordinate))
+	}
+	h, err := strconv.ParseInt(strings.TrimSpace(height), 10, 64)
+	if err != nil || h < 1 || h > maxCoordinate {
+		return topology{}, fmt.Errorf("height '%s' is not between 1 and %d", height, int64(maxCoordinate))
+	}
+	return topology{bounds: &Rect{-w / 2, -h / 2, w, h}, wraps: kind == "torus"}, nil
+}
+
+// wrapped moves cells outside a torus to where they are on it.
+func (t topology) wrapped(cells Cells) Cells {
+	if !t.wraps {
+		return cells
+	}
+	wrapped := make(Cells, len(cells))
+	for cell := range cells {
+		wrapped.addCell(t.wrap(cell))
+	}
+	return wrapped
+}
+
+func (t topology) wrap(cell Cell) Cell {
+	b := t.bounds
+	return Cell{b.x + ((cell.x-b.x)%b.w+b.w)%b.w, b.y + ((cell.y-b.y)%b.h+b.h)%b.h}
+}
+
+// torusEngine runs an engine on a torus by joining the edges of its grid.
+// Before each step the cells within reach of an edge are copied beyond the
+// opposite one, where the engine counts them as neighbors but, with the grid
+// among its constraints, births nothing; the copies are dropped after.
+type torusEngine struct {
+	engine Engine
+	bounds Rect
+	radius int64
+}
+
+func newTorusEngine(engine Engine, bounds Rect, neighborhood Neighborhood) (*torusEngine, error) {
+	radius := neighborhood.radius()
+	if radius > bounds.w || radius > bounds.h {
+		return nil, fmt.Errorf("a torus of %dx%d is smaller than the reach %d of the neighborhood", bounds.w, bounds.h, radius)
+	}
+	return &torusEngine{engine, bounds, radius}, nil
+}
+
+func (engine *torusEngine) step(cells Cells) (Cells, Cells, Cells) {
+	b, reach := engine.bounds, engine.bounds.grown(engine.radius)
+	var copies []Cell
+	for cell := range cells {
+		nearX := cell.x-b.x < engine.radius || b.x+b.w-1-cell.x < engine.radius
+		nearY := cell.y-b.y < engine.radius || b.y+b.h-1-cell.y < engine.radius
+		if !nearX && !nearY {
+			continue
+		}
+		for _, dx := range []int64{-b.w, 0, b.w} {
+			for _, dy := range []int64{-b.h, 0, b.h} {
+				copied := Cell{cell.x + dx, cell.y + dy}
+				if (dx != 0 || dy != 0) && reach.contains(copied) {
+					copies = append(copies, copied)
+				}
+			}
+		}
+	}
+	for _, cell := range copies {
+		cells.addCell(cell)
+	}
+
+	next, born, died := engine.engine.step(cells)
+	for _, cell := range copies {
+		next.removeCell(cell)
+		died.removeCell(cell)
+	}
+	return next, born, died
+}
+
+const (
+	// maxTorusPeriod is the longest period the universe of a torus is seen
+	// repeating with.
+	maxTorusPeriod = 1 << 16
+	// maxTorusCandidates is how many universes are kept at once to compare
+	// with the ones a period later.
+	maxTorusCandidates = 8
+)
+
+// torusPeriodSink reports when the universe of a torus becomes periodic,
+// including agar that comes back moved around the torus. Each generation is
+// fingerprinted by the populations of its rows and columns, and of adjacent
+// pairs of them, which do not change when the universe moves around the
+// torus, updated from the cells born and died. Once a fingerprint repeats,
+// the universe is kept and compared with the one a candidate period later,
+// which finds how far it moved and rules out fingerprints that only collide,
+// as those of the mirror images of a spaceship's phases do.
+type torusPeriodSink struct {
+	bounds        Rect
+	rows, columns cyclicCounts
+	last          int
+	// seen is the last generation of each fingerprint, and fingerprints
+	// those of the last maxTorusPeriod generations, oldest first.
+	seen         map[uint64]int
+	fingerprints []uint64
+	candidates   []torusCandidate
+	// periodic is the candidate that came back, moved by dx,dy.
+	periodic *torusCandidate
+	dx, dy   int64
+}
+
+// torusCandidate is a universe that may come back after period generations.
+type torusCandidate struct {
+	generation, period int
+	cells              Cells
+}
+
+func newTorusPeriodSink(bounds Rect) *torusPeriodSink {
+	return &torusPeriodSink{
+		bounds:  bounds,
+		rows:    cyclicCounts{bounds.h, 0, make(map[int64]int), 0},
+		columns: cyclicCounts{bounds.w, 1, make(map[int64]int), 0},
+		last:    -1,
+		seen:    make(map[uint64]int),
+	}
+}
+
+func (sink *torusPeriodSink) observe(event Event) error {
+	if sink.periodic != nil {
+		return nil
+	}
+	if event.generation == sink.last+1 {
+		sink.count(event.born, 1)
+		sink.count(event.died, -1)
+	} else {
+		// the generations skipped, as by -fast-forward, are counted afresh
+		sink.rows = cyclicCounts{sink.bounds.h, 0, make(map[int64]int), 0}
+		sink.columns = cyclicCounts{sink.bounds.w, 1, make(map[int64]int), 0}
+		sink.count(event.cells, 1)
+		sink.seen, sink.fingerprints, sink.candidates = make(map[uint64]int), nil, nil
+	}
+	sink.last = event.generation
+
+	pending := sink.candidates[:0]
+	for _, c := range sink.candidates {
+		if event.generation < c.generation+c.period {
+			pending = append(pending, c)
+			continue
+		}
+		if dx, dy, ok := sink.translation(c.cells, event.cells); ok {
+			c.cells = nil
+			sink.periodic, sink.dx, sink.dy, sink.candidates = &c, dx, dy, nil
+			logger(logEngine).Info("The universe of the torus is periodic", "by-generation", c.generation, "period", c.period, "dx", dx, "dy", dy)
+			return nil
+		}
+	}
+	sink.candidates = pending
+	fingerprint := sink.rows.sum ^ sink.columns.sum
+	if generation, found := sink.seen[fingerprint]; found && len(sink.candidates) < maxTorusCandidates {
+		sink.candidates = append(sink.candidates, torusCandidate{event.generation, event.generation - generation, event.cells.clone()})
+	}
+	sink.seen[fingerprint] = event.generation
+	sink.fingerprints = append(sink.fingerprints, fingerprint)
+	if len(sink.fingerprints) > maxTorusPeriod {
+		oldest := sink.fingerprints[0]
+		if sink.seen[oldest] == event.generation-maxTorusPeriod {
+			delete(sink.seen, oldest)
+		}
+		sink.fingerprints = sink.fingerprints[1:]
+	}
+	return nil
+}
+
+func (sink *torusPeriodSink) count(cells Cells, delta int) {
+	for cell := range cells {
+		sink.rows.add(cell.y-sink.bounds.y, delta)
+		sink.columns.add(cell.x-sink.bounds.x, delta)
+	}
+}
+
+// translation finds how far before moved around the torus to become after,
+// as the shortest way around, and false when after is not before moved.
+func (sink *torusPeriodSink) translation(before, after Cells) (int64, int64, bool) {
+	if len(before) != len(after) {
+		return 0, 0, false
+	}
+	if len(before) == 0 {
+		return 0, 0, true
+	}
+	var reference Cell
+	for cell := range before {
+		reference = cell
+		break
+	}
+	t := topology{bounds: &sink.bounds, wraps: true}
+	for candidate := range after {
+		dx, dy := candidate.x-reference.x, candidate.y-reference.y
+		moved := true
+		for cell := range before {
+			if !after.hasCell(t.wrap(Cell{cell.x + dx, cell.y + dy})) {
+				moved = false
+				break
+			}
+		}
+		if moved {
+			return shortestAround(dx, sink.bounds.w), shortestAround(dy, sink.bounds.h), true
+		}
+	}
+	return 0, 0, false
+}
+
+// shortestAround is the distance d around a loop of length n, from -n/2 to
+// n/2.
+func shortestAround(d, n int64) int64 {
+	d = (d%n + n) % n
+	if d > n/2 {
+		d -= n
+	}
+	return d
+}
+
+func (sink *torusPeriodSink) close() error {
+	if sink.periodic == nil {
+		logger(logEngine).Debug("The universe of the torus was not seen repeating", "max-period", maxTorusPeriod)
+	}
+	return nil
+}
+
+// cyclicCounts are the populations of the rows, or the columns, of a torus,
+// and sum a fingerprint of them that does not change when they are rotated.
+type cyclicCounts struct {
+	n    int64
+	axis int64
+	// counts are by index from the edge of the torus.
+	counts map[int64]int
+	sum    uint64
+}
+
+// add changes the population at index by delta, and the terms of sum for the
+// pairs index starts and ends.
+func (c *cyclicCounts) add(index int64, delta int) {
+	previous := (index - 1 + c.n) % c.n
+	c.sum -= c.term(previous) + c.term(index)
+	if c.counts[index] += delta; c.counts[index] == 0 {
+		delete(c.counts, index)
+	}
+	c.sum += c.term(previous) + c.term(index)
+}
+
+// term is the part of the fingerprint of the pair of index and the one
+// after it.
+func (c *cyclicCounts) term(index int64) uint64 {
+	if c.n == 1 {
+		// a torus one wide is its own neighbor
+		return cellHash(Cell{int64(c.counts[index])<<1 | c.axis, -1})
+	}
+	return cellHash(Cell{int64(c.counts[index])<<1 | c.axis, int64(c.counts[(index+1)%c.n])})
+}
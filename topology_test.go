@@ -0,0 +1,99 @@
+package main
+
+import "testing"
+
+// TestTorusPeriod checks that spaceships moving around a torus are seen
+// repeating, with how far they move each period.
+func TestTorusPeriod(t *testing.T) {
+	tests := []struct {
+		preset, torus string
+		period        int
+		dx, dy        int64
+	}{
+		{"glider", "torus:8x8", 4, 1, 1},
+		{"lwss", "torus:16x9", 4, -2, 0},
+		{"r-pentomino", "torus:20x20", 1, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.preset, func(t *testing.T) {
+			pattern, err := readPreset(test.preset, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			torus, err := parseTopology(test.torus)
+			if err != nil {
+				t.Fatal(err)
+			}
+			engine, err := newTorusEngine(newNaiveEngine(conwayRule, mooreNeighborhood, constraints{bounds: torus.bounds}), *torus.bounds, mooreNeighborhood)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sink := newTorusPeriodSink(*torus.bounds)
+			cells := torus.wrapped(pattern.cells)
+			sink.observe(Event{generation: 0, cells: cells, born: cells})
+			for generation := 1; generation <= 1000 && sink.periodic == nil; generation++ {
+				var born, died Cells
+				cells, born, died = engine.step(cells)
+				sink.observe(Event{generation: generation, cells: cells, born: born, died: died})
+			}
+			if sink.periodic == nil {
+				t.Fatalf("not seen repeating")
+			}
+			if sink.periodic.period != test.period || sink.dx != test.dx || sink.dy != test.dy {
+				t.Errorf("period %d moving by %d,%d, not period %d moving by %d,%d", sink.periodic.period, sink.dx, sink.dy, test.period, test.dx, test.dy)
+			}
+		})
+	}
+}
+
+// TestTorusWrap checks that cells beyond the edges of a torus wrap to the
+// opposite ones, and that neighbors are counted across the edges.
+func TestTorusWrap(t *testing.T) {
+	torus, err := parseTopology("torus:8x8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cell, want := range map[Cell]Cell{{0, 0}: {0, 0}, {4, 0}: {-4, 0}, {-5, -5}: {3, 3}, {11, -12}: {3, -4}} {
+		if got := torus.wrap(cell); got != want {
+			t.Errorf("%v wraps to %v, not %v", cell, got, want)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		cells       []Cell
+		generations int
+		want        []Cell
+	}{
+		{"blinker across the side", []Cell{{3, 0}, {-4, 0}, {-3, 0}}, 1, []Cell{{-4, -1}, {-4, 0}, {-4, 1}}},
+		{"block across the corner", []Cell{{3, 3}, {-4, 3}, {3, -4}, {-4, -4}}, 1, []Cell{{3, 3}, {-4, 3}, {3, -4}, {-4, -4}}},
+		// a glider moves a cell diagonally every 4 generations
+		{"glider around the torus", []Cell{{1, 0}, {2, 1}, {0, 2}, {1, 2}, {2, 2}}, 32, []Cell{{1, 0}, {2, 1}, {0, 2}, {1, 2}, {2, 2}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine, err := newTorusEngine(newNaiveEngine(conwayRule, mooreNeighborhood, constraints{bounds: torus.bounds}), *torus.bounds, mooreNeighborhood)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cells, want := make(Cells), make(Cells)
+			for _, cell := range test.cells {
+				cells.addCell(cell)
+			}
+			for _, cell := range test.want {
+				want.addCell(cell)
+			}
+			for generation := 0; generation < test.generations; generation++ {
+				cells, _, _ = engine.step(cells)
+				for cell := range cells {
+					if !torus.bounds.contains(cell) {
+						t.Fatalf("generation %d has %v outside the torus", generation+1, cell)
+					}
+				}
+			}
+			if !cells.equal(want) {
+				t.Errorf("got %v, not %v", cells, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"image"
+)
+
+// viewTransform maps cells of the universe to pixels, so that every renderer
+// agrees on where a cell lands: the viewport's top-left cell covers the
+// pixels from 0,0, and each cell a square of cellSize by cellSize pixels.
+// With flipY, y grows upwards instead, as in most plotting tools, and the
+// viewport's bottom row is drawn at the top. With hex, the cells are those of
+// the hex neighborhood, whose neighbors above are up-left and up-right of a
+// cell, so each row is drawn half a cell to the left of the row above it.
+type viewTransform struct {
+	viewport Rect
+	cellSize int
+	flipY    bool
+	hex      bool
+}
+
+// shift is how many half cells the row y of the universe is drawn to the
+// right of the viewport's bottom row.
+func (view viewTransform) shift(y int64) int64 {
+	if !view.hex {
+		return 0
+	}
+	return view.viewport.h - 1 - (y - view.viewport.y)
+}
+
+// width is the width of the viewport in pixels, not checked for overflow.
+func (view viewTransform) width() int64 {
+	if view.hex {
+		return ((2*view.viewport.w+view.viewport.h-1)*int64(view.cellSize) + 1) / 2
+	}
+	return view.viewport.w * int64(view.cellSize)
+}
+
+// fitted returns the transform with its viewport set to the bounding box of
+// cells and a border of one cell, unless it already has a viewport.
+func (view viewTransform) fitted(cells Cells) viewTransform {
+	if view.viewport.w > 0 && view.viewport.h > 0 {
+		return view
+	}
+	topLeft, bottomRight, ok := cells.boundingBox()
+	if !ok {
+		view.viewport = Rect{0, 0, 1, 1}
+		return view
+	}
+	view.viewport = Rect{topLeft.x, topLeft.y, bottomRight.x - topLeft.x + 1, bottomRight.y - topLeft.y + 1}.grown(1)
+	return view
+}
+
+// size returns the width and height of the viewport in pixels, or an error
+// when the image would be too large to hold.
+func (view viewTransform) size() (int, int, error) {
+	w, h := view.viewport.w, view.viewport.h
+	if view.hex {
+		// the rows shift by up to half a cell each
+		w += h/2 + 1
+	}
+	if w <= 0 || h <= 0 || w > maxSnapshotPixels/h/int64(view.cellSize*view.cellSize) {
+		return 0, 0, fmt.Errorf("%dx%d cells are too many to render at %d pixels per cell", w, h, view.cellSize)
+	}
+	return int(view.width()), int(h) * view.cellSize, nil
+}
+
+// pixels returns the square of pixels covered by cell, and false when the
+// cell is outside the viewport.
+func (view viewTransform) pixels(cell Cell) (image.Rectangle, bool) {
+	if !view.viewport.contains(cell) {
+		return image.Rectangle{}, false
+	}
+	column, row := cell.x-view.viewport.x, cell.y-view.viewport.y
+	if view.flipY {
+		row = view.viewport.h - 1 - row
+	}
+	left, top := int(column)*view.cellSize, int(row)*view.cellSize
+	if view.hex {
+		left = int(2*column+view.shift(cell.y)) * view.cellSize / 2
+	}
+	return image.Rect(left, top, left+view.cellSize, top+view.cellSize), true
+}
+
+// paint draws the alive cells within the viewport in color index alive.
+func (view viewTransform) paint(img *image.Paletted, cells Cells, alive uint8) {
+	for cell := range cells {
+		square, ok := view.pixels(cell)
+		if !ok {
+			continue
+		}
+		for y := square.Min.Y; y < square.Max.Y; y++ {
+			for x := square.Min.X; x < square.Max.X; x++ {
+				img.SetColorIndex(x, y, alive)
+			}
+		}
+	}
+}
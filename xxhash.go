@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// xxh32 and xxh64 are the XXH32 and XXH64 hashes, with a seed of 0, that
+// the LZ4 and Zstandard frame formats checksum their contents with. They
+// hash a stream as it is written, like the hash.Hash of the standard
+// library.
+
+const (
+	xxh32Prime1 uint32 = 2654435761
+	xxh32Prime2 uint32 = 2246822519
+	xxh32Prime3 uint32 = 3266489917
+	xxh32Prime4 uint32 = 668265263
+	xxh32Prime5 uint32 = 374761393
+
+	xxh64Prime1 uint64 = 11400714785074694791
+	xxh64Prime2 uint64 = 14029467366897019727
+	xxh64Prime3 uint64 = 1609587929392839161
+	xxh64Prime4 uint64 = 9650029242287828579
+	xxh64Prime5 uint64 = 2870177450012600261
+)
+
+type xxh32 struct {
+	v      [4]uint32
+	total  uint64
+	buffer [16]byte
+	n      int
+}
+
+func newXXH32() *xxh32 {
+	// the primes wrap around, so they are added as variables
+	prime1, prime2 := xxh32Prime1, xxh32Prime2
+	return &xxh32{v: [4]uint32{prime1 + prime2, prime2, 0, -prime1}}
+}
+
+func xxh32Round(v, input uint32) uint32 {
+	return bits.RotateLeft32(v+input*xxh32Prime2, 13) * xxh32Prime1
+}
+
+func (h *xxh32) Write(p []byte) (int, error) {
+	written := len(p)
+	h.total += uint64(len(p))
+	if h.n > 0 {
+		copied := copy(h.buffer[h.n:], p)
+		h.n += copied
+		p = p[copied:]
+		if h.n < len(h.buffer) {
+			return written, nil
+		}
+		h.stripe(h.buffer[:])
+		h.n = 0
+	}
+	for ; len(p) >= 16; p = p[16:] {
+		h.stripe(p)
+	}
+	h.n = copy(h.buffer[:], p)
+	return written, nil
+}
+
+func (h *xxh32) stripe(p []byte) {
+	for i := range h.v {
+		h.v[i] = xxh32Round(h.v[i], binary.LittleEndian.Uint32(p[4*i:]))
+	}
+}
+
+func (h *xxh32) Sum32() uint32 {
+	var sum uint32
+	if h.total >= 16 {
+		sum = bits.RotateLeft32(h.v[0], 1) + bits.RotateLeft32(h.v[1], 7) + bits.RotateLeft32(h.v[2], 12) + bits.RotateLeft32(h.v[3], 18)
+	} else {
+		sum = xxh32Prime5
+	}
+	sum += uint32(h.total)
+	p := h.buffer[:h.n]
+	for ; len(p) >= 4; p = p[4:] {
+		sum = bits.RotateLeft32(sum+binary.LittleEndian.Uint32(p)*xxh32Prime3, 17) * xxh32Prime4
+	}
+	for _, b := range p {
+		sum = bits.RotateLeft32(sum+uint32(b)*xxh32Prime5, 11) * xxh32Prime1
+	}
+	sum ^= sum >> 15
+	sum *= xxh32Prime2
+	sum ^= sum >> 13
+	sum *= xxh32Prime3
+	sum ^= sum >> 16
+	return sum
+}
+
+type xxh64 struct {
+	v      [4]uint64
+	total  uint64
+	buffer [32]byte
+	n      int
+}
+
+func newXXH64() *xxh64 {
+	prime1, prime2 := xxh64Prime1, xxh64Prime2
+	return &xxh64{v: [4]uint64{prime1 + prime2, prime2, 0, -prime1}}
+}
+
+func xxh64Round(v, input uint64) uint64 {
+	return bits.RotateLeft64(v+input*xxh64Prime2, 31) * xxh64Prime1
+}
+
+func xxh64Merge(sum, v uint64) uint64 {
+	return (sum^xxh64Round(0, v))*xxh64Prime1 + xxh64Prime4
+}
+
+func (h *xxh64) Write(p []byte) (int, error) {
+	written := len(p)
+	h.total += uint64(len(p))
+	if h.n > 0 {
+		copied := copy(h.buffer[h.n:], p)
+		h.n += copied
+		p = p[copied:]
+		if h.n < len(h.buffer) {
+			return written, nil
+		}
+		h.stripe(h.buffer[:])
+		h.n = 0
+	}
+	for ; len(p) >= 32; p = p[32:] {
+		h.stripe(p)
+	}
+	h.n = copy(h.buffer[:], p)
+	return written, nil
+}
+
+func (h *xxh64) stripe(p []byte) {
+	for i := range h.v {
+		h.v[i] = xxh64Round(h.v[i], binary.LittleEndian.Uint64(p[8*i:]))
+	}
+}
+
+func (h *xxh64) Sum64() uint64 {
+	var sum uint64
+	if h.total >= 32 {
+		sum = bits.RotateLeft64(h.v[0], 1) + bits.RotateLeft64(h.v[1], 7) + bits.RotateLeft64(h.v[2], 12) + bits.RotateLeft64(h.v[3], 18)
+		for _, v := range h.v {
+			sum = xxh64Merge(sum, v)
+		}
+	} else {
+		sum = xxh64Prime5
+	}
+	sum += h.total
+	p := h.buffer[:h.n]
+	for ; len(p) >= 8; p = p[8:] {
+		sum = bits.RotateLeft64(sum^xxh64Round(0, binary.LittleEndian.Uint64(p)), 27)*xxh64Prime1 + xxh64Prime4
+	}
+	if len(p) >= 4 {
+		sum = bits.RotateLeft64(sum^uint64(binary.LittleEndian.Uint32(p))*xxh64Prime1, 23)*xxh64Prime2 + xxh64Prime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		sum = bits.RotateLeft64(sum^uint64(b)*xxh64Prime5, 11) * xxh64Prime1
+	}
+	sum ^= sum >> 33
+	sum *= xxh64Prime2
+	sum ^= sum >> 29
+	sum *= xxh64Prime3
+	sum ^= sum >> 32
+	return sum
+}
@@ -0,0 +1,1080 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// The Zstandard frame format of RFC 8878, as the zstd command line tool
+// reads and writes it. Reading takes any frame without a dictionary: raw,
+// RLE and compressed blocks, Huffman coded literals and FSE coded
+// sequences, concatenated frames and skippable frames. Writing keeps to a
+// subset that is quick to produce: matches found by a hash of the next
+// four bytes within each block, literals stored as they are and sequences
+// coded with the predefined FSE tables, which still halves a checkpoint or
+// history.
+
+const (
+	zstdMagic          = 0xfd2fb528
+	zstdSkippableMagic = 0x184d2a50
+	// zstdMaxWindow is the largest window a frame may need to be read, as
+	// the zstd tool allows by default.
+	zstdMaxWindow = 1 << 27
+	// zstdBlockSize is the largest block, and the size of those written.
+	zstdBlockSize = 1 << 17
+	// zstdWindowDescriptor is the window of the frames written, that of one
+	// block since matches are only searched for within a block.
+	zstdWindowDescriptor = (17 - 10) << 3
+	zstdHashLog          = 16
+	zstdMinMatch         = 4
+
+	zstdBlockRaw        = 0
+	zstdBlockRLE        = 1
+	zstdBlockCompressed = 2
+
+	zstdLiteralsRaw        = 0
+	zstdLiteralsRLE        = 1
+	zstdLiteralsCompressed = 2
+	zstdLiteralsTreeless   = 3
+
+	zstdModePredefined = 0
+	zstdModeRLE        = 1
+	zstdModeFSE        = 2
+	zstdModeRepeat     = 3
+
+	zstdMaxHuffmanBits = 11
+)
+
+var zstdMagicBytes = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+var errZstdCorrupt = errors.New("corrupt zstd block")
+
+// The baselines and extra bits of the literal length and match length
+// codes, and the predefined distributions of the codes.
+var (
+	zstdLiteralBase  = []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768, 65536}
+	zstdLiteralExtra = []uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	zstdMatchBase    = []uint32{3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051, 4099, 8195, 16387, 32771, 65539}
+	zstdMatchExtra   = []uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	zstdLiteralTable = mustFSETable([]int16{4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1, -1, -1, -1, -1}, 6)
+	zstdMatchTable   = mustFSETable([]int16{1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1, -1, -1}, 6)
+	zstdOffsetTable  = mustFSETable([]int16{1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1}, 5)
+)
+
+// zstdKinds are the literal length, offset and match length codes, in the
+// order their tables are described: the largest code and accuracy log of
+// each, and its predefined table.
+var zstdKinds = [3]struct {
+	maxSymbol, maxLog int
+	predefined        *fseTable
+}{
+	{35, 9, zstdLiteralTable},
+	{31, 8, zstdOffsetTable},
+	{52, 9, zstdMatchTable},
+}
+
+// fseTable decodes the symbols of a finite state entropy code: in state s
+// it gives entries[s].symbol, then reads entries[s].bits bits and adds them
+// to entries[s].baseline for the next state.
+type fseTable struct {
+	log     int
+	entries []fseEntry
+	// encode is the state before each state of each symbol, for writing:
+	// encode[symbol][next] is the state that gives symbol and reads its way
+	// to next. It is only built for the predefined tables.
+	encode [][]uint16
+}
+
+type fseEntry struct {
+	symbol   uint8
+	bits     uint8
+	baseline uint16
+}
+
+// buildFSETable spreads the symbols of a normalized distribution over a
+// table of 1<<log states, those of probability -1 taking one state each at
+// the end of the table.
+func buildFSETable(norm []int16, log int) (*fseTable, error) {
+	size := 1 << log
+	table := &fseTable{log: log, entries: make([]fseEntry, size)}
+	high := size - 1
+	next := make([]int, len(norm))
+	for symbol, p := range norm {
+		if p == -1 {
+			table.entries[high].symbol = uint8(symbol)
+			high--
+			next[symbol] = 1
+		} else {
+			next[symbol] = int(p)
+		}
+	}
+	position, step := 0, size>>1+size>>3+3
+	for symbol, p := range norm {
+		for i := 0; i < int(p); i++ {
+			table.entries[position].symbol = uint8(symbol)
+			for position = (position + step) & (size - 1); position > high; position = (position + step) & (size - 1) {
+			}
+		}
+	}
+	if position != 0 {
+		return nil, errZstdCorrupt
+	}
+	for state := range table.entries {
+		entry := &table.entries[state]
+		x := next[entry.symbol]
+		next[entry.symbol]++
+		entry.bits = uint8(log - (bits.Len(uint(x)) - 1))
+		entry.baseline = uint16(x<<entry.bits - size)
+	}
+	return table, nil
+}
+
+func mustFSETable(norm []int16, log int) *fseTable {
+	table, err := buildFSETable(norm, log)
+	if err != nil {
+		panic(err)
+	}
+	table.encode = make([][]uint16, len(norm))
+	for symbol := range table.encode {
+		table.encode[symbol] = make([]uint16, len(table.entries))
+	}
+	for state, entry := range table.entries {
+		for next := int(entry.baseline); next < int(entry.baseline)+1<<entry.bits; next++ {
+			table.encode[entry.symbol][next] = uint16(state)
+		}
+	}
+	return table
+}
+
+// readFSETable reads the description of an FSE table from the start of src,
+// returning the table and the number of bytes the description took.
+func readFSETable(src []byte, maxSymbol, maxLog int) (*fseTable, int, error) {
+	r := forwardBits{data: src}
+	log := int(r.read(4)) + 5
+	if log > maxLog {
+		return nil, 0, errZstdCorrupt
+	}
+	remaining, threshold, width := 1<<log+1, 1<<log, log+1
+	var norm []int16
+	previousZero := false
+	for remaining > 1 && len(norm) <= maxSymbol {
+		if previousZero {
+			for {
+				repeat := int(r.read(2))
+				for i := 0; i < repeat; i++ {
+					norm = append(norm, 0)
+				}
+				if repeat != 3 {
+					break
+				}
+			}
+			if len(norm) > maxSymbol {
+				return nil, 0, errZstdCorrupt
+			}
+		}
+		most := 2*threshold - 1 - remaining
+		value := int(r.peek(width))
+		var count int
+		if value&(threshold-1) < most {
+			count = value & (threshold - 1)
+			r.skip(width - 1)
+		} else {
+			count = value & (2*threshold - 1)
+			if count >= threshold {
+				count -= most
+			}
+			r.skip(width)
+		}
+		count--
+		if count < 0 {
+			remaining--
+		} else {
+			remaining -= count
+		}
+		norm = append(norm, int16(count))
+		previousZero = count == 0
+		for remaining < threshold {
+			width--
+			threshold >>= 1
+		}
+	}
+	if remaining != 1 || r.overflow() {
+		return nil, 0, errZstdCorrupt
+	}
+	table, err := buildFSETable(norm, log)
+	return table, (r.position + 7) / 8, err
+}
+
+// forwardBits reads bits from the start of data, the low bits of each byte
+// first. Bits past the end read as 0 and are reported by overflow.
+type forwardBits struct {
+	data     []byte
+	position int
+}
+
+func (r *forwardBits) peek(n int) uint64 {
+	value := uint64(0)
+	for i := n - 1; i >= 0; i-- {
+		bit := r.position + i
+		value <<= 1
+		if bit/8 < len(r.data) {
+			value |= uint64(r.data[bit/8]>>(bit%8)) & 1
+		}
+	}
+	return value
+}
+
+func (r *forwardBits) skip(n int) {
+	r.position += n
+}
+
+func (r *forwardBits) read(n int) uint64 {
+	value := r.peek(n)
+	r.skip(n)
+	return value
+}
+
+func (r *forwardBits) overflow() bool {
+	return r.position > 8*len(r.data)
+}
+
+// backwardBits reads the bitstreams of Huffman and FSE codes, which are
+// written forwards and read from their end, starting after the highest set
+// bit of the last byte. Bits before the start read as 0, which the FSE
+// codes of Huffman weights rely on at their end.
+type backwardBits struct {
+	data []byte
+	// position is the number of bits left to read, negative once more were
+	// read than there are.
+	position int
+}
+
+func newBackwardBits(data []byte) (backwardBits, error) {
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return backwardBits{}, errZstdCorrupt
+	}
+	return backwardBits{data, (len(data)-1)*8 + bits.Len8(data[len(data)-1]) - 1}, nil
+}
+
+// peek returns the next n bits, up to 56, the first of them the highest.
+func (r *backwardBits) peek(n int) uint64 {
+	start := r.position - n
+	if start >= 0 {
+		return r.at(start, n)
+	}
+	if r.position <= 0 {
+		return 0
+	}
+	return r.at(0, r.position) << uint(-start)
+}
+
+func (r *backwardBits) at(start, n int) uint64 {
+	i := start >> 3
+	var value uint64
+	if i+8 <= len(r.data) {
+		value = binary.LittleEndian.Uint64(r.data[i:])
+	} else {
+		for j := len(r.data) - 1; j >= i; j-- {
+			value = value<<8 | uint64(r.data[j])
+		}
+	}
+	return (value >> uint(start&7)) & (1<<uint(n) - 1)
+}
+
+func (r *backwardBits) read(n int) uint64 {
+	value := r.peek(n)
+	r.position -= n
+	return value
+}
+
+// huffmanTable decodes Huffman coded literals by the next maxBits bits.
+type huffmanTable struct {
+	maxBits int
+	entries []huffmanEntry
+}
+
+type huffmanEntry struct {
+	symbol byte
+	bits   uint8
+}
+
+// readHuffmanTable reads the description of a Huffman code from the start of
+// src: a weight for each symbol but the last, whose weight makes the code
+// complete, stored as they are or FSE coded. It returns the table and the
+// number of bytes the description took.
+func readHuffmanTable(src []byte) (*huffmanTable, int, error) {
+	if len(src) == 0 {
+		return nil, 0, errZstdCorrupt
+	}
+	var weights []uint8
+	var size int
+	if header := int(src[0]); header < 128 {
+		size = 1 + header
+		if size > len(src) {
+			return nil, 0, errZstdCorrupt
+		}
+		var err error
+		if weights, err = decodeHuffmanWeights(src[1:size]); err != nil {
+			return nil, 0, err
+		}
+	} else {
+		count := header - 127
+		size = 1 + (count+1)/2
+		if size > len(src) {
+			return nil, 0, errZstdCorrupt
+		}
+		for i := 0; i < count; i++ {
+			b := src[1+i/2]
+			if i%2 == 0 {
+				b >>= 4
+			}
+			weights = append(weights, b&15)
+		}
+	}
+
+	total := 0
+	for _, weight := range weights {
+		if weight > zstdMaxHuffmanBits {
+			return nil, 0, errZstdCorrupt
+		}
+		if weight > 0 {
+			total += 1 << (weight - 1)
+		}
+	}
+	if total == 0 || len(weights) > 255 {
+		return nil, 0, errZstdCorrupt
+	}
+	maxBits := bits.Len(uint(total))
+	rest := 1<<maxBits - total
+	if maxBits > zstdMaxHuffmanBits || rest&(rest-1) != 0 {
+		return nil, 0, errZstdCorrupt
+	}
+	weights = append(weights, uint8(bits.Len(uint(rest))))
+
+	// the states of the codes of each weight start after those of the
+	// weights below it
+	var starts [zstdMaxHuffmanBits + 2]int
+	for _, weight := range weights {
+		if weight > 0 {
+			starts[weight] += 1 << (weight - 1)
+		}
+	}
+	next := 0
+	for weight := 1; weight <= maxBits; weight++ {
+		next, starts[weight] = next+starts[weight], next
+	}
+	table := &huffmanTable{maxBits, make([]huffmanEntry, 1<<maxBits)}
+	for symbol, weight := range weights {
+		if weight == 0 {
+			continue
+		}
+		entry := huffmanEntry{byte(symbol), uint8(maxBits + 1 - int(weight))}
+		for i := 0; i < 1<<(weight-1); i++ {
+			table.entries[starts[weight]+i] = entry
+		}
+		starts[weight] += 1 << (weight - 1)
+	}
+	return table, size, nil
+}
+
+// decodeHuffmanWeights decodes the FSE coded weights of a Huffman code, two
+// states taking turns until the bitstream runs out.
+func decodeHuffmanWeights(src []byte) ([]uint8, error) {
+	table, n, err := readFSETable(src, 255, 6)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newBackwardBits(src[n:])
+	if err != nil {
+		return nil, err
+	}
+	states := [2]int{int(r.read(table.log)), int(r.read(table.log))}
+	var weights []uint8
+	for i := 0; len(weights) < 255; i ^= 1 {
+		entry := table.entries[states[i]]
+		weights = append(weights, entry.symbol)
+		states[i] = int(entry.baseline) + int(r.read(int(entry.bits)))
+		if r.position < 0 {
+			weights = append(weights, table.entries[states[i^1]].symbol)
+			return weights, nil
+		}
+	}
+	return nil, errZstdCorrupt
+}
+
+// decode appends the n symbols of the Huffman coded stream src to dst.
+func (table *huffmanTable) decode(dst, src []byte, n int) ([]byte, error) {
+	r, err := newBackwardBits(src)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < n; i++ {
+		entry := table.entries[r.peek(table.maxBits)]
+		r.position -= int(entry.bits)
+		dst = append(dst, entry.symbol)
+	}
+	if r.position != 0 {
+		return nil, errZstdCorrupt
+	}
+	return dst, nil
+}
+
+// zstdReader decompresses the Zstandard frames read from r.
+type zstdReader struct {
+	r       io.Reader
+	inFrame bool
+	// checksum is true when the frame ends with a checksum of its contents.
+	checksum   bool
+	windowSize int
+	sum        *xxh64
+	// window holds what was decompressed: the last block, to be read, after
+	// at least windowSize bytes before it that blocks may refer back into.
+	window []byte
+	unread int
+	block  []byte
+	// literals are those of the block being decompressed.
+	literals []byte
+	// repeats, huffman and tables carry over from block to block.
+	repeats [3]int
+	huffman *huffmanTable
+	tables  [3]*fseTable
+}
+
+func newZstdReader(r io.Reader) (*zstdReader, error) {
+	reader := &zstdReader{r: r}
+	found, err := reader.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("empty zstd stream")
+	}
+	return reader, nil
+}
+
+// readHeader reads the header of the next frame, skipping skippable ones,
+// reporting false at the end of the stream.
+func (reader *zstdReader) readHeader() (bool, error) {
+	var magic [4]byte
+	for {
+		if _, err := io.ReadFull(reader.r, magic[:]); err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		value := binary.LittleEndian.Uint32(magic[:])
+		if value&0xfffffff0 != zstdSkippableMagic {
+			if value != zstdMagic {
+				return false, fmt.Errorf("not a zstd frame")
+			}
+			break
+		}
+		var size [4]byte
+		if _, err := io.ReadFull(reader.r, size[:]); err != nil {
+			return false, err
+		}
+		if _, err := io.CopyN(io.Discard, reader.r, int64(binary.LittleEndian.Uint32(size[:]))); err != nil {
+			return false, err
+		}
+	}
+
+	var descriptor [1]byte
+	if _, err := io.ReadFull(reader.r, descriptor[:]); err != nil {
+		return false, noEOF(err)
+	}
+	flags := descriptor[0]
+	if flags&0x08 != 0 {
+		return false, fmt.Errorf("unsupported zstd frame header")
+	}
+	single := flags&0x20 != 0
+	sizeBytes := [4]int{0, 2, 4, 8}[flags>>6]
+	if single && sizeBytes == 0 {
+		sizeBytes = 1
+	}
+	length := [4]int{0, 1, 2, 4}[flags&3] + sizeBytes
+	if !single {
+		length++
+	}
+	header := make([]byte, length)
+	if _, err := io.ReadFull(reader.r, header); err != nil {
+		return false, noEOF(err)
+	}
+	if !single {
+		exponent, mantissa := int(header[0]>>3), int(header[0]&7)
+		if exponent > 17 {
+			return false, fmt.Errorf("zstd window is larger than %d bytes", zstdMaxWindow)
+		}
+		base := 1 << (10 + exponent)
+		reader.windowSize = base + base/8*mantissa
+		header = header[1:]
+	}
+	dictionary := uint64(0)
+	for i := [4]int{0, 1, 2, 4}[flags&3] - 1; i >= 0; i-- {
+		dictionary = dictionary<<8 | uint64(header[i])
+	}
+	if dictionary != 0 {
+		return false, fmt.Errorf("zstd frames with a dictionary are not supported")
+	}
+	header = header[[4]int{0, 1, 2, 4}[flags&3]:]
+	if single {
+		size := uint64(0)
+		for i := sizeBytes - 1; i >= 0; i-- {
+			size = size<<8 | uint64(header[i])
+		}
+		if sizeBytes == 2 {
+			size += 256
+		}
+		if size > zstdMaxWindow {
+			return false, fmt.Errorf("zstd window is larger than %d bytes", zstdMaxWindow)
+		}
+		reader.windowSize = int(size)
+	}
+	if reader.windowSize > zstdMaxWindow {
+		return false, fmt.Errorf("zstd window is larger than %d bytes", zstdMaxWindow)
+	}
+
+	reader.inFrame = true
+	reader.checksum = flags&0x04 != 0
+	reader.sum = newXXH64()
+	reader.window = reader.window[:0]
+	reader.repeats = [3]int{1, 4, 8}
+	reader.huffman = nil
+	reader.tables = [3]*fseTable{}
+	return true, nil
+}
+
+func (reader *zstdReader) Read(p []byte) (int, error) {
+	for reader.unread == 0 {
+		if !reader.inFrame {
+			found, err := reader.readHeader()
+			if err != nil {
+				return 0, err
+			}
+			if !found {
+				return 0, io.EOF
+			}
+		}
+		if err := reader.readBlock(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, reader.window[len(reader.window)-reader.unread:])
+	reader.unread -= n
+	return n, nil
+}
+
+// readBlock decompresses the next block of the frame and, after the last
+// one, checks the frame's checksum.
+func (reader *zstdReader) readBlock() error {
+	var header [4]byte
+	if _, err := io.ReadFull(reader.r, header[:3]); err != nil {
+		return noEOF(err)
+	}
+	value := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	last, kind, size := value&1 != 0, value>>1&3, value>>3
+	if size > min(zstdBlockSize, max(reader.windowSize, 1)) && kind != zstdBlockRLE || size > zstdBlockSize {
+		return errZstdCorrupt
+	}
+
+	// keep what later blocks may refer back into
+	if len(reader.window) > 2*reader.windowSize+zstdBlockSize {
+		reader.window = append(reader.window[:0], reader.window[len(reader.window)-reader.windowSize:]...)
+	}
+	before := len(reader.window)
+	readSize := size
+	if kind == zstdBlockRLE {
+		readSize = 1
+	}
+	if cap(reader.block) < readSize {
+		reader.block = make([]byte, readSize)
+	}
+	block := reader.block[:readSize]
+	if _, err := io.ReadFull(reader.r, block); err != nil {
+		return noEOF(err)
+	}
+	switch kind {
+	case zstdBlockRaw:
+		reader.window = append(reader.window, block...)
+	case zstdBlockRLE:
+		for i := 0; i < size; i++ {
+			reader.window = append(reader.window, block[0])
+		}
+	case zstdBlockCompressed:
+		if err := reader.decompressBlock(block); err != nil {
+			return err
+		}
+	default:
+		return errZstdCorrupt
+	}
+	reader.unread = len(reader.window) - before
+	reader.sum.Write(reader.window[before:])
+
+	if last {
+		reader.inFrame = false
+		if reader.checksum {
+			if _, err := io.ReadFull(reader.r, header[:]); err != nil {
+				return noEOF(err)
+			}
+			if binary.LittleEndian.Uint32(header[:]) != uint32(reader.sum.Sum64()) {
+				return fmt.Errorf("zstd content checksum mismatch")
+			}
+		}
+	}
+	return nil
+}
+
+// decompressBlock decompresses a compressed block onto the window: its
+// literals, then the sequences of literals and matches they make up.
+func (reader *zstdReader) decompressBlock(src []byte) error {
+	n, err := reader.readLiterals(src)
+	if err != nil {
+		return err
+	}
+	src = src[n:]
+	if len(src) == 0 {
+		return errZstdCorrupt
+	}
+	count, n := int(src[0]), 1
+	switch {
+	case count == 0:
+		reader.window = append(reader.window, reader.literals...)
+		return nil
+	case count == 255:
+		if len(src) < 3 {
+			return errZstdCorrupt
+		}
+		count, n = int(src[1])+int(src[2])<<8+0x7f00, 3
+	case count >= 128:
+		if len(src) < 2 {
+			return errZstdCorrupt
+		}
+		count, n = (count-128)<<8+int(src[1]), 2
+	}
+	if n >= len(src) {
+		return errZstdCorrupt
+	}
+	modes := src[n]
+	src = src[n+1:]
+	if modes&3 != 0 {
+		return errZstdCorrupt
+	}
+	for i, kind := range zstdKinds {
+		switch mode := modes >> (6 - 2*i) & 3; mode {
+		case zstdModePredefined:
+			reader.tables[i] = kind.predefined
+		case zstdModeRLE:
+			if len(src) == 0 || int(src[0]) > kind.maxSymbol {
+				return errZstdCorrupt
+			}
+			reader.tables[i] = &fseTable{entries: []fseEntry{{symbol: src[0]}}}
+			src = src[1:]
+		case zstdModeFSE:
+			table, n, err := readFSETable(src, kind.maxSymbol, kind.maxLog)
+			if err != nil {
+				return err
+			}
+			reader.tables[i], src = table, src[n:]
+		case zstdModeRepeat:
+			if reader.tables[i] == nil {
+				return errZstdCorrupt
+			}
+		}
+	}
+	return reader.executeSequences(src, count)
+}
+
+// readLiterals reads the literals section at the start of src into
+// reader.literals, returning its size.
+func (reader *zstdReader) readLiterals(src []byte) (int, error) {
+	if len(src) == 0 {
+		return 0, errZstdCorrupt
+	}
+	kind, format := src[0]&3, src[0]>>2&3
+	if kind == zstdLiteralsRaw || kind == zstdLiteralsRLE {
+		var size, header int
+		switch format {
+		case 0, 2:
+			size, header = int(src[0]>>3), 1
+		case 1:
+			if len(src) < 2 {
+				return 0, errZstdCorrupt
+			}
+			size, header = int(src[0]>>4)+int(src[1])<<4, 2
+		case 3:
+			if len(src) < 3 {
+				return 0, errZstdCorrupt
+			}
+			size, header = int(src[0]>>4)+int(src[1])<<4+int(src[2])<<12, 3
+		}
+		if size > zstdBlockSize {
+			return 0, errZstdCorrupt
+		}
+		if kind == zstdLiteralsRLE {
+			if len(src) < header+1 {
+				return 0, errZstdCorrupt
+			}
+			reader.literals = reader.literals[:0]
+			for i := 0; i < size; i++ {
+				reader.literals = append(reader.literals, src[header])
+			}
+			return header + 1, nil
+		}
+		if len(src) < header+size {
+			return 0, errZstdCorrupt
+		}
+		reader.literals = append(reader.literals[:0], src[header:header+size]...)
+		return header + size, nil
+	}
+
+	header, width, streams := [4]int{3, 3, 4, 5}[format], [4]int{10, 10, 14, 18}[format], 4
+	if format == 0 {
+		streams = 1
+	}
+	if len(src) < header {
+		return 0, errZstdCorrupt
+	}
+	value := uint64(0)
+	for i := header - 1; i >= 0; i-- {
+		value = value<<8 | uint64(src[i])
+	}
+	size := int(value >> 4 & (1<<width - 1))
+	compressed := int(value >> (4 + width) & (1<<width - 1))
+	if size > zstdBlockSize || len(src) < header+compressed {
+		return 0, errZstdCorrupt
+	}
+	data := src[header : header+compressed]
+	if kind == zstdLiteralsCompressed {
+		table, n, err := readHuffmanTable(data)
+		if err != nil {
+			return 0, err
+		}
+		reader.huffman, data = table, data[n:]
+	} else if reader.huffman == nil {
+		return 0, errZstdCorrupt
+	}
+
+	reader.literals = reader.literals[:0]
+	var err error
+	if streams == 1 {
+		reader.literals, err = reader.huffman.decode(reader.literals, data, size)
+		return header + compressed, err
+	}
+	if len(data) < 6 {
+		return 0, errZstdCorrupt
+	}
+	jumps := []int{int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])), int(binary.LittleEndian.Uint16(data[4:]))}
+	data = data[6:]
+	each := (size + 3) / 4
+	for i := 0; i < 4; i++ {
+		length, n := len(data), size-3*each
+		if i < 3 {
+			length, n = jumps[i], each
+		}
+		if length > len(data) || n < 0 {
+			return 0, errZstdCorrupt
+		}
+		if reader.literals, err = reader.huffman.decode(reader.literals, data[:length], n); err != nil {
+			return 0, err
+		}
+		data = data[length:]
+	}
+	return header + compressed, nil
+}
+
+// executeSequences decodes count sequences from the bitstream src, each
+// copying literals and then a match onto the window, and copies the
+// literals left after them.
+func (reader *zstdReader) executeSequences(src []byte, count int) error {
+	r, err := newBackwardBits(src)
+	if err != nil {
+		return err
+	}
+	literalTable, offsetTable, matchTable := reader.tables[0], reader.tables[1], reader.tables[2]
+	literalState := int(r.read(literalTable.log))
+	offsetState := int(r.read(offsetTable.log))
+	matchState := int(r.read(matchTable.log))
+	literals := reader.literals
+	start := len(reader.window)
+	for i := 0; i < count; i++ {
+		literalEntry := literalTable.entries[literalState]
+		offsetEntry := offsetTable.entries[offsetState]
+		matchEntry := matchTable.entries[matchState]
+		if offsetEntry.symbol > 31 {
+			return errZstdCorrupt
+		}
+		offsetValue := 1<<offsetEntry.symbol + int(r.read(int(offsetEntry.symbol)))
+		matchLength := int(zstdMatchBase[matchEntry.symbol]) + int(r.read(int(zstdMatchExtra[matchEntry.symbol])))
+		literalLength := int(zstdLiteralBase[literalEntry.symbol]) + int(r.read(int(zstdLiteralExtra[literalEntry.symbol])))
+
+		var offset int
+		if offsetValue > 3 {
+			offset = offsetValue - 3
+			reader.repeats = [3]int{offset, reader.repeats[0], reader.repeats[1]}
+		} else {
+			repeat := offsetValue - 1
+			if literalLength == 0 {
+				repeat++
+			}
+			switch repeat {
+			case 0:
+				offset = reader.repeats[0]
+			case 1:
+				offset = reader.repeats[1]
+				reader.repeats[0], reader.repeats[1] = offset, reader.repeats[0]
+			case 2:
+				offset = reader.repeats[2]
+				reader.repeats = [3]int{offset, reader.repeats[0], reader.repeats[1]}
+			case 3:
+				offset = reader.repeats[0] - 1
+				reader.repeats = [3]int{offset, reader.repeats[0], reader.repeats[1]}
+			}
+		}
+
+		if literalLength > len(literals) || len(reader.window)-start+literalLength+matchLength > zstdBlockSize {
+			return errZstdCorrupt
+		}
+		reader.window = append(reader.window, literals[:literalLength]...)
+		literals = literals[literalLength:]
+		if offset <= 0 || offset > len(reader.window) {
+			return errZstdCorrupt
+		}
+		from := len(reader.window) - offset
+		if offset >= matchLength {
+			reader.window = append(reader.window, reader.window[from:from+matchLength]...)
+		} else {
+			// byte by byte, since the match overlaps what it copies
+			for j := 0; j < matchLength; j++ {
+				reader.window = append(reader.window, reader.window[from+j])
+			}
+		}
+
+		if i < count-1 {
+			literalState = int(literalEntry.baseline) + int(r.read(int(literalEntry.bits)))
+			matchState = int(matchEntry.baseline) + int(r.read(int(matchEntry.bits)))
+			offsetState = int(offsetEntry.baseline) + int(r.read(int(offsetEntry.bits)))
+		}
+	}
+	if r.position != 0 || len(reader.window)-start+len(literals) > zstdBlockSize {
+		return errZstdCorrupt
+	}
+	reader.window = append(reader.window, literals...)
+	return nil
+}
+
+// zstdWriter compresses what is written to it into a Zstandard frame with a
+// checksum of its contents.
+type zstdWriter struct {
+	w       io.Writer
+	started bool
+	buffer  []byte
+	block   []byte
+	table   []int32
+	sum     *xxh64
+	err     error
+}
+
+func newZstdWriter(w io.Writer) *zstdWriter {
+	return &zstdWriter{w: w, sum: newXXH64()}
+}
+
+func (writer *zstdWriter) Write(p []byte) (int, error) {
+	if writer.err != nil {
+		return 0, writer.err
+	}
+	writer.sum.Write(p)
+	writer.buffer = append(writer.buffer, p...)
+	// the last block is only written on Close, which must know it is last
+	written := 0
+	for len(writer.buffer)-written > zstdBlockSize {
+		if writer.err = writer.writeBlock(writer.buffer[written:written+zstdBlockSize], false); writer.err != nil {
+			return 0, writer.err
+		}
+		written += zstdBlockSize
+	}
+	writer.buffer = append(writer.buffer[:0], writer.buffer[written:]...)
+	return len(p), nil
+}
+
+// Close ends the frame, without closing the writer under it.
+func (writer *zstdWriter) Close() error {
+	if writer.err != nil {
+		return writer.err
+	}
+	if writer.err = writer.writeBlock(writer.buffer, true); writer.err != nil {
+		return writer.err
+	}
+	if _, writer.err = writer.w.Write(binary.LittleEndian.AppendUint32(nil, uint32(writer.sum.Sum64()))); writer.err != nil {
+		return writer.err
+	}
+	writer.err = errCodecClosed
+	return nil
+}
+
+func (writer *zstdWriter) writeBlock(src []byte, last bool) error {
+	if !writer.started {
+		writer.started = true
+		// a checksum, no content size and the window of a block
+		header := append(append([]byte{}, zstdMagicBytes...), 0x04, zstdWindowDescriptor)
+		if _, err := writer.w.Write(header); err != nil {
+			return err
+		}
+	}
+	if writer.table == nil {
+		writer.table = make([]int32, 1<<zstdHashLog)
+	}
+	writer.block = zstdCompressBlock(writer.block[:0], src, writer.table)
+	kind, data := zstdBlockCompressed, writer.block
+	if len(writer.block) >= len(src) {
+		kind, data = zstdBlockRaw, src
+	}
+	value := len(data)<<3 | kind<<1
+	if last {
+		value |= 1
+	}
+	if _, err := writer.w.Write([]byte{byte(value), byte(value >> 8), byte(value >> 16)}); err != nil {
+		return err
+	}
+	_, err := writer.w.Write(data)
+	return err
+}
+
+// zstdSequence is literalLength literals followed by a match of
+// matchLength bytes offset back.
+type zstdSequence struct {
+	literalLength, offset, matchLength int
+}
+
+// zstdCompressBlock appends src compressed as the contents of a compressed
+// block to dst: its literals stored as they are, then its sequences coded
+// with the predefined tables. table is the hash table matches are found
+// with, of which entries are cleared first.
+func zstdCompressBlock(dst, src []byte, table []int32) []byte {
+	clear(table)
+	var sequences []zstdSequence
+	var literals []byte
+	anchor := 0
+	for i := 0; i+zstdMinMatch <= len(src); {
+		value := binary.LittleEndian.Uint32(src[i:])
+		h := (value * 2654435761) >> (32 - zstdHashLog)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != value {
+			i++
+			continue
+		}
+		length := zstdMinMatch
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+		sequences = append(sequences, zstdSequence{i - anchor, i - candidate, length})
+		literals = append(literals, src[anchor:i]...)
+		i += length
+		anchor = i
+	}
+	literals = append(literals, src[anchor:]...)
+
+	switch size := len(literals); {
+	case size < 1<<5:
+		dst = append(dst, byte(size<<3))
+	case size < 1<<12:
+		dst = append(dst, byte(size<<4|1<<2), byte(size>>4))
+	default:
+		dst = append(dst, byte(size<<4|3<<2), byte(size>>4), byte(size>>12))
+	}
+	dst = append(dst, literals...)
+
+	switch count := len(sequences); {
+	case count < 128:
+		dst = append(dst, byte(count))
+	case count < 0x7f00:
+		dst = append(dst, byte(count>>8+128), byte(count))
+	default:
+		dst = append(dst, 255, byte(count-0x7f00), byte((count-0x7f00)>>8))
+	}
+	if len(sequences) == 0 {
+		return dst
+	}
+	dst = append(dst, zstdModePredefined)
+	return zstdEncodeSequences(dst, sequences)
+}
+
+// zstdEncodeSequences appends the bitstream of sequences to dst. The
+// decoder reads it from the end, so the fields are listed in the order they
+// are read and then written the other way round, working out the state of
+// each code from the last sequence back.
+func zstdEncodeSequences(dst []byte, sequences []zstdSequence) []byte {
+	type field struct {
+		value uint64
+		bits  int
+	}
+	codes := make([][3]uint8, len(sequences))
+	for i, sequence := range sequences {
+		codes[i] = [3]uint8{
+			zstdCode(zstdLiteralBase, uint32(sequence.literalLength)),
+			uint8(bits.Len(uint(sequence.offset+3)) - 1),
+			zstdCode(zstdMatchBase, uint32(sequence.matchLength)),
+		}
+	}
+	tables := [3]*fseTable{zstdLiteralTable, zstdOffsetTable, zstdMatchTable}
+	states := make([][3]uint16, len(sequences))
+	for kind, table := range tables {
+		last := len(sequences) - 1
+		for state, entry := range table.entries {
+			if entry.symbol == codes[last][kind] {
+				states[last][kind] = uint16(state)
+				break
+			}
+		}
+		for i := last - 1; i >= 0; i-- {
+			states[i][kind] = table.encode[codes[i][kind]][states[i+1][kind]]
+		}
+	}
+
+	fields := make([]field, 0, 3+6*len(sequences))
+	for kind, table := range tables {
+		fields = append(fields, field{uint64(states[0][kind]), table.log})
+	}
+	for i, sequence := range sequences {
+		literalCode, offsetCode, matchCode := codes[i][0], codes[i][1], codes[i][2]
+		offsetValue := sequence.offset + 3
+		fields = append(fields,
+			field{uint64(offsetValue - 1<<offsetCode), int(offsetCode)},
+			field{uint64(sequence.matchLength) - uint64(zstdMatchBase[matchCode]), int(zstdMatchExtra[matchCode])},
+			field{uint64(sequence.literalLength) - uint64(zstdLiteralBase[literalCode]), int(zstdLiteralExtra[literalCode])})
+		if i == len(sequences)-1 {
+			break
+		}
+		// the literal length, match length and offset states, in that order
+		for _, kind := range []int{0, 2, 1} {
+			entry := tables[kind].entries[states[i][kind]]
+			fields = append(fields, field{uint64(states[i+1][kind] - entry.baseline), int(entry.bits)})
+		}
+	}
+
+	var accumulator uint64
+	pending := 0
+	for i := len(fields) - 1; i >= 0; i-- {
+		accumulator |= fields[i].value << uint(pending)
+		for pending += fields[i].bits; pending >= 8; pending -= 8 {
+			dst = append(dst, byte(accumulator))
+			accumulator >>= 8
+		}
+	}
+	// the bit marking the end of the stream, where the decoder starts
+	accumulator |= 1 << uint(pending)
+	return append(dst, byte(accumulator))
+}
+
+// zstdCode is the literal length or match length code of value, given the
+// baselines of the codes.
+func zstdCode(baselines []uint32, value uint32) uint8 {
+	code := len(baselines) - 1
+	for baselines[code] > value {
+		code--
+	}
+	return uint8(code)
+}